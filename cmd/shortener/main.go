@@ -3,6 +3,9 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 
@@ -35,7 +38,10 @@ func main() {
 	cfg := config.NewConfig()
 	cfg.ParseFlags()
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	repo := repository.NewRepository(context.Background(), cfg)
 	srv := server.NewServer(cfg, repo)
-	srv.Run()
+	srv.Run(ctx)
 }
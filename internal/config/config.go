@@ -3,7 +3,21 @@ package config
 import (
 	"flag"
 	"log"
+	"net/http"
 	"os"
+	"strconv"
+	"time"
+)
+
+// DefaultRedirectStatus is the status code of redirects when none is configured.
+const DefaultRedirectStatus = http.StatusTemporaryRedirect
+
+// Rate limiter stores
+const (
+	// RateLimitStoreMemory keeps the rate limiter buckets in memory, each instance limits on its own.
+	RateLimitStoreMemory = "memory"
+	// RateLimitStorePostgres keeps the rate limiter buckets in the database, instances share the limits.
+	RateLimitStorePostgres = "postgres"
 )
 
 // Config holds the application configuration settings.
@@ -11,6 +25,8 @@ import (
 type Config struct {
 	// RunAddr is the address and port where the server will listen.
 	RunAddr string
+	// GRPCAddr is the address and port where the gRPC server will listen, empty disables it.
+	GRPCAddr string
 	// BaseURL is the base URL used for generating short URLs.
 	BaseURL string
 	// LogLevel specifies the logging level (debug, info, warn, error).
@@ -19,8 +35,78 @@ type Config struct {
 	FileStoragePath string
 	// DSN is the PostgreSQL database connection string (optional).
 	DSN string
-	// SecretKey is used for JWT token signing and validation.
+	// SecretKey is used for JWT token signing and validation when no keyring is configured.
+	// With a keyring it is only accepted for verifying tokens without a key ID.
 	SecretKey string
+	// JWTKeysFile is the path to the JWT keyring file (optional).
+	JWTKeysFile string
+	// JWTKeys is the JWT keyring definition, it takes precedence over JWTKeysFile (optional).
+	JWTKeys string
+	// TokenTTL is the lifetime of a JWT token and of the cookie carrying it.
+	TokenTTL time.Duration
+	// TokenRenewBefore is the remaining lifetime below which a valid JWT token is renewed.
+	TokenRenewBefore time.Duration
+	// RedirectStatus is the status code of redirects for links without their own status code.
+	RedirectStatus int
+	// LinkCheckInterval is the time between two dead-link checks of a link, zero disables the checker.
+	LinkCheckInterval time.Duration
+	// LinkCheckHostConcurrency is the number of dead-link check requests sent to a single host at the same time.
+	LinkCheckHostConcurrency int
+	// LinkCheckHostInterval is the minimal time between two dead-link check requests to a single host.
+	LinkCheckHostInterval time.Duration
+	// DomainPolicyFile is the path to the domain allowlist/denylist file (optional).
+	DomainPolicyFile string
+	// URLSchemes is the comma-separated list of URL schemes accepted for shortening.
+	URLSchemes string
+	// URLMaxLength is the maximum length of a URL accepted for shortening in bytes.
+	URLMaxLength int
+	// CanonicalRules is the comma-separated list of canonicalization rules applied to URLs before storage.
+	CanonicalRules string
+	// TrackingParams is the comma-separated list of query parameters removed by the strip-tracking rule.
+	TrackingParams string
+	// ServedHosts is the comma-separated list of hosts served by this instance in addition to the BaseURL host.
+	ServedHosts string
+	// Shorteners is the comma-separated list of known URL shortener domains, empty uses the default list.
+	Shorteners string
+	// ResolveShorteners enables storing the final destination of links to known shorteners instead of rejecting them.
+	ResolveShorteners bool
+	// AdminToken is the credential granting access to the admin API, empty disables it.
+	AdminToken string
+	// AdminLogins is the comma-separated list of logins of registered users with access to the admin API.
+	AdminLogins string
+	// RateLimitShorten is the rate limit of the shortening endpoints as "<requests>/<period>", "0" disables it.
+	RateLimitShorten string
+	// RateLimitRedirect is the rate limit of short URL redirects as "<requests>/<period>", "0" disables it.
+	RateLimitRedirect string
+	// RateLimitUser is the rate limit of the user, account and workspace APIs as "<requests>/<period>", "0" disables it.
+	RateLimitUser string
+	// RateLimitStore is the store of the rate limiter buckets: memory or postgres.
+	RateLimitStore string
+	// TrustedProxies is the comma-separated list of proxy addresses and CIDR ranges trusted to report the client IP.
+	TrustedProxies string
+	// QuotaActiveLinks is the maximum number of links of a user or workspace that are not deleted, zero is unlimited.
+	QuotaActiveLinks int
+	// QuotaDailyLinks is the maximum number of links a user or workspace creates per UTC day, zero is unlimited.
+	QuotaDailyLinks int
+	// QuotaBatchSize is the maximum number of URLs in a batch shortening request, zero is unlimited.
+	QuotaBatchSize int
+	// OpenAPIValidate enables validating requests and responses against the OpenAPI document.
+	OpenAPIValidate bool
+	// OpenAPIDocs enables the docs UI of the OpenAPI document.
+	OpenAPIDocs bool
+	// ReportThreshold is the number of reporters with open abuse reports that quarantines a link, zero disables quarantine.
+	ReportThreshold int
+}
+
+// IsRedirectStatus reports whether the status code can be used for short URL redirects.
+func IsRedirectStatus(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	default:
+		return false
+	}
 }
 
 // NewConfig creates a new Config instance with default values.
@@ -33,16 +119,49 @@ func NewConfig() *Config {
 // Command line flags take precedence over environment variables.
 func (cfg *Config) ParseFlags() {
 	flag.StringVar(&cfg.RunAddr, "a", ":8080", "address and port to run server")
+	flag.StringVar(&cfg.GRPCAddr, "grpc-address", "", "address and port to run gRPC server, empty disables it")
 	flag.StringVar(&cfg.BaseURL, "b", "http://localhost:8080", "address and port for short url")
 	flag.StringVar(&cfg.LogLevel, "l", "info", "log level")
 	flag.StringVar(&cfg.FileStoragePath, "f", "", "file repository path")
 	flag.StringVar(&cfg.DSN, "d", "", "postgres connection string")
+	flag.IntVar(&cfg.RedirectStatus, "r", DefaultRedirectStatus, "redirect status code: 301, 302, 303, 307 or 308")
+	flag.DurationVar(&cfg.LinkCheckInterval, "link-check-interval", 0, "interval of dead-link checks, 0 disables them")
+	flag.IntVar(&cfg.LinkCheckHostConcurrency, "link-check-host-concurrency", 2, "concurrent dead-link check requests per host")
+	flag.DurationVar(&cfg.LinkCheckHostInterval, "link-check-host-interval", time.Second, "minimal time between dead-link check requests per host")
+	flag.StringVar(&cfg.DomainPolicyFile, "domain-policy", "", "domain allowlist/denylist file path")
+	flag.StringVar(&cfg.URLSchemes, "url-schemes", "http,https", "comma-separated URL schemes accepted for shortening")
+	flag.IntVar(&cfg.URLMaxLength, "url-max-length", 2048, "maximum length of a URL accepted for shortening")
+	flag.StringVar(&cfg.CanonicalRules, "canonical-rules", "host,port,dot-segments,sort-query",
+		"comma-separated URL canonicalization rules: host, port, dot-segments, sort-query, strip-tracking, strip-fragment")
+	flag.StringVar(&cfg.TrackingParams, "tracking-params", "", "comma-separated tracking query parameters, utm_* style prefixes allowed")
+	flag.StringVar(&cfg.ServedHosts, "served-hosts", "", "comma-separated hosts served in addition to the base URL host")
+	flag.StringVar(&cfg.Shorteners, "shorteners", "", "comma-separated known URL shortener domains, empty uses the default list")
+	flag.BoolVar(&cfg.ResolveShorteners, "resolve-shorteners", false, "store the final destination of links to known shorteners")
+	flag.DurationVar(&cfg.TokenTTL, "token-ttl", 24*time.Hour, "lifetime of JWT tokens and their cookies")
+	flag.DurationVar(&cfg.TokenRenewBefore, "token-renew-before", 6*time.Hour, "remaining token lifetime that triggers renewal")
+	flag.StringVar(&cfg.JWTKeysFile, "jwt-keys-file", "", "JWT keyring file path")
+	flag.StringVar(&cfg.AdminLogins, "admin-logins", "", "comma-separated logins of users with access to the admin API")
+	flag.StringVar(&cfg.RateLimitShorten, "rate-limit-shorten", "30/1m", "rate limit of the shortening endpoints, 0 disables it")
+	flag.StringVar(&cfg.RateLimitRedirect, "rate-limit-redirect", "300/1m", "rate limit of short URL redirects, 0 disables it")
+	flag.StringVar(&cfg.RateLimitUser, "rate-limit-user", "120/1m", "rate limit of the user APIs, 0 disables it")
+	flag.StringVar(&cfg.RateLimitStore, "rate-limit-store", RateLimitStoreMemory, "rate limiter store: memory or postgres")
+	flag.IntVar(&cfg.QuotaActiveLinks, "quota-active-links", 0, "maximum active links per user or workspace, 0 is unlimited")
+	flag.IntVar(&cfg.QuotaDailyLinks, "quota-daily-links", 0, "maximum links created per user or workspace and UTC day, 0 is unlimited")
+	flag.IntVar(&cfg.QuotaBatchSize, "quota-batch-size", 0, "maximum URLs in a batch shortening request, 0 is unlimited")
+	flag.IntVar(&cfg.ReportThreshold, "report-threshold", 3, "reporters with open abuse reports that quarantine a link, 0 disables quarantine")
+	flag.BoolVar(&cfg.OpenAPIValidate, "openapi-validate", false, "validate requests and responses against the OpenAPI document")
+	flag.BoolVar(&cfg.OpenAPIDocs, "openapi-docs", false, "serve the docs UI of the OpenAPI document at /api/docs")
+	flag.StringVar(&cfg.TrustedProxies, "trusted-proxies", "", "comma-separated proxy addresses and CIDR ranges trusted to report the client IP")
 	flag.Parse()
 
 	if envRunAddr := os.Getenv("SERVER_ADDRESS"); envRunAddr != "" {
 		cfg.RunAddr = envRunAddr
 	}
 
+	if envGRPCAddr := os.Getenv("GRPC_ADDRESS"); envGRPCAddr != "" {
+		cfg.GRPCAddr = envGRPCAddr
+	}
+
 	if envShortBaseURL := os.Getenv("BASE_URL"); envShortBaseURL != "" {
 		cfg.BaseURL = envShortBaseURL
 	}
@@ -59,9 +178,175 @@ func (cfg *Config) ParseFlags() {
 		cfg.DSN = envDSN
 	}
 
+	if envRedirectStatus := os.Getenv("REDIRECT_STATUS"); envRedirectStatus != "" {
+		code, err := strconv.Atoi(envRedirectStatus)
+		if err != nil {
+			log.Fatalf("invalid redirect status: %s", envRedirectStatus)
+		}
+		cfg.RedirectStatus = code
+	}
+	if !IsRedirectStatus(cfg.RedirectStatus) {
+		log.Fatalf("unsupported redirect status: %d", cfg.RedirectStatus)
+	}
+
+	if envLinkCheckInterval := os.Getenv("LINK_CHECK_INTERVAL"); envLinkCheckInterval != "" {
+		cfg.LinkCheckInterval = parseDuration("LINK_CHECK_INTERVAL", envLinkCheckInterval)
+	}
+
+	if envHostConcurrency := os.Getenv("LINK_CHECK_HOST_CONCURRENCY"); envHostConcurrency != "" {
+		concurrency, err := strconv.Atoi(envHostConcurrency)
+		if err != nil {
+			log.Fatalf("invalid LINK_CHECK_HOST_CONCURRENCY: %s", envHostConcurrency)
+		}
+		cfg.LinkCheckHostConcurrency = concurrency
+	}
+
+	if envHostInterval := os.Getenv("LINK_CHECK_HOST_INTERVAL"); envHostInterval != "" {
+		cfg.LinkCheckHostInterval = parseDuration("LINK_CHECK_HOST_INTERVAL", envHostInterval)
+	}
+
+	if envDomainPolicyFile := os.Getenv("DOMAIN_POLICY_FILE"); envDomainPolicyFile != "" {
+		cfg.DomainPolicyFile = envDomainPolicyFile
+	}
+
+	if envURLSchemes := os.Getenv("URL_SCHEMES"); envURLSchemes != "" {
+		cfg.URLSchemes = envURLSchemes
+	}
+
+	if envURLMaxLength := os.Getenv("URL_MAX_LENGTH"); envURLMaxLength != "" {
+		maxLength, err := strconv.Atoi(envURLMaxLength)
+		if err != nil {
+			log.Fatalf("invalid URL_MAX_LENGTH: %s", envURLMaxLength)
+		}
+		cfg.URLMaxLength = maxLength
+	}
+
+	if envCanonicalRules, ok := os.LookupEnv("CANONICAL_RULES"); ok {
+		cfg.CanonicalRules = envCanonicalRules
+	}
+
+	if envTrackingParams := os.Getenv("TRACKING_PARAMS"); envTrackingParams != "" {
+		cfg.TrackingParams = envTrackingParams
+	}
+
+	if envServedHosts := os.Getenv("SERVED_HOSTS"); envServedHosts != "" {
+		cfg.ServedHosts = envServedHosts
+	}
+
+	if envShorteners := os.Getenv("SHORTENERS"); envShorteners != "" {
+		cfg.Shorteners = envShorteners
+	}
+
+	if envResolveShorteners := os.Getenv("RESOLVE_SHORTENERS"); envResolveShorteners != "" {
+		resolve, err := strconv.ParseBool(envResolveShorteners)
+		if err != nil {
+			log.Fatalf("invalid RESOLVE_SHORTENERS: %s", envResolveShorteners)
+		}
+		cfg.ResolveShorteners = resolve
+	}
+
+	cfg.OpenAPIValidate = parseBool("OPENAPI_VALIDATE", cfg.OpenAPIValidate)
+	cfg.OpenAPIDocs = parseBool("OPENAPI_DOCS", cfg.OpenAPIDocs)
+
+	if envTokenTTL := os.Getenv("TOKEN_TTL"); envTokenTTL != "" {
+		cfg.TokenTTL = parseDuration("TOKEN_TTL", envTokenTTL)
+	}
+
+	if envTokenRenewBefore := os.Getenv("TOKEN_RENEW_BEFORE"); envTokenRenewBefore != "" {
+		cfg.TokenRenewBefore = parseDuration("TOKEN_RENEW_BEFORE", envTokenRenewBefore)
+	}
+	if cfg.TokenTTL <= 0 || cfg.TokenRenewBefore <= 0 || cfg.TokenRenewBefore >= cfg.TokenTTL {
+		log.Fatalf("invalid token lifetimes: ttl %s, renew before %s", cfg.TokenTTL, cfg.TokenRenewBefore)
+	}
+
+	if envJWTKeysFile := os.Getenv("JWT_KEYS_FILE"); envJWTKeysFile != "" {
+		cfg.JWTKeysFile = envJWTKeysFile
+	}
+	cfg.JWTKeys = os.Getenv("JWT_KEYS")
+
+	if envRateLimitShorten := os.Getenv("RATE_LIMIT_SHORTEN"); envRateLimitShorten != "" {
+		cfg.RateLimitShorten = envRateLimitShorten
+	}
+	if envRateLimitRedirect := os.Getenv("RATE_LIMIT_REDIRECT"); envRateLimitRedirect != "" {
+		cfg.RateLimitRedirect = envRateLimitRedirect
+	}
+	if envRateLimitUser := os.Getenv("RATE_LIMIT_USER"); envRateLimitUser != "" {
+		cfg.RateLimitUser = envRateLimitUser
+	}
+	if envRateLimitStore := os.Getenv("RATE_LIMIT_STORE"); envRateLimitStore != "" {
+		cfg.RateLimitStore = envRateLimitStore
+	}
+	switch cfg.RateLimitStore {
+	case RateLimitStoreMemory:
+	case RateLimitStorePostgres:
+		if cfg.DSN == "" {
+			log.Fatal("rate limit store postgres requires a database DSN")
+		}
+	default:
+		log.Fatalf("invalid rate limit store: %s", cfg.RateLimitStore)
+	}
+	if envTrustedProxies := os.Getenv("TRUSTED_PROXIES"); envTrustedProxies != "" {
+		cfg.TrustedProxies = envTrustedProxies
+	}
+
+	cfg.QuotaActiveLinks = parseQuota("QUOTA_ACTIVE_LINKS", cfg.QuotaActiveLinks)
+	cfg.QuotaDailyLinks = parseQuota("QUOTA_DAILY_LINKS", cfg.QuotaDailyLinks)
+	cfg.QuotaBatchSize = parseQuota("QUOTA_BATCH_SIZE", cfg.QuotaBatchSize)
+
+	if envReportThreshold := os.Getenv("REPORT_THRESHOLD"); envReportThreshold != "" {
+		threshold, err := strconv.Atoi(envReportThreshold)
+		if err != nil {
+			log.Fatalf("invalid REPORT_THRESHOLD: %s", envReportThreshold)
+		}
+		cfg.ReportThreshold = threshold
+	}
+	if cfg.ReportThreshold < 0 {
+		log.Fatalf("invalid report threshold: %d", cfg.ReportThreshold)
+	}
+
+	if envAdminLogins := os.Getenv("ADMIN_LOGINS"); envAdminLogins != "" {
+		cfg.AdminLogins = envAdminLogins
+	}
+	cfg.AdminToken = os.Getenv("ADMIN_TOKEN")
+
 	secretKey := os.Getenv("SECRET_KEY")
 	cfg.SecretKey = secretKey
-	if secretKey == "" {
+	if secretKey == "" && cfg.JWTKeys == "" && cfg.JWTKeysFile == "" {
 		log.Fatal("secret key is not set")
 	}
 }
+
+// parseQuota returns the quota set by the environment variable, or the value if the variable is not set.
+func parseQuota(name string, value int) int {
+	if env := os.Getenv(name); env != "" {
+		quota, err := strconv.Atoi(env)
+		if err != nil {
+			log.Fatalf("invalid %s: %s", name, env)
+		}
+		value = quota
+	}
+	if value < 0 {
+		log.Fatalf("invalid %s: %d, quotas must not be negative", name, value)
+	}
+	return value
+}
+
+func parseDuration(name, value string) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("invalid %s: %s", name, value)
+	}
+	return d
+}
+
+// parseBool returns the flag set by the environment variable, or the value if the variable is not set.
+func parseBool(name string, value bool) bool {
+	if env := os.Getenv(name); env != "" {
+		b, err := strconv.ParseBool(env)
+		if err != nil {
+			log.Fatalf("invalid %s: %s", name, env)
+		}
+		value = b
+	}
+	return value
+}
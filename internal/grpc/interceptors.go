@@ -0,0 +1,235 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/netip"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/aifedorov/shortener/internal/grpc/pb"
+	"github.com/aifedorov/shortener/internal/http/middleware/auth"
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/middleware/ratelimit"
+	"github.com/aifedorov/shortener/internal/pkg/apikey"
+)
+
+// Metadata keys of the authentication.
+const (
+	apiKeyMetadata        = "x-api-key"
+	authorizationMetadata = "authorization"
+	tokenMetadata         = "x-auth-token"
+	bearerPrefix          = "Bearer "
+	retryAfterMetadata    = "retry-after"
+)
+
+// Authenticator resolves the credentials of a call to a user, it is implemented by *auth.Middleware.
+type Authenticator interface {
+	Authenticate(key, token string) (auth.Identity, error)
+}
+
+// RateLimiter takes tokens from the buckets of a rate limited route group, it is implemented by *ratelimit.Limiter.
+type RateLimiter interface {
+	Take(name, client string, limit ratelimit.Limit) (ratelimit.Result, error)
+}
+
+// RateLimits are the limits of the route groups of the HTTP API, the zero Limit disables a group.
+type RateLimits struct {
+	// Shorten limits Shorten and ShortenBatch.
+	Shorten ratelimit.Limit
+	// Redirect limits Expand.
+	Redirect ratelimit.Limit
+	// User limits ListURLs and DeleteURLs.
+	User ratelimit.Limit
+}
+
+// publicMethods are the methods served without authentication.
+var publicMethods = map[string]bool{
+	pb.Shortener_Ping_FullMethodName: true,
+}
+
+// methodGroups assigns the methods to the rate limited route groups of the HTTP API, named like in the HTTP server.
+var methodGroups = map[string]string{
+	pb.Shortener_Shorten_FullMethodName:      "shorten",
+	pb.Shortener_ShortenBatch_FullMethodName: "shorten",
+	pb.Shortener_Expand_FullMethodName:       "redirect",
+	pb.Shortener_ListURLs_FullMethodName:     "user",
+	pb.Shortener_DeleteURLs_FullMethodName:   "user",
+}
+
+// NewServer creates a gRPC server serving the service.
+// Calls are logged, panics are recovered, every call except Ping is authenticated and then rate limited
+// with the limiter. The zero Limit disables limiting of its group, like in the HTTP API.
+func NewServer(svc *Service, authenticator Authenticator, limiter RateLimiter, limits RateLimits) *grpc.Server {
+	interceptors := []grpc.UnaryServerInterceptor{
+		LoggingInterceptor,
+		RecoveryInterceptor,
+		AuthInterceptor(authenticator),
+	}
+	if limiter != nil {
+		interceptors = append(interceptors, RateLimitInterceptor(limiter, limits))
+	}
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors...))
+	pb.RegisterShortenerServer(srv, svc)
+	return srv
+}
+
+// LoggingInterceptor logs the method, status code and duration of every call.
+func LoggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logger.Log.Info("grpc: call",
+		zap.String("method", info.FullMethod),
+		zap.String("code", status.Code(err).String()),
+		zap.Duration("duration", time.Since(start)),
+	)
+	return resp, err
+}
+
+// RecoveryInterceptor turns a panic of the handler into an INTERNAL status.
+func RecoveryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			logger.Log.Error("grpc: panic recovered",
+				zap.String("method", info.FullMethod),
+				zap.Any("panic", rec),
+				zap.ByteString("stack", debug.Stack()),
+			)
+			err = status.Error(codes.Internal, "internal error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// AuthInterceptor authenticates calls with the semantics of the HTTP auth middleware.
+// An API key is taken from the x-api-key metadata or an authorization bearer token that is an API key,
+// otherwise the bearer token is a JWT. Calls without credentials get a new user ID, new and renewed
+// tokens are sent in the x-auth-token response header.
+func AuthInterceptor(authenticator Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if publicMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		key, token := credentials(ctx)
+		identity, err := authenticator.Authenticate(key, token)
+		if errors.Is(err, auth.ErrUnknownAPIKey) || errors.Is(err, auth.ErrTokenExpired) || errors.Is(err, auth.ErrInvalidToken) {
+			logger.Log.Info("grpc: unauthenticated", zap.String("method", info.FullMethod), zap.Error(err))
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if err != nil {
+			logger.Log.Error("grpc: failed to authenticate", zap.String("method", info.FullMethod), zap.Error(err))
+			return nil, status.Error(codes.Internal, "failed to authenticate")
+		}
+
+		if identity.Token != "" {
+			if err := grpc.SetHeader(ctx, metadata.Pairs(tokenMetadata, identity.Token)); err != nil {
+				logger.Log.Error("grpc: failed to set token header", zap.Error(err))
+			}
+		}
+
+		ctx = context.WithValue(ctx, auth.UserIDKey, identity.UserID)
+		if identity.NewSession {
+			ctx = context.WithValue(ctx, auth.NewSessionKey, true)
+		}
+		if identity.Account {
+			ctx = context.WithValue(ctx, auth.AccountKey, true)
+		}
+		if identity.APIKey {
+			ctx = context.WithValue(ctx, auth.APIKeyKey, true)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// RateLimitInterceptor applies the limits of the HTTP route groups to the methods in them, it must run after AuthInterceptor.
+// Calls share the buckets of the HTTP API: calls of registered accounts and API keys count per user, other calls
+// per peer IP. Calls over the limit fail with RESOURCE_EXHAUSTED and a retry-after header.
+// If the limiter fails the call is let through.
+func RateLimitInterceptor(limiter RateLimiter, limits RateLimits) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		name := methodGroups[info.FullMethod]
+		limit := limits.group(name)
+		if limit.IsZero() {
+			return handler(ctx, req)
+		}
+
+		client := clientKey(ctx)
+		res, err := limiter.Take(name, client, limit)
+		if err != nil {
+			logger.Log.Error("grpc: failed to take rate limit token", zap.String("method", info.FullMethod), zap.Error(err))
+			return handler(ctx, req)
+		}
+		if !res.Allowed {
+			logger.Log.Info("grpc: rate limit exceeded", zap.String("method", info.FullMethod), zap.String("client", client))
+			retryAfter := max(int(math.Ceil(res.RetryAfter.Seconds())), 1)
+			if err := grpc.SetHeader(ctx, metadata.Pairs(retryAfterMetadata, strconv.Itoa(retryAfter))); err != nil {
+				logger.Log.Error("grpc: failed to set retry-after header", zap.Error(err))
+			}
+			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// group returns the limit of the route group, the zero Limit for methods outside the groups.
+func (l RateLimits) group(name string) ratelimit.Limit {
+	switch name {
+	case "shorten":
+		return l.Shorten
+	case "redirect":
+		return l.Redirect
+	case "user":
+		return l.User
+	}
+	return ratelimit.Limit{}
+}
+
+// clientKey identifies the client of a call like ratelimit.TrustedProxies.ClientKey does for HTTP requests.
+func clientKey(ctx context.Context) string {
+	if key, ok := ratelimit.UserKey(ctx); ok {
+		return key
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "ip:"
+	}
+	address := p.Addr.String()
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	if ip, err := netip.ParseAddr(address); err == nil {
+		address = ip.Unmap().String()
+	}
+	return "ip:" + address
+}
+
+// credentials returns the API key and the token sent in the metadata of the call.
+func credentials(ctx context.Context) (key, token string) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(apiKeyMetadata); len(values) > 0 && strings.TrimSpace(values[0]) != "" {
+		return strings.TrimSpace(values[0]), ""
+	}
+	if values := md.Get(authorizationMetadata); len(values) > 0 {
+		bearer, ok := strings.CutPrefix(values[0], bearerPrefix)
+		bearer = strings.TrimSpace(bearer)
+		if ok && apikey.IsKey(bearer) {
+			return bearer, ""
+		}
+		if ok {
+			return "", bearer
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,223 @@
+// Package grpcserver serves the shortener over gRPC next to the HTTP server.
+// It shares the repository, the URL validation and the authentication of the HTTP server.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/aifedorov/shortener/internal/config"
+	"github.com/aifedorov/shortener/internal/grpc/pb"
+	"github.com/aifedorov/shortener/internal/http/middleware/auth"
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/pkg/validate"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+// Service implements the Shortener gRPC service on top of the repository.
+type Service struct {
+	pb.UnimplementedShortenerServer
+	// cfg holds the application configuration settings.
+	cfg *config.Config
+	// repo is the repository interface for data persistence.
+	repo repository.Repository
+	// urlChecker validates URLs before they are stored.
+	urlChecker validate.URLChecker
+}
+
+// NewService creates the Shortener service storing links in the repository.
+func NewService(cfg *config.Config, repo repository.Repository, urlChecker validate.URLChecker) *Service {
+	return &Service{
+		cfg:        cfg,
+		repo:       repo,
+		urlChecker: urlChecker,
+	}
+}
+
+// Shorten shortens a URL for the calling user.
+// A URL the user shortened before is answered with its existing short URL.
+func (s *Service) Shorten(ctx context.Context, req *pb.ShortenRequest) (*pb.ShortenResponse, error) {
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	originalURL, err := resolveURL(s.urlChecker, req.GetUrl())
+	if err != nil {
+		return nil, urlError(err)
+	}
+
+	shortURL, err := s.repo.Store(userID, s.cfg.BaseURL, originalURL, repository.LinkOptions{})
+	var cErr *repository.ConflictError
+	if errors.As(err, &cErr) {
+		return &pb.ShortenResponse{ShortUrl: cErr.ShortURL, Existing: true}, nil
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return &pb.ShortenResponse{ShortUrl: shortURL}, nil
+}
+
+// ShortenBatch shortens several URLs for the calling user, a batch exceeding a quota stores none of them.
+// URLs shortened before are answered with their existing short URL and marked as existing.
+func (s *Service) ShortenBatch(ctx context.Context, req *pb.ShortenBatchRequest) (*pb.ShortenBatchResponse, error) {
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	items := req.GetItems()
+	if len(items) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "items must not be empty")
+	}
+	if s.cfg.QuotaBatchSize > 0 && len(items) > s.cfg.QuotaBatchSize {
+		return nil, status.Errorf(codes.ResourceExhausted, "batch must hold at most %d items", s.cfg.QuotaBatchSize)
+	}
+
+	urls := make([]repository.BatchURLInput, len(items))
+	for i, item := range items {
+		originalURL, err := resolveURL(s.urlChecker, item.GetOriginalUrl())
+		if err != nil {
+			return nil, urlError(err)
+		}
+		urls[i] = repository.BatchURLInput{CID: item.GetCorrelationId(), OriginalURL: originalURL}
+	}
+
+	stored, err := s.repo.StoreBatch(userID, s.cfg.BaseURL, urls)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	resp := &pb.ShortenBatchResponse{Results: make([]*pb.BatchResult, len(stored))}
+	for i, out := range stored {
+		resp.Results[i] = &pb.BatchResult{CorrelationId: out.CID, ShortUrl: out.ShortURL, Existing: out.Existing}
+	}
+	return resp, nil
+}
+
+// Expand returns the original URL of a short URL without counting a redirect.
+// A link quarantined by abuse reports fails with FAILED_PRECONDITION instead of exposing its target.
+func (s *Service) Expand(_ context.Context, req *pb.ExpandRequest) (*pb.ExpandResponse, error) {
+	alias, ok := aliasOf(req.GetShortUrl())
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "short_url must be a short URL or its alias")
+	}
+
+	originalURL, err := s.repo.Get(alias)
+	switch {
+	case errors.Is(err, repository.ErrShortURLNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, repository.ErrURLDeleted), errors.Is(err, repository.ErrLinkDisabled):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, repository.ErrLinkQuarantined):
+		return nil, status.Error(codes.FailedPrecondition, "link is quarantined by abuse reports")
+	case err != nil:
+		logger.Log.Error("grpc: failed to expand url", zap.String("alias", alias), zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to expand url")
+	}
+	return &pb.ExpandResponse{OriginalUrl: originalURL}, nil
+}
+
+// ListURLs lists the links of the calling user.
+func (s *Service) ListURLs(ctx context.Context, _ *pb.ListURLsRequest) (*pb.ListURLsResponse, error) {
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	urls, err := s.repo.GetAll(userID, s.cfg.BaseURL)
+	if err != nil && !errors.Is(err, repository.ErrUserHasNoData) {
+		logger.Log.Error("grpc: failed to list urls", zap.String("user_id", userID), zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to list urls")
+	}
+
+	resp := &pb.ListURLsResponse{Urls: make([]*pb.URL, len(urls))}
+	for i, u := range urls {
+		resp.Urls[i] = &pb.URL{ShortUrl: u.ShortURL, OriginalUrl: u.OriginalURL}
+	}
+	return resp, nil
+}
+
+// DeleteURLs deletes links of the calling user.
+func (s *Service) DeleteURLs(ctx context.Context, req *pb.DeleteURLsRequest) (*pb.DeleteURLsResponse, error) {
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.GetAliases()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "aliases must not be empty")
+	}
+
+	if err := s.repo.DeleteBatch(userID, req.GetAliases()); err != nil {
+		logger.Log.Error("grpc: failed to delete urls", zap.String("user_id", userID), zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to delete urls")
+	}
+	return &pb.DeleteURLsResponse{}, nil
+}
+
+// Ping checks the storage connection.
+func (s *Service) Ping(context.Context, *pb.PingRequest) (*pb.PingResponse, error) {
+	if err := s.repo.Ping(); err != nil {
+		logger.Log.Error("grpc: failed to ping repository", zap.Error(err))
+		return nil, status.Error(codes.Unavailable, "storage is unavailable")
+	}
+	return &pb.PingResponse{}, nil
+}
+
+// userIDFromContext returns the user ID set by the authentication interceptor.
+func userIDFromContext(ctx context.Context) (string, error) {
+	userID, ok := ctx.Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		logger.Log.Error("grpc: user_id not found")
+		return "", status.Error(codes.Unauthenticated, "user_id not found")
+	}
+	return userID, nil
+}
+
+// resolveURL validates the URL and returns the URL to store.
+// Checkers implementing validate.URLResolver may replace a shortener link with its final destination.
+func resolveURL(urlChecker validate.URLChecker, rawURL string) (string, error) {
+	if resolver, ok := urlChecker.(validate.URLResolver); ok {
+		return resolver.ResolveURL(rawURL)
+	}
+	return rawURL, urlChecker.CheckURL(rawURL)
+}
+
+// aliasOf returns the alias of a short URL, the value may also be the alias itself.
+func aliasOf(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if u, err := url.Parse(value); err == nil && u.Host != "" {
+		value = u.Path
+	}
+	alias := strings.Trim(value, "/")
+	if alias == "" || strings.ContainsAny(alias, "/?# ") {
+		return "", false
+	}
+	return alias, true
+}
+
+// urlError converts a URL validation error to an INVALID_ARGUMENT status.
+func urlError(err error) error {
+	logger.Log.Info("grpc: invalid url", zap.Error(err))
+	var pErr *validate.PolicyError
+	var uErr *validate.URLError
+	if errors.As(err, &pErr) || errors.As(err, &uErr) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.InvalidArgument, "invalid url")
+}
+
+// storeError converts an error of storing links to a status, exceeded quotas are RESOURCE_EXHAUSTED.
+func storeError(err error) error {
+	if errors.Is(err, repository.ErrQuotaExceeded) {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	logger.Log.Error("grpc: failed to store url", zap.Error(err))
+	return status.Error(codes.Internal, "failed to store url")
+}
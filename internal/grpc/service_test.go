@@ -0,0 +1,558 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/aifedorov/shortener/internal/config"
+	"github.com/aifedorov/shortener/internal/grpc/pb"
+	"github.com/aifedorov/shortener/internal/http/middleware/auth"
+	"github.com/aifedorov/shortener/internal/http/middleware/ratelimit"
+	"github.com/aifedorov/shortener/internal/mocks"
+	"github.com/aifedorov/shortener/internal/pkg/validate"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+const (
+	testBaseURL = "http://localhost:8080"
+	testUserID  = "user123"
+)
+
+// stubAuthenticator authenticates every call as the same identity.
+type stubAuthenticator struct {
+	identity auth.Identity
+	err      error
+	key      string
+	token    string
+}
+
+func (a *stubAuthenticator) Authenticate(key, token string) (auth.Identity, error) {
+	a.key, a.token = key, token
+	return a.identity, a.err
+}
+
+// newTestClient serves the service over an in-memory connection and returns a client for it.
+func newTestClient(t *testing.T, repo repository.Repository, authenticator Authenticator) pb.ShortenerClient {
+	t.Helper()
+	return newLimitedTestClient(t, repo, authenticator, nil, RateLimits{})
+}
+
+// newLimitedTestClient serves the service with rate limits over an in-memory connection and returns a client for it.
+func newLimitedTestClient(t *testing.T, repo repository.Repository, authenticator Authenticator,
+	limiter RateLimiter, limits RateLimits) pb.ShortenerClient {
+	t.Helper()
+	cfg := &config.Config{BaseURL: testBaseURL}
+
+	listener := bufconn.Listen(1 << 20)
+	srv := NewServer(NewService(cfg, repo, validate.NewService()), authenticator, limiter, limits)
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return pb.NewShortenerClient(conn)
+}
+
+func TestService_Shorten(t *testing.T) {
+	tests := []struct {
+		name         string
+		url          string
+		storeURL     string
+		storeErr     error
+		expectStore  bool
+		expectedCode codes.Code
+		expectedResp *pb.ShortenResponse
+	}{
+		{
+			name:         "new url",
+			url:          "https://example.com",
+			storeURL:     testBaseURL + "/abc123",
+			expectStore:  true,
+			expectedCode: codes.OK,
+			expectedResp: &pb.ShortenResponse{ShortUrl: testBaseURL + "/abc123"},
+		},
+		{
+			name:         "existing url",
+			url:          "https://example.com",
+			storeErr:     repository.NewConflictError(testBaseURL+"/abc123", repository.ErrURLExists),
+			expectStore:  true,
+			expectedCode: codes.OK,
+			expectedResp: &pb.ShortenResponse{ShortUrl: testBaseURL + "/abc123", Existing: true},
+		},
+		{
+			name:         "invalid url",
+			url:          "not a url",
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "quota exceeded",
+			url:          "https://example.com",
+			storeErr:     &repository.QuotaError{Quota: "active links", Limit: 1},
+			expectStore:  true,
+			expectedCode: codes.ResourceExhausted,
+		},
+		{
+			name:         "repository error",
+			url:          "https://example.com",
+			storeErr:     errors.New("database error"),
+			expectStore:  true,
+			expectedCode: codes.Internal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			if tt.expectStore {
+				mockRepo.EXPECT().Store(testUserID, testBaseURL, tt.url, repository.LinkOptions{}).Return(tt.storeURL, tt.storeErr)
+			}
+
+			client := newTestClient(t, mockRepo, &stubAuthenticator{identity: auth.Identity{UserID: testUserID}})
+			resp, err := client.Shorten(context.Background(), &pb.ShortenRequest{Url: tt.url})
+
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+			if tt.expectedResp != nil {
+				require.NotNil(t, resp)
+				assert.Equal(t, tt.expectedResp.GetShortUrl(), resp.GetShortUrl())
+				assert.Equal(t, tt.expectedResp.GetExisting(), resp.GetExisting())
+			}
+		})
+	}
+}
+
+func TestService_ShortenBatch(t *testing.T) {
+	items := []*pb.BatchItem{
+		{CorrelationId: "1", OriginalUrl: "https://example.com/a"},
+		{CorrelationId: "2", OriginalUrl: "https://example.com/b"},
+	}
+	inputs := []repository.BatchURLInput{
+		{CID: "1", OriginalURL: "https://example.com/a"},
+		{CID: "2", OriginalURL: "https://example.com/b"},
+	}
+
+	tests := []struct {
+		name         string
+		items        []*pb.BatchItem
+		stored       []repository.BatchURLOutput
+		storeErr     error
+		expectStore  bool
+		expectedCode codes.Code
+	}{
+		{
+			name:  "stored",
+			items: items,
+			stored: []repository.BatchURLOutput{
+				{CID: "1", ShortURL: testBaseURL + "/aaa"},
+				{CID: "2", ShortURL: testBaseURL + "/bbb"},
+			},
+			expectStore:  true,
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "empty batch",
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "invalid url",
+			items:        []*pb.BatchItem{{CorrelationId: "1", OriginalUrl: "ftp://example.com"}},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:  "existing url",
+			items: items,
+			stored: []repository.BatchURLOutput{
+				{CID: "1", ShortURL: testBaseURL + "/aaa", Existing: true},
+				{CID: "2", ShortURL: testBaseURL + "/bbb"},
+			},
+			expectStore:  true,
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "quota exceeded",
+			items:        items,
+			storeErr:     &repository.QuotaError{Quota: repository.QuotaActiveLinks, Limit: 1, Used: 1, Requested: 2},
+			expectStore:  true,
+			expectedCode: codes.ResourceExhausted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			if tt.expectStore {
+				mockRepo.EXPECT().StoreBatch(testUserID, testBaseURL, inputs).Return(tt.stored, tt.storeErr)
+			}
+
+			client := newTestClient(t, mockRepo, &stubAuthenticator{identity: auth.Identity{UserID: testUserID}})
+			resp, err := client.ShortenBatch(context.Background(), &pb.ShortenBatchRequest{Items: tt.items})
+
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+			if tt.expectedCode == codes.OK {
+				require.Len(t, resp.GetResults(), len(tt.stored))
+				for i, out := range tt.stored {
+					assert.Equal(t, out.CID, resp.GetResults()[i].GetCorrelationId())
+					assert.Equal(t, out.ShortURL, resp.GetResults()[i].GetShortUrl())
+					assert.Equal(t, out.Existing, resp.GetResults()[i].GetExisting())
+				}
+			}
+		})
+	}
+}
+
+func TestService_Expand(t *testing.T) {
+	tests := []struct {
+		name         string
+		shortURL     string
+		alias        string
+		getURL       string
+		getErr       error
+		expectedCode codes.Code
+	}{
+		{
+			name:         "short url",
+			shortURL:     testBaseURL + "/abc123",
+			alias:        "abc123",
+			getURL:       "https://example.com",
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "alias",
+			shortURL:     "abc123",
+			alias:        "abc123",
+			getURL:       "https://example.com",
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "not found",
+			shortURL:     "abc123",
+			alias:        "abc123",
+			getErr:       repository.ErrShortURLNotFound,
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "deleted",
+			shortURL:     "abc123",
+			alias:        "abc123",
+			getErr:       repository.ErrURLDeleted,
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "quarantined",
+			shortURL:     "abc123",
+			alias:        "abc123",
+			getErr:       repository.ErrLinkQuarantined,
+			expectedCode: codes.FailedPrecondition,
+		},
+		{
+			name:         "empty",
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			if tt.alias != "" {
+				mockRepo.EXPECT().Get(tt.alias).Return(tt.getURL, tt.getErr)
+			}
+
+			client := newTestClient(t, mockRepo, &stubAuthenticator{identity: auth.Identity{UserID: testUserID}})
+			resp, err := client.Expand(context.Background(), &pb.ExpandRequest{ShortUrl: tt.shortURL})
+
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+			assert.Equal(t, tt.getURL, resp.GetOriginalUrl())
+		})
+	}
+}
+
+func TestService_ListURLs(t *testing.T) {
+	tests := []struct {
+		name         string
+		urls         []repository.URLOutput
+		getErr       error
+		expectedCode codes.Code
+		expectedLen  int
+	}{
+		{
+			name: "with urls",
+			urls: []repository.URLOutput{
+				{ShortURL: testBaseURL + "/abc123", OriginalURL: "https://example.com"},
+			},
+			expectedCode: codes.OK,
+			expectedLen:  1,
+		},
+		{
+			name:         "no urls",
+			getErr:       repository.ErrUserHasNoData,
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "repository error",
+			getErr:       errors.New("database error"),
+			expectedCode: codes.Internal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			mockRepo.EXPECT().GetAll(testUserID, testBaseURL).Return(tt.urls, tt.getErr)
+
+			client := newTestClient(t, mockRepo, &stubAuthenticator{identity: auth.Identity{UserID: testUserID}})
+			resp, err := client.ListURLs(context.Background(), &pb.ListURLsRequest{})
+
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+			assert.Len(t, resp.GetUrls(), tt.expectedLen)
+		})
+	}
+}
+
+func TestService_DeleteURLs(t *testing.T) {
+	tests := []struct {
+		name         string
+		aliases      []string
+		deleteErr    error
+		expectedCode codes.Code
+	}{
+		{
+			name:         "deleted",
+			aliases:      []string{"abc123", "def456"},
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "empty aliases",
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "repository error",
+			aliases:      []string{"abc123"},
+			deleteErr:    errors.New("database error"),
+			expectedCode: codes.Internal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			if len(tt.aliases) > 0 {
+				mockRepo.EXPECT().DeleteBatch(testUserID, tt.aliases).Return(tt.deleteErr)
+			}
+
+			client := newTestClient(t, mockRepo, &stubAuthenticator{identity: auth.Identity{UserID: testUserID}})
+			_, err := client.DeleteURLs(context.Background(), &pb.DeleteURLsRequest{Aliases: tt.aliases})
+
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+		})
+	}
+}
+
+func TestService_Ping(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	gomock.InOrder(
+		mockRepo.EXPECT().Ping().Return(nil),
+		mockRepo.EXPECT().Ping().Return(errors.New("connection refused")),
+	)
+
+	authenticator := &stubAuthenticator{err: auth.ErrInvalidToken}
+	client := newTestClient(t, mockRepo, authenticator)
+
+	_, err := client.Ping(context.Background(), &pb.PingRequest{})
+	assert.NoError(t, err, "ping needs no credentials")
+
+	_, err = client.Ping(context.Background(), &pb.PingRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	tests := []struct {
+		name          string
+		md            metadata.MD
+		identity      auth.Identity
+		authErr       error
+		expectedKey   string
+		expectedToken string
+		expectedCode  codes.Code
+		expectHeader  string
+	}{
+		{
+			name:         "api key metadata",
+			md:           metadata.Pairs("x-api-key", "shk_testkey"),
+			identity:     auth.Identity{UserID: testUserID},
+			expectedKey:  "shk_testkey",
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "api key bearer",
+			md:           metadata.Pairs("authorization", "Bearer shk_testkey"),
+			identity:     auth.Identity{UserID: testUserID},
+			expectedKey:  "shk_testkey",
+			expectedCode: codes.OK,
+		},
+		{
+			name:          "jwt bearer",
+			md:            metadata.Pairs("authorization", "Bearer jwt-token"),
+			identity:      auth.Identity{UserID: testUserID},
+			expectedToken: "jwt-token",
+			expectedCode:  codes.OK,
+		},
+		{
+			name:         "new session gets a token",
+			identity:     auth.Identity{UserID: testUserID, NewSession: true, Token: "new-token"},
+			expectedCode: codes.OK,
+			expectHeader: "new-token",
+		},
+		{
+			name:          "expired token",
+			md:            metadata.Pairs("authorization", "Bearer jwt-token"),
+			authErr:       auth.ErrTokenExpired,
+			expectedToken: "jwt-token",
+			expectedCode:  codes.Unauthenticated,
+		},
+		{
+			name:         "unknown api key",
+			md:           metadata.Pairs("x-api-key", "shk_testkey"),
+			authErr:      auth.ErrUnknownAPIKey,
+			expectedKey:  "shk_testkey",
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			name:         "repository error",
+			md:           metadata.Pairs("x-api-key", "shk_testkey"),
+			authErr:      errors.New("database error"),
+			expectedKey:  "shk_testkey",
+			expectedCode: codes.Internal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			if tt.authErr == nil {
+				mockRepo.EXPECT().GetAll(testUserID, testBaseURL).Return(nil, repository.ErrUserHasNoData)
+			}
+
+			authenticator := &stubAuthenticator{identity: tt.identity, err: tt.authErr}
+			client := newTestClient(t, mockRepo, authenticator)
+
+			ctx := metadata.NewOutgoingContext(context.Background(), tt.md)
+			var header metadata.MD
+			_, err := client.ListURLs(ctx, &pb.ListURLsRequest{}, grpc.Header(&header))
+
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+			assert.Equal(t, tt.expectedKey, authenticator.key)
+			assert.Equal(t, tt.expectedToken, authenticator.token)
+			if tt.expectHeader != "" {
+				assert.Equal(t, []string{tt.expectHeader}, header.Get("x-auth-token"))
+			}
+		})
+	}
+}
+
+func TestRecoveryInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: pb.Shortener_Shorten_FullMethodName}
+	handler := func(context.Context, interface{}) (interface{}, error) {
+		panic("boom")
+	}
+
+	resp, err := RecoveryInterceptor(context.Background(), nil, info, handler)
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
+
+func TestRateLimitInterceptor(t *testing.T) {
+	limit := ratelimit.Limit{Requests: 1, Period: time.Minute}
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), nil)
+	interceptor := RateLimitInterceptor(limiter, RateLimits{Shorten: limit})
+	handler := func(context.Context, interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	call := func(method, userID string, account bool) codes.Code {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1234}})
+		ctx = context.WithValue(ctx, auth.UserIDKey, userID)
+		ctx = context.WithValue(ctx, auth.AccountKey, account)
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return status.Code(err)
+	}
+
+	assert.Equal(t, codes.OK, call(pb.Shortener_Shorten_FullMethodName, "anon1", false))
+	assert.Equal(t, codes.ResourceExhausted, call(pb.Shortener_ShortenBatch_FullMethodName, "anon2", false),
+		"anonymous sessions share the bucket of the peer IP")
+	assert.Equal(t, codes.OK, call(pb.Shortener_Shorten_FullMethodName, "user1", true), "accounts have their own bucket")
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, codes.OK, call(pb.Shortener_ListURLs_FullMethodName, "anon1", false), "the zero limit disables a group")
+		assert.Equal(t, codes.OK, call(pb.Shortener_Ping_FullMethodName, "", false))
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/shorten", nil)
+	r.RemoteAddr = "192.0.2.1:4321"
+	w := httptest.NewRecorder()
+	limiter.Limit("shorten", limit)(http.NotFoundHandler()).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "the HTTP API shares the buckets")
+}
+
+func TestRateLimitInterceptor_RetryAfter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockRepo.EXPECT().Store(testUserID, testBaseURL, "https://example.com", gomock.Any()).Return(testBaseURL+"/abc", nil)
+
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), nil)
+	limits := RateLimits{Shorten: ratelimit.Limit{Requests: 1, Period: time.Minute}}
+	authenticator := &stubAuthenticator{identity: auth.Identity{UserID: testUserID, APIKey: true}}
+	client := newLimitedTestClient(t, mockRepo, authenticator, limiter, limits)
+
+	_, err := client.Shorten(context.Background(), &pb.ShortenRequest{Url: "https://example.com"})
+	require.NoError(t, err)
+
+	var header metadata.MD
+	_, err = client.Shorten(context.Background(), &pb.ShortenRequest{Url: "https://example.com"}, grpc.Header(&header))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"60"}, header.Get("retry-after"))
+}
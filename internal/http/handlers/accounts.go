@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/aifedorov/shortener/internal/http/middleware/auth"
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/problem"
+	"github.com/aifedorov/shortener/internal/pkg/password"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+// Login limits
+const (
+	// minLoginLength is the minimum login length in bytes.
+	minLoginLength = 3
+	// maxLoginLength is the maximum login length in bytes.
+	maxLoginLength = 64
+)
+
+// errInvalidLogin is returned when a login is too short, too long or contains unsupported characters.
+var errInvalidLogin = errors.New("login must be 3 to 64 characters: letters, digits, '.', '_' or '-'")
+
+// TokenIssuer starts the session of a user by issuing the JWT the authentication middleware validates.
+type TokenIssuer interface {
+	// IssueToken sends a new token of the user in the response and returns it.
+	IssueToken(rw http.ResponseWriter, userID string) (string, error)
+}
+
+// NewRegisterHandler creates a new HTTP handler for registering a user account.
+// It accepts a JSON object with the login and password, stores the account with a bcrypt password hash
+// and starts a session of the new account. It responds with 409 if the login is taken.
+// The links of the anonymous session the request was made in are claimed into the new account.
+func NewRegisterHandler(repo repository.Repository, issuer TokenIssuer) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		creds, err := decodeCredentials(r)
+		if err != nil {
+			problem.Write(rw, r, problem.InvalidBody(err.Error()))
+			return
+		}
+		login, err := normalizeLogin(creds.Login)
+		if err != nil {
+			problem.Write(rw, r, problem.InvalidParameter(err.Error()))
+			return
+		}
+		hash, err := password.Hash(creds.Password)
+		if errors.Is(err, password.ErrTooShort) || errors.Is(err, password.ErrTooLong) {
+			problem.Write(rw, r, problem.InvalidParameter(err.Error()))
+			return
+		}
+		if err != nil {
+			logger.Log.Error("failed to hash password", zap.Error(err))
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+
+		user := repository.User{
+			ID:           uuid.NewString(),
+			Login:        login,
+			PasswordHash: hash,
+			CreatedAt:    time.Now().UTC(),
+		}
+		err = repo.CreateUser(user)
+		if errors.Is(err, repository.ErrLoginTaken) {
+			problem.Write(rw, r, problem.Conflict(err.Error()))
+			return
+		}
+		if err != nil {
+			logger.Log.Error("failed to create user", zap.String("login", login), zap.Error(err))
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+
+		writeSession(rw, r, issuer, user, claimLinks(r, repo, user.ID), http.StatusCreated)
+	}
+}
+
+// NewLoginHandler creates a new HTTP handler for logging into a user account.
+// It accepts a JSON object with the login and password and starts a session of the account.
+// It responds with 401 if the login is unknown or the password does not match,
+// an unknown login is answered after a password comparison as well to keep both cases equally slow.
+// The links of the anonymous session the request was made in are claimed into the account.
+func NewLoginHandler(repo repository.Repository, issuer TokenIssuer) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		creds, err := decodeCredentials(r)
+		if err != nil {
+			problem.Write(rw, r, problem.InvalidBody(err.Error()))
+			return
+		}
+
+		user, err := repo.GetUserByLogin(strings.ToLower(strings.TrimSpace(creds.Login)))
+		if errors.Is(err, repository.ErrUserNotFound) {
+			logger.Log.Info("login: unknown user")
+			password.CompareDummy(creds.Password)
+			problem.Write(rw, r, problem.Unauthorized(detailInvalidCredentials))
+			return
+		}
+		if err != nil {
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+		err = password.Compare(user.PasswordHash, creds.Password)
+		if errors.Is(err, password.ErrMismatch) {
+			logger.Log.Info("login: wrong password", zap.String("login", user.Login))
+			problem.Write(rw, r, problem.Unauthorized(detailInvalidCredentials))
+			return
+		}
+		if err != nil {
+			logger.Log.Error("failed to compare password", zap.String("login", user.Login), zap.Error(err))
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+
+		writeSession(rw, r, issuer, user, claimLinks(r, repo, user.ID), http.StatusOK)
+	}
+}
+
+func decodeCredentials(r *http.Request) (CredentialsRequest, error) {
+	var creds CredentialsRequest
+	if err := decodeJSON(r, &creds); err != nil {
+		return CredentialsRequest{}, err
+	}
+	return creds, nil
+}
+
+func normalizeLogin(login string) (string, error) {
+	login = strings.ToLower(strings.TrimSpace(login))
+	if len(login) < minLoginLength || len(login) > maxLoginLength {
+		return "", errInvalidLogin
+	}
+	for _, c := range login {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '.' && c != '_' && c != '-' {
+			return "", errInvalidLogin
+		}
+	}
+	return login, nil
+}
+
+// claimLinks moves the links of the anonymous session the request was made in to the account.
+// A failed merge does not fail the login, the links stay with the anonymous user.
+func claimLinks(r *http.Request, repo repository.Repository, accountID string) *MergeResponse {
+	sessionID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || sessionID == "" || sessionID == accountID {
+		return nil
+	}
+
+	merge, err := repo.MergeLinks(sessionID, accountID, time.Now().UTC())
+	if errors.Is(err, repository.ErrRegisteredUser) {
+		logger.Log.Debug("session belongs to another account, links are not merged", zap.String("user_id", accountID))
+		return nil
+	}
+	if err != nil {
+		logger.Log.Error("failed to merge links", zap.String("user_id", accountID), zap.Error(err))
+		return nil
+	}
+	if merge.IsEmpty() {
+		return nil
+	}
+
+	logger.Log.Info("anonymous links merged", zap.String("user_id", accountID), zap.String("merge_id", merge.ID),
+		zap.Int("moved", len(merge.Moved)), zap.Int("skipped", len(merge.Skipped)))
+	return &MergeResponse{
+		ID:      merge.ID,
+		Moved:   merge.Moved,
+		Skipped: merge.Skipped,
+	}
+}
+
+func writeSession(rw http.ResponseWriter, r *http.Request, issuer TokenIssuer, user repository.User, merge *MergeResponse, status int) {
+	token, err := issuer.IssueToken(rw, user.ID)
+	if err != nil {
+		problem.Write(rw, r, problem.Internal())
+		return
+	}
+
+	rw.WriteHeader(status)
+	resp := AccountResponse{
+		UserID: user.ID,
+		Login:  user.Login,
+		Token:  token,
+		Merge:  merge,
+	}
+	if err := json.NewEncoder(rw).Encode(resp); err != nil {
+		logger.Log.Error("failed to encode response", zap.Error(err))
+		return
+	}
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aifedorov/shortener/internal/http/middleware/auth"
+	"github.com/aifedorov/shortener/internal/mocks"
+	"github.com/aifedorov/shortener/internal/pkg/password"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+// fakeIssuer issues the user ID as the token.
+type fakeIssuer struct {
+	err error
+}
+
+func (f fakeIssuer) IssueToken(_ http.ResponseWriter, userID string) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	return "token-" + userID, nil
+}
+
+func TestNewRegisterHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		expectCreate   bool
+		createErr      error
+		issuerErr      error
+		expectedStatus int
+		expectedLogin  string
+	}{
+		{
+			name:           "user registered",
+			requestBody:    `{"login":" Alice ","password":"correct horse"}`,
+			expectCreate:   true,
+			expectedStatus: http.StatusCreated,
+			expectedLogin:  "alice",
+		},
+		{
+			name:           "login taken",
+			requestBody:    `{"login":"alice","password":"correct horse"}`,
+			expectCreate:   true,
+			createErr:      repository.ErrLoginTaken,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "login is too short",
+			requestBody:    `{"login":"al","password":"correct horse"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "login has unsupported characters",
+			requestBody:    `{"login":"alice smith","password":"correct horse"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "password is too short",
+			requestBody:    `{"login":"alice","password":"short"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "password is too long",
+			requestBody:    `{"login":"alice","password":"` + strings.Repeat("a", password.MaxLength+1) + `"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid json",
+			requestBody:    `{"login":`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "repository error",
+			requestBody:    `{"login":"alice","password":"correct horse"}`,
+			expectCreate:   true,
+			createErr:      errors.New("database error"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "token error",
+			requestBody:    `{"login":"alice","password":"correct horse"}`,
+			expectCreate:   true,
+			issuerErr:      errors.New("signing error"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var created repository.User
+			mockRepo := mocks.NewMockRepository(ctrl)
+			if tt.expectCreate {
+				mockRepo.EXPECT().CreateUser(gomock.Any()).DoAndReturn(func(user repository.User) error {
+					created = user
+					return tt.createErr
+				})
+			}
+
+			handler := NewRegisterHandler(mockRepo, fakeIssuer{err: tt.issuerErr})
+			req := httptest.NewRequest(http.MethodPost, "/api/register", strings.NewReader(tt.requestBody))
+			rw := httptest.NewRecorder()
+			handler(rw, req)
+
+			assert.Equal(t, tt.expectedStatus, rw.Code)
+			if tt.expectedStatus != http.StatusCreated {
+				return
+			}
+
+			var resp AccountResponse
+			require.NoError(t, json.NewDecoder(rw.Body).Decode(&resp))
+			assert.Equal(t, tt.expectedLogin, resp.Login)
+			assert.Equal(t, created.ID, resp.UserID)
+			assert.Equal(t, "token-"+created.ID, resp.Token)
+			assert.Equal(t, tt.expectedLogin, created.Login)
+			assert.NoError(t, password.Compare(created.PasswordHash, "correct horse"))
+		})
+	}
+}
+
+func TestNewLoginHandler(t *testing.T) {
+	hash, err := password.Hash("correct horse")
+	require.NoError(t, err)
+	user := repository.User{ID: "user123", Login: "alice", PasswordHash: hash}
+
+	tests := []struct {
+		name           string
+		requestBody    string
+		expectGet      bool
+		user           repository.User
+		getErr         error
+		expectedStatus int
+	}{
+		{
+			name:           "logged in",
+			requestBody:    `{"login":"Alice","password":"correct horse"}`,
+			expectGet:      true,
+			user:           user,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "wrong password",
+			requestBody:    `{"login":"alice","password":"wrong horse"}`,
+			expectGet:      true,
+			user:           user,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "unknown user",
+			requestBody:    `{"login":"alice","password":"correct horse"}`,
+			expectGet:      true,
+			getErr:         repository.ErrUserNotFound,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "repository error",
+			requestBody:    `{"login":"alice","password":"correct horse"}`,
+			expectGet:      true,
+			getErr:         errors.New("database error"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "invalid json",
+			requestBody:    `{"login":`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			if tt.expectGet {
+				mockRepo.EXPECT().GetUserByLogin("alice").Return(tt.user, tt.getErr)
+			}
+
+			handler := NewLoginHandler(mockRepo, fakeIssuer{})
+			req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(tt.requestBody))
+			rw := httptest.NewRecorder()
+			handler(rw, req)
+
+			assert.Equal(t, tt.expectedStatus, rw.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var resp AccountResponse
+			require.NoError(t, json.NewDecoder(rw.Body).Decode(&resp))
+			assert.Equal(t, AccountResponse{UserID: "user123", Login: "alice", Token: "token-user123"}, resp)
+		})
+	}
+}
+
+func TestNewLoginHandler_ClaimLinks(t *testing.T) {
+	hash, err := password.Hash("correct horse")
+	require.NoError(t, err)
+	user := repository.User{ID: "user123", Login: "alice", PasswordHash: hash}
+
+	tests := []struct {
+		name          string
+		sessionID     string
+		expectMerge   bool
+		merge         repository.LinkMerge
+		mergeErr      error
+		expectedMerge *MergeResponse
+	}{
+		{
+			name:        "anonymous links claimed",
+			sessionID:   "anonymous",
+			expectMerge: true,
+			merge:       repository.LinkMerge{ID: "merge1", Moved: []string{"abc"}, Skipped: []string{"def"}},
+			expectedMerge: &MergeResponse{
+				ID:      "merge1",
+				Moved:   []string{"abc"},
+				Skipped: []string{"def"},
+			},
+		},
+		{
+			name:        "anonymous session without links",
+			sessionID:   "anonymous",
+			expectMerge: true,
+		},
+		{
+			name:        "session of another account",
+			sessionID:   "other",
+			expectMerge: true,
+			mergeErr:    repository.ErrRegisteredUser,
+		},
+		{
+			name:        "merge fails",
+			sessionID:   "anonymous",
+			expectMerge: true,
+			mergeErr:    errors.New("database error"),
+		},
+		{
+			name:      "session of the same account",
+			sessionID: "user123",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			mockRepo.EXPECT().GetUserByLogin("alice").Return(user, nil)
+			if tt.expectMerge {
+				mockRepo.EXPECT().MergeLinks(tt.sessionID, "user123", gomock.Any()).Return(tt.merge, tt.mergeErr)
+			}
+
+			handler := NewLoginHandler(mockRepo, fakeIssuer{})
+			ctx := context.WithValue(context.Background(), auth.UserIDKey, tt.sessionID)
+			req := httptest.NewRequest(http.MethodPost, "/api/login",
+				strings.NewReader(`{"login":"alice","password":"correct horse"}`)).WithContext(ctx)
+			rw := httptest.NewRecorder()
+			handler(rw, req)
+
+			require.Equal(t, http.StatusOK, rw.Code, "login succeeds whatever the outcome of the merge")
+			var resp AccountResponse
+			require.NoError(t, json.NewDecoder(rw.Body).Decode(&resp))
+			assert.Equal(t, tt.expectedMerge, resp.Merge)
+		})
+	}
+}
@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/aifedorov/shortener/internal/config"
+	"github.com/aifedorov/shortener/internal/http/middleware/admin"
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/problem"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+// maxDisableReasonLength is the maximum length of the reason for disabling a link in bytes.
+const maxDisableReasonLength = 500
+
+// Admin audit actions
+const (
+	auditSearchLinks     = "search_links"
+	auditDisableLink     = "disable_link"
+	auditEnableLink      = "enable_link"
+	auditReassignLink    = "reassign_link"
+	auditOwnerStats      = "view_owner_stats"
+	auditViewAudit       = "view_audit_log"
+	auditViewReports     = "view_reports"
+	auditDismissReports  = "dismiss_reports"
+	auditDisableReported = "disable_reported_link"
+)
+
+// NewAdminSearchHandler creates a new HTTP handler for searching the links of all owners.
+// This handler requires admin access.
+// The alias, domain and owner query parameters filter the links by alias prefix, destination host
+// including subdomains and owner ID, limit caps the number of returned links.
+func NewAdminSearchHandler(cfg *config.Config, repo repository.Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		query := r.URL.Query()
+		filter := repository.LinkFilter{
+			Alias:   query.Get("alias"),
+			Domain:  query.Get("domain"),
+			OwnerID: query.Get("owner"),
+		}
+		limit, err := queryLimit(r)
+		if err != nil {
+			problem.Write(rw, r, problem.InvalidParameter("limit must be a positive integer"))
+			return
+		}
+		filter.Limit = limit
+
+		links, err := repo.SearchLinks(filter, cfg.BaseURL)
+		if err != nil {
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+
+		if !audit(rw, r, repo, auditSearchLinks, "", map[string]string{
+			"alias":   filter.Alias,
+			"domain":  filter.Domain,
+			"owner":   filter.OwnerID,
+			"results": strconv.Itoa(len(links)),
+		}) {
+			return
+		}
+
+		rw.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(rw).Encode(links); err != nil {
+			logger.Log.Error("failed to encode response", zap.Error(err))
+			return
+		}
+	}
+}
+
+// NewAdminDisableHandler creates a new HTTP handler for disabling a link of any owner.
+// This handler requires admin access.
+// It accepts an optional JSON object with the status code served instead of the redirect, 410 or 451
+// for links taken down for legal reasons, and a reason. Disabling a disabled link replaces its status and reason.
+func NewAdminDisableHandler(repo repository.Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		req, ok := decodeDisableRequest(rw, r)
+		if !ok {
+			return
+		}
+
+		alias := chi.URLParam(r, "alias")
+		entry := newAuditEntry(r, auditDisableLink, alias, map[string]string{
+			"status": strconv.Itoa(req.Status),
+			"reason": req.Reason,
+		})
+		if err := repo.SetLinkDisabled(alias, req.Status, req.Reason, entry); err != nil {
+			writeAdminLinkError(rw, r, alias, err)
+			return
+		}
+
+		logger.Log.Debug("sending HTTP 204 response")
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// NewAdminEnableHandler creates a new HTTP handler for enabling a disabled link of any owner.
+// This handler requires admin access.
+func NewAdminEnableHandler(repo repository.Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		alias := chi.URLParam(r, "alias")
+		entry := newAuditEntry(r, auditEnableLink, alias, nil)
+		if err := repo.SetLinkDisabled(alias, 0, "", entry); err != nil {
+			writeAdminLinkError(rw, r, alias, err)
+			return
+		}
+
+		logger.Log.Debug("sending HTTP 204 response")
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// NewAdminReassignHandler creates a new HTTP handler for moving a link to another user or workspace.
+// This handler requires admin access.
+// It accepts a JSON object with the ID of the new owner and responds with the previous and the new owner.
+func NewAdminReassignHandler(repo repository.Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		var req ReassignLinkRequest
+		if err := decodeJSON(r, &req); err != nil {
+			problem.Write(rw, r, problem.InvalidBody(err.Error()))
+			return
+		}
+		if _, err := uuid.Parse(req.OwnerID); err != nil {
+			problem.Write(rw, r, problem.InvalidParameter("owner_id must be a user or workspace ID"))
+			return
+		}
+
+		alias := chi.URLParam(r, "alias")
+		entry := newAuditEntry(r, auditReassignLink, alias, map[string]string{"to": req.OwnerID})
+		previous, err := repo.ReassignLink(alias, req.OwnerID, entry)
+		if err != nil {
+			writeAdminLinkError(rw, r, alias, err)
+			return
+		}
+
+		rw.WriteHeader(http.StatusOK)
+		resp := ReassignLinkResponse{Alias: alias, PreviousOwnerID: previous, OwnerID: req.OwnerID}
+		if err := json.NewEncoder(rw).Encode(resp); err != nil {
+			logger.Log.Error("failed to encode response", zap.Error(err))
+			return
+		}
+	}
+}
+
+// NewAdminOwnerStatsHandler creates a new HTTP handler for listing the link counts of every user and workspace.
+// This handler requires admin access.
+// Owners are ordered by their number of active links, most first.
+func NewAdminOwnerStatsHandler(repo repository.Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		stats, err := repo.GetOwnerStats()
+		if err != nil {
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+
+		if !audit(rw, r, repo, auditOwnerStats, "", nil) {
+			return
+		}
+
+		rw.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(rw).Encode(stats); err != nil {
+			logger.Log.Error("failed to encode response", zap.Error(err))
+			return
+		}
+	}
+}
+
+// NewAdminAuditHandler creates a new HTTP handler for reading the audit log of the admin API, newest first.
+// This handler requires admin access.
+// The limit query parameter caps the number of returned entries, 100 by default.
+func NewAdminAuditHandler(repo repository.Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		limit, err := queryLimit(r)
+		if err != nil {
+			problem.Write(rw, r, problem.InvalidParameter("limit must be a positive integer"))
+			return
+		}
+		if limit == 0 {
+			limit = repository.DefaultSearchLimit
+		}
+
+		entries, err := repo.GetAuditLog(limit)
+		if err != nil {
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+
+		if !audit(rw, r, repo, auditViewAudit, "", nil) {
+			return
+		}
+
+		rw.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(rw).Encode(entries); err != nil {
+			logger.Log.Error("failed to encode response", zap.Error(err))
+			return
+		}
+	}
+}
+
+// NewAdminReportsHandler creates a new HTTP handler for reviewing abuse reports, newest first.
+// This handler requires admin access.
+// The status query parameter selects open, dismissed or actioned reports, every report by default,
+// limit caps the number of returned reports, 100 by default.
+func NewAdminReportsHandler(repo repository.Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "", repository.ReportOpen, repository.ReportDismissed, repository.ReportActioned:
+		default:
+			problem.Write(rw, r, problem.InvalidParameter("status must be open, dismissed or actioned"))
+			return
+		}
+		limit, err := queryLimit(r)
+		if err != nil {
+			problem.Write(rw, r, problem.InvalidParameter("limit must be a positive integer"))
+			return
+		}
+		if limit == 0 {
+			limit = repository.DefaultSearchLimit
+		}
+
+		reports, err := repo.GetReports(status, limit)
+		if err != nil {
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+
+		if !audit(rw, r, repo, auditViewReports, "", map[string]string{"status": status}) {
+			return
+		}
+
+		rw.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(rw).Encode(reports); err != nil {
+			logger.Log.Error("failed to encode response", zap.Error(err))
+			return
+		}
+	}
+}
+
+// NewAdminDismissReportsHandler creates a new HTTP handler for dismissing the open reports against a link.
+// This handler requires admin access.
+// The quarantine of the link is lifted and it redirects again.
+func NewAdminDismissReportsHandler(repo repository.Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		alias := chi.URLParam(r, "alias")
+		entry := newAuditEntry(r, auditDismissReports, alias, nil)
+		resolved, err := repo.ResolveReports(alias, repository.ReportDismissed, entry)
+		if err != nil {
+			writeAdminLinkError(rw, r, alias, err)
+			return
+		}
+
+		writeResolvedReports(rw, alias, repository.ReportDismissed, resolved)
+	}
+}
+
+// NewAdminDisableReportedHandler creates a new HTTP handler for disabling a reported link and closing
+// the open reports against it as actioned.
+// This handler requires admin access.
+// It accepts the same optional JSON object as the disable handler.
+func NewAdminDisableReportedHandler(repo repository.Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		req, ok := decodeDisableRequest(rw, r)
+		if !ok {
+			return
+		}
+
+		alias := chi.URLParam(r, "alias")
+		details := map[string]string{
+			"status": strconv.Itoa(req.Status),
+			"reason": req.Reason,
+		}
+		if err := repo.SetLinkDisabled(alias, req.Status, req.Reason, newAuditEntry(r, auditDisableLink, alias, details)); err != nil {
+			writeAdminLinkError(rw, r, alias, err)
+			return
+		}
+		resolved, err := repo.ResolveReports(alias, repository.ReportActioned, newAuditEntry(r, auditDisableReported, alias, details))
+		if err != nil {
+			writeAdminLinkError(rw, r, alias, err)
+			return
+		}
+
+		writeResolvedReports(rw, alias, repository.ReportActioned, resolved)
+	}
+}
+
+// decodeDisableRequest decodes the optional body of a request disabling a link and fills in the default status.
+// It writes an error response and returns false if the body is invalid.
+func decodeDisableRequest(rw http.ResponseWriter, r *http.Request) (DisableLinkRequest, bool) {
+	var req DisableLinkRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &req); err != nil {
+			problem.Write(rw, r, problem.InvalidBody(err.Error()))
+			return req, false
+		}
+	}
+	if req.Status == 0 {
+		req.Status = http.StatusGone
+	}
+	if req.Status != http.StatusGone && req.Status != http.StatusUnavailableForLegalReasons {
+		problem.Write(rw, r, problem.InvalidParameter("status must be 410 or 451"))
+		return req, false
+	}
+	if len(req.Reason) > maxDisableReasonLength {
+		problem.Write(rw, r, problem.InvalidParameter("reason must be at most 500 characters long"))
+		return req, false
+	}
+	return req, true
+}
+
+func writeResolvedReports(rw http.ResponseWriter, alias, status string, resolved int) {
+	rw.WriteHeader(http.StatusOK)
+	resp := ResolveReportsResponse{Alias: alias, Status: status, Resolved: resolved}
+	if err := json.NewEncoder(rw).Encode(resp); err != nil {
+		logger.Log.Error("failed to encode response", zap.Error(err))
+		return
+	}
+}
+
+// queryLimit returns the limit query parameter, zero if it is not set.
+func queryLimit(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, errors.New("invalid limit")
+	}
+	return limit, nil
+}
+
+// newAuditEntry describes an admin action taken by the operator of the request, empty details are left out.
+// Changes pass the entry to the repository, which records it together with the change.
+func newAuditEntry(r *http.Request, action, target string, details map[string]string) repository.AuditEntry {
+	for key, value := range details {
+		if value == "" {
+			delete(details, key)
+		}
+	}
+	return repository.AuditEntry{
+		ID:        uuid.NewString(),
+		Actor:     requestActor(r),
+		Action:    action,
+		Target:    target,
+		Details:   details,
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+// audit records a read-only admin action before its result is sent.
+// It writes an error response and returns false if the entry cannot be recorded, so no data is served unaudited.
+func audit(rw http.ResponseWriter, r *http.Request, repo repository.Repository, action, target string, details map[string]string) bool {
+	entry := newAuditEntry(r, action, target, details)
+	if err := repo.AppendAudit(entry); err != nil {
+		logger.Log.Error("admin: failed to record audit entry", zap.String("action", action),
+			zap.String("actor", entry.Actor), zap.Error(err))
+		problem.Write(rw, r, problem.Internal())
+		return false
+	}
+	return true
+}
+
+// requestActor returns the operator of the request set by the admin middleware.
+func requestActor(r *http.Request) string {
+	actor, _ := r.Context().Value(admin.ActorKey).(string)
+	return actor
+}
+
+func writeAdminLinkError(rw http.ResponseWriter, r *http.Request, alias string, err error) {
+	if errors.Is(err, repository.ErrShortURLNotFound) {
+		logger.Log.Info("admin: short url not found", zap.String("alias", alias))
+		problem.WriteError(rw, r, err)
+		return
+	}
+	logger.Log.Error("admin: failed to update link", zap.String("alias", alias), zap.Error(err))
+	problem.Write(rw, r, problem.Internal())
+}
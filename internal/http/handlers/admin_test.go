@@ -0,0 +1,446 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aifedorov/shortener/internal/config"
+	"github.com/aifedorov/shortener/internal/http/middleware/admin"
+	"github.com/aifedorov/shortener/internal/mocks"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+const adminActor = "user:alice"
+
+func adminRequest(method, target, body string, params map[string]string) *http.Request {
+	req := workspaceRequest(method, target, body, "admin-id", params)
+	return req.WithContext(context.WithValue(req.Context(), admin.ActorKey, adminActor))
+}
+
+func assertAudit(t *testing.T, entry repository.AuditEntry, action, target string, details map[string]string) {
+	assert.NotEmpty(t, entry.ID)
+	assert.False(t, entry.CreatedAt.IsZero())
+	assert.Equal(t, adminActor, entry.Actor)
+	assert.Equal(t, action, entry.Action)
+	assert.Equal(t, target, entry.Target)
+	assert.Equal(t, len(details), len(entry.Details))
+	for key, value := range details {
+		assert.Equal(t, value, entry.Details[key], key)
+	}
+}
+
+func expectAudit(t *testing.T, repo *mocks.MockRepository, action, target string, details map[string]string) {
+	repo.EXPECT().AppendAudit(gomock.Any()).DoAndReturn(func(entry repository.AuditEntry) error {
+		assertAudit(t, entry, action, target, details)
+		return nil
+	})
+}
+
+func expectDisable(t *testing.T, repo *mocks.MockRepository, status int, reason string, details map[string]string) {
+	repo.EXPECT().SetLinkDisabled("abc", status, reason, gomock.Any()).
+		DoAndReturn(func(_ string, _ int, _ string, entry repository.AuditEntry) error {
+			assertAudit(t, entry, auditDisableLink, "abc", details)
+			return nil
+		})
+}
+
+func TestNewAdminSearchHandler(t *testing.T) {
+	cfg := &config.Config{BaseURL: "http://localhost:8080"}
+	links := []repository.LinkRecord{{Alias: "abc", ShortURL: "http://localhost:8080/abc", OriginalURL: "https://example.com", OwnerID: "user1"}}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectRepo     func(repo *mocks.MockRepository)
+		expectedStatus int
+		expectedLinks  []repository.LinkRecord
+	}{
+		{
+			name:  "search by domain and owner",
+			query: "?domain=example.com&owner=user1&limit=10",
+			expectRepo: func(repo *mocks.MockRepository) {
+				filter := repository.LinkFilter{Domain: "example.com", OwnerID: "user1", Limit: 10}
+				repo.EXPECT().SearchLinks(filter, cfg.BaseURL).Return(links, nil)
+				expectAudit(t, repo, auditSearchLinks, "", map[string]string{"domain": "example.com", "owner": "user1", "results": "1"})
+			},
+			expectedStatus: http.StatusOK,
+			expectedLinks:  links,
+		},
+		{
+			name:           "invalid limit",
+			query:          "?limit=-1",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "repository error",
+			query: "?alias=ab",
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().SearchLinks(repository.LinkFilter{Alias: "ab"}, cfg.BaseURL).Return(nil, errors.New("db down"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockRepository(ctrl)
+			if tt.expectRepo != nil {
+				tt.expectRepo(repo)
+			}
+
+			w := httptest.NewRecorder()
+			NewAdminSearchHandler(cfg, repo).ServeHTTP(w, adminRequest(http.MethodGet, "/api/admin/links"+tt.query, "", nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedLinks != nil {
+				var got []repository.LinkRecord
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+				assert.Equal(t, tt.expectedLinks, got)
+			}
+		})
+	}
+}
+
+func TestNewAdminDisableHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectRepo     func(repo *mocks.MockRepository)
+		expectedStatus int
+	}{
+		{
+			name: "defaults to gone",
+			body: "",
+			expectRepo: func(repo *mocks.MockRepository) {
+				expectDisable(t, repo, http.StatusGone, "", map[string]string{"status": "410"})
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name: "unavailable for legal reasons",
+			body: `{"status":451,"reason":"court order"}`,
+			expectRepo: func(repo *mocks.MockRepository) {
+				expectDisable(t, repo, http.StatusUnavailableForLegalReasons, "court order",
+					map[string]string{"status": "451", "reason": "court order"})
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "unsupported status",
+			body:           `{"status":404}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid body",
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "link not found",
+			body: `{"status":410}`,
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().SetLinkDisabled("abc", http.StatusGone, "", gomock.Any()).Return(repository.ErrShortURLNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "audit failure fails the request",
+			body: `{"status":410}`,
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().SetLinkDisabled("abc", http.StatusGone, "", gomock.Any()).Return(errors.New("db down"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockRepository(ctrl)
+			if tt.expectRepo != nil {
+				tt.expectRepo(repo)
+			}
+
+			w := httptest.NewRecorder()
+			req := adminRequest(http.MethodPost, "/api/admin/links/abc/disable", tt.body, map[string]string{"alias": "abc"})
+			NewAdminDisableHandler(repo).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestNewAdminEnableHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	repo.EXPECT().SetLinkDisabled("abc", 0, "", gomock.Any()).
+		DoAndReturn(func(_ string, _ int, _ string, entry repository.AuditEntry) error {
+			assertAudit(t, entry, auditEnableLink, "abc", nil)
+			return nil
+		})
+
+	w := httptest.NewRecorder()
+	req := adminRequest(http.MethodPost, "/api/admin/links/abc/enable", "", map[string]string{"alias": "abc"})
+	NewAdminEnableHandler(repo).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestNewAdminReassignHandler(t *testing.T) {
+	const newOwner = "6a1f4c1e-3b7d-4c55-9d8e-0c1f2a3b4c5d"
+
+	tests := []struct {
+		name           string
+		body           string
+		expectRepo     func(repo *mocks.MockRepository)
+		expectedStatus int
+		expectedResp   *ReassignLinkResponse
+	}{
+		{
+			name: "reassigned",
+			body: `{"owner_id":"` + newOwner + `"}`,
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().ReassignLink("abc", newOwner, gomock.Any()).
+					DoAndReturn(func(_, _ string, entry repository.AuditEntry) (string, error) {
+						assertAudit(t, entry, auditReassignLink, "abc", map[string]string{"to": newOwner})
+						return "old-owner", nil
+					})
+			},
+			expectedStatus: http.StatusOK,
+			expectedResp:   &ReassignLinkResponse{Alias: "abc", PreviousOwnerID: "old-owner", OwnerID: newOwner},
+		},
+		{
+			name:           "invalid owner",
+			body:           `{"owner_id":"nobody"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "link not found",
+			body: `{"owner_id":"` + newOwner + `"}`,
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().ReassignLink("abc", newOwner, gomock.Any()).Return("", repository.ErrShortURLNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockRepository(ctrl)
+			if tt.expectRepo != nil {
+				tt.expectRepo(repo)
+			}
+
+			w := httptest.NewRecorder()
+			req := adminRequest(http.MethodPost, "/api/admin/links/abc/owner", tt.body, map[string]string{"alias": "abc"})
+			NewAdminReassignHandler(repo).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedResp != nil {
+				var got ReassignLinkResponse
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+				assert.Equal(t, *tt.expectedResp, got)
+			}
+		})
+	}
+}
+
+func TestNewAdminOwnerStatsHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	stats := []repository.OwnerStats{{OwnerID: "user1", Active: 2, Deleted: 1, Clicks: 7}}
+	repo := mocks.NewMockRepository(ctrl)
+	repo.EXPECT().GetOwnerStats().Return(stats, nil)
+	expectAudit(t, repo, auditOwnerStats, "", nil)
+
+	w := httptest.NewRecorder()
+	NewAdminOwnerStatsHandler(repo).ServeHTTP(w, adminRequest(http.MethodGet, "/api/admin/users", "", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var got []repository.OwnerStats
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	assert.Equal(t, stats, got)
+}
+
+func TestNewAdminOwnerStatsHandler_AuditFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	repo.EXPECT().GetOwnerStats().Return([]repository.OwnerStats{{OwnerID: "user1", Active: 2}}, nil)
+	repo.EXPECT().AppendAudit(gomock.Any()).Return(errors.New("db down"))
+
+	w := httptest.NewRecorder()
+	NewAdminOwnerStatsHandler(repo).ServeHTTP(w, adminRequest(http.MethodGet, "/api/admin/users", "", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "user1", "unaudited results are not served")
+}
+
+func TestNewAdminAuditHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	entries := []repository.AuditEntry{{ID: "1", Actor: "token", Action: auditEnableLink, Target: "abc"}}
+	repo := mocks.NewMockRepository(ctrl)
+	repo.EXPECT().GetAuditLog(repository.DefaultSearchLimit).Return(entries, nil)
+	expectAudit(t, repo, auditViewAudit, "", nil)
+
+	w := httptest.NewRecorder()
+	NewAdminAuditHandler(repo).ServeHTTP(w, adminRequest(http.MethodGet, "/api/admin/audit", "", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var got []repository.AuditEntry
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	assert.Equal(t, entries, got)
+}
+
+func TestNewAdminReportsHandler(t *testing.T) {
+	reports := []repository.Report{{ID: "1", Alias: "abc", Category: "phishing", Reporter: "r1", Status: repository.ReportOpen}}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectRepo     func(repo *mocks.MockRepository)
+		expectedStatus int
+	}{
+		{
+			name:  "open reports",
+			query: "?status=open",
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().GetReports(repository.ReportOpen, repository.DefaultSearchLimit).Return(reports, nil)
+				expectAudit(t, repo, auditViewReports, "", map[string]string{"status": "open"})
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unknown status",
+			query:          "?status=closed",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "repository error",
+			query: "?limit=5",
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().GetReports("", 5).Return(nil, errors.New("db down"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockRepository(ctrl)
+			if tt.expectRepo != nil {
+				tt.expectRepo(repo)
+			}
+
+			w := httptest.NewRecorder()
+			NewAdminReportsHandler(repo).ServeHTTP(w, adminRequest(http.MethodGet, "/api/admin/reports"+tt.query, "", nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var got []repository.Report
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+				assert.Equal(t, reports, got)
+			}
+		})
+	}
+}
+
+func TestNewAdminDismissReportsHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks.NewMockRepository(ctrl)
+	repo.EXPECT().ResolveReports("abc", repository.ReportDismissed, gomock.Any()).
+		DoAndReturn(func(_, _ string, entry repository.AuditEntry) (int, error) {
+			assertAudit(t, entry, auditDismissReports, "abc", nil)
+			return 3, nil
+		})
+
+	w := httptest.NewRecorder()
+	req := adminRequest(http.MethodPost, "/api/admin/reports/abc/dismiss", "", map[string]string{"alias": "abc"})
+	NewAdminDismissReportsHandler(repo).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp ResolveReportsResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, ResolveReportsResponse{Alias: "abc", Status: repository.ReportDismissed, Resolved: 3}, resp)
+}
+
+func TestNewAdminDisableReportedHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectRepo     func(repo *mocks.MockRepository)
+		expectedStatus int
+	}{
+		{
+			name: "disables the link and actions the reports",
+			body: `{"reason":"phishing"}`,
+			expectRepo: func(repo *mocks.MockRepository) {
+				details := map[string]string{"status": "410", "reason": "phishing"}
+				expectDisable(t, repo, http.StatusGone, "phishing", details)
+				repo.EXPECT().ResolveReports("abc", repository.ReportActioned, gomock.Any()).
+					DoAndReturn(func(_, _ string, entry repository.AuditEntry) (int, error) {
+						assertAudit(t, entry, auditDisableReported, "abc", details)
+						return 2, nil
+					})
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unsupported status",
+			body:           `{"status":302}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "link not found",
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().SetLinkDisabled("abc", http.StatusGone, "", gomock.Any()).Return(repository.ErrShortURLNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockRepository(ctrl)
+			if tt.expectRepo != nil {
+				tt.expectRepo(repo)
+			}
+
+			w := httptest.NewRecorder()
+			req := adminRequest(http.MethodPost, "/api/admin/reports/abc/disable", tt.body, map[string]string{"alias": "abc"})
+			NewAdminDisableReportedHandler(repo).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/problem"
+	"github.com/aifedorov/shortener/internal/pkg/apikey"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+// maxAPIKeyNameLength is the maximum length of an API key name in bytes.
+const maxAPIKeyNameLength = 100
+
+// NewCreateAPIKeyHandler creates a new HTTP handler for creating an API key of the user.
+// This handler requires the session of a registered account, anonymous sessions and requests authenticated
+// with an API key are rejected with 403, so a key cannot be used to mint further keys.
+// It accepts a JSON object with the key name and responds with the key, which is not retrievable later.
+func NewCreateAPIKeyHandler(repo repository.Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		userID, err := getUserID(r)
+		if err != nil {
+			problem.Write(rw, r, problem.Unauthorized(detailNotAuthenticated))
+			return
+		}
+		if isAPIKeyRequest(r) {
+			logger.Log.Info("api key creation with an api key rejected", zap.String("user_id", userID))
+			problem.Write(rw, r, problem.Forbidden("api keys cannot be created with an api key"))
+			return
+		}
+		if !isAccountSession(r) {
+			logger.Log.Info("api key creation without an account rejected", zap.String("user_id", userID))
+			problem.Write(rw, r, problem.Forbidden("api keys require a registered account"))
+			return
+		}
+
+		var req APIKeyRequest
+		if err := decodeJSON(r, &req); err != nil {
+			problem.Write(rw, r, problem.InvalidBody(err.Error()))
+			return
+		}
+		name := strings.TrimSpace(req.Name)
+		if name == "" || len(name) > maxAPIKeyNameLength {
+			problem.Write(rw, r, problem.InvalidParameter("name must be 1 to 100 characters long"))
+			return
+		}
+
+		key, err := apikey.Generate()
+		if err != nil {
+			logger.Log.Error("failed to generate api key", zap.Error(err))
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+		record := repository.APIKey{
+			ID:        uuid.NewString(),
+			UserID:    userID,
+			Name:      name,
+			Prefix:    apikey.DisplayPrefix(key),
+			Hash:      apikey.Hash(key),
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := repo.StoreAPIKey(record); err != nil {
+			logger.Log.Error("failed to store api key", zap.Error(err))
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+
+		logger.Log.Debug("sending HTTP 201 response")
+		rw.WriteHeader(http.StatusCreated)
+		resp := newAPIKeyResponse(record)
+		resp.Key = key
+		if err := json.NewEncoder(rw).Encode(resp); err != nil {
+			logger.Log.Error("failed to encode response", zap.Error(err))
+			return
+		}
+	}
+}
+
+// NewAPIKeysHandler creates a new HTTP handler for listing the active API keys of the user.
+// This handler requires user authentication. If the user is not authenticated, a cookie will be created for them.
+// The keys themselves are not included, only their names and prefixes.
+func NewAPIKeysHandler(repo repository.Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		userID, err := getUserID(r)
+		if err != nil {
+			problem.Write(rw, r, problem.Unauthorized(detailNotAuthenticated))
+			return
+		}
+
+		keys, err := repo.GetAPIKeys(userID)
+		if err != nil {
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+
+		resp := make([]APIKeyResponse, len(keys))
+		for i, key := range keys {
+			resp[i] = newAPIKeyResponse(key)
+		}
+		rw.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(rw).Encode(resp); err != nil {
+			logger.Log.Error("failed to encode response", zap.Error(err))
+			return
+		}
+	}
+}
+
+// NewRevokeAPIKeyHandler creates a new HTTP handler for revoking an API key of the user.
+// This handler requires user authentication. If the user is not authenticated, a cookie will be created for them.
+// It responds with 204 once the key is revoked and 404 if the user has no such active key.
+func NewRevokeAPIKeyHandler(repo repository.Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID, err := getUserID(r)
+		if err != nil {
+			problem.Write(rw, r, problem.Unauthorized(detailNotAuthenticated))
+			return
+		}
+
+		keyID := chi.URLParam(r, "id")
+		err = repo.RevokeAPIKey(userID, keyID, time.Now().UTC())
+		if errors.Is(err, repository.ErrAPIKeyNotFound) {
+			problem.WriteError(rw, r, err)
+			return
+		}
+		if err != nil {
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+
+		logger.Log.Debug("sending HTTP 204 response")
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newAPIKeyResponse(key repository.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		CreatedAt: key.CreatedAt,
+	}
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aifedorov/shortener/internal/http/middleware/auth"
+	"github.com/aifedorov/shortener/internal/mocks"
+	"github.com/aifedorov/shortener/internal/pkg/apikey"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+func TestNewCreateAPIKeyHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		userID         string
+		anonymous      bool
+		apiKey         bool
+		requestBody    string
+		expectStore    bool
+		storeErr       error
+		expectedStatus int
+	}{
+		{
+			name:           "key created",
+			userID:         "user123",
+			requestBody:    `{"name":"ci"}`,
+			expectStore:    true,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "empty name",
+			userID:         "user123",
+			requestBody:    `{"name":"  "}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "name is too long",
+			userID:         "user123",
+			requestBody:    `{"name":"` + strings.Repeat("a", maxAPIKeyNameLength+1) + `"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid json",
+			userID:         "user123",
+			requestBody:    `{"name":`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "repository error",
+			userID:         "user123",
+			requestBody:    `{"name":"ci"}`,
+			expectStore:    true,
+			storeErr:       errors.New("database error"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "unauthorized user",
+			requestBody:    `{"name":"ci"}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "anonymous session",
+			userID:         "user123",
+			anonymous:      true,
+			requestBody:    `{"name":"ci"}`,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "api key request",
+			userID:         "user123",
+			apiKey:         true,
+			requestBody:    `{"name":"ci"}`,
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var stored repository.APIKey
+			mockRepo := mocks.NewMockRepository(ctrl)
+			if tt.expectStore {
+				mockRepo.EXPECT().StoreAPIKey(gomock.Any()).DoAndReturn(func(key repository.APIKey) error {
+					stored = key
+					return tt.storeErr
+				})
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/user/keys", strings.NewReader(tt.requestBody))
+			if tt.userID != "" {
+				ctx := context.WithValue(req.Context(), auth.UserIDKey, tt.userID)
+				ctx = context.WithValue(ctx, auth.AccountKey, !tt.anonymous)
+				ctx = context.WithValue(ctx, auth.APIKeyKey, tt.apiKey)
+				req = req.WithContext(ctx)
+			}
+			rr := httptest.NewRecorder()
+
+			NewCreateAPIKeyHandler(mockRepo)(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus != http.StatusCreated {
+				return
+			}
+
+			var resp APIKeyResponse
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+			assert.True(t, apikey.IsKey(resp.Key))
+			assert.Equal(t, "ci", resp.Name)
+			assert.Equal(t, stored.ID, resp.ID)
+			assert.Equal(t, tt.userID, stored.UserID)
+			assert.Equal(t, apikey.Hash(resp.Key), stored.Hash, "only the hash is stored")
+			assert.Equal(t, apikey.DisplayPrefix(resp.Key), stored.Prefix)
+		})
+	}
+}
+
+func TestNewAPIKeysHandler(t *testing.T) {
+	createdAt := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		userID         string
+		keys           []repository.APIKey
+		getErr         error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:   "keys listed without secrets",
+			userID: "user123",
+			keys: []repository.APIKey{
+				{ID: "key1", UserID: "user123", Name: "ci", Prefix: "shk_abcdef", Hash: "secret-hash", CreatedAt: createdAt},
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[{"id":"key1","name":"ci","prefix":"shk_abcdef","created_at":"2026-05-01T10:00:00Z"}]`,
+		},
+		{
+			name:           "no keys",
+			userID:         "user123",
+			keys:           []repository.APIKey{},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[]`,
+		},
+		{
+			name:           "repository error",
+			userID:         "user123",
+			getErr:         errors.New("database error"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "unauthorized user",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			if tt.userID != "" {
+				mockRepo.EXPECT().GetAPIKeys(tt.userID).Return(tt.keys, tt.getErr)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/user/keys", nil)
+			if tt.userID != "" {
+				req = req.WithContext(context.WithValue(req.Context(), auth.UserIDKey, tt.userID))
+			}
+			rr := httptest.NewRecorder()
+
+			NewAPIKeysHandler(mockRepo)(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestNewRevokeAPIKeyHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		userID         string
+		revokeErr      error
+		expectedStatus int
+	}{
+		{
+			name:           "key revoked",
+			userID:         "user123",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "unknown key",
+			userID:         "user123",
+			revokeErr:      repository.ErrAPIKeyNotFound,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "repository error",
+			userID:         "user123",
+			revokeErr:      errors.New("database error"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "unauthorized user",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			if tt.userID != "" {
+				mockRepo.EXPECT().RevokeAPIKey(tt.userID, "key1", gomock.Any()).Return(tt.revokeErr)
+			}
+
+			r := chi.NewRouter()
+			r.Delete("/api/user/keys/{id}", NewRevokeAPIKeyHandler(mockRepo))
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/user/keys/key1", nil)
+			if tt.userID != "" {
+				req = req.WithContext(context.WithValue(req.Context(), auth.UserIDKey, tt.userID))
+			}
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
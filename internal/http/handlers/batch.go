@@ -1,62 +1,74 @@
 package handlers
 
 import (
-	"errors"
 	"net/http"
 
 	"github.com/aifedorov/shortener/internal/config"
 	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/problem"
 	"github.com/aifedorov/shortener/internal/pkg/validate"
+	"github.com/aifedorov/shortener/internal/pkg/workspace"
 	"github.com/aifedorov/shortener/internal/repository"
+	"github.com/aifedorov/shortener/internal/service"
+	"go.uber.org/zap"
 )
 
 // NewSaveJSONBatchHandler creates a new HTTP handler for batch URL shortening operations.
 // This handler requires user authentication. If the user is not authenticated, a cookie will be created for them.
-// It accepts a JSON array of URLs and returns a JSON array of shortened URLs with correlation IDs.
+// It accepts a JSON array of URLs and returns the outcome of every URL with its correlation ID:
+// created or existing with the short URL, or invalid with the reason it was rejected.
+// The response is 201 if every URL was created and 207 otherwise, invalid URLs do not fail the batch.
+// The workspace query parameter stores the links in a workspace, it requires the editor or owner role.
+// Batches over the size quota are rejected with 403, batches exceeding a link quota store no links.
 func NewSaveJSONBatchHandler(config *config.Config, repo repository.Repository, urlChecker validate.URLChecker) http.HandlerFunc {
+	links := service.NewLinks(config, repo, urlChecker)
 	return func(rw http.ResponseWriter, r *http.Request) {
 		rw.Header().Set("Content-Type", "application/json")
 
 		reqURLs, err := decodeBatchRequest(r)
 		if err != nil {
-			http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			problem.Write(rw, r, problem.InvalidBody(err.Error()))
 			return
 		}
 
-		urls, err := validateURLs(reqURLs, urlChecker)
-		if err != nil {
-			http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		if writeQuotaError(rw, r, links.CheckBatchSize(len(reqURLs))) {
 			return
 		}
 
 		userID, err := getUserID(r)
 		if err != nil {
-			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			problem.Write(rw, r, problem.Internal())
 			return
 		}
 
-		res, err := repo.StoreBatch(userID, config.BaseURL, urls)
-		var cErr *repository.ConflictError
-		if errors.As(err, &cErr) {
-			logger.Log.Debug("sending HTTP 409 response")
-			rw.WriteHeader(http.StatusConflict)
-
-			if err := encodeResponse(rw, cErr.ShortURL); err != nil {
-				http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-				return
-			}
+		ownerID, err := linkOwner(r, repo, userID, workspace.PermissionWrite)
+		if err != nil {
+			writeWorkspaceError(rw, r, err)
 			return
 		}
+
+		items := make([]service.BatchItem, len(reqURLs))
+		for i, reqURL := range reqURLs {
+			items[i] = service.BatchItem{CID: reqURL.CID, URL: reqURL.OriginalURL, Options: reqURL.options()}
+		}
+		res, err := links.ShortenBatch(ownerID, items)
 		if err != nil {
-			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			writeLinkError(rw, r, err)
 			return
 		}
 
-		logger.Log.Debug("sending HTTP 201 response")
-		rw.WriteHeader(http.StatusCreated)
+		status := http.StatusCreated
+		for _, link := range res {
+			if batchResult(link) != batchResultCreated {
+				status = http.StatusMultiStatus
+				break
+			}
+		}
+		logger.Log.Debug("sending HTTP response", zap.Int("status", status))
+		rw.WriteHeader(status)
 
 		if err := encodeBatchResponse(rw, res); err != nil {
-			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			problem.Write(rw, r, problem.Internal())
 			return
 		}
 	}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -12,7 +11,9 @@ import (
 
 	"github.com/aifedorov/shortener/internal/config"
 	"github.com/aifedorov/shortener/internal/http/middleware/auth"
+	"github.com/aifedorov/shortener/internal/http/problem"
 	"github.com/aifedorov/shortener/internal/mocks"
+	"github.com/aifedorov/shortener/internal/pkg/validate"
 	"github.com/aifedorov/shortener/internal/repository"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -23,100 +24,134 @@ func TestNewSaveJSONBatchHandler(t *testing.T) {
 		name           string
 		requestBody    string
 		userID         string
-		urlCheckerErr  error
+		urlCheckerErrs map[string]error
+		storeBatchURLs []repository.BatchURLInput
+		storeBatchRes  []repository.BatchURLOutput
 		storeBatchErr  error
 		expectedStatus int
 		expectedBody   string
 	}{
 		{
-			name:           "successful batch URL shortening",
-			requestBody:    `[{"correlation_id": "1", "original_url": "https://example.com"}, {"correlation_id": "2", "original_url": "https://google.com"}]`,
-			userID:         "user123",
-			urlCheckerErr:  nil,
-			storeBatchErr:  nil,
+			name:        "successful batch URL shortening",
+			requestBody: `[{"correlation_id": "1", "original_url": "https://example.com"}, {"correlation_id": "2", "original_url": "https://google.com"}]`,
+			userID:      "user123",
+			storeBatchURLs: []repository.BatchURLInput{
+				{CID: "1", OriginalURL: "https://example.com"},
+				{CID: "2", OriginalURL: "https://google.com"},
+			},
+			storeBatchRes: []repository.BatchURLOutput{
+				{CID: "1", ShortURL: "http://localhost:8080/abc1"},
+				{CID: "2", ShortURL: "http://localhost:8080/abc2"},
+			},
 			expectedStatus: http.StatusCreated,
-			expectedBody:   `[{"correlation_id":"1","short_url":"http://localhost:8080/abc1"},{"correlation_id":"2","short_url":"http://localhost:8080/abc2"}]`,
+			expectedBody: `[{"correlation_id":"1","short_url":"http://localhost:8080/abc1","status":"created"},
+				{"correlation_id":"2","short_url":"http://localhost:8080/abc2","status":"created"}]`,
 		},
 		{
 			name:           "invalid JSON",
 			requestBody:    `[{"correlation_id": "1", "original_url": "https://example.com"`,
 			userID:         "user123",
-			urlCheckerErr:  nil,
-			storeBatchErr:  nil,
 			expectedStatus: http.StatusBadRequest,
-			expectedBody:   "Bad Request\n",
+			expectedBody:   problem.TypeInvalidBody,
 		},
 		{
 			name:           "empty request body",
 			requestBody:    ``,
 			userID:         "user123",
-			urlCheckerErr:  nil,
-			storeBatchErr:  nil,
 			expectedStatus: http.StatusBadRequest,
-			expectedBody:   "Bad Request\n",
+			expectedBody:   problem.TypeInvalidBody,
 		},
 		{
 			name:           "invalid URL in batch",
-			requestBody:    `[{"correlation_id": "1", "original_url": "invalid-url"}]`,
+			requestBody:    `[{"correlation_id": "1", "original_url": "invalid-url"}, {"correlation_id": "2", "original_url": "https://google.com"}]`,
 			userID:         "user123",
-			urlCheckerErr:  errors.New("invalid URL"),
-			storeBatchErr:  nil,
-			expectedStatus: http.StatusBadRequest,
-			expectedBody:   "Bad Request\n",
+			urlCheckerErrs: map[string]error{"invalid-url": errors.New("unsupported scheme")},
+			storeBatchURLs: []repository.BatchURLInput{
+				{CID: "2", OriginalURL: "https://google.com"},
+			},
+			storeBatchRes: []repository.BatchURLOutput{
+				{CID: "2", ShortURL: "http://localhost:8080/abc2"},
+			},
+			expectedStatus: http.StatusMultiStatus,
+			expectedBody: `[{"correlation_id":"1","status":"invalid","error":"invalid url: unsupported scheme"},
+				{"correlation_id":"2","short_url":"http://localhost:8080/abc2","status":"created"}]`,
+		},
+		{
+			name:           "host denied by domain policy",
+			requestBody:    `[{"correlation_id": "1", "original_url": "https://evil.com"}]`,
+			userID:         "user123",
+			urlCheckerErrs: map[string]error{"https://evil.com": &validate.PolicyError{Host: "evil.com", Err: validate.ErrHostDenied}},
+			expectedStatus: http.StatusMultiStatus,
+			expectedBody:   `[{"correlation_id":"1","status":"invalid","error":"invalid url: host is denied: evil.com"}]`,
+		},
+		{
+			name:           "invalid link options",
+			requestBody:    `[{"correlation_id": "1", "original_url": "https://example.com", "max_clicks": -1}]`,
+			userID:         "user123",
+			expectedStatus: http.StatusMultiStatus,
+			expectedBody:   `[{"correlation_id":"1","status":"invalid","error":"max_clicks must not be negative"}]`,
 		},
 		{
 			name:           "unauthorized user",
 			requestBody:    `[{"correlation_id": "1", "original_url": "https://example.com"}]`,
 			userID:         "",
-			urlCheckerErr:  nil,
-			storeBatchErr:  nil,
 			expectedStatus: http.StatusInternalServerError,
-			expectedBody:   "Internal Server Error\n",
+			expectedBody:   problem.TypeInternal,
 		},
 		{
-			name:           "conflict error",
-			requestBody:    `[{"correlation_id": "1", "original_url": "https://example.com"}]`,
-			userID:         "user123",
-			urlCheckerErr:  nil,
-			storeBatchErr:  repository.NewConflictError("http://localhost:8080/existing", repository.ErrURLExists),
-			expectedStatus: http.StatusConflict,
-			expectedBody:   `{"result":"http://localhost:8080/existing"}`,
+			name:        "existing URL",
+			requestBody: `[{"correlation_id": "1", "original_url": "https://example.com"}, {"correlation_id": "2", "original_url": "https://google.com"}]`,
+			userID:      "user123",
+			storeBatchURLs: []repository.BatchURLInput{
+				{CID: "1", OriginalURL: "https://example.com"},
+				{CID: "2", OriginalURL: "https://google.com"},
+			},
+			storeBatchRes: []repository.BatchURLOutput{
+				{CID: "1", ShortURL: "http://localhost:8080/existing", Existing: true},
+				{CID: "2", ShortURL: "http://localhost:8080/abc2"},
+			},
+			expectedStatus: http.StatusMultiStatus,
+			expectedBody: `[{"correlation_id":"1","short_url":"http://localhost:8080/existing","status":"existing"},
+				{"correlation_id":"2","short_url":"http://localhost:8080/abc2","status":"created"}]`,
 		},
 		{
-			name:           "repository error",
-			requestBody:    `[{"correlation_id": "1", "original_url": "https://example.com"}]`,
-			userID:         "user123",
-			urlCheckerErr:  nil,
+			name:        "repository error",
+			requestBody: `[{"correlation_id": "1", "original_url": "https://example.com"}]`,
+			userID:      "user123",
+			storeBatchURLs: []repository.BatchURLInput{
+				{CID: "1", OriginalURL: "https://example.com"},
+			},
 			storeBatchErr:  errors.New("database error"),
 			expectedStatus: http.StatusInternalServerError,
-			expectedBody:   "Internal Server Error\n",
+			expectedBody:   problem.TypeInternal,
 		},
 		{
 			name:           "empty batch array",
 			requestBody:    `[]`,
 			userID:         "user123",
-			urlCheckerErr:  nil,
-			storeBatchErr:  nil,
 			expectedStatus: http.StatusCreated,
 			expectedBody:   `[]`,
 		},
 		{
-			name:           "missing correlation_id",
-			requestBody:    `[{"original_url": "https://example.com"}]`,
-			userID:         "user123",
-			urlCheckerErr:  nil,
-			storeBatchErr:  nil,
+			name:        "missing correlation_id",
+			requestBody: `[{"original_url": "https://example.com"}]`,
+			userID:      "user123",
+			storeBatchURLs: []repository.BatchURLInput{
+				{OriginalURL: "https://example.com"},
+			},
+			storeBatchRes: []repository.BatchURLOutput{
+				{ShortURL: "http://localhost:8080/abc1"},
+			},
 			expectedStatus: http.StatusCreated,
-			expectedBody:   `[{"correlation_id":"","short_url":"http://localhost:8080/abc1"}]`,
+			expectedBody:   `[{"correlation_id":"","short_url":"http://localhost:8080/abc1","status":"created"}]`,
 		},
 		{
 			name:           "missing original_url",
 			requestBody:    `[{"correlation_id": "1"}]`,
 			userID:         "user123",
-			urlCheckerErr:  errors.New("empty URL"),
-			storeBatchErr:  nil,
-			expectedStatus: http.StatusBadRequest,
-			expectedBody:   "Bad Request\n",
+			urlCheckerErrs: map[string]error{"": errors.New("empty URL")},
+			expectedStatus: http.StatusMultiStatus,
+			expectedBody:   `[{"correlation_id":"1","status":"invalid","error":"invalid url: empty URL"}]`,
 		},
 	}
 
@@ -132,38 +167,16 @@ func TestNewSaveJSONBatchHandler(t *testing.T) {
 			mockRepo := mocks.NewMockRepository(ctrl)
 			mockURLChecker := mocks.NewMockURLChecker(ctrl)
 
-			if tt.userID != "" && tt.requestBody != "" && !strings.Contains(tt.requestBody, "invalid") {
+			if tt.userID != "" {
 				var batchReqs []BatchRequest
 				if err := json.Unmarshal([]byte(tt.requestBody), &batchReqs); err == nil {
 					for _, req := range batchReqs {
-						if req.OriginalURL != "" {
-							mockURLChecker.EXPECT().CheckURL(req.OriginalURL).Return(tt.urlCheckerErr)
-						} else if tt.name == "missing original_url" {
-							mockURLChecker.EXPECT().CheckURL("").Return(tt.urlCheckerErr)
-						}
-					}
-					if tt.urlCheckerErr == nil {
-						urls := make([]repository.BatchURLInput, len(batchReqs))
-						for i, req := range batchReqs {
-							urls[i] = repository.BatchURLInput{
-								CID:         req.CID,
-								OriginalURL: req.OriginalURL,
-							}
-						}
-						results := make([]repository.BatchURLOutput, len(urls))
-						for i, url := range urls {
-							results[i] = repository.BatchURLOutput{
-								CID:      url.CID,
-								ShortURL: fmt.Sprintf("http://localhost:8080/abc%d", i+1),
-							}
-						}
-						mockRepo.EXPECT().StoreBatch(tt.userID, cfg.BaseURL, urls).Return(results, tt.storeBatchErr)
+						mockURLChecker.EXPECT().CheckURL(req.OriginalURL).Return(tt.urlCheckerErrs[req.OriginalURL])
 					}
 				}
-			} else if tt.userID != "" && strings.Contains(tt.requestBody, "invalid-url") {
-				mockURLChecker.EXPECT().CheckURL("invalid-url").Return(tt.urlCheckerErr)
-			} else if tt.name == "unauthorized user" {
-				mockURLChecker.EXPECT().CheckURL("https://example.com").Return(nil)
+			}
+			if tt.storeBatchURLs != nil {
+				mockRepo.EXPECT().StoreBatch(tt.userID, cfg.BaseURL, tt.storeBatchURLs).Return(tt.storeBatchRes, tt.storeBatchErr)
 			}
 
 			handler := NewSaveJSONBatchHandler(cfg, mockRepo, mockURLChecker)
@@ -181,15 +194,11 @@ func TestNewSaveJSONBatchHandler(t *testing.T) {
 			handler(rr, req)
 
 			assert.Equal(t, tt.expectedStatus, rr.Code)
-			if strings.HasPrefix(tt.expectedBody, "[") || strings.HasPrefix(tt.expectedBody, "{") {
+			if tt.expectedStatus == http.StatusCreated || tt.expectedStatus == http.StatusMultiStatus {
 				assert.JSONEq(t, tt.expectedBody, rr.Body.String())
-			} else {
-				assert.Equal(t, tt.expectedBody, rr.Body.String())
-			}
-			if tt.expectedStatus == http.StatusCreated || tt.expectedStatus == http.StatusConflict {
 				assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
 			} else {
-				assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+				assertProblem(t, rr, tt.expectedStatus, tt.expectedBody)
 			}
 		})
 	}
@@ -3,38 +3,46 @@ package handlers
 import (
 	"net/http"
 
-	"go.uber.org/zap"
-
+	"github.com/aifedorov/shortener/internal/config"
 	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/problem"
+	"github.com/aifedorov/shortener/internal/pkg/workspace"
 	"github.com/aifedorov/shortener/internal/repository"
+	"github.com/aifedorov/shortener/internal/service"
 )
 
 // NewDeleteHandler creates a new HTTP handler for batch URL deletion operations.
 // This handler requires user authentication. If the user is not authenticated, a cookie will be created for them.
 // It accepts a JSON array of short URL aliases and marks them as deleted asynchronously.
-func NewDeleteHandler(repo repository.Repository) http.HandlerFunc {
+// The workspace query parameter deletes links of a workspace instead, it requires the editor or owner role.
+func NewDeleteHandler(cfg *config.Config, repo repository.Repository) http.HandlerFunc {
+	links := service.NewLinks(cfg, repo, nil)
 	return func(rw http.ResponseWriter, r *http.Request) {
 		rw.Header().Set("Content-Type", "application/json")
 
 		aliases, err := decodeAliasesRequest(r)
-		if err != nil || len(aliases) == 0 {
-			http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		if err != nil {
+			problem.Write(rw, r, problem.InvalidBody(err.Error()))
+			return
+		}
+		if len(aliases) == 0 {
+			problem.Write(rw, r, problem.InvalidParameter("aliases must not be empty"))
 			return
 		}
 
 		userID, err := getUserID(r)
 		if err != nil {
-			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+
+		ownerID, err := linkOwner(r, repo, userID, workspace.PermissionWrite)
+		if err != nil {
+			writeWorkspaceError(rw, r, err)
 			return
 		}
 
-		go func(userID string, aliases []string) {
-			err = repo.DeleteBatch(userID, aliases)
-			if err != nil {
-				logger.Log.Error("failed to delete urls", zap.Error(err))
-				return
-			}
-		}(userID, aliases)
+		links.Delete(ownerID, aliases)
 
 		logger.Log.Debug("sending HTTP 202 response")
 		rw.WriteHeader(http.StatusAccepted)
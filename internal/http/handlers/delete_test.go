@@ -9,7 +9,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/aifedorov/shortener/internal/config"
 	"github.com/aifedorov/shortener/internal/http/middleware/auth"
+	"github.com/aifedorov/shortener/internal/http/problem"
 	"github.com/aifedorov/shortener/internal/mocks"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -38,7 +40,7 @@ func TestNewDeleteHandler(t *testing.T) {
 			userID:         "user123",
 			deleteError:    nil,
 			expectedStatus: http.StatusBadRequest,
-			expectedBody:   "Bad Request\n",
+			expectedBody:   problem.TypeInvalidBody,
 		},
 		{
 			name:           "empty request body",
@@ -46,7 +48,7 @@ func TestNewDeleteHandler(t *testing.T) {
 			userID:         "user123",
 			deleteError:    nil,
 			expectedStatus: http.StatusBadRequest,
-			expectedBody:   "Bad Request\n",
+			expectedBody:   problem.TypeInvalidBody,
 		},
 		{
 			name:           "empty aliases array",
@@ -54,7 +56,7 @@ func TestNewDeleteHandler(t *testing.T) {
 			userID:         "user123",
 			deleteError:    nil,
 			expectedStatus: http.StatusBadRequest,
-			expectedBody:   "Bad Request\n",
+			expectedBody:   problem.TypeInvalidParameter,
 		},
 		{
 			name:           "unauthorized user",
@@ -62,7 +64,7 @@ func TestNewDeleteHandler(t *testing.T) {
 			userID:         "",
 			deleteError:    nil,
 			expectedStatus: http.StatusInternalServerError,
-			expectedBody:   "Internal Server Error\n",
+			expectedBody:   problem.TypeInternal,
 		},
 		{
 			name:           "repository error",
@@ -96,7 +98,7 @@ func TestNewDeleteHandler(t *testing.T) {
 				}
 			}
 
-			handler := NewDeleteHandler(mockRepo)
+			handler := NewDeleteHandler(&config.Config{BaseURL: "http://localhost:8080"}, mockRepo)
 
 			req := httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(tt.requestBody))
 			req.Header.Set("Content-Type", "application/json")
@@ -111,11 +113,11 @@ func TestNewDeleteHandler(t *testing.T) {
 			handler(rr, req)
 
 			assert.Equal(t, tt.expectedStatus, rr.Code)
-			assert.Equal(t, tt.expectedBody, rr.Body.String())
 			if tt.expectedStatus == http.StatusAccepted {
+				assert.Equal(t, tt.expectedBody, rr.Body.String())
 				assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
 			} else {
-				assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+				assertProblem(t, rr, tt.expectedStatus, tt.expectedBody)
 			}
 		})
 	}
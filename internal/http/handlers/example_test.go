@@ -2,10 +2,14 @@ package handlers
 
 import (
 	"fmt"
+	"net/http"
 	"net/http/httptest"
+	"time"
 
 	"github.com/aifedorov/shortener/internal/config"
+	"github.com/aifedorov/shortener/internal/pkg/rules"
 	"github.com/aifedorov/shortener/internal/pkg/validate"
+	"github.com/aifedorov/shortener/internal/pkg/workspace"
 	"github.com/aifedorov/shortener/internal/repository"
 )
 
@@ -89,11 +93,16 @@ func ExampleNewSaveJSONBatchHandler() {
 
 // ExampleNewRedirectHandler demonstrates how to create a redirect handler.
 func ExampleNewRedirectHandler() {
+	// Create a configuration with the server-wide redirect status code
+	cfg := &config.Config{
+		RedirectStatus: http.StatusMovedPermanently,
+	}
+
 	// Create a mock repository
 	repo := &mockRepository{}
 
 	// Create the handler
-	_ = NewRedirectHandler(repo)
+	_ = NewRedirectHandler(cfg, repo)
 
 	// The handler is now ready to redirect short URLs to their original URLs
 	// Note: This handler is available to all users (no authentication required)
@@ -130,11 +139,16 @@ func ExampleNewURLsHandler() {
 
 // ExampleNewDeleteHandler demonstrates how to create a delete handler.
 func ExampleNewDeleteHandler() {
+	// Create configuration
+	cfg := &config.Config{
+		BaseURL: "http://localhost:8080",
+	}
+
 	// Create a mock repository
 	repo := &mockRepository{}
 
 	// Create the handler
-	_ = NewDeleteHandler(repo)
+	_ = NewDeleteHandler(cfg, repo)
 
 	// The handler is now ready to delete user URLs
 	// Note: In a real application, this handler requires user authentication
@@ -202,6 +216,13 @@ func (m *mockRepository) Get(shortURL string) (string, error) {
 	return "", repository.ErrShortURLNotFound
 }
 
+func (m *mockRepository) Resolve(shortURL string) (repository.Link, error) {
+	if url, exists := m.urls[shortURL]; exists {
+		return repository.Link{Alias: shortURL, OriginalURL: url, Clicks: 1}, nil
+	}
+	return repository.Link{}, repository.ErrShortURLNotFound
+}
+
 func (m *mockRepository) GetAll(userID, baseURL string) ([]repository.URLOutput, error) {
 	if urls, exists := m.userURLs[userID]; exists {
 		return urls, nil
@@ -209,7 +230,7 @@ func (m *mockRepository) GetAll(userID, baseURL string) ([]repository.URLOutput,
 	return nil, repository.ErrUserHasNoData
 }
 
-func (m *mockRepository) Store(userID, baseURL, targetURL string) (string, error) {
+func (m *mockRepository) Store(userID, baseURL, targetURL string, opts repository.LinkOptions) (string, error) {
 	shortURL := "abc123"
 	m.urls[shortURL] = targetURL
 	return baseURL + "/" + shortURL, nil
@@ -232,3 +253,121 @@ func (m *mockRepository) DeleteBatch(userID string, aliases []string) error {
 	// Mock implementation - just return success
 	return nil
 }
+
+func (m *mockRepository) GetRules(userID, alias string) ([]rules.Rule, error) {
+	return nil, nil
+}
+
+func (m *mockRepository) SetRules(userID, alias string, linkRules []rules.Rule) error {
+	return nil
+}
+
+func (m *mockRepository) TrackVariant(alias string, variant int) error {
+	return nil
+}
+
+func (m *mockRepository) GetCheckTargets(checkedBefore time.Time, limit int) ([]repository.CheckTarget, error) {
+	return nil, nil
+}
+
+func (m *mockRepository) SaveCheckResult(alias string, result repository.CheckResult) error {
+	return nil
+}
+
+func (m *mockRepository) StoreAPIKey(key repository.APIKey) error {
+	return nil
+}
+
+func (m *mockRepository) GetAPIKeys(userID string) ([]repository.APIKey, error) {
+	return nil, nil
+}
+
+func (m *mockRepository) RevokeAPIKey(userID, keyID string, revokedAt time.Time) error {
+	return nil
+}
+
+func (m *mockRepository) GetAPIKeyUser(keyHash string) (string, error) {
+	return "", repository.ErrAPIKeyNotFound
+}
+
+func (m *mockRepository) CreateUser(user repository.User) error {
+	return nil
+}
+
+func (m *mockRepository) GetUserByLogin(login string) (repository.User, error) {
+	return repository.User{}, repository.ErrUserNotFound
+}
+
+func (m *mockRepository) MergeLinks(fromUserID, toUserID string, mergedAt time.Time) (repository.LinkMerge, error) {
+	return repository.LinkMerge{FromUserID: fromUserID, ToUserID: toUserID, MergedAt: mergedAt}, nil
+}
+
+func (m *mockRepository) CreateWorkspace(ws repository.Workspace, ownerID string) error {
+	return nil
+}
+
+func (m *mockRepository) GetWorkspaces(userID string) ([]repository.UserWorkspace, error) {
+	return nil, nil
+}
+
+func (m *mockRepository) GetMembers(workspaceID string) ([]repository.Member, error) {
+	return nil, repository.ErrWorkspaceNotFound
+}
+
+func (m *mockRepository) GetMemberRole(workspaceID, userID string) (workspace.Role, error) {
+	return "", repository.ErrMemberNotFound
+}
+
+func (m *mockRepository) SetMember(member repository.Member) error {
+	return nil
+}
+
+func (m *mockRepository) RemoveMember(workspaceID, userID string) error {
+	return nil
+}
+
+func (m *mockRepository) GetUserByID(userID string) (repository.User, error) {
+	return repository.User{}, repository.ErrUserNotFound
+}
+
+func (m *mockRepository) SearchLinks(filter repository.LinkFilter, baseURL string) ([]repository.LinkRecord, error) {
+	return nil, nil
+}
+
+func (m *mockRepository) SetLinkDisabled(alias string, statusCode int, reason string, entry repository.AuditEntry) error {
+	return nil
+}
+
+func (m *mockRepository) ReassignLink(alias, ownerID string, entry repository.AuditEntry) (string, error) {
+	return "", nil
+}
+
+func (m *mockRepository) GetOwnerStats() ([]repository.OwnerStats, error) {
+	return nil, nil
+}
+
+func (m *mockRepository) AppendAudit(entry repository.AuditEntry) error {
+	return nil
+}
+
+func (m *mockRepository) GetAuditLog(limit int) ([]repository.AuditEntry, error) {
+	return nil, nil
+}
+
+func (m *mockRepository) AddReport(report repository.Report, threshold int) (bool, error) {
+	return false, nil
+}
+
+func (m *mockRepository) GetReports(status string, limit int) ([]repository.Report, error) {
+	return nil, nil
+}
+
+func (m *mockRepository) ResolveReports(alias, status string, entry repository.AuditEntry) (int, error) {
+	return 0, nil
+}
+
+func (m *mockRepository) SetQuota(quota repository.Quota) {}
+
+func (m *mockRepository) GetUsage(userID string) (repository.Usage, error) {
+	return repository.Usage{}, nil
+}
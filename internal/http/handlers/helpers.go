@@ -3,51 +3,79 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 
+	"github.com/aifedorov/shortener/internal/pkg/rules"
 	"github.com/aifedorov/shortener/internal/pkg/validate"
 	"go.uber.org/zap"
 
 	"github.com/aifedorov/shortener/internal/http/middleware/auth"
 	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/problem"
 	"github.com/aifedorov/shortener/internal/repository"
+	"github.com/aifedorov/shortener/internal/service"
 )
 
-func decodeRequest(r *http.Request) (RequestBody, error) {
+// Problem details shared by the handlers
+const (
+	// detailNotAuthenticated explains a request without a user.
+	detailNotAuthenticated = "request is not authenticated"
+	// detailInvalidCredentials explains a login with an unknown login or a wrong password.
+	detailInvalidCredentials = "invalid login or password"
+)
+
+// errEmptyBody is returned when a request has no body.
+var errEmptyBody = errors.New("request body is empty")
+
+// decodeJSON decodes the JSON body of the request into v.
+// The error describes why the body was rejected, it is meant for the problem detail.
+func decodeJSON(r *http.Request, v interface{}) error {
 	logger.Log.Debug("decoding request body")
-	var body RequestBody
-	err := json.NewDecoder(r.Body).Decode(&body)
+	err := json.NewDecoder(r.Body).Decode(v)
 	if errors.Is(err, io.EOF) {
-		return RequestBody{}, errors.New("request body is empty")
+		return errEmptyBody
 	}
 	if err != nil {
 		logger.Log.Error("failed to decode request", zap.Error(err))
-		return RequestBody{}, errors.New("failed to decode request body")
+		return fmt.Errorf("failed to decode request body: %w", err)
+	}
+	return nil
+}
+
+func decodeRequest(r *http.Request) (RequestBody, error) {
+	var body RequestBody
+	if err := decodeJSON(r, &body); err != nil {
+		return RequestBody{}, err
 	}
 	return body, nil
 }
 
 func decodeBatchRequest(r *http.Request) ([]BatchRequest, error) {
-	logger.Log.Debug("decoding request body")
 	var urls []BatchRequest
-	if err := json.NewDecoder(r.Body).Decode(&urls); err != nil {
-		logger.Log.Error("failed to decode request", zap.Error(err))
-		return nil, errors.New("failed to decode request body")
+	if err := decodeJSON(r, &urls); err != nil {
+		return nil, err
 	}
 	return urls, nil
 }
 
 func decodeAliasesRequest(r *http.Request) ([]string, error) {
-	logger.Log.Debug("decoding request body")
 	var aliases []string
-	if err := json.NewDecoder(r.Body).Decode(&aliases); err != nil {
-		logger.Log.Error("failed to decode request", zap.Error(err))
-		return nil, errors.New("failed to decode request body")
+	if err := decodeJSON(r, &aliases); err != nil {
+		return nil, err
 	}
 	return aliases, nil
 }
 
+func decodeRulesRequest(r *http.Request) ([]rules.Rule, error) {
+	var linkRules []rules.Rule
+	if err := decodeJSON(r, &linkRules); err != nil {
+		return nil, err
+	}
+	return linkRules, nil
+}
+
 func encodeResponse(rw http.ResponseWriter, resURL string) error {
 	logger.Log.Debug("encoding response")
 	encoder := json.NewEncoder(rw)
@@ -62,7 +90,7 @@ func encodeResponse(rw http.ResponseWriter, resURL string) error {
 	return nil
 }
 
-func encodeBatchResponse(rw http.ResponseWriter, urls []repository.BatchURLOutput) error {
+func encodeBatchResponse(rw http.ResponseWriter, urls []service.BatchLink) error {
 	logger.Log.Debug("encoding response")
 	encoder := json.NewEncoder(rw)
 	resp := make([]BatchResponse, len(urls))
@@ -70,6 +98,10 @@ func encodeBatchResponse(rw http.ResponseWriter, urls []repository.BatchURLOutpu
 		r := BatchResponse{
 			CID:      urls[url].CID,
 			ShortURL: urls[url].ShortURL,
+			Status:   batchResult(urls[url]),
+		}
+		if urls[url].Err != nil {
+			r.Error = urls[url].Err.Error()
 		}
 		resp[url] = r
 	}
@@ -81,39 +113,98 @@ func encodeBatchResponse(rw http.ResponseWriter, urls []repository.BatchURLOutpu
 	return nil
 }
 
+// batchResult returns the outcome of a batch item: created, existing or invalid.
+func batchResult(link service.BatchLink) string {
+	switch {
+	case link.Err != nil:
+		return batchResultInvalid
+	case link.Existing:
+		return batchResultExisting
+	default:
+		return batchResultCreated
+	}
+}
+
 func encodeURLsResponse(rw http.ResponseWriter, urls []repository.URLOutput) error {
 	logger.Log.Debug("encoding response")
 	encoder := json.NewEncoder(rw)
-	resp := make([]repository.URLOutput, len(urls))
-	for i, url := range urls {
-		r := repository.URLOutput{
-			ShortURL:    url.ShortURL,
-			OriginalURL: url.OriginalURL,
-		}
-		resp[i] = r
+	if urls == nil {
+		urls = []repository.URLOutput{}
 	}
 
-	if err := encoder.Encode(resp); err != nil {
+	if err := encoder.Encode(urls); err != nil {
 		logger.Log.Error("failed to encode response", zap.Error(err))
 		return errors.New("failed to encode response")
 	}
 	return nil
 }
 
-func validateURLs(reqURLs []BatchRequest, urlChecker validate.URLChecker) ([]repository.BatchURLInput, error) {
-	logger.Log.Debug("validating url")
-	var urls = make([]repository.BatchURLInput, len(reqURLs))
-	for i, reqBodyURL := range reqURLs {
-		if err := urlChecker.CheckURL(reqBodyURL.OriginalURL); err != nil {
-			logger.Log.Error("invalid url", zap.String("url", reqBodyURL.OriginalURL), zap.Error(err))
-			return nil, errors.New("invalid url")
-		}
-		urls[i] = repository.BatchURLInput{
-			CID:         reqBodyURL.CID,
-			OriginalURL: reqBodyURL.OriginalURL,
-		}
+func encodeRulesResponse(rw http.ResponseWriter, linkRules []rules.Rule) error {
+	logger.Log.Debug("encoding response")
+	if linkRules == nil {
+		linkRules = []rules.Rule{}
 	}
-	return urls, nil
+	if err := json.NewEncoder(rw).Encode(linkRules); err != nil {
+		logger.Log.Error("failed to encode response", zap.Error(err))
+		return errors.New("failed to encode response")
+	}
+	return nil
+}
+
+// resolveURL validates the URL and returns the URL to store.
+// Checkers implementing validate.URLResolver may replace a shortener link with its final destination.
+func resolveURL(urlChecker validate.URLChecker, rawURL string) (string, error) {
+	if resolver, ok := urlChecker.(validate.URLResolver); ok {
+		return resolver.ResolveURL(rawURL)
+	}
+	return rawURL, urlChecker.CheckURL(rawURL)
+}
+
+// writeURLError responds to a request with a rejected URL or invalid link options.
+// URLs rejected by the domain policy are answered with 422, malformed URLs and invalid options with 400,
+// the problem detail gives the reason.
+func writeURLError(rw http.ResponseWriter, r *http.Request, err error) {
+	var pErr *validate.PolicyError
+	if errors.As(err, &pErr) {
+		logger.Log.Info("url rejected by domain policy", zap.String("host", pErr.Host), zap.Error(err))
+		problem.WriteError(rw, r, err)
+		return
+	}
+	var uErr *validate.URLError
+	if errors.As(err, &uErr) {
+		logger.Log.Info("invalid url", zap.Error(err))
+		problem.WriteError(rw, r, err)
+		return
+	}
+	logger.Log.Info("invalid link options", zap.Error(err))
+	problem.Write(rw, r, problem.InvalidParameter(err.Error()))
+}
+
+// writeLinkError responds to a failed operation of the link service.
+// Rejected input is answered like writeURLError, exceeded quotas with the quota problem and other failures with 500.
+func writeLinkError(rw http.ResponseWriter, r *http.Request, err error) {
+	if writeQuotaError(rw, r, err) {
+		return
+	}
+	var iErr *service.InvalidError
+	if errors.As(err, &iErr) {
+		writeURLError(rw, r, err)
+		return
+	}
+	logger.Log.Error("link operation failed", zap.Error(err))
+	problem.Write(rw, r, problem.Internal())
+}
+
+// isAccountSession reports whether the request comes from the session of a registered account.
+func isAccountSession(r *http.Request) bool {
+	account, _ := r.Context().Value(auth.AccountKey).(bool)
+	return account
+}
+
+// isAPIKeyRequest reports whether the request was authenticated with an API key.
+func isAPIKeyRequest(r *http.Request) bool {
+	apiKey, _ := r.Context().Value(auth.APIKeyKey).(bool)
+	return apiKey
 }
 
 func getUserID(r *http.Request) (string, error) {
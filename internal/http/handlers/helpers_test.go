@@ -2,16 +2,14 @@ package handlers
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/aifedorov/shortener/internal/http/middleware/auth"
-	"github.com/aifedorov/shortener/internal/mocks"
-	"github.com/aifedorov/shortener/internal/repository"
-	"github.com/golang/mock/gomock"
+	"github.com/aifedorov/shortener/internal/http/problem"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -210,63 +208,16 @@ func TestGetUserID(t *testing.T) {
 	}
 }
 
-func TestValidateURLs(t *testing.T) {
-	tests := []struct {
-		name        string
-		reqURLs     []BatchRequest
-		checkError  error
-		expected    []repository.BatchURLInput
-		expectError bool
-	}{
-		{
-			name: "valid URLs",
-			reqURLs: []BatchRequest{
-				{CID: "1", OriginalURL: "https://example.com"},
-				{CID: "2", OriginalURL: "https://google.com"},
-			},
-			checkError: nil,
-			expected: []repository.BatchURLInput{
-				{CID: "1", OriginalURL: "https://example.com"},
-				{CID: "2", OriginalURL: "https://google.com"},
-			},
-			expectError: false,
-		},
-		{
-			name: "invalid URL",
-			reqURLs: []BatchRequest{
-				{CID: "1", OriginalURL: "invalid-url"},
-			},
-			checkError:  errors.New("invalid URL"),
-			expected:    nil,
-			expectError: true,
-		},
-		{
-			name:        "empty URLs",
-			reqURLs:     []BatchRequest{},
-			checkError:  nil,
-			expected:    []repository.BatchURLInput{},
-			expectError: false,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			ctrl := gomock.NewController(t)
-			defer ctrl.Finish()
-
-			mockURLChecker := mocks.NewMockURLChecker(ctrl)
-			for _, reqURL := range tt.reqURLs {
-				mockURLChecker.EXPECT().CheckURL(reqURL.OriginalURL).Return(tt.checkError)
-			}
-
-			result, err := validateURLs(tt.reqURLs, mockURLChecker)
-
-			if tt.expectError {
-				assert.Error(t, err)
-			} else {
-				assert.NoError(t, err)
-				assert.Equal(t, tt.expected, result)
-			}
-		})
+// assertProblem asserts that the response holds a problem of the type answered with the status code.
+func assertProblem(t *testing.T, rr *httptest.ResponseRecorder, status int, typ string) {
+	t.Helper()
+
+	assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+	var p problem.Problem
+	if assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p)) {
+		assert.Equal(t, typ, p.Type)
+		assert.Equal(t, status, p.Status)
+		assert.NotEmpty(t, p.Title)
+		assert.NotEmpty(t, p.Instance)
 	}
 }
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+)
+
+// interstitialTemplate is the warning page served instead of the redirect of a quarantined link.
+var interstitialTemplate = template.Must(template.New("interstitial").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Warning: suspicious link</title>
+</head>
+<body>
+<h1>This link has been reported as suspicious</h1>
+<p>Visitors reported the short link <strong>{{.Alias}}</strong> as phishing, spam or otherwise harmful.
+It is under review and may lead to a page that tries to steal your passwords or personal data.</p>
+<p>It points to:</p>
+<p><code>{{.Target}}</code></p>
+<p><a href="{{.Target}}" rel="noopener noreferrer nofollow">Continue to the site anyway</a></p>
+</body>
+</html>
+`))
+
+// writeInterstitial writes the warning page of a quarantined link with a link to the target.
+// The page must not be cached, the visitor is redirected once the quarantine is lifted.
+func writeInterstitial(rw http.ResponseWriter, alias, target string) {
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("X-Robots-Tag", "noindex")
+
+	logger.Log.Debug("sending HTTP 200 response")
+	rw.WriteHeader(http.StatusOK)
+	data := struct {
+		Alias  string
+		Target string
+	}{Alias: alias, Target: target}
+	if err := interstitialTemplate.Execute(rw, data); err != nil {
+		logger.Log.Error("redirect: failed to render interstitial", zap.String("alias", alias), zap.Error(err))
+	}
+}
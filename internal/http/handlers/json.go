@@ -1,60 +1,65 @@
 package handlers
 
 import (
-	"errors"
 	"net/http"
 
 	"github.com/aifedorov/shortener/internal/config"
 	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/problem"
 	"github.com/aifedorov/shortener/internal/pkg/validate"
+	"github.com/aifedorov/shortener/internal/pkg/workspace"
 	"github.com/aifedorov/shortener/internal/repository"
+	"github.com/aifedorov/shortener/internal/service"
 )
 
 // NewSaveJSONHandler creates a new HTTP handler for single URL shortening operations via JSON.
 // This handler requires user authentication. If the user is not authenticated, a cookie will be created for them.
 // It accepts a JSON request with a URL and returns a JSON response with the shortened URL.
+// The workspace query parameter stores the link in a workspace, it requires the editor or owner role.
+// Links over the quota of the owner are rejected with a JSON description of the exceeded quota.
 func NewSaveJSONHandler(config *config.Config, repo repository.Repository, urlChecker validate.URLChecker) http.HandlerFunc {
+	links := service.NewLinks(config, repo, urlChecker)
 	return func(rw http.ResponseWriter, r *http.Request) {
 		rw.Header().Set("Content-Type", "application/json")
 
 		userID, err := getUserID(r)
 		if err != nil {
-			http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			problem.Write(rw, r, problem.Unauthorized(detailNotAuthenticated))
 			return
 		}
 
-		body, err := decodeRequest(r)
+		ownerID, err := linkOwner(r, repo, userID, workspace.PermissionWrite)
 		if err != nil {
-			http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			writeWorkspaceError(rw, r, err)
 			return
 		}
 
-		if err := urlChecker.CheckURL(body.URL); err != nil {
-			http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		body, err := decodeRequest(r)
+		if err != nil {
+			problem.Write(rw, r, problem.InvalidBody(err.Error()))
 			return
 		}
 
-		resURL, err := repo.Store(userID, config.BaseURL, body.URL)
-		var cErr *repository.ConflictError
-		if errors.As(err, &cErr) {
+		link, err := links.Shorten(ownerID, body.URL, body.options())
+		if err != nil {
+			writeLinkError(rw, r, err)
+			return
+		}
+		if link.Existing {
 			logger.Log.Debug("sending HTTP 409 response")
 			rw.WriteHeader(http.StatusConflict)
 
-			if err := encodeResponse(rw, cErr.ShortURL); err != nil {
-				http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			if err := encodeResponse(rw, link.ShortURL); err != nil {
+				problem.Write(rw, r, problem.Internal())
 				return
 			}
 			return
 		}
-		if err != nil {
-			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		}
 
 		logger.Log.Debug("sending HTTP 201 response")
 		rw.WriteHeader(http.StatusCreated)
-		if err := encodeResponse(rw, resURL); err != nil {
-			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		if err := encodeResponse(rw, link.ShortURL); err != nil {
+			problem.Write(rw, r, problem.Internal())
 			return
 		}
 	}
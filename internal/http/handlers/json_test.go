@@ -11,7 +11,10 @@ import (
 
 	"github.com/aifedorov/shortener/internal/config"
 	"github.com/aifedorov/shortener/internal/http/middleware/auth"
+	"github.com/aifedorov/shortener/internal/http/problem"
 	"github.com/aifedorov/shortener/internal/mocks"
+	"github.com/aifedorov/shortener/internal/pkg/split"
+	"github.com/aifedorov/shortener/internal/pkg/validate"
 	"github.com/aifedorov/shortener/internal/repository"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -43,7 +46,7 @@ func TestNewSaveJSONHandler(t *testing.T) {
 			urlCheckerErr:  nil,
 			storeErr:       nil,
 			expectedStatus: http.StatusBadRequest,
-			expectedBody:   "Bad Request\n",
+			expectedBody:   problem.TypeInvalidBody,
 		},
 		{
 			name:           "empty request body",
@@ -52,7 +55,7 @@ func TestNewSaveJSONHandler(t *testing.T) {
 			urlCheckerErr:  nil,
 			storeErr:       nil,
 			expectedStatus: http.StatusBadRequest,
-			expectedBody:   "Bad Request\n",
+			expectedBody:   problem.TypeInvalidBody,
 		},
 		{
 			name:           "invalid URL",
@@ -61,7 +64,25 @@ func TestNewSaveJSONHandler(t *testing.T) {
 			urlCheckerErr:  errors.New("invalid URL"),
 			storeErr:       nil,
 			expectedStatus: http.StatusBadRequest,
-			expectedBody:   "Bad Request\n",
+			expectedBody:   problem.TypeInvalidParameter,
+		},
+		{
+			name:           "malformed URL",
+			requestBody:    `{"url": "see https://example.com"}`,
+			userID:         "user123",
+			urlCheckerErr:  &validate.URLError{Err: validate.ErrMalformedURL, Detail: "contains invalid characters"},
+			storeErr:       nil,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   problem.TypeInvalidURL,
+		},
+		{
+			name:           "host not allowed by domain policy",
+			requestBody:    `{"url": "https://google.com"}`,
+			userID:         "user123",
+			urlCheckerErr:  &validate.PolicyError{Host: "google.com", Err: validate.ErrHostNotAllowed},
+			storeErr:       nil,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   problem.TypeBlockedURL,
 		},
 		{
 			name:           "unauthorized user",
@@ -70,7 +91,7 @@ func TestNewSaveJSONHandler(t *testing.T) {
 			urlCheckerErr:  nil,
 			storeErr:       nil,
 			expectedStatus: http.StatusUnauthorized,
-			expectedBody:   "Unauthorized\n",
+			expectedBody:   problem.TypeUnauthorized,
 		},
 		{
 			name:           "conflict error",
@@ -88,7 +109,7 @@ func TestNewSaveJSONHandler(t *testing.T) {
 			urlCheckerErr:  nil,
 			storeErr:       errors.New("database error"),
 			expectedStatus: http.StatusInternalServerError,
-			expectedBody:   "Internal Server Error\n",
+			expectedBody:   problem.TypeInternal,
 		},
 		{
 			name:           "empty URL in JSON",
@@ -97,7 +118,16 @@ func TestNewSaveJSONHandler(t *testing.T) {
 			urlCheckerErr:  errors.New("empty URL"),
 			storeErr:       nil,
 			expectedStatus: http.StatusBadRequest,
-			expectedBody:   "Bad Request\n",
+			expectedBody:   problem.TypeInvalidParameter,
+		},
+		{
+			name:           "one-time link",
+			requestBody:    `{"url": "https://example.com", "max_clicks": 1}`,
+			userID:         "user123",
+			urlCheckerErr:  nil,
+			storeErr:       nil,
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `{"result":"http://localhost:8080/abc123"}`,
 		},
 		{
 			name:           "missing URL field",
@@ -128,7 +158,7 @@ func TestNewSaveJSONHandler(t *testing.T) {
 					if err := json.Unmarshal([]byte(tt.requestBody), &reqBody); err == nil {
 						mockURLChecker.EXPECT().CheckURL(reqBody.URL).Return(tt.urlCheckerErr)
 						if tt.urlCheckerErr == nil {
-							mockRepo.EXPECT().Store(tt.userID, cfg.BaseURL, reqBody.URL).Return("http://localhost:8080/abc123", tt.storeErr)
+							mockRepo.EXPECT().Store(tt.userID, cfg.BaseURL, reqBody.URL, repository.LinkOptions{MaxClicks: reqBody.MaxClicks}).Return("http://localhost:8080/abc123", tt.storeErr)
 						}
 					}
 				} else if strings.Contains(tt.requestBody, `"url": "invalid-url"`) {
@@ -137,7 +167,7 @@ func TestNewSaveJSONHandler(t *testing.T) {
 					mockURLChecker.EXPECT().CheckURL("").Return(tt.urlCheckerErr)
 				} else if tt.requestBody == `{}` {
 					mockURLChecker.EXPECT().CheckURL("").Return(nil)
-					mockRepo.EXPECT().Store(tt.userID, cfg.BaseURL, "").Return("http://localhost:8080/abc123", tt.storeErr)
+					mockRepo.EXPECT().Store(tt.userID, cfg.BaseURL, "", repository.LinkOptions{}).Return("http://localhost:8080/abc123", tt.storeErr)
 				}
 			}
 
@@ -156,16 +186,152 @@ func TestNewSaveJSONHandler(t *testing.T) {
 			handler(rr, req)
 
 			assert.Equal(t, tt.expectedStatus, rr.Code)
-			if strings.HasPrefix(tt.expectedBody, "{") {
-				assert.JSONEq(t, tt.expectedBody, rr.Body.String())
-			} else {
-				assert.Equal(t, tt.expectedBody, rr.Body.String())
-			}
 			if tt.expectedStatus == http.StatusCreated || tt.expectedStatus == http.StatusConflict {
+				assert.JSONEq(t, tt.expectedBody, rr.Body.String())
 				assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
 			} else {
-				assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+				assertProblem(t, rr, tt.expectedStatus, tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestNewSaveJSONHandler_NegativeMaxClicks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := &config.Config{
+		BaseURL: "http://localhost:8080",
+	}
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockURLChecker := mocks.NewMockURLChecker(ctrl)
+	mockURLChecker.EXPECT().CheckURL("https://example.com").Return(nil)
+
+	handler := NewSaveJSONHandler(cfg, mockRepo, mockURLChecker)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url": "https://example.com", "max_clicks": -1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserIDKey, "user123"))
+
+	rr := httptest.NewRecorder()
+
+	handler(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assertProblem(t, rr, http.StatusBadRequest, problem.TypeInvalidParameter)
+}
+
+func TestNewSaveJSONHandler_RedirectStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		expectStore    bool
+		expectedStatus int
+	}{
+		{
+			name:           "permanent redirect",
+			requestBody:    `{"url": "https://example.com", "redirect_status": 301}`,
+			expectStore:    true,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "unsupported status",
+			requestBody:    `{"url": "https://example.com", "redirect_status": 200}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cfg := &config.Config{
+				BaseURL: "http://localhost:8080",
+			}
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			mockURLChecker := mocks.NewMockURLChecker(ctrl)
+			mockURLChecker.EXPECT().CheckURL("https://example.com").Return(nil)
+			if tt.expectStore {
+				opts := repository.LinkOptions{RedirectStatus: http.StatusMovedPermanently}
+				mockRepo.EXPECT().Store("user123", cfg.BaseURL, "https://example.com", opts).Return("http://localhost:8080/abc123", nil)
 			}
+
+			handler := NewSaveJSONHandler(cfg, mockRepo, mockURLChecker)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			req = req.WithContext(context.WithValue(req.Context(), auth.UserIDKey, "user123"))
+
+			rr := httptest.NewRecorder()
+
+			handler(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestNewSaveJSONHandler_Variants(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		expectStore    bool
+		expectedStatus int
+	}{
+		{
+			name:           "split link",
+			requestBody:    `{"url": "https://example.com", "variants": [{"url": "https://a.example.com", "weight": 1, "clicks": 10}, {"url": "https://b.example.com", "weight": 3}]}`,
+			expectStore:    true,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "single variant",
+			requestBody:    `{"url": "https://example.com", "variants": [{"url": "https://a.example.com", "weight": 1}]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "zero weight",
+			requestBody:    `{"url": "https://example.com", "variants": [{"url": "https://a.example.com", "weight": 1}, {"url": "https://b.example.com", "weight": 0}]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cfg := &config.Config{
+				BaseURL: "http://localhost:8080",
+			}
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			mockURLChecker := mocks.NewMockURLChecker(ctrl)
+			mockURLChecker.EXPECT().CheckURL(gomock.Any()).Return(nil).AnyTimes()
+			if tt.expectStore {
+				opts := repository.LinkOptions{
+					Variants: []split.Variant{
+						{URL: "https://a.example.com", Weight: 1},
+						{URL: "https://b.example.com", Weight: 3},
+					},
+				}
+				mockRepo.EXPECT().Store("user123", cfg.BaseURL, "https://example.com", opts).Return("http://localhost:8080/abc123", nil)
+			}
+
+			handler := NewSaveJSONHandler(cfg, mockRepo, mockURLChecker)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			req = req.WithContext(context.WithValue(req.Context(), auth.UserIDKey, "user123"))
+
+			rr := httptest.NewRecorder()
+
+			handler(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
 		})
 	}
 }
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/aifedorov/shortener/internal/config"
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/problem"
+	"github.com/aifedorov/shortener/internal/pkg/validate"
+	"github.com/aifedorov/shortener/internal/pkg/workspace"
+	"github.com/aifedorov/shortener/internal/repository"
+	"github.com/aifedorov/shortener/internal/service"
+)
+
+// NewCreateLinkHandler creates a new HTTP handler for creating a link through the v2 API.
+// This handler requires user authentication. If the user is not authenticated, a cookie will be created for them.
+// It answers a new link with 201 and a URL shortened before with 200 and its existing link.
+// The workspace query parameter stores the link in a workspace, it requires the editor or owner role.
+func NewCreateLinkHandler(cfg *config.Config, repo repository.Repository, urlChecker validate.URLChecker) http.HandlerFunc {
+	links := service.NewLinks(cfg, repo, urlChecker)
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		userID, err := getUserID(r)
+		if err != nil {
+			problem.Write(rw, r, problem.Unauthorized(detailNotAuthenticated))
+			return
+		}
+
+		var req LinkRequest
+		if err := decodeJSON(r, &req); err != nil {
+			problem.Write(rw, r, problem.InvalidBody(err.Error()))
+			return
+		}
+
+		ownerID, err := linkOwner(r, repo, userID, workspace.PermissionWrite)
+		if err != nil {
+			writeWorkspaceError(rw, r, err)
+			return
+		}
+
+		link, err := links.Shorten(ownerID, req.URL, req.options())
+		if err != nil {
+			writeLinkError(rw, r, err)
+			return
+		}
+
+		status := http.StatusCreated
+		if link.Existing {
+			status = http.StatusOK
+		}
+		writeData(rw, status, newLinkResponse(links, link))
+	}
+}
+
+// NewCreateLinksBatchHandler creates a new HTTP handler for creating several links through the v2 API.
+// This handler requires user authentication. If the user is not authenticated, a cookie will be created for them.
+// It answers with 200 and the result of every item in the order of the request: created, existing or invalid.
+// Invalid items carry the problem they were rejected with and do not fail the batch.
+// Batches over the size quota are rejected with 403, batches exceeding a link quota store no links.
+// The workspace query parameter stores the links in a workspace, it requires the editor or owner role.
+func NewCreateLinksBatchHandler(cfg *config.Config, repo repository.Repository, urlChecker validate.URLChecker) http.HandlerFunc {
+	links := service.NewLinks(cfg, repo, urlChecker)
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		userID, err := getUserID(r)
+		if err != nil {
+			problem.Write(rw, r, problem.Unauthorized(detailNotAuthenticated))
+			return
+		}
+
+		var req LinkBatchRequest
+		if err := decodeJSON(r, &req); err != nil {
+			problem.Write(rw, r, problem.InvalidBody(err.Error()))
+			return
+		}
+		if len(req.Items) == 0 {
+			problem.Write(rw, r, problem.InvalidParameter("items must not be empty"))
+			return
+		}
+		if writeQuotaError(rw, r, links.CheckBatchSize(len(req.Items))) {
+			return
+		}
+
+		ownerID, err := linkOwner(r, repo, userID, workspace.PermissionWrite)
+		if err != nil {
+			writeWorkspaceError(rw, r, err)
+			return
+		}
+
+		items := make([]service.BatchItem, len(req.Items))
+		for i, item := range req.Items {
+			items[i] = service.BatchItem{CID: item.CID, URL: item.URL, Options: item.options()}
+		}
+		stored, err := links.ShortenBatch(ownerID, items)
+		if err != nil {
+			writeLinkError(rw, r, err)
+			return
+		}
+
+		res := make([]LinkBatchResult, len(stored))
+		for i, link := range stored {
+			res[i] = LinkBatchResult{
+				CID:    link.CID,
+				Result: batchResult(link),
+			}
+			if link.Err != nil {
+				res[i].Error = problem.FromError(link.Err)
+				continue
+			}
+			linkResp := newLinkResponse(links, link.Link)
+			res[i].Link = &linkResp
+		}
+		writeData(rw, http.StatusOK, res)
+	}
+}
+
+// NewListLinksHandler creates a new HTTP handler for listing links through the v2 API.
+// This handler requires user authentication. If the user is not authenticated, a cookie will be created for them.
+// It answers with 200 and the links of the user, the list is empty if the user has none.
+// The status=broken query parameter limits the list to links whose latest dead-link check failed.
+// The workspace query parameter lists the links of a workspace instead, any member may list them.
+func NewListLinksHandler(cfg *config.Config, repo repository.Repository) http.HandlerFunc {
+	links := service.NewLinks(cfg, repo, nil)
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		userID, err := getUserID(r)
+		if err != nil {
+			problem.Write(rw, r, problem.Unauthorized(detailNotAuthenticated))
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		if status != "" && status != statusFilterBroken {
+			logger.Log.Info("unsupported status filter", zap.String("status", status))
+			problem.Write(rw, r, problem.InvalidParameter("status must be broken"))
+			return
+		}
+
+		ownerID, err := linkOwner(r, repo, userID, workspace.PermissionRead)
+		if err != nil {
+			writeWorkspaceError(rw, r, err)
+			return
+		}
+
+		urls, err := links.List(ownerID, status == statusFilterBroken)
+		if err != nil && !errors.Is(err, repository.ErrUserHasNoData) {
+			logger.Log.Error("error fetching urls", zap.Error(err))
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+
+		res := make([]LinkResponse, len(urls))
+		for i, u := range urls {
+			res[i] = LinkResponse{
+				Alias:          links.Alias(u.ShortURL),
+				ShortURL:       u.ShortURL,
+				OriginalURL:    u.OriginalURL,
+				SubmittedURL:   u.SubmittedURL,
+				Variants:       u.Variants,
+				RedirectStatus: u.RedirectStatus,
+				LastStatus:     u.LastStatus,
+				CheckedAt:      u.CheckedAt,
+			}
+		}
+		writeData(rw, http.StatusOK, res)
+	}
+}
+
+// NewDeleteLinksHandler creates a new HTTP handler for deleting links through the v2 API.
+// This handler requires user authentication. If the user is not authenticated, a cookie will be created for them.
+// It accepts a JSON object with the aliases of the links, marks them as deleted asynchronously and answers with 202.
+// The workspace query parameter deletes links of a workspace instead, it requires the editor or owner role.
+func NewDeleteLinksHandler(cfg *config.Config, repo repository.Repository) http.HandlerFunc {
+	links := service.NewLinks(cfg, repo, nil)
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		userID, err := getUserID(r)
+		if err != nil {
+			problem.Write(rw, r, problem.Unauthorized(detailNotAuthenticated))
+			return
+		}
+
+		var req DeleteLinksRequest
+		if err := decodeJSON(r, &req); err != nil {
+			problem.Write(rw, r, problem.InvalidBody(err.Error()))
+			return
+		}
+		if len(req.Aliases) == 0 {
+			problem.Write(rw, r, problem.InvalidParameter("aliases must not be empty"))
+			return
+		}
+
+		ownerID, err := linkOwner(r, repo, userID, workspace.PermissionWrite)
+		if err != nil {
+			writeWorkspaceError(rw, r, err)
+			return
+		}
+
+		links.Delete(ownerID, req.Aliases)
+
+		logger.Log.Debug("sending HTTP 202 response")
+		rw.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// newLinkResponse describes a link created or found by the link service.
+func newLinkResponse(links *service.Links, link service.Link) LinkResponse {
+	return LinkResponse{
+		Alias:       links.Alias(link.ShortURL),
+		ShortURL:    link.ShortURL,
+		OriginalURL: link.OriginalURL,
+	}
+}
+
+// writeData writes the data wrapped into the envelope of the v2 API with the status code.
+func writeData(rw http.ResponseWriter, status int, data interface{}) {
+	logger.Log.Debug("sending HTTP response", zap.Int("status", status))
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(DataResponse{Data: data}); err != nil {
+		logger.Log.Error("failed to encode response", zap.Error(err))
+		return
+	}
+}
@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aifedorov/shortener/internal/config"
+	"github.com/aifedorov/shortener/internal/http/middleware/auth"
+	"github.com/aifedorov/shortener/internal/http/problem"
+	"github.com/aifedorov/shortener/internal/mocks"
+	"github.com/aifedorov/shortener/internal/pkg/validate"
+	"github.com/aifedorov/shortener/internal/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// newLinksRequest creates a v2 API request of the user, an empty user ID leaves the request unauthenticated.
+func newLinksRequest(method, path, body, userID string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if userID != "" {
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserIDKey, userID))
+	}
+	return req
+}
+
+func TestNewCreateLinkHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		userID         string
+		checkErr       error
+		expectStore    bool
+		storeURL       string
+		storeErr       error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "created",
+			requestBody:    `{"url": "https://example.com"}`,
+			userID:         "user123",
+			expectStore:    true,
+			storeURL:       "http://localhost:8080/abc123",
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `{"data":{"alias":"abc123","short_url":"http://localhost:8080/abc123","original_url":"https://example.com"}}`,
+		},
+		{
+			name:           "existing",
+			requestBody:    `{"url": "https://example.com"}`,
+			userID:         "user123",
+			expectStore:    true,
+			storeErr:       repository.NewConflictError("http://localhost:8080/old123", repository.ErrURLExists),
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":{"alias":"old123","short_url":"http://localhost:8080/old123","original_url":"https://example.com"}}`,
+		},
+		{
+			name:           "invalid url",
+			requestBody:    `{"url": "not a url"}`,
+			userID:         "user123",
+			checkErr:       &validate.URLError{Err: validate.ErrMalformedURL},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   problem.TypeInvalidURL,
+		},
+		{
+			name:           "invalid options",
+			requestBody:    `{"url": "https://example.com", "max_clicks": -1}`,
+			userID:         "user123",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   problem.TypeInvalidParameter,
+		},
+		{
+			name:           "invalid JSON",
+			requestBody:    `{"url": `,
+			userID:         "user123",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   problem.TypeInvalidBody,
+		},
+		{
+			name:           "unauthorized user",
+			requestBody:    `{"url": "https://example.com"}`,
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   problem.TypeUnauthorized,
+		},
+		{
+			name:           "repository error",
+			requestBody:    `{"url": "https://example.com"}`,
+			userID:         "user123",
+			expectStore:    true,
+			storeErr:       errors.New("database error"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   problem.TypeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cfg := &config.Config{BaseURL: "http://localhost:8080"}
+			mockRepo := mocks.NewMockRepository(ctrl)
+			mockURLChecker := mocks.NewMockURLChecker(ctrl)
+			mockURLChecker.EXPECT().CheckURL(gomock.Any()).Return(tt.checkErr).AnyTimes()
+			if tt.expectStore {
+				mockRepo.EXPECT().Store(tt.userID, cfg.BaseURL, "https://example.com", repository.LinkOptions{}).
+					Return(tt.storeURL, tt.storeErr)
+			}
+
+			handler := NewCreateLinkHandler(cfg, mockRepo, mockURLChecker)
+			rr := httptest.NewRecorder()
+			handler(rr, newLinksRequest(http.MethodPost, "/api/v2/links", tt.requestBody, tt.userID))
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus < http.StatusBadRequest {
+				assert.JSONEq(t, tt.expectedBody, rr.Body.String())
+				assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			} else {
+				assertProblem(t, rr, tt.expectedStatus, tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestNewCreateLinksBatchHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		userID         string
+		maxBatchSize   int
+		checkErrs      map[string]error
+		storeURLs      []repository.BatchURLInput
+		stored         []repository.BatchURLOutput
+		storeErr       error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:        "created and existing",
+			requestBody: `{"items": [{"correlation_id": "1", "url": "https://example.com"}, {"correlation_id": "2", "url": "https://google.com"}]}`,
+			userID:      "user123",
+			storeURLs: []repository.BatchURLInput{
+				{CID: "1", OriginalURL: "https://example.com"},
+				{CID: "2", OriginalURL: "https://google.com"},
+			},
+			stored: []repository.BatchURLOutput{
+				{CID: "1", ShortURL: "http://localhost:8080/abc1"},
+				{CID: "2", ShortURL: "http://localhost:8080/old2", Existing: true},
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"data":[
+				{"correlation_id":"1","result":"created","link":{"alias":"abc1","short_url":"http://localhost:8080/abc1","original_url":"https://example.com"}},
+				{"correlation_id":"2","result":"existing","link":{"alias":"old2","short_url":"http://localhost:8080/old2","original_url":"https://google.com"}}
+			]}`,
+		},
+		{
+			name:           "empty items",
+			requestBody:    `{"items": []}`,
+			userID:         "user123",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   problem.TypeInvalidParameter,
+		},
+		{
+			name:           "batch too large",
+			requestBody:    `{"items": [{"correlation_id": "1", "url": "https://example.com"}, {"correlation_id": "2", "url": "https://google.com"}]}`,
+			userID:         "user123",
+			maxBatchSize:   1,
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   problem.TypeQuotaExceeded,
+		},
+		{
+			name:        "invalid items",
+			requestBody: `{"items": [{"correlation_id": "1", "url": "not a url"}, {"correlation_id": "2", "url": "https://evil.com"}, {"correlation_id": "3", "url": "https://google.com"}]}`,
+			userID:      "user123",
+			checkErrs: map[string]error{
+				"not a url":        &validate.URLError{Err: validate.ErrMalformedURL},
+				"https://evil.com": &validate.PolicyError{Host: "evil.com", Err: validate.ErrHostDenied},
+			},
+			storeURLs: []repository.BatchURLInput{
+				{CID: "3", OriginalURL: "https://google.com"},
+			},
+			stored: []repository.BatchURLOutput{
+				{CID: "3", ShortURL: "http://localhost:8080/abc3"},
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"data":[
+				{"correlation_id":"1","result":"invalid","error":{"type":"urn:shortener:problem:invalid-url","title":"Invalid URL","status":400,"detail":"url is malformed"}},
+				{"correlation_id":"2","result":"invalid","error":{"type":"urn:shortener:problem:blocked-url","title":"URL blocked by policy","status":422,"detail":"host is denied: evil.com"}},
+				{"correlation_id":"3","result":"created","link":{"alias":"abc3","short_url":"http://localhost:8080/abc3","original_url":"https://google.com"}}
+			]}`,
+		},
+		{
+			name:        "quota exceeded",
+			requestBody: `{"items": [{"correlation_id": "1", "url": "https://example.com"}, {"correlation_id": "2", "url": "https://google.com"}]}`,
+			userID:      "user123",
+			storeURLs: []repository.BatchURLInput{
+				{CID: "1", OriginalURL: "https://example.com"},
+				{CID: "2", OriginalURL: "https://google.com"},
+			},
+			storeErr:       &repository.QuotaError{Quota: repository.QuotaActiveLinks, Limit: 1, Used: 1, Requested: 2},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   problem.TypeQuotaExceeded,
+		},
+		{
+			name:           "unauthorized user",
+			requestBody:    `{"items": [{"correlation_id": "1", "url": "https://example.com"}]}`,
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   problem.TypeUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cfg := &config.Config{BaseURL: "http://localhost:8080", QuotaBatchSize: tt.maxBatchSize}
+			mockRepo := mocks.NewMockRepository(ctrl)
+			mockURLChecker := mocks.NewMockURLChecker(ctrl)
+			for url, err := range tt.checkErrs {
+				mockURLChecker.EXPECT().CheckURL(url).Return(err)
+			}
+			mockURLChecker.EXPECT().CheckURL(gomock.Any()).Return(nil).AnyTimes()
+			if tt.storeURLs != nil {
+				mockRepo.EXPECT().StoreBatch(tt.userID, cfg.BaseURL, tt.storeURLs).Return(tt.stored, tt.storeErr)
+			}
+
+			handler := NewCreateLinksBatchHandler(cfg, mockRepo, mockURLChecker)
+			rr := httptest.NewRecorder()
+			handler(rr, newLinksRequest(http.MethodPost, "/api/v2/links/batch", tt.requestBody, tt.userID))
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.JSONEq(t, tt.expectedBody, rr.Body.String())
+			} else {
+				assertProblem(t, rr, tt.expectedStatus, tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestNewListLinksHandler(t *testing.T) {
+	checkedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		path           string
+		userID         string
+		getAllResult   []repository.URLOutput
+		getAllError    error
+		expectGetAll   bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:   "links",
+			path:   "/api/v2/links",
+			userID: "user123",
+			getAllResult: []repository.URLOutput{
+				{ShortURL: "http://localhost:8080/abc123", OriginalURL: "https://example.com"},
+			},
+			expectGetAll:   true,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":[{"alias":"abc123","short_url":"http://localhost:8080/abc123","original_url":"https://example.com"}]}`,
+		},
+		{
+			name:           "no links",
+			path:           "/api/v2/links",
+			userID:         "user123",
+			getAllError:    repository.ErrUserHasNoData,
+			expectGetAll:   true,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":[]}`,
+		},
+		{
+			name:   "broken links",
+			path:   "/api/v2/links?status=broken",
+			userID: "user123",
+			getAllResult: []repository.URLOutput{
+				{ShortURL: "http://localhost:8080/abc123", OriginalURL: "https://example.com", LastStatus: 200, CheckedAt: &checkedAt},
+				{ShortURL: "http://localhost:8080/def456", OriginalURL: "https://gone.example.com", LastStatus: 404, CheckedAt: &checkedAt},
+			},
+			expectGetAll:   true,
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"data":[{"alias":"def456","short_url":"http://localhost:8080/def456","original_url":"https://gone.example.com",
+				"last_status":404,"checked_at":"2024-01-01T00:00:00Z"}]}`,
+		},
+		{
+			name:           "unsupported status",
+			path:           "/api/v2/links?status=ok",
+			userID:         "user123",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   problem.TypeInvalidParameter,
+		},
+		{
+			name:           "unauthorized user",
+			path:           "/api/v2/links",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   problem.TypeUnauthorized,
+		},
+		{
+			name:           "repository error",
+			path:           "/api/v2/links",
+			userID:         "user123",
+			getAllError:    errors.New("database error"),
+			expectGetAll:   true,
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   problem.TypeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cfg := &config.Config{BaseURL: "http://localhost:8080"}
+			mockRepo := mocks.NewMockRepository(ctrl)
+			if tt.expectGetAll {
+				mockRepo.EXPECT().GetAll(tt.userID, cfg.BaseURL).Return(tt.getAllResult, tt.getAllError)
+			}
+
+			handler := NewListLinksHandler(cfg, mockRepo)
+			rr := httptest.NewRecorder()
+			handler(rr, newLinksRequest(http.MethodGet, tt.path, "", tt.userID))
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.JSONEq(t, tt.expectedBody, rr.Body.String())
+			} else {
+				assertProblem(t, rr, tt.expectedStatus, tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestNewDeleteLinksHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		userID         string
+		expectDelete   bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "deleted",
+			requestBody:    `{"aliases": ["abc123", "def456"]}`,
+			userID:         "user123",
+			expectDelete:   true,
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "empty aliases",
+			requestBody:    `{"aliases": []}`,
+			userID:         "user123",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   problem.TypeInvalidParameter,
+		},
+		{
+			name:           "array body",
+			requestBody:    `["abc123"]`,
+			userID:         "user123",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   problem.TypeInvalidBody,
+		},
+		{
+			name:           "unauthorized user",
+			requestBody:    `{"aliases": ["abc123"]}`,
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   problem.TypeUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			if tt.expectDelete {
+				mockRepo.EXPECT().DeleteBatch(tt.userID, []string{"abc123", "def456"}).Return(nil).AnyTimes()
+			}
+
+			handler := NewDeleteLinksHandler(&config.Config{BaseURL: "http://localhost:8080"}, mockRepo)
+			rr := httptest.NewRecorder()
+			handler(rr, newLinksRequest(http.MethodDelete, "/api/v2/links", tt.requestBody, tt.userID))
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusAccepted {
+				assert.Empty(t, rr.Body.String())
+			} else {
+				assertProblem(t, rr, tt.expectedStatus, tt.expectedBody)
+			}
+		})
+	}
+}
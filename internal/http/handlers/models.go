@@ -2,13 +2,47 @@ package handlers
 
 import (
 	"fmt"
+	"time"
+
+	"github.com/aifedorov/shortener/internal/http/problem"
+	"github.com/aifedorov/shortener/internal/pkg/querymerge"
+	"github.com/aifedorov/shortener/internal/pkg/split"
+	"github.com/aifedorov/shortener/internal/service"
 )
 
+// LinkOptionsRequest holds the optional link settings accepted by the shortening endpoints.
+// It is embedded into the request bodies, so its fields appear next to the URL.
+type LinkOptionsRequest struct {
+	// MaxClicks limits the number of redirects of the short URL, zero means unlimited.
+	MaxClicks int `json:"max_clicks,omitempty"`
+	// Variants lists weighted destinations the visits of the short URL are split between.
+	Variants []split.Variant `json:"variants,omitempty"`
+	// PassQuery forwards the query parameters of the short URL to the destination.
+	PassQuery bool `json:"pass_query,omitempty"`
+	// UTM holds the campaign parameters appended to the destination.
+	UTM querymerge.UTM `json:"utm,omitempty"`
+	// RedirectStatus overrides the server-wide redirect status code: 301, 302, 303, 307 or 308.
+	RedirectStatus int `json:"redirect_status,omitempty"`
+}
+
+// options returns the link settings requested by the client.
+func (r LinkOptionsRequest) options() service.Options {
+	return service.Options{
+		MaxClicks:      r.MaxClicks,
+		Variants:       r.Variants,
+		PassQuery:      r.PassQuery,
+		UTM:            r.UTM,
+		RedirectStatus: r.RedirectStatus,
+	}
+}
+
 // RequestBody represents the request body for URL shortening operations.
 // Used in JSON API endpoints for single URL shortening.
 type RequestBody struct {
 	// URL is the original URL to be shortened.
 	URL string `json:"url"`
+	// LinkOptionsRequest holds the optional settings of the link.
+	LinkOptionsRequest
 }
 
 // String returns a string representation of the RequestBody.
@@ -35,6 +69,8 @@ type BatchRequest struct {
 	CID string `json:"correlation_id"`
 	// OriginalURL is the original URL to be shortened.
 	OriginalURL string `json:"original_url"`
+	// LinkOptionsRequest holds the optional settings of the link.
+	LinkOptionsRequest
 }
 
 // String returns a string representation of the BatchRequest.
@@ -42,16 +78,246 @@ func (r BatchRequest) String() string {
 	return fmt.Sprintf("{correlation_id: %s, original_url: %s}", r.CID, r.OriginalURL)
 }
 
-// BatchResponse represents a single URL in a batch shortening response.
-// Returned by batch API endpoints after successful URL shortening.
+// BatchResponse represents the outcome of a single URL in a batch shortening response.
+// Returned by batch API endpoints for every item of the request.
 type BatchResponse struct {
 	// CID is the correlation ID matching the original request.
 	CID string `json:"correlation_id"`
-	// ShortURL is the generated short URL.
-	ShortURL string `json:"short_url"`
+	// ShortURL is the generated or existing short URL, omitted for invalid items.
+	ShortURL string `json:"short_url,omitempty"`
+	// Status is the outcome of the item: created, existing or invalid.
+	Status string `json:"status"`
+	// Error is the reason an invalid item was rejected.
+	Error string `json:"error,omitempty"`
 }
 
 // String returns a string representation of the BatchResponse.
 func (r BatchResponse) String() string {
-	return fmt.Sprintf("{correlation_id: %s, short_url: %s}", r.CID, r.ShortURL)
+	return fmt.Sprintf("{correlation_id: %s, short_url: %s, status: %s}", r.CID, r.ShortURL, r.Status)
+}
+
+// DataResponse is the envelope of the successful responses of the v2 API.
+type DataResponse struct {
+	// Data is the requested resource or the list of resources.
+	Data interface{} `json:"data"`
+}
+
+// LinkRequest represents the request body for creating a link through the v2 API.
+type LinkRequest struct {
+	// URL is the original URL to be shortened.
+	URL string `json:"url"`
+	// LinkOptionsRequest holds the optional settings of the link.
+	LinkOptionsRequest
+}
+
+// LinkBatchRequest represents the request body for creating several links through the v2 API.
+type LinkBatchRequest struct {
+	// Items lists the URLs to be shortened.
+	Items []LinkBatchItem `json:"items"`
+}
+
+// LinkBatchItem represents a single URL in a v2 batch request.
+type LinkBatchItem struct {
+	// CID is the correlation ID to match request and response items.
+	CID string `json:"correlation_id"`
+	// URL is the original URL to be shortened.
+	URL string `json:"url"`
+	// LinkOptionsRequest holds the optional settings of the link.
+	LinkOptionsRequest
+}
+
+// LinkResponse represents a link in the responses of the v2 API.
+type LinkResponse struct {
+	// Alias is the short URL path/alias.
+	Alias string `json:"alias"`
+	// ShortURL is the short URL of the link.
+	ShortURL string `json:"short_url"`
+	// OriginalURL is the URL the link redirects to.
+	OriginalURL string `json:"original_url"`
+	// SubmittedURL is the URL as submitted by the client, omitted if it equals the canonical original URL.
+	SubmittedURL string `json:"submitted_url,omitempty"`
+	// Variants lists the weighted destinations of a split link with their click counts.
+	Variants []split.Variant `json:"variants,omitempty"`
+	// RedirectStatus is the redirect status code of the link, omitted if the server default is used.
+	RedirectStatus int `json:"redirect_status,omitempty"`
+	// LastStatus is the status code of the latest dead-link check, zero if the target was unreachable.
+	LastStatus int `json:"last_status,omitempty"`
+	// CheckedAt is the time of the latest dead-link check, omitted if the link was never checked.
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+}
+
+// Outcomes of the items of a batch
+const (
+	// batchResultCreated marks an item stored as a new link.
+	batchResultCreated = "created"
+	// batchResultExisting marks an item whose URL was shortened before.
+	batchResultExisting = "existing"
+	// batchResultInvalid marks an item rejected by validation, it is not stored.
+	batchResultInvalid = "invalid"
+)
+
+// LinkBatchResult represents the outcome of a single item of a v2 batch request.
+type LinkBatchResult struct {
+	// CID is the correlation ID matching the request item.
+	CID string `json:"correlation_id"`
+	// Result is the outcome of the item: created, existing or invalid.
+	Result string `json:"result"`
+	// Link is the created or existing link, omitted for invalid items.
+	Link *LinkResponse `json:"link,omitempty"`
+	// Error describes why an invalid item was rejected.
+	Error *problem.Problem `json:"error,omitempty"`
+}
+
+// DeleteLinksRequest represents the request body for deleting links through the v2 API.
+type DeleteLinksRequest struct {
+	// Aliases lists the aliases of the links to delete.
+	Aliases []string `json:"aliases"`
+}
+
+// APIKeyRequest represents the request body for creating an API key.
+type APIKeyRequest struct {
+	// Name is the label of the key.
+	Name string `json:"name"`
+}
+
+// APIKeyResponse represents an API key in API responses.
+type APIKeyResponse struct {
+	// ID is the unique identifier of the key, used to revoke it.
+	ID string `json:"id"`
+	// Name is the label of the key.
+	Name string `json:"name"`
+	// Prefix holds the leading characters of the key to identify it.
+	Prefix string `json:"prefix"`
+	// CreatedAt is the time the key was created.
+	CreatedAt time.Time `json:"created_at"`
+	// Key is the API key itself, it is only returned once on creation.
+	Key string `json:"key,omitempty"`
+}
+
+// CredentialsRequest represents the request body for registration and login.
+type CredentialsRequest struct {
+	// Login is the login name, it is case insensitive.
+	Login string `json:"login"`
+	// Password is the plain text password.
+	Password string `json:"password"`
+}
+
+// AccountResponse represents the response body of registration and login.
+type AccountResponse struct {
+	// UserID is the user ID the links of the account are stored under.
+	UserID string `json:"user_id"`
+	// Login is the login name in lower case.
+	Login string `json:"login"`
+	// Token is the JWT of the session, it is also set as the cookie.
+	Token string `json:"token"`
+	// Merge describes the links claimed from the anonymous session, omitted if there were none.
+	Merge *MergeResponse `json:"merge,omitempty"`
+}
+
+// MergeResponse describes the anonymous links claimed into an account on registration or login.
+type MergeResponse struct {
+	// ID is the identifier of the recorded merge.
+	ID string `json:"id"`
+	// Moved lists the aliases of the links moved to the account.
+	Moved []string `json:"moved"`
+	// Skipped lists the aliases of the links left behind because the account already links to the same URL.
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// WorkspaceRequest represents the request body for creating a workspace.
+type WorkspaceRequest struct {
+	// Name is the display name of the workspace.
+	Name string `json:"name"`
+}
+
+// MemberRequest represents the request body for adding a workspace member or changing the role of a member.
+type MemberRequest struct {
+	// Login is the login of the registered user.
+	Login string `json:"login"`
+	// Role is the role of the member: owner, editor or viewer.
+	Role string `json:"role"`
+}
+
+// DisableLinkRequest represents the request body for disabling a link through the admin API.
+type DisableLinkRequest struct {
+	// Status is the status code served instead of the redirect: 410 (default) or 451.
+	Status int `json:"status,omitempty"`
+	// Reason is an optional note about why the link was disabled.
+	Reason string `json:"reason,omitempty"`
+}
+
+// ReassignLinkRequest represents the request body for moving a link to another owner through the admin API.
+type ReassignLinkRequest struct {
+	// OwnerID is the ID of the user or workspace receiving the link.
+	OwnerID string `json:"owner_id"`
+}
+
+// ReassignLinkResponse describes a link moved to another owner.
+type ReassignLinkResponse struct {
+	// Alias is the short URL path/alias.
+	Alias string `json:"alias"`
+	// PreviousOwnerID is the ID of the owner the link was taken from.
+	PreviousOwnerID string `json:"previous_owner_id"`
+	// OwnerID is the ID of the new owner.
+	OwnerID string `json:"owner_id"`
+}
+
+// QuotaErrorResponse is the problem of a request that would exceed a quota.
+type QuotaErrorResponse struct {
+	// Problem describes the failure, its type is problem.TypeQuotaExceeded.
+	*problem.Problem
+	// Quota is the name of the exceeded quota: active_links, daily_links or batch_size.
+	Quota string `json:"quota"`
+	// Limit is the configured limit of the quota.
+	Limit int `json:"limit"`
+	// Used is the usage counted against the quota before the request.
+	Used int `json:"used"`
+	// Requested is the number of links the request would add.
+	Requested int `json:"requested"`
+	// ResetAt is the time the daily quota is reset, set only for daily_links.
+	ResetAt *time.Time `json:"reset_at,omitempty"`
+}
+
+// QuotaResponse describes the quotas of a user or workspace and their current usage, zero limits are unlimited.
+type QuotaResponse struct {
+	// MaxActiveLinks is the maximum number of links that are not deleted.
+	MaxActiveLinks int `json:"max_active_links"`
+	// ActiveLinks is the number of links that are not deleted.
+	ActiveLinks int `json:"active_links"`
+	// MaxLinksPerDay is the maximum number of links created per UTC day.
+	MaxLinksPerDay int `json:"max_links_per_day"`
+	// LinksToday is the number of links created since the start of the current UTC day.
+	LinksToday int `json:"links_today"`
+	// MaxBatchSize is the maximum number of URLs in a batch shortening request.
+	MaxBatchSize int `json:"max_batch_size"`
+	// ResetAt is the time the daily usage is reset.
+	ResetAt time.Time `json:"reset_at"`
+}
+
+// ReportRequest represents the request body for reporting an abusive link.
+type ReportRequest struct {
+	// URL is the reported short URL or its alias.
+	URL string `json:"url"`
+	// Category is the kind of abuse: phishing, spam, malware or other.
+	Category string `json:"category"`
+	// Reason is an optional description of the abuse.
+	Reason string `json:"reason,omitempty"`
+}
+
+// ReportResponse acknowledges a filed abuse report.
+type ReportResponse struct {
+	// ID is the unique identifier of the report.
+	ID string `json:"id"`
+	// Status is the review status of the report, open for a new report.
+	Status string `json:"status"`
+}
+
+// ResolveReportsResponse describes the open reports against a link closed by an operator.
+type ResolveReportsResponse struct {
+	// Alias is the short URL path/alias.
+	Alias string `json:"alias"`
+	// Status is the status the reports were closed with: dismissed or actioned.
+	Status string `json:"status"`
+	// Resolved is the number of closed reports.
+	Resolved int `json:"resolved"`
 }
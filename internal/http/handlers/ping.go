@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/problem"
 
 	"go.uber.org/zap"
 
@@ -18,7 +19,7 @@ func NewPingHandler(repo repository.Repository) http.HandlerFunc {
 		err := repo.Ping()
 		if err != nil {
 			logger.Log.Error("ping failed", zap.Error(err))
-			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			problem.Write(rw, req, problem.Internal())
 			return
 		}
 
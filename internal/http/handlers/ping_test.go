@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/aifedorov/shortener/internal/http/problem"
 	"github.com/aifedorov/shortener/internal/mocks"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -28,13 +29,13 @@ func TestNewPingHandler(t *testing.T) {
 			name:           "ping failed",
 			pingError:      errors.New("connection failed"),
 			expectedStatus: http.StatusInternalServerError,
-			expectedBody:   "Internal Server Error\n",
+			expectedBody:   problem.TypeInternal,
 		},
 		{
 			name:           "database error",
 			pingError:      errors.New("database connection lost"),
 			expectedStatus: http.StatusInternalServerError,
-			expectedBody:   "Internal Server Error\n",
+			expectedBody:   problem.TypeInternal,
 		},
 	}
 
@@ -54,7 +55,11 @@ func TestNewPingHandler(t *testing.T) {
 			handler(rr, req)
 
 			assert.Equal(t, tt.expectedStatus, rr.Code)
-			assert.Equal(t, tt.expectedBody, rr.Body.String())
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, tt.expectedBody, rr.Body.String())
+			} else {
+				assertProblem(t, rr, tt.expectedStatus, tt.expectedBody)
+			}
 		})
 	}
 }
@@ -1,27 +1,38 @@
 package handlers
 
 import (
-	"errors"
 	"io"
 	"net/http"
 
 	"github.com/aifedorov/shortener/internal/config"
 	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/problem"
 	"github.com/aifedorov/shortener/internal/pkg/validate"
+	"github.com/aifedorov/shortener/internal/pkg/workspace"
 	"github.com/aifedorov/shortener/internal/repository"
+	"github.com/aifedorov/shortener/internal/service"
 	"go.uber.org/zap"
 )
 
 // NewSavePlainTextHandler creates a new HTTP handler for single URL shortening operations via plain text.
 // This handler requires user authentication. If the user is not authenticated, a cookie will be created for them.
 // It accepts a plain text URL in the request body and returns the shortened URL as plain text.
+// The workspace query parameter stores the link in a workspace, it requires the editor or owner role.
+// Links over the quota of the owner are rejected with a JSON description of the exceeded quota.
 func NewSavePlainTextHandler(config *config.Config, repo repository.Repository, urlChecker validate.URLChecker) http.HandlerFunc {
+	links := service.NewLinks(config, repo, urlChecker)
 	return func(rw http.ResponseWriter, r *http.Request) {
 		rw.Header().Set("Content-Type", "text/plain")
 
 		userID, err := getUserID(r)
 		if err != nil {
-			http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			problem.Write(rw, r, problem.Unauthorized(detailNotAuthenticated))
+			return
+		}
+
+		ownerID, err := linkOwner(r, repo, userID, workspace.PermissionWrite)
+		if err != nil {
+			writeWorkspaceError(rw, r, err)
 			return
 		}
 
@@ -29,49 +40,36 @@ func NewSavePlainTextHandler(config *config.Config, repo repository.Repository,
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
 			logger.Log.Error("failed to read request body", zap.Error(err))
-			http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			problem.Write(rw, r, problem.InvalidBody(err.Error()))
 			return
 		}
 
-		logger.Log.Debug("checking original url", zap.String("original_url", string(body)))
-		oURL := string(body)
-		if err := urlChecker.CheckURL(oURL); err != nil {
-			logger.Log.Error("invalid original url", zap.String("original_url", oURL))
-			http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		logger.Log.Debug("saving original url", zap.String("original_url", string(body)))
+		link, err := links.Shorten(ownerID, string(body), service.Options{})
+		if err != nil {
+			writeLinkError(rw, r, err)
 			return
 		}
-		if oURL == "" {
-			oURL = config.BaseURL
-		}
-
-		logger.Log.Debug("saving original url", zap.String("original_url", oURL))
-		resURL, err := repo.Store(userID, config.BaseURL, oURL)
-		var cErr *repository.ConflictError
-		if errors.As(err, &cErr) {
+		if link.Existing {
 			logger.Log.Debug("sending HTTP 409 response")
 			rw.WriteHeader(http.StatusConflict)
 
-			_, err := rw.Write([]byte(cErr.ShortURL))
+			_, err := rw.Write([]byte(link.ShortURL))
 			if err != nil {
 				logger.Log.Error("failed to write response", zap.Error(err))
-				http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				problem.Write(rw, r, problem.Internal())
 				return
 			}
 			return
 		}
-		if err != nil {
-			logger.Log.Error("failed to save original url", zap.String("original_url", oURL), zap.Error(err))
-			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		}
-		logger.Log.Debug("store updated", zap.String("short_url", resURL), zap.String("original_url", oURL))
+		logger.Log.Debug("store updated", zap.String("short_url", link.ShortURL), zap.String("original_url", link.OriginalURL))
 
 		logger.Log.Debug("sending HTTP 201 response")
 		rw.WriteHeader(http.StatusCreated)
-		_, writeErr := rw.Write([]byte(resURL))
+		_, writeErr := rw.Write([]byte(link.ShortURL))
 		if writeErr != nil {
 			logger.Log.Error("Failed to write response", zap.Error(writeErr))
-			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			problem.Write(rw, r, problem.Internal())
 			return
 		}
 	}
@@ -10,7 +10,9 @@ import (
 
 	"github.com/aifedorov/shortener/internal/config"
 	"github.com/aifedorov/shortener/internal/http/middleware/auth"
+	"github.com/aifedorov/shortener/internal/http/problem"
 	"github.com/aifedorov/shortener/internal/mocks"
+	"github.com/aifedorov/shortener/internal/pkg/validate"
 	"github.com/aifedorov/shortener/internal/repository"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -42,7 +44,25 @@ func TestNewSavePlainTextHandler(t *testing.T) {
 			urlCheckerErr:  errors.New("invalid URL"),
 			storeErr:       nil,
 			expectedStatus: http.StatusBadRequest,
-			expectedBody:   "Bad Request\n",
+			expectedBody:   problem.TypeInvalidParameter,
+		},
+		{
+			name:           "unsupported scheme",
+			requestBody:    "ftp://files.example.com",
+			userID:         "user123",
+			urlCheckerErr:  &validate.URLError{Err: validate.ErrUnsupportedScheme, Detail: "ftp"},
+			storeErr:       nil,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   problem.TypeInvalidURL,
+		},
+		{
+			name:           "host denied by domain policy",
+			requestBody:    "https://evil.com",
+			userID:         "user123",
+			urlCheckerErr:  &validate.PolicyError{Host: "evil.com", Err: validate.ErrHostDenied},
+			storeErr:       nil,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   problem.TypeBlockedURL,
 		},
 		{
 			name:           "unauthorized user",
@@ -51,7 +71,7 @@ func TestNewSavePlainTextHandler(t *testing.T) {
 			urlCheckerErr:  nil,
 			storeErr:       nil,
 			expectedStatus: http.StatusUnauthorized,
-			expectedBody:   "Unauthorized\n",
+			expectedBody:   problem.TypeUnauthorized,
 		},
 		{
 			name:           "conflict error",
@@ -69,7 +89,7 @@ func TestNewSavePlainTextHandler(t *testing.T) {
 			urlCheckerErr:  nil,
 			storeErr:       errors.New("database error"),
 			expectedStatus: http.StatusInternalServerError,
-			expectedBody:   "Internal Server Error\n",
+			expectedBody:   problem.TypeInternal,
 		},
 		{
 			name:           "empty request body",
@@ -78,7 +98,7 @@ func TestNewSavePlainTextHandler(t *testing.T) {
 			urlCheckerErr:  errors.New("empty URL"),
 			storeErr:       nil,
 			expectedStatus: http.StatusBadRequest,
-			expectedBody:   "Bad Request\n",
+			expectedBody:   problem.TypeInvalidParameter,
 		},
 	}
 
@@ -97,7 +117,7 @@ func TestNewSavePlainTextHandler(t *testing.T) {
 			if tt.userID != "" {
 				mockURLChecker.EXPECT().CheckURL(tt.requestBody).Return(tt.urlCheckerErr)
 				if tt.urlCheckerErr == nil {
-					mockRepo.EXPECT().Store(tt.userID, cfg.BaseURL, tt.requestBody).Return("http://localhost:8080/abc123", tt.storeErr)
+					mockRepo.EXPECT().Store(tt.userID, cfg.BaseURL, tt.requestBody, repository.LinkOptions{}).Return("http://localhost:8080/abc123", tt.storeErr)
 				}
 			}
 
@@ -116,11 +136,11 @@ func TestNewSavePlainTextHandler(t *testing.T) {
 			handler(rr, req)
 
 			assert.Equal(t, tt.expectedStatus, rr.Code)
-			assert.Equal(t, tt.expectedBody, rr.Body.String())
 			if tt.expectedStatus == http.StatusCreated || tt.expectedStatus == http.StatusConflict {
+				assert.Equal(t, tt.expectedBody, rr.Body.String())
 				assert.Equal(t, "text/plain", rr.Header().Get("Content-Type"))
 			} else {
-				assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+				assertProblem(t, rr, tt.expectedStatus, tt.expectedBody)
 			}
 		})
 	}
@@ -150,7 +170,7 @@ func TestNewSavePlainTextHandler_ReadBodyError(t *testing.T) {
 	handler(rr, req)
 
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
-	assert.Equal(t, "Bad Request\n", rr.Body.String())
+	assertProblem(t, rr, http.StatusBadRequest, problem.TypeInvalidBody)
 }
 
 type errorReader struct{}
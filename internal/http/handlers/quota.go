@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/aifedorov/shortener/internal/config"
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/problem"
+	"github.com/aifedorov/shortener/internal/pkg/workspace"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+// NewQuotaHandler creates a new HTTP handler for retrieving the link quotas of the user and their usage.
+// This handler requires user authentication. If the user is not authenticated, a cookie will be created for them.
+// The workspace query parameter selects the quota of a workspace instead, any member may read it.
+func NewQuotaHandler(cfg *config.Config, repo repository.Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		userID, err := getUserID(r)
+		if err != nil {
+			problem.Write(rw, r, problem.Unauthorized(detailNotAuthenticated))
+			return
+		}
+
+		ownerID, err := linkOwner(r, repo, userID, workspace.PermissionRead)
+		if err != nil {
+			writeWorkspaceError(rw, r, err)
+			return
+		}
+
+		usage, err := repo.GetUsage(ownerID)
+		if err != nil {
+			logger.Log.Error("failed to get quota usage", zap.String("owner_id", ownerID), zap.Error(err))
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+
+		resp := QuotaResponse{
+			MaxActiveLinks: cfg.QuotaActiveLinks,
+			ActiveLinks:    usage.ActiveLinks,
+			MaxLinksPerDay: cfg.QuotaDailyLinks,
+			LinksToday:     usage.LinksToday,
+			MaxBatchSize:   cfg.QuotaBatchSize,
+			ResetAt:        quotaResetAt(time.Now()),
+		}
+		rw.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(rw).Encode(resp); err != nil {
+			logger.Log.Error("failed to encode response", zap.Error(err))
+			return
+		}
+	}
+}
+
+// writeQuotaError writes the response for a request that would exceed a quota and reports whether err was
+// a quota error. The daily quota answers with 429 and a Retry-After header until the next UTC day,
+// the other quotas cannot be waited out and answer with 403.
+func writeQuotaError(rw http.ResponseWriter, r *http.Request, err error) bool {
+	var qErr *repository.QuotaError
+	if !errors.As(err, &qErr) {
+		return false
+	}
+
+	resp := QuotaErrorResponse{
+		Problem:   problem.FromError(err),
+		Quota:     qErr.Quota,
+		Limit:     qErr.Limit,
+		Used:      qErr.Used,
+		Requested: qErr.Requested,
+	}
+	resp.Detail = fmt.Sprintf("%s quota of %d exceeded", qErr.Quota, qErr.Limit)
+	if qErr.Quota == repository.QuotaDailyLinks {
+		now := time.Now()
+		resetAt := quotaResetAt(now)
+		resp.ResetAt = &resetAt
+		resp.Status = http.StatusTooManyRequests
+		rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(resetAt.Sub(now).Seconds()))))
+	}
+
+	logger.Log.Info("quota exceeded", zap.String("quota", qErr.Quota), zap.Int("limit", qErr.Limit),
+		zap.Int("used", qErr.Used), zap.Int("requested", qErr.Requested))
+	problem.WriteExtended(rw, r, resp.Problem, resp)
+	return true
+}
+
+// quotaResetAt returns the time the daily quota is reset after now.
+func quotaResetAt(now time.Time) time.Time {
+	return repository.DayStart(now).Add(24 * time.Hour)
+}
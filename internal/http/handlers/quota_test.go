@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aifedorov/shortener/internal/config"
+	"github.com/aifedorov/shortener/internal/http/problem"
+	"github.com/aifedorov/shortener/internal/mocks"
+	"github.com/aifedorov/shortener/internal/pkg/validate"
+	"github.com/aifedorov/shortener/internal/pkg/workspace"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+func TestNewQuotaHandler(t *testing.T) {
+	cfg := &config.Config{QuotaActiveLinks: 100, QuotaDailyLinks: 20, QuotaBatchSize: 10}
+
+	tests := []struct {
+		name           string
+		target         string
+		expectRepo     func(repo *mocks.MockRepository)
+		expectedStatus int
+		expectedUsage  repository.Usage
+	}{
+		{
+			name:   "user quota",
+			target: "/api/user/quota",
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().GetUsage("user1").Return(repository.Usage{ActiveLinks: 42, LinksToday: 3}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedUsage:  repository.Usage{ActiveLinks: 42, LinksToday: 3},
+		},
+		{
+			name:   "workspace quota",
+			target: "/api/user/quota?workspace=ws1",
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().GetMemberRole("ws1", "user1").Return(workspace.RoleViewer, nil)
+				repo.EXPECT().GetUsage("ws1").Return(repository.Usage{ActiveLinks: 7}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedUsage:  repository.Usage{ActiveLinks: 7},
+		},
+		{
+			name:   "not a member",
+			target: "/api/user/quota?workspace=ws1",
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().GetMemberRole("ws1", "user1").Return(workspace.Role(""), repository.ErrMemberNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockRepository(ctrl)
+			tt.expectRepo(repo)
+
+			w := httptest.NewRecorder()
+			NewQuotaHandler(cfg, repo).ServeHTTP(w, workspaceRequest(http.MethodGet, tt.target, "", "user1", nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var resp QuotaResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+			assert.Equal(t, 100, resp.MaxActiveLinks)
+			assert.Equal(t, 20, resp.MaxLinksPerDay)
+			assert.Equal(t, 10, resp.MaxBatchSize)
+			assert.Equal(t, tt.expectedUsage.ActiveLinks, resp.ActiveLinks)
+			assert.Equal(t, tt.expectedUsage.LinksToday, resp.LinksToday)
+			assert.Equal(t, quotaResetAt(resp.ResetAt.Add(-1)), resp.ResetAt, "usage is reset at midnight UTC")
+		})
+	}
+}
+
+func TestShortenHandlers_Quota(t *testing.T) {
+	cfg := &config.Config{BaseURL: "http://localhost:8080", QuotaBatchSize: 2}
+
+	tests := []struct {
+		name           string
+		handler        func(repo *mocks.MockRepository) http.HandlerFunc
+		body           string
+		expectRepo     func(repo *mocks.MockRepository)
+		expectedStatus int
+		expectedQuota  string
+		retryAfter     bool
+	}{
+		{
+			name: "active links exceeded",
+			handler: func(repo *mocks.MockRepository) http.HandlerFunc {
+				return NewSaveJSONHandler(cfg, repo, validate.NewService())
+			},
+			body: `{"url":"https://example.com"}`,
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().Store("user1", cfg.BaseURL, "https://example.com", gomock.Any()).
+					Return("", &repository.QuotaError{Quota: repository.QuotaActiveLinks, Limit: 10, Used: 10, Requested: 1})
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedQuota:  repository.QuotaActiveLinks,
+		},
+		{
+			name: "daily links exceeded",
+			handler: func(repo *mocks.MockRepository) http.HandlerFunc {
+				return NewSavePlainTextHandler(cfg, repo, validate.NewService())
+			},
+			body: "https://example.com",
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().Store("user1", cfg.BaseURL, "https://example.com", gomock.Any()).
+					Return("", &repository.QuotaError{Quota: repository.QuotaDailyLinks, Limit: 5, Used: 5, Requested: 1})
+			},
+			expectedStatus: http.StatusTooManyRequests,
+			expectedQuota:  repository.QuotaDailyLinks,
+			retryAfter:     true,
+		},
+		{
+			name: "batch links exceeded",
+			handler: func(repo *mocks.MockRepository) http.HandlerFunc {
+				return NewSaveJSONBatchHandler(cfg, repo, validate.NewService())
+			},
+			body: `[{"correlation_id":"1","original_url":"https://example.com"}]`,
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().StoreBatch("user1", cfg.BaseURL, gomock.Any()).
+					Return(nil, &repository.QuotaError{Quota: repository.QuotaActiveLinks, Limit: 10, Used: 10, Requested: 1})
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedQuota:  repository.QuotaActiveLinks,
+		},
+		{
+			name: "batch too large",
+			handler: func(repo *mocks.MockRepository) http.HandlerFunc {
+				return NewSaveJSONBatchHandler(cfg, repo, validate.NewService())
+			},
+			body: `[{"correlation_id":"1","original_url":"https://example.com/1"},
+				{"correlation_id":"2","original_url":"https://example.com/2"},
+				{"correlation_id":"3","original_url":"https://example.com/3"}]`,
+			expectedStatus: http.StatusForbidden,
+			expectedQuota:  repository.QuotaBatchSize,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockRepository(ctrl)
+			if tt.expectRepo != nil {
+				tt.expectRepo(repo)
+			}
+
+			w := httptest.NewRecorder()
+			tt.handler(repo).ServeHTTP(w, workspaceRequest(http.MethodPost, "/", tt.body, "user1", nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+			var resp QuotaErrorResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+			assert.Equal(t, tt.expectedQuota, resp.Quota)
+			require.NotNil(t, resp.Problem)
+			assert.Equal(t, problem.TypeQuotaExceeded, resp.Type)
+			assert.Equal(t, tt.expectedStatus, resp.Status)
+			if tt.retryAfter {
+				seconds, err := strconv.Atoi(w.Header().Get("Retry-After"))
+				require.NoError(t, err)
+				assert.True(t, seconds > 0 && seconds <= 24*60*60)
+				assert.NotNil(t, resp.ResetAt)
+			} else {
+				assert.Empty(t, w.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
@@ -2,22 +2,39 @@ package handlers
 
 import (
 	"errors"
+	"net"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 
+	"github.com/aifedorov/shortener/internal/config"
 	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/pkg/querymerge"
+	"github.com/aifedorov/shortener/internal/pkg/rules"
+	"github.com/aifedorov/shortener/internal/pkg/split"
 	"github.com/aifedorov/shortener/internal/repository"
 )
 
 // NewRedirectHandler creates a new HTTP handler for redirecting short URLs to their original URLs.
 // This handler is available to all users (no authentication required).
 // It returns a handler function that performs HTTP redirects or returns appropriate error responses.
-func NewRedirectHandler(repo repository.Repository) http.HandlerFunc {
+// Click-limited links answer with 410 Gone once their last allowed redirect has been served.
+// Conditional redirect rules of the link are evaluated in order, the original URL is the default target.
+// Visits of a split link that match no rule are shared between its variants, a returning visitor
+// always gets the same variant and the served variant is tracked.
+// Query parameters of the short URL are forwarded when the link enables passthrough and UTM parameters
+// of the link are added, parameters already present in the destination are never overridden.
+// The redirect uses the status code of the link, or the server-wide one if the link has none.
+// Links disabled by an operator answer with the status code chosen on disabling, 410 or 451.
+// Links quarantined by abuse reports answer with a warning page linking to the target instead of redirecting,
+// such visits are not counted.
+func NewRedirectHandler(config *config.Config, repo repository.Repository) http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
 		shortURL := chi.URLParam(r, "shortURL")
-		target, err := repo.Get(shortURL)
+		link, err := repo.Resolve(shortURL)
 		if errors.Is(err, repository.ErrShortURLNotFound) {
 			logger.Log.Info("redirect: short url not found", zap.String("alias", shortURL))
 			http.NotFound(rw, r)
@@ -26,6 +43,13 @@ func NewRedirectHandler(repo repository.Repository) http.HandlerFunc {
 		if errors.Is(err, repository.ErrURLDeleted) {
 			logger.Log.Info("redirect: url deleted", zap.String("alias", shortURL))
 			http.Error(rw, http.StatusText(http.StatusGone), http.StatusGone)
+			return
+		}
+		var dErr *repository.DisabledError
+		if errors.As(err, &dErr) {
+			logger.Log.Info("redirect: url disabled", zap.String("alias", shortURL), zap.Int("status", dErr.StatusCode))
+			http.Error(rw, http.StatusText(dErr.StatusCode), dErr.StatusCode)
+			return
 		}
 		if err != nil {
 			logger.Log.Error("redirect: failed to get short url", zap.String("short_url", shortURL), zap.Error(err))
@@ -33,7 +57,73 @@ func NewRedirectHandler(repo repository.Repository) http.HandlerFunc {
 			return
 		}
 
+		target := link.OriginalURL
+		if rule, ok := rules.Match(link.Rules, r, time.Now()); ok {
+			logger.Log.Debug("redirect: rule matched", zap.String("alias", shortURL), zap.String("target", rule.Target))
+			target = rule.Target
+		} else if variants := link.Options.Variants; len(variants) > 0 {
+			if i := split.Pick(variants, visitorKey(r)+"/"+shortURL); i >= 0 {
+				target = variants[i].URL
+				if !link.Quarantined {
+					if err := repo.TrackVariant(shortURL, i); err != nil {
+						logger.Log.Error("redirect: failed to track variant", zap.String("alias", shortURL), zap.Int("variant", i), zap.Error(err))
+					}
+				}
+			}
+		}
+
+		target = mergeQuery(target, r, link.Options)
+
+		if link.Quarantined {
+			logger.Log.Info("redirect: url quarantined", zap.String("alias", shortURL), zap.String("url", target))
+			writeInterstitial(rw, shortURL, target)
+			return
+		}
+
 		logger.Log.Info("redirect: redirecting to url", zap.String("alias", shortURL), zap.String("url", target))
-		http.Redirect(rw, r, target, http.StatusTemporaryRedirect)
+		http.Redirect(rw, r, target, redirectStatus(config, link.Options))
+	}
+}
+
+// redirectStatus returns the status code of the redirect for the link.
+func redirectStatus(cfg *config.Config, opts repository.LinkOptions) int {
+	if opts.RedirectStatus != 0 {
+		return opts.RedirectStatus
+	}
+	if cfg.RedirectStatus != 0 {
+		return cfg.RedirectStatus
+	}
+	return config.DefaultRedirectStatus
+}
+
+// mergeQuery adds the forwarded query parameters and the UTM parameters of the link to the target.
+// The target is returned unchanged if it cannot be parsed.
+func mergeQuery(target string, r *http.Request, opts repository.LinkOptions) string {
+	if !opts.PassQuery && opts.UTM.IsZero() {
+		return target
+	}
+
+	var incoming url.Values
+	if opts.PassQuery {
+		incoming = r.URL.Query()
+	}
+	merged, err := querymerge.Merge(target, incoming, opts.UTM)
+	if err != nil {
+		logger.Log.Error("redirect: failed to merge query", zap.String("target", target), zap.Error(err))
+		return target
+	}
+	return merged
+}
+
+// visitorKey identifies the visitor for choosing a split link variant.
+// It is the user ID assigned by the auth middleware, or the client address and user agent without one.
+func visitorKey(r *http.Request) string {
+	if userID, err := getUserID(r); err == nil {
+		return userID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
 	}
+	return host + "|" + r.UserAgent()
 }
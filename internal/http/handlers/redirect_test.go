@@ -7,7 +7,12 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/aifedorov/shortener/internal/config"
+	"github.com/aifedorov/shortener/internal/http/middleware/auth"
 	"github.com/aifedorov/shortener/internal/mocks"
+	"github.com/aifedorov/shortener/internal/pkg/querymerge"
+	"github.com/aifedorov/shortener/internal/pkg/rules"
+	"github.com/aifedorov/shortener/internal/pkg/split"
 	"github.com/aifedorov/shortener/internal/repository"
 	"github.com/go-chi/chi/v5"
 	"github.com/golang/mock/gomock"
@@ -18,40 +23,52 @@ func TestNewRedirectHandler(t *testing.T) {
 	tests := []struct {
 		name             string
 		shortURL         string
-		getResult        string
-		getError         error
+		resolveResult    string
+		resolveError     error
 		expectedStatus   int
 		expectedLocation string
 	}{
 		{
 			name:             "successful redirect",
 			shortURL:         "abc123",
-			getResult:        "https://example.com",
-			getError:         nil,
+			resolveResult:    "https://example.com",
+			resolveError:     nil,
 			expectedStatus:   http.StatusTemporaryRedirect,
 			expectedLocation: "https://example.com",
 		},
 		{
 			name:             "short URL not found",
 			shortURL:         "nonexistent",
-			getResult:        "",
-			getError:         repository.ErrShortURLNotFound,
+			resolveResult:    "",
+			resolveError:     repository.ErrShortURLNotFound,
 			expectedStatus:   http.StatusNotFound,
 			expectedLocation: "",
 		},
 		{
 			name:             "URL deleted",
 			shortURL:         "deleted123",
-			getResult:        "",
-			getError:         repository.ErrURLDeleted,
+			resolveResult:    "",
+			resolveError:     repository.ErrURLDeleted,
 			expectedStatus:   http.StatusGone,
 			expectedLocation: "",
 		},
+		{
+			name:           "URL disabled",
+			shortURL:       "disabled123",
+			resolveError:   &repository.DisabledError{StatusCode: http.StatusGone},
+			expectedStatus: http.StatusGone,
+		},
+		{
+			name:           "URL disabled for legal reasons",
+			shortURL:       "legal123",
+			resolveError:   &repository.DisabledError{StatusCode: http.StatusUnavailableForLegalReasons, Reason: "court order"},
+			expectedStatus: http.StatusUnavailableForLegalReasons,
+		},
 		{
 			name:             "repository error",
 			shortURL:         "error123",
-			getResult:        "",
-			getError:         errors.New("database error"),
+			resolveResult:    "",
+			resolveError:     errors.New("database error"),
 			expectedStatus:   http.StatusInternalServerError,
 			expectedLocation: "",
 		},
@@ -63,9 +80,9 @@ func TestNewRedirectHandler(t *testing.T) {
 			defer ctrl.Finish()
 
 			mockRepo := mocks.NewMockRepository(ctrl)
-			mockRepo.EXPECT().Get(tt.shortURL).Return(tt.getResult, tt.getError)
+			mockRepo.EXPECT().Resolve(tt.shortURL).Return(repository.Link{Alias: tt.shortURL, OriginalURL: tt.resolveResult}, tt.resolveError)
 
-			handler := NewRedirectHandler(mockRepo)
+			handler := NewRedirectHandler(&config.Config{}, mockRepo)
 
 			req := httptest.NewRequest(http.MethodGet, "/"+tt.shortURL, nil)
 
@@ -89,9 +106,9 @@ func TestNewRedirectHandler_ChiURLParam(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockRepo := mocks.NewMockRepository(ctrl)
-	mockRepo.EXPECT().Get("test123").Return("https://example.com", nil)
+	mockRepo.EXPECT().Resolve("test123").Return(repository.Link{Alias: "test123", OriginalURL: "https://example.com"}, nil)
 
-	handler := NewRedirectHandler(mockRepo)
+	handler := NewRedirectHandler(&config.Config{}, mockRepo)
 
 	req := httptest.NewRequest(http.MethodGet, "/test123", nil)
 
@@ -111,9 +128,9 @@ func TestNewRedirectHandler_DirectCall(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockRepo := mocks.NewMockRepository(ctrl)
-	mockRepo.EXPECT().Get("direct123").Return("https://example.com", nil)
+	mockRepo.EXPECT().Resolve("direct123").Return(repository.Link{Alias: "direct123", OriginalURL: "https://example.com"}, nil)
 
-	handler := NewRedirectHandler(mockRepo)
+	handler := NewRedirectHandler(&config.Config{}, mockRepo)
 
 	req := httptest.NewRequest(http.MethodGet, "/direct123", nil)
 
@@ -128,3 +145,295 @@ func TestNewRedirectHandler_DirectCall(t *testing.T) {
 	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
 	assert.Equal(t, "https://example.com", rr.Header().Get("Location"))
 }
+
+func TestNewRedirectHandler_Rules(t *testing.T) {
+	link := repository.Link{
+		Alias:       "app",
+		OriginalURL: "https://example.com",
+		Rules: []rules.Rule{
+			{Target: "https://apps.apple.com/app", Device: rules.DeviceIOS},
+			{Target: "https://play.google.com/app", Device: rules.DeviceAndroid},
+		},
+	}
+
+	tests := []struct {
+		name             string
+		userAgent        string
+		expectedLocation string
+	}{
+		{
+			name:             "ios device",
+			userAgent:        "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)",
+			expectedLocation: "https://apps.apple.com/app",
+		},
+		{
+			name:             "android device",
+			userAgent:        "Mozilla/5.0 (Linux; Android 14; Pixel 8)",
+			expectedLocation: "https://play.google.com/app",
+		},
+		{
+			name:             "default target",
+			userAgent:        "Mozilla/5.0 (X11; Linux x86_64)",
+			expectedLocation: "https://example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			mockRepo.EXPECT().Resolve("app").Return(link, nil)
+
+			r := chi.NewRouter()
+			r.Get("/{shortURL}", NewRedirectHandler(&config.Config{}, mockRepo))
+
+			req := httptest.NewRequest(http.MethodGet, "/app", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+			assert.Equal(t, tt.expectedLocation, rr.Header().Get("Location"))
+		})
+	}
+}
+
+func TestNewRedirectHandler_Variants(t *testing.T) {
+	link := repository.Link{
+		Alias:       "ab",
+		OriginalURL: "https://example.com",
+		Options: repository.LinkOptions{
+			Variants: []split.Variant{
+				{URL: "https://a.example.com", Weight: 1},
+				{URL: "https://b.example.com", Weight: 1},
+			},
+		},
+	}
+
+	serve := func(t *testing.T, userID string) string {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		want := split.Pick(link.Options.Variants, userID+"/ab")
+		mockRepo := mocks.NewMockRepository(ctrl)
+		mockRepo.EXPECT().Resolve("ab").Return(link, nil)
+		mockRepo.EXPECT().TrackVariant("ab", want).Return(nil)
+
+		r := chi.NewRouter()
+		r.Get("/{shortURL}", NewRedirectHandler(&config.Config{}, mockRepo))
+
+		req := httptest.NewRequest(http.MethodGet, "/ab", nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserIDKey, userID))
+		rr := httptest.NewRecorder()
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+		assert.Equal(t, link.Options.Variants[want].URL, rr.Header().Get("Location"))
+		return rr.Header().Get("Location")
+	}
+
+	t.Run("returning visitor gets the same variant", func(t *testing.T) {
+		first := serve(t, "user123")
+		assert.Equal(t, first, serve(t, "user123"))
+	})
+
+	t.Run("tracking failure does not break the redirect", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRepo := mocks.NewMockRepository(ctrl)
+		mockRepo.EXPECT().Resolve("ab").Return(link, nil)
+		mockRepo.EXPECT().TrackVariant("ab", gomock.Any()).Return(errors.New("database error"))
+
+		r := chi.NewRouter()
+		r.Get("/{shortURL}", NewRedirectHandler(&config.Config{}, mockRepo))
+
+		req := httptest.NewRequest(http.MethodGet, "/ab", nil)
+		rr := httptest.NewRecorder()
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+		assert.NotEmpty(t, rr.Header().Get("Location"))
+	})
+}
+
+func TestNewRedirectHandler_Quarantined(t *testing.T) {
+	link := repository.Link{
+		Alias:       "ab",
+		OriginalURL: "https://example.com/login?next=<script>",
+		Quarantined: true,
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockRepo.EXPECT().Resolve("ab").Return(link, nil)
+
+	r := chi.NewRouter()
+	r.Get("/{shortURL}", NewRedirectHandler(&config.Config{}, mockRepo))
+
+	req := httptest.NewRequest(http.MethodGet, "/ab", nil)
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get("Location"))
+	assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+	assert.Contains(t, rr.Body.String(), "reported as suspicious")
+	assert.Contains(t, rr.Body.String(), `href="https://example.com/login?next=%3cscript%3e"`)
+	assert.NotContains(t, rr.Body.String(), "<script>")
+
+	t.Run("split link variant is not tracked", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		splitLink := link
+		splitLink.Options.Variants = []split.Variant{{URL: "https://a.example.com", Weight: 1}}
+		mockRepo := mocks.NewMockRepository(ctrl)
+		mockRepo.EXPECT().Resolve("ab").Return(splitLink, nil)
+
+		r := chi.NewRouter()
+		r.Get("/{shortURL}", NewRedirectHandler(&config.Config{}, mockRepo))
+
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/ab", nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "https://a.example.com")
+	})
+}
+
+func TestNewRedirectHandler_Query(t *testing.T) {
+	utm := querymerge.UTM{Source: "newsletter", Medium: "email"}
+
+	tests := []struct {
+		name             string
+		originalURL      string
+		options          repository.LinkOptions
+		requestURL       string
+		expectedLocation string
+	}{
+		{
+			name:             "query is dropped by default",
+			originalURL:      "https://example.com/page",
+			requestURL:       "/q?ref=twitter",
+			expectedLocation: "https://example.com/page",
+		},
+		{
+			name:             "query passthrough",
+			originalURL:      "https://example.com/page",
+			options:          repository.LinkOptions{PassQuery: true},
+			requestURL:       "/q?ref=twitter",
+			expectedLocation: "https://example.com/page?ref=twitter",
+		},
+		{
+			name:             "destination parameters win over forwarded ones",
+			originalURL:      "https://example.com/page?ref=site",
+			options:          repository.LinkOptions{PassQuery: true},
+			requestURL:       "/q?ref=twitter&lang=de",
+			expectedLocation: "https://example.com/page?ref=site&lang=de",
+		},
+		{
+			name:             "utm injection",
+			originalURL:      "https://example.com/page",
+			options:          repository.LinkOptions{UTM: utm},
+			requestURL:       "/q?utm_source=other",
+			expectedLocation: "https://example.com/page?utm_medium=email&utm_source=newsletter",
+		},
+		{
+			name:             "utm does not override destination",
+			originalURL:      "https://example.com/page?utm_source=site",
+			options:          repository.LinkOptions{PassQuery: true, UTM: utm},
+			requestURL:       "/q?utm_medium=sms",
+			expectedLocation: "https://example.com/page?utm_source=site&utm_medium=email",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			mockRepo.EXPECT().Resolve("q").Return(repository.Link{
+				Alias:       "q",
+				OriginalURL: tt.originalURL,
+				Options:     tt.options,
+			}, nil)
+
+			r := chi.NewRouter()
+			r.Get("/{shortURL}", NewRedirectHandler(&config.Config{}, mockRepo))
+
+			req := httptest.NewRequest(http.MethodGet, tt.requestURL, nil)
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+			assert.Equal(t, tt.expectedLocation, rr.Header().Get("Location"))
+		})
+	}
+}
+
+func TestNewRedirectHandler_Status(t *testing.T) {
+	tests := []struct {
+		name           string
+		configStatus   int
+		linkStatus     int
+		expectedStatus int
+	}{
+		{
+			name:           "default status",
+			expectedStatus: http.StatusTemporaryRedirect,
+		},
+		{
+			name:           "server-wide status",
+			configStatus:   http.StatusFound,
+			expectedStatus: http.StatusFound,
+		},
+		{
+			name:           "link status overrides server-wide status",
+			configStatus:   http.StatusFound,
+			linkStatus:     http.StatusMovedPermanently,
+			expectedStatus: http.StatusMovedPermanently,
+		},
+		{
+			name:           "link status without server-wide status",
+			linkStatus:     http.StatusPermanentRedirect,
+			expectedStatus: http.StatusPermanentRedirect,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			mockRepo.EXPECT().Resolve("seo").Return(repository.Link{
+				Alias:       "seo",
+				OriginalURL: "https://example.com",
+				Options:     repository.LinkOptions{RedirectStatus: tt.linkStatus},
+			}, nil)
+
+			r := chi.NewRouter()
+			r.Get("/{shortURL}", NewRedirectHandler(&config.Config{RedirectStatus: tt.configStatus}, mockRepo))
+
+			req := httptest.NewRequest(http.MethodGet, "/seo", nil)
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, "https://example.com", rr.Header().Get("Location"))
+		})
+	}
+}
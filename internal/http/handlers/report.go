@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/aifedorov/shortener/internal/config"
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/middleware/ratelimit"
+	"github.com/aifedorov/shortener/internal/http/problem"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+// maxReportReasonLength is the maximum length of the description of a report in bytes.
+const maxReportReasonLength = 500
+
+// reportCategories lists the accepted kinds of abuse.
+var reportCategories = map[string]bool{
+	"phishing": true,
+	"spam":     true,
+	"malware":  true,
+	"other":    true,
+}
+
+// NewReportHandler creates a new HTTP handler for reporting an abusive link.
+// This handler is available to all users (no authentication required).
+// It accepts a JSON object with the short URL or alias, the category and an optional reason.
+// Reporters are identified like rate limited clients: by the user ID of registered accounts and API keys,
+// otherwise by the client IP behind the trusted proxies, so fresh anonymous sessions cannot add reporters.
+// A reporter may have one open report per link.
+// The link is quarantined once the configured number of reporters have open reports against it.
+func NewReportHandler(cfg *config.Config, repo repository.Repository, proxies ratelimit.TrustedProxies) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		var req ReportRequest
+		if err := decodeJSON(r, &req); err != nil {
+			problem.Write(rw, r, problem.InvalidBody(err.Error()))
+			return
+		}
+		alias, ok := reportedAlias(req.URL)
+		if !ok {
+			problem.Write(rw, r, problem.InvalidParameter("url must be a short URL or its alias"))
+			return
+		}
+		if !reportCategories[req.Category] {
+			problem.Write(rw, r, problem.InvalidParameter("category must be phishing, spam, malware or other"))
+			return
+		}
+		if len(req.Reason) > maxReportReasonLength {
+			problem.Write(rw, r, problem.InvalidParameter("reason must be at most 500 characters long"))
+			return
+		}
+
+		report := repository.Report{
+			ID:        uuid.NewString(),
+			Alias:     alias,
+			Category:  req.Category,
+			Reason:    strings.TrimSpace(req.Reason),
+			Reporter:  reporterHash(proxies.ClientKey(r)),
+			Status:    repository.ReportOpen,
+			CreatedAt: time.Now().UTC(),
+		}
+		quarantined, err := repo.AddReport(report, cfg.ReportThreshold)
+		switch {
+		case errors.Is(err, repository.ErrShortURLNotFound), errors.Is(err, repository.ErrURLDeleted):
+			logger.Log.Info("report: short url not found", zap.String("alias", alias))
+			problem.Write(rw, r, problem.NotFound(repository.ErrShortURLNotFound.Error()))
+			return
+		case errors.Is(err, repository.ErrLinkDisabled):
+			logger.Log.Info("report: link already disabled", zap.String("alias", alias))
+			problem.WriteError(rw, r, err)
+			return
+		case errors.Is(err, repository.ErrReportExists):
+			problem.Write(rw, r, problem.Conflict("link is already reported"))
+			return
+		case err != nil:
+			logger.Log.Error("report: failed to add report", zap.String("alias", alias), zap.Error(err))
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+		logger.Log.Info("report: link reported", zap.String("alias", alias), zap.String("category", report.Category),
+			zap.Bool("quarantined", quarantined))
+
+		logger.Log.Debug("sending HTTP 202 response")
+		rw.WriteHeader(http.StatusAccepted)
+		resp := ReportResponse{ID: report.ID, Status: report.Status}
+		if err := json.NewEncoder(rw).Encode(resp); err != nil {
+			logger.Log.Error("failed to encode response", zap.Error(err))
+			return
+		}
+	}
+}
+
+// reportedAlias returns the alias of the reported short URL, the value may also be the alias itself.
+func reportedAlias(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if u, err := url.Parse(value); err == nil && u.Host != "" {
+		value = u.Path
+	}
+	alias := strings.Trim(value, "/")
+	if alias == "" || strings.ContainsAny(alias, "/?# ") {
+		return "", false
+	}
+	return alias, true
+}
+
+// reporterHash hashes the client key, so reports do not store user IDs and addresses.
+func reporterHash(clientKey string) string {
+	sum := sha256.Sum256([]byte(clientKey))
+	return hex.EncodeToString(sum[:16])
+}
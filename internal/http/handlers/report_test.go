@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aifedorov/shortener/internal/config"
+	"github.com/aifedorov/shortener/internal/http/middleware/auth"
+	"github.com/aifedorov/shortener/internal/mocks"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+func TestNewReportHandler(t *testing.T) {
+	cfg := &config.Config{BaseURL: "http://localhost:8080", ReportThreshold: 3}
+
+	tests := []struct {
+		name           string
+		body           string
+		expectRepo     func(repo *mocks.MockRepository)
+		expectedStatus int
+	}{
+		{
+			name: "report by short URL",
+			body: `{"url":"http://localhost:8080/abc","category":"phishing","reason":" fake bank login "}`,
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().AddReport(gomock.Any(), 3).DoAndReturn(func(report repository.Report, _ int) (bool, error) {
+					assert.NotEmpty(t, report.ID)
+					assert.Equal(t, "abc", report.Alias)
+					assert.Equal(t, "phishing", report.Category)
+					assert.Equal(t, "fake bank login", report.Reason)
+					assert.Equal(t, reporterHash("user:user1"), report.Reporter)
+					assert.Equal(t, repository.ReportOpen, report.Status)
+					return true, nil
+				})
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name: "report by alias",
+			body: `{"url":"abc","category":"spam"}`,
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().AddReport(gomock.Any(), 3).Return(false, nil)
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "unknown category",
+			body:           `{"url":"abc","category":"rude"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing url",
+			body:           `{"category":"spam"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "reason too long",
+			body:           `{"url":"abc","category":"spam","reason":"` + strings.Repeat("a", maxReportReasonLength+1) + `"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid body",
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "link not found",
+			body: `{"url":"abc","category":"spam"}`,
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().AddReport(gomock.Any(), 3).Return(false, repository.ErrShortURLNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "link already disabled",
+			body: `{"url":"abc","category":"spam"}`,
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().AddReport(gomock.Any(), 3).Return(false, &repository.DisabledError{StatusCode: http.StatusGone})
+			},
+			expectedStatus: http.StatusGone,
+		},
+		{
+			name: "reported twice",
+			body: `{"url":"abc","category":"spam"}`,
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().AddReport(gomock.Any(), 3).Return(false, repository.ErrReportExists)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name: "repository error",
+			body: `{"url":"abc","category":"spam"}`,
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().AddReport(gomock.Any(), 3).Return(false, errors.New("db down"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := mocks.NewMockRepository(ctrl)
+			if tt.expectRepo != nil {
+				tt.expectRepo(repo)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/report", strings.NewReader(tt.body))
+			ctx := context.WithValue(req.Context(), auth.UserIDKey, "user1")
+			req = req.WithContext(context.WithValue(ctx, auth.AccountKey, true))
+			w := httptest.NewRecorder()
+			NewReportHandler(cfg, repo, nil).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusAccepted {
+				var resp ReportResponse
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+				assert.NotEmpty(t, resp.ID)
+				assert.Equal(t, repository.ReportOpen, resp.Status)
+			}
+		})
+	}
+
+	t.Run("anonymous reporters are identified by client IP", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		repo := mocks.NewMockRepository(ctrl)
+		repo.EXPECT().AddReport(gomock.Any(), 3).DoAndReturn(func(report repository.Report, _ int) (bool, error) {
+			assert.Equal(t, reporterHash("ip:192.0.2.1"), report.Reporter)
+			return false, nil
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/api/report", strings.NewReader(`{"url":"abc","category":"spam"}`))
+		ctx := context.WithValue(req.Context(), auth.UserIDKey, "new-user")
+		req = req.WithContext(context.WithValue(ctx, auth.NewSessionKey, true))
+		w := httptest.NewRecorder()
+		NewReportHandler(cfg, repo, nil).ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusAccepted, w.Code)
+	})
+
+	t.Run("fresh sessions from one client IP count as one reporter", func(t *testing.T) {
+		repo := repository.NewMemoryRepository()
+		repo.PathToURL = map[string]*repository.URLMapping{
+			"abc": {UserID: "owner", ShortURL: "abc", OriginalURL: "https://example.com"},
+		}
+		report := func(remoteAddr, userID string, newSession, account bool) int {
+			req := httptest.NewRequest(http.MethodPost, "/api/report", strings.NewReader(`{"url":"abc","category":"spam"}`))
+			req.RemoteAddr = remoteAddr
+			ctx := context.WithValue(req.Context(), auth.UserIDKey, userID)
+			ctx = context.WithValue(ctx, auth.NewSessionKey, newSession)
+			req = req.WithContext(context.WithValue(ctx, auth.AccountKey, account))
+			w := httptest.NewRecorder()
+			NewReportHandler(cfg, repo, nil).ServeHTTP(w, req)
+			return w.Code
+		}
+
+		assert.Equal(t, http.StatusAccepted, report("192.0.2.1:1234", "anon1", true, false))
+		for _, userID := range []string{"anon2", "anon3", "anon4"} {
+			assert.Equal(t, http.StatusConflict, report("192.0.2.1:4321", userID, true, false))
+		}
+		assert.Equal(t, http.StatusConflict, report("192.0.2.1:1234", "anon1", false, false), "a returning cookie counts by IP too")
+		assert.False(t, repo.PathToURL["abc"].Quarantined, "the threshold is not reached from one address")
+
+		assert.Equal(t, http.StatusAccepted, report("192.0.2.1:1234", "user1", false, true))
+		assert.Equal(t, http.StatusAccepted, report("198.51.100.7:1234", "anon5", true, false))
+		assert.True(t, repo.PathToURL["abc"].Quarantined)
+	})
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/problem"
+	"github.com/aifedorov/shortener/internal/pkg/rules"
+	"github.com/aifedorov/shortener/internal/pkg/validate"
+	"github.com/aifedorov/shortener/internal/pkg/workspace"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+// NewGetRulesHandler creates a new HTTP handler for retrieving the conditional redirect rules of a user's link.
+// This handler requires user authentication. If the user is not authenticated, a cookie will be created for them.
+// It responds with a JSON array of rules in evaluation order.
+// The workspace query parameter selects a link of a workspace instead, any member may read its rules.
+func NewGetRulesHandler(repo repository.Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		userID, err := getUserID(r)
+		if err != nil {
+			problem.Write(rw, r, problem.Unauthorized(detailNotAuthenticated))
+			return
+		}
+
+		ownerID, err := linkOwner(r, repo, userID, workspace.PermissionRead)
+		if err != nil {
+			writeWorkspaceError(rw, r, err)
+			return
+		}
+
+		alias := chi.URLParam(r, "alias")
+		linkRules, err := repo.GetRules(ownerID, alias)
+		if err != nil {
+			writeRulesError(rw, r, alias, err)
+			return
+		}
+
+		rw.WriteHeader(http.StatusOK)
+		if err := encodeRulesResponse(rw, linkRules); err != nil {
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+	}
+}
+
+// NewSetRulesHandler creates a new HTTP handler for replacing the conditional redirect rules of a user's link.
+// This handler requires user authentication. If the user is not authenticated, a cookie will be created for them.
+// It accepts a JSON array of rules, an empty array removes all rules, and responds with the stored rules.
+// The workspace query parameter selects a link of a workspace instead, it requires the editor or owner role.
+func NewSetRulesHandler(repo repository.Repository, urlChecker validate.URLChecker) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		userID, err := getUserID(r)
+		if err != nil {
+			problem.Write(rw, r, problem.Unauthorized(detailNotAuthenticated))
+			return
+		}
+
+		ownerID, err := linkOwner(r, repo, userID, workspace.PermissionWrite)
+		if err != nil {
+			writeWorkspaceError(rw, r, err)
+			return
+		}
+
+		linkRules, err := decodeRulesRequest(r)
+		if err != nil {
+			problem.Write(rw, r, problem.InvalidBody(err.Error()))
+			return
+		}
+
+		if err := validateRules(linkRules, urlChecker); err != nil {
+			writeURLError(rw, r, err)
+			return
+		}
+
+		alias := chi.URLParam(r, "alias")
+		if err := repo.SetRules(ownerID, alias, linkRules); err != nil {
+			writeRulesError(rw, r, alias, err)
+			return
+		}
+
+		logger.Log.Debug("sending HTTP 200 response")
+		rw.WriteHeader(http.StatusOK)
+		if err := encodeRulesResponse(rw, linkRules); err != nil {
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+	}
+}
+
+func validateRules(linkRules []rules.Rule, urlChecker validate.URLChecker) error {
+	logger.Log.Debug("validating rules")
+	for i, rule := range linkRules {
+		if err := rule.Validate(); err != nil {
+			logger.Log.Error("invalid rule", zap.Error(err))
+			return err
+		}
+		target, err := resolveURL(urlChecker, rule.Target)
+		if err != nil {
+			logger.Log.Error("invalid rule target", zap.String("url", rule.Target), zap.Error(err))
+			return fmt.Errorf("invalid rule target: %w", err)
+		}
+		linkRules[i].Target = target
+	}
+	return nil
+}
+
+func writeRulesError(rw http.ResponseWriter, r *http.Request, alias string, err error) {
+	if errors.Is(err, repository.ErrShortURLNotFound) {
+		logger.Log.Info("rules: short url not found", zap.String("alias", alias))
+		problem.WriteError(rw, r, err)
+		return
+	}
+	if errors.Is(err, repository.ErrURLDeleted) {
+		logger.Log.Info("rules: url deleted", zap.String("alias", alias))
+		problem.WriteError(rw, r, err)
+		return
+	}
+	logger.Log.Error("rules: failed to access rules", zap.String("alias", alias), zap.Error(err))
+	problem.Write(rw, r, problem.Internal())
+}
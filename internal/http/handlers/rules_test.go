@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aifedorov/shortener/internal/http/middleware/auth"
+	"github.com/aifedorov/shortener/internal/http/problem"
+	"github.com/aifedorov/shortener/internal/mocks"
+	"github.com/aifedorov/shortener/internal/pkg/rules"
+	"github.com/aifedorov/shortener/internal/pkg/validate"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+func TestNewGetRulesHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		userID         string
+		getRules       []rules.Rule
+		getRulesErr    error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "rules found",
+			userID:         "user123",
+			getRules:       []rules.Rule{{Target: "https://apps.apple.com/app", Device: rules.DeviceIOS}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[{"target":"https://apps.apple.com/app","device":"ios"}]`,
+		},
+		{
+			name:           "no rules",
+			userID:         "user123",
+			getRules:       nil,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[]`,
+		},
+		{
+			name:           "link of another user",
+			userID:         "user123",
+			getRulesErr:    repository.ErrShortURLNotFound,
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   problem.TypeNotFound,
+		},
+		{
+			name:           "deleted link",
+			userID:         "user123",
+			getRulesErr:    repository.ErrURLDeleted,
+			expectedStatus: http.StatusGone,
+			expectedBody:   problem.TypeLinkDeleted,
+		},
+		{
+			name:           "repository error",
+			userID:         "user123",
+			getRulesErr:    errors.New("database error"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   problem.TypeInternal,
+		},
+		{
+			name:           "unauthorized user",
+			userID:         "",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   problem.TypeUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			if tt.userID != "" {
+				mockRepo.EXPECT().GetRules(tt.userID, "abc123").Return(tt.getRules, tt.getRulesErr)
+			}
+
+			r := chi.NewRouter()
+			r.Get("/api/user/urls/{alias}/rules", NewGetRulesHandler(mockRepo))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls/abc123/rules", nil)
+			if tt.userID != "" {
+				req = req.WithContext(context.WithValue(req.Context(), auth.UserIDKey, tt.userID))
+			}
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.JSONEq(t, tt.expectedBody, rr.Body.String())
+			} else {
+				assertProblem(t, rr, tt.expectedStatus, tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestNewSetRulesHandler(t *testing.T) {
+	validRules := []rules.Rule{
+		{Target: "https://apps.apple.com/app", Device: rules.DeviceIOS},
+		{Target: "https://example.de", Languages: []string{"de"}},
+	}
+
+	tests := []struct {
+		name           string
+		requestBody    string
+		urlCheckerErr  error
+		expectSet      bool
+		setRulesErr    error
+		expectedStatus int
+	}{
+		{
+			name:           "rules replaced",
+			requestBody:    `[{"target":"https://apps.apple.com/app","device":"ios"},{"target":"https://example.de","languages":["de"]}]`,
+			expectSet:      true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid JSON",
+			requestBody:    `[{"target":`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown device",
+			requestBody:    `[{"target":"https://example.com","device":"watch"}]`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid target",
+			requestBody:    `[{"target":"https://apps.apple.com/app","device":"ios"},{"target":"https://example.de","languages":["de"]}]`,
+			urlCheckerErr:  errors.New("invalid URL"),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "target denied by domain policy",
+			requestBody:    `[{"target":"https://evil.com","device":"ios"}]`,
+			urlCheckerErr:  &validate.PolicyError{Host: "evil.com", Err: validate.ErrHostDenied},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "link not found",
+			requestBody:    `[{"target":"https://apps.apple.com/app","device":"ios"},{"target":"https://example.de","languages":["de"]}]`,
+			expectSet:      true,
+			setRulesErr:    repository.ErrShortURLNotFound,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			mockURLChecker := mocks.NewMockURLChecker(ctrl)
+			mockURLChecker.EXPECT().CheckURL(gomock.Any()).Return(tt.urlCheckerErr).AnyTimes()
+			if tt.expectSet {
+				mockRepo.EXPECT().SetRules("user123", "abc123", validRules).Return(tt.setRulesErr)
+			}
+
+			r := chi.NewRouter()
+			r.Put("/api/user/urls/{alias}/rules", NewSetRulesHandler(mockRepo, mockURLChecker))
+
+			req := httptest.NewRequest(http.MethodPut, "/api/user/urls/abc123/rules", strings.NewReader(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			req = req.WithContext(context.WithValue(req.Context(), auth.UserIDKey, "user123"))
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.JSONEq(t, tt.requestBody, rr.Body.String())
+			}
+		})
+	}
+}
@@ -5,10 +5,13 @@ import (
 	"net/http"
 
 	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/problem"
 	"go.uber.org/zap"
 
 	"github.com/aifedorov/shortener/internal/config"
+	"github.com/aifedorov/shortener/internal/pkg/workspace"
 	"github.com/aifedorov/shortener/internal/repository"
+	"github.com/aifedorov/shortener/internal/service"
 )
 
 // URLResponse represents a URL entry in the user's URL list response.
@@ -20,30 +23,49 @@ type URLResponse struct {
 	OriginalURL string `json:"original_url"`
 }
 
+// statusFilterBroken is the value of the status query parameter selecting broken links.
+const statusFilterBroken = "broken"
+
 // NewURLsHandler creates a new HTTP handler for retrieving all URLs belonging to a user.
 // This handler requires user authentication. If the user is not authenticated, a cookie will be created for them.
 // It returns a handler function that responds with a JSON array of user's URLs.
+// The status=broken query parameter limits the list to links whose latest dead-link check failed.
+// The workspace query parameter lists the links of a workspace instead, any member may list them.
 func NewURLsHandler(cfg *config.Config, repo repository.Repository) http.HandlerFunc {
+	links := service.NewLinks(cfg, repo, nil)
 	return func(rw http.ResponseWriter, r *http.Request) {
 		rw.Header().Set("Content-Type", "application/json")
 
 		userID, err := getUserID(r)
 		if err != nil {
 			logger.Log.Error("error getting user id", zap.Error(err))
-			http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			problem.Write(rw, r, problem.Unauthorized(detailNotAuthenticated))
+			return
+		}
+
+		ownerID, err := linkOwner(r, repo, userID, workspace.PermissionRead)
+		if err != nil {
+			writeWorkspaceError(rw, r, err)
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		if status != "" && status != statusFilterBroken {
+			logger.Log.Info("unsupported status filter", zap.String("status", status))
+			problem.Write(rw, r, problem.InvalidParameter("status must be broken"))
 			return
 		}
 
-		logger.Log.Debug("fetching urls for user_id", zap.String("user_id", userID))
-		urls, err := repo.GetAll(userID, cfg.BaseURL)
+		logger.Log.Debug("fetching urls for owner", zap.String("user_id", userID), zap.String("owner_id", ownerID))
+		urls, err := links.List(ownerID, status == statusFilterBroken)
 		if errors.Is(err, repository.ErrUserHasNoData) {
-			logger.Log.Info("user don't have any urls", zap.String("user_id", userID))
+			logger.Log.Info("user don't have any urls", zap.String("owner_id", ownerID))
 			http.Error(rw, http.StatusText(http.StatusNoContent), http.StatusNoContent)
 			return
 		}
 		if err != nil {
 			logger.Log.Error("error fetching urls", zap.Error(err))
-			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			problem.Write(rw, r, problem.Internal())
 			return
 		}
 
@@ -51,7 +73,7 @@ func NewURLsHandler(cfg *config.Config, repo repository.Repository) http.Handler
 		err = encodeURLsResponse(rw, urls)
 		if err != nil {
 			logger.Log.Error("error encoding urls", zap.Error(err))
-			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			problem.Write(rw, r, problem.Internal())
 			return
 		}
 	}
@@ -5,11 +5,12 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
-	"strings"
 	"testing"
+	"time"
 
 	"github.com/aifedorov/shortener/internal/config"
 	"github.com/aifedorov/shortener/internal/http/middleware/auth"
+	"github.com/aifedorov/shortener/internal/http/problem"
 	"github.com/aifedorov/shortener/internal/mocks"
 	"github.com/aifedorov/shortener/internal/repository"
 	"github.com/golang/mock/gomock"
@@ -50,7 +51,7 @@ func TestNewURLsHandler(t *testing.T) {
 			getAllResult:   nil,
 			getAllError:    nil,
 			expectedStatus: http.StatusUnauthorized,
-			expectedBody:   "Unauthorized\n",
+			expectedBody:   problem.TypeUnauthorized,
 		},
 		{
 			name:           "repository error",
@@ -58,7 +59,7 @@ func TestNewURLsHandler(t *testing.T) {
 			getAllResult:   nil,
 			getAllError:    errors.New("database error"),
 			expectedStatus: http.StatusInternalServerError,
-			expectedBody:   "Internal Server Error\n",
+			expectedBody:   problem.TypeInternal,
 		},
 		{
 			name:           "empty URLs list",
@@ -68,6 +69,16 @@ func TestNewURLsHandler(t *testing.T) {
 			expectedStatus: http.StatusOK,
 			expectedBody:   `[]`,
 		},
+		{
+			name:   "link settings",
+			userID: "user123",
+			getAllResult: []repository.URLOutput{
+				{ShortURL: "http://localhost:8080/abc123", OriginalURL: "https://example.com", RedirectStatus: http.StatusMovedPermanently},
+			},
+			getAllError:    nil,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[{"short_url":"http://localhost:8080/abc123","original_url":"https://example.com","redirect_status":301}]`,
+		},
 		{
 			name:   "single URL",
 			userID: "user123",
@@ -109,15 +120,79 @@ func TestNewURLsHandler(t *testing.T) {
 			handler(rr, req)
 
 			assert.Equal(t, tt.expectedStatus, rr.Code)
-			if strings.HasPrefix(tt.expectedBody, "[") {
+			switch tt.expectedStatus {
+			case http.StatusOK:
 				assert.JSONEq(t, tt.expectedBody, rr.Body.String())
-			} else {
+				assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			case http.StatusNoContent:
 				assert.Equal(t, tt.expectedBody, rr.Body.String())
+				assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+			default:
+				assertProblem(t, rr, tt.expectedStatus, tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestNewURLsHandler_BrokenFilter(t *testing.T) {
+	checkedAt := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	urls := []repository.URLOutput{
+		{ShortURL: "http://localhost:8080/ok", OriginalURL: "https://example.com", LastStatus: http.StatusOK, CheckedAt: &checkedAt},
+		{ShortURL: "http://localhost:8080/gone", OriginalURL: "https://example.com/gone", LastStatus: http.StatusNotFound, CheckedAt: &checkedAt},
+		{ShortURL: "http://localhost:8080/down", OriginalURL: "https://down.example.com", CheckedAt: &checkedAt},
+		{ShortURL: "http://localhost:8080/new", OriginalURL: "https://example.com/new"},
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectGetAll   bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "broken links",
+			query:          "?status=broken",
+			expectGetAll:   true,
+			expectedStatus: http.StatusOK,
+			expectedBody: `[{"short_url":"http://localhost:8080/gone","original_url":"https://example.com/gone","last_status":404,"checked_at":"2026-03-10T12:00:00Z"},` +
+				`{"short_url":"http://localhost:8080/down","original_url":"https://down.example.com","checked_at":"2026-03-10T12:00:00Z"}]`,
+		},
+		{
+			name:           "unsupported filter",
+			query:          "?status=alive",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   problem.TypeInvalidParameter,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cfg := &config.Config{
+				BaseURL: "http://localhost:8080",
 			}
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			if tt.expectGetAll {
+				mockRepo.EXPECT().GetAll("user123", cfg.BaseURL).Return(urls, nil)
+			}
+
+			handler := NewURLsHandler(cfg, mockRepo)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls"+tt.query, nil)
+			req = req.WithContext(context.WithValue(req.Context(), auth.UserIDKey, "user123"))
+			rr := httptest.NewRecorder()
+
+			handler(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
 			if tt.expectedStatus == http.StatusOK {
-				assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+				assert.JSONEq(t, tt.expectedBody, rr.Body.String())
 			} else {
-				assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+				assertProblem(t, rr, tt.expectedStatus, tt.expectedBody)
 			}
 		})
 	}
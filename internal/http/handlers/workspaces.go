@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/problem"
+	"github.com/aifedorov/shortener/internal/pkg/workspace"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+// workspaceParam is the query parameter selecting the workspace whose links a request works with.
+const workspaceParam = "workspace"
+
+// maxWorkspaceNameLength is the maximum length of a workspace name in bytes.
+const maxWorkspaceNameLength = 100
+
+// errForbidden is returned when the role of the user in the workspace does not grant the permission.
+var errForbidden = errors.New("forbidden")
+
+// linkOwner returns the ID owning the links the request works with: the workspace selected by the workspace
+// query parameter if the role of the user in it grants the permission, the user otherwise.
+func linkOwner(r *http.Request, repo repository.Repository, userID string, perm workspace.Permission) (string, error) {
+	workspaceID := r.URL.Query().Get(workspaceParam)
+	if workspaceID == "" {
+		return userID, nil
+	}
+	if err := checkPermission(repo, workspaceID, userID, perm); err != nil {
+		return "", err
+	}
+	return workspaceID, nil
+}
+
+// checkPermission returns nil if the role of the user in the workspace grants the permission.
+func checkPermission(repo repository.Repository, workspaceID, userID string, perm workspace.Permission) error {
+	role, err := repo.GetMemberRole(workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if !role.Can(perm) {
+		logger.Log.Info("workspace permission denied", zap.String("workspace_id", workspaceID),
+			zap.String("user_id", userID), zap.String("role", string(role)))
+		return errForbidden
+	}
+	return nil
+}
+
+// writeWorkspaceError writes the response for a failed workspace access.
+// Users outside the workspace get 404, so they cannot tell whether it exists.
+func writeWorkspaceError(rw http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, repository.ErrMemberNotFound), errors.Is(err, repository.ErrWorkspaceNotFound):
+		problem.Write(rw, r, problem.NotFound(repository.ErrWorkspaceNotFound.Error()))
+	case errors.Is(err, errForbidden):
+		problem.Write(rw, r, problem.Forbidden("role in the workspace does not allow this request"))
+	case errors.Is(err, repository.ErrLastOwner):
+		problem.Write(rw, r, problem.Conflict(err.Error()))
+	default:
+		logger.Log.Error("failed to access workspace", zap.Error(err))
+		problem.Write(rw, r, problem.Internal())
+	}
+}
+
+// NewCreateWorkspaceHandler creates a new HTTP handler for creating a workspace.
+// This handler requires user authentication. If the user is not authenticated, a cookie will be created for them.
+// It accepts a JSON object with the workspace name and makes the user its owner.
+func NewCreateWorkspaceHandler(repo repository.Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		userID, err := getUserID(r)
+		if err != nil {
+			problem.Write(rw, r, problem.Unauthorized(detailNotAuthenticated))
+			return
+		}
+
+		var req WorkspaceRequest
+		if err := decodeJSON(r, &req); err != nil {
+			problem.Write(rw, r, problem.InvalidBody(err.Error()))
+			return
+		}
+		name := strings.TrimSpace(req.Name)
+		if name == "" || len(name) > maxWorkspaceNameLength {
+			problem.Write(rw, r, problem.InvalidParameter("name must be 1 to 100 characters long"))
+			return
+		}
+
+		ws := repository.Workspace{
+			ID:        uuid.NewString(),
+			Name:      name,
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := repo.CreateWorkspace(ws, userID); err != nil {
+			logger.Log.Error("failed to create workspace", zap.Error(err))
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+
+		logger.Log.Debug("sending HTTP 201 response")
+		rw.WriteHeader(http.StatusCreated)
+		resp := repository.UserWorkspace{Workspace: ws, Role: workspace.RoleOwner}
+		if err := json.NewEncoder(rw).Encode(resp); err != nil {
+			logger.Log.Error("failed to encode response", zap.Error(err))
+			return
+		}
+	}
+}
+
+// NewWorkspacesHandler creates a new HTTP handler for listing the workspaces of the user with the role of the user.
+// This handler requires user authentication. If the user is not authenticated, a cookie will be created for them.
+func NewWorkspacesHandler(repo repository.Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		userID, err := getUserID(r)
+		if err != nil {
+			problem.Write(rw, r, problem.Unauthorized(detailNotAuthenticated))
+			return
+		}
+
+		workspaces, err := repo.GetWorkspaces(userID)
+		if err != nil {
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+
+		rw.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(rw).Encode(workspaces); err != nil {
+			logger.Log.Error("failed to encode response", zap.Error(err))
+			return
+		}
+	}
+}
+
+// NewMembersHandler creates a new HTTP handler for listing the members of a workspace.
+// This handler requires user authentication. If the user is not authenticated, a cookie will be created for them.
+// Every member may list the members, other users get 404.
+func NewMembersHandler(repo repository.Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		userID, err := getUserID(r)
+		if err != nil {
+			problem.Write(rw, r, problem.Unauthorized(detailNotAuthenticated))
+			return
+		}
+
+		workspaceID := chi.URLParam(r, "id")
+		if err := checkPermission(repo, workspaceID, userID, workspace.PermissionRead); err != nil {
+			writeWorkspaceError(rw, r, err)
+			return
+		}
+
+		members, err := repo.GetMembers(workspaceID)
+		if err != nil {
+			writeWorkspaceError(rw, r, err)
+			return
+		}
+
+		rw.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(rw).Encode(members); err != nil {
+			logger.Log.Error("failed to encode response", zap.Error(err))
+			return
+		}
+	}
+}
+
+// NewSetMemberHandler creates a new HTTP handler for adding a registered user to a workspace or changing the role of a member.
+// This handler requires user authentication. If the user is not authenticated, a cookie will be created for them.
+// It accepts a JSON object with the login and role and is restricted to owners of the workspace.
+// It responds with 409 if the change would leave the workspace without an owner.
+func NewSetMemberHandler(repo repository.Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		userID, err := getUserID(r)
+		if err != nil {
+			problem.Write(rw, r, problem.Unauthorized(detailNotAuthenticated))
+			return
+		}
+
+		workspaceID := chi.URLParam(r, "id")
+		if err := checkPermission(repo, workspaceID, userID, workspace.PermissionManage); err != nil {
+			writeWorkspaceError(rw, r, err)
+			return
+		}
+
+		var req MemberRequest
+		if err := decodeJSON(r, &req); err != nil {
+			problem.Write(rw, r, problem.InvalidBody(err.Error()))
+			return
+		}
+		role, err := workspace.ParseRole(req.Role)
+		if err != nil {
+			problem.Write(rw, r, problem.InvalidParameter(err.Error()))
+			return
+		}
+		user, err := repo.GetUserByLogin(strings.ToLower(strings.TrimSpace(req.Login)))
+		if errors.Is(err, repository.ErrUserNotFound) {
+			problem.Write(rw, r, problem.New(problem.TypeInvalidParameter, http.StatusUnprocessableEntity, err.Error()))
+			return
+		}
+		if err != nil {
+			problem.Write(rw, r, problem.Internal())
+			return
+		}
+
+		member := repository.Member{
+			WorkspaceID: workspaceID,
+			UserID:      user.ID,
+			Role:        role,
+			AddedAt:     time.Now().UTC(),
+		}
+		if err := repo.SetMember(member); err != nil {
+			writeWorkspaceError(rw, r, err)
+			return
+		}
+
+		logger.Log.Debug("sending HTTP 200 response")
+		rw.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(rw).Encode(member); err != nil {
+			logger.Log.Error("failed to encode response", zap.Error(err))
+			return
+		}
+	}
+}
+
+// NewRemoveMemberHandler creates a new HTTP handler for removing a member from a workspace.
+// This handler requires user authentication. If the user is not authenticated, a cookie will be created for them.
+// Owners may remove any member and every member may leave the workspace.
+// It responds with 409 if the member is the last owner of the workspace.
+func NewRemoveMemberHandler(repo repository.Repository) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID, err := getUserID(r)
+		if err != nil {
+			problem.Write(rw, r, problem.Unauthorized(detailNotAuthenticated))
+			return
+		}
+
+		workspaceID := chi.URLParam(r, "id")
+		memberID := chi.URLParam(r, "userID")
+		perm := workspace.PermissionManage
+		if memberID == userID {
+			perm = workspace.PermissionRead
+		}
+		if err := checkPermission(repo, workspaceID, userID, perm); err != nil {
+			writeWorkspaceError(rw, r, err)
+			return
+		}
+
+		if err := repo.RemoveMember(workspaceID, memberID); err != nil {
+			writeWorkspaceError(rw, r, err)
+			return
+		}
+
+		logger.Log.Debug("sending HTTP 204 response")
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
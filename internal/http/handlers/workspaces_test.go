@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aifedorov/shortener/internal/config"
+	"github.com/aifedorov/shortener/internal/http/middleware/auth"
+	"github.com/aifedorov/shortener/internal/mocks"
+	"github.com/aifedorov/shortener/internal/pkg/validate"
+	"github.com/aifedorov/shortener/internal/pkg/workspace"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+func workspaceRequest(method, target, body, userID string, params map[string]string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rctx := chi.NewRouteContext()
+	for key, value := range params {
+		rctx.URLParams.Add(key, value)
+	}
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+	ctx = context.WithValue(ctx, auth.UserIDKey, userID)
+	return req.WithContext(ctx)
+}
+
+func TestLinkHandlers_Workspace(t *testing.T) {
+	cfg := &config.Config{BaseURL: "http://localhost:8080"}
+
+	tests := []struct {
+		name           string
+		role           workspace.Role
+		roleErr        error
+		method         string
+		expectRepo     func(repo *mocks.MockRepository)
+		expectedStatus int
+	}{
+		{
+			name:   "viewer lists workspace links",
+			role:   workspace.RoleViewer,
+			method: http.MethodGet,
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().GetAll("ws1", cfg.BaseURL).Return([]repository.URLOutput{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "non-member cannot list workspace links",
+			roleErr:        repository.ErrMemberNotFound,
+			method:         http.MethodGet,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "editor deletes workspace links",
+			role:   workspace.RoleEditor,
+			method: http.MethodDelete,
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().DeleteBatch("ws1", []string{"abc"}).Return(nil).AnyTimes()
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "viewer cannot delete workspace links",
+			role:           workspace.RoleViewer,
+			method:         http.MethodDelete,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:   "editor stores workspace links",
+			role:   workspace.RoleEditor,
+			method: http.MethodPost,
+			expectRepo: func(repo *mocks.MockRepository) {
+				repo.EXPECT().Store("ws1", cfg.BaseURL, "https://example.com", gomock.Any()).Return(cfg.BaseURL+"/abc", nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "viewer cannot store workspace links",
+			role:           workspace.RoleViewer,
+			method:         http.MethodPost,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "role lookup fails",
+			roleErr:        errors.New("database error"),
+			method:         http.MethodGet,
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			mockRepo.EXPECT().GetMemberRole("ws1", "user123").Return(tt.role, tt.roleErr)
+			if tt.expectRepo != nil {
+				tt.expectRepo(mockRepo)
+			}
+
+			var handler http.HandlerFunc
+			var body string
+			switch tt.method {
+			case http.MethodGet:
+				handler = NewURLsHandler(cfg, mockRepo)
+			case http.MethodDelete:
+				handler = NewDeleteHandler(cfg, mockRepo)
+				body = `["abc"]`
+			case http.MethodPost:
+				handler = NewSaveJSONHandler(cfg, mockRepo, validate.NewService())
+				body = `{"url":"https://example.com"}`
+			}
+
+			req := workspaceRequest(tt.method, "/api/user/urls?workspace=ws1", body, "user123", nil)
+			rw := httptest.NewRecorder()
+			handler(rw, req)
+
+			assert.Equal(t, tt.expectedStatus, rw.Code)
+		})
+	}
+}
+
+func TestLinkHandlers_WorkspaceMemoryRepository(t *testing.T) {
+	cfg := &config.Config{BaseURL: "http://localhost:8080"}
+	repo := repository.NewMemoryRepository()
+	require.NoError(t, repo.CreateWorkspace(repository.Workspace{ID: "ws1", Name: "Marketing"}, "owner1"))
+	require.NoError(t, repo.SetMember(repository.Member{WorkspaceID: "ws1", UserID: "viewer1", Role: workspace.RoleViewer}))
+	require.NoError(t, repo.SetMember(repository.Member{WorkspaceID: "ws1", UserID: "editor1", Role: workspace.RoleEditor}))
+
+	wsURL, err := repo.Store("ws1", cfg.BaseURL, "https://example.com/workspace", repository.LinkOptions{})
+	require.NoError(t, err)
+	otherURL, err := repo.Store("stranger", cfg.BaseURL, "https://example.com/stranger", repository.LinkOptions{})
+	require.NoError(t, err)
+	wsAlias := strings.TrimPrefix(wsURL, cfg.BaseURL+"/")
+	otherAlias := strings.TrimPrefix(otherURL, cfg.BaseURL+"/")
+
+	t.Run("viewer lists only workspace links", func(t *testing.T) {
+		req := workspaceRequest(http.MethodGet, "/api/user/urls?workspace=ws1", "", "viewer1", nil)
+		rw := httptest.NewRecorder()
+		NewURLsHandler(cfg, repo)(rw, req)
+
+		require.Equal(t, http.StatusOK, rw.Code)
+		var resp []URLResponse
+		require.NoError(t, json.NewDecoder(rw.Body).Decode(&resp))
+		assert.Equal(t, []URLResponse{{ShortURL: wsURL, OriginalURL: "https://example.com/workspace"}}, resp)
+	})
+
+	t.Run("editor cannot delete links of another owner", func(t *testing.T) {
+		body := `["` + wsAlias + `","` + otherAlias + `"]`
+		req := workspaceRequest(http.MethodDelete, "/api/user/urls?workspace=ws1", body, "editor1", nil)
+		rw := httptest.NewRecorder()
+		NewDeleteHandler(cfg, repo)(rw, req)
+
+		require.Equal(t, http.StatusAccepted, rw.Code)
+		require.Eventually(t, func() bool {
+			_, err := repo.Get(wsAlias)
+			return errors.Is(err, repository.ErrURLDeleted)
+		}, time.Second, 10*time.Millisecond)
+		original, err := repo.Get(otherAlias)
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com/stranger", original)
+	})
+}
+
+func TestNewCreateWorkspaceHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		expectCreate   bool
+		createErr      error
+		expectedStatus int
+	}{
+		{
+			name:           "workspace created",
+			requestBody:    `{"name":" Marketing "}`,
+			expectCreate:   true,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "empty name",
+			requestBody:    `{"name":""}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "name is too long",
+			requestBody:    `{"name":"` + strings.Repeat("a", maxWorkspaceNameLength+1) + `"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "repository error",
+			requestBody:    `{"name":"Marketing"}`,
+			expectCreate:   true,
+			createErr:      errors.New("database error"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var created repository.Workspace
+			mockRepo := mocks.NewMockRepository(ctrl)
+			if tt.expectCreate {
+				mockRepo.EXPECT().CreateWorkspace(gomock.Any(), "user123").DoAndReturn(func(ws repository.Workspace, _ string) error {
+					created = ws
+					return tt.createErr
+				})
+			}
+
+			req := workspaceRequest(http.MethodPost, "/api/workspaces", tt.requestBody, "user123", nil)
+			rw := httptest.NewRecorder()
+			NewCreateWorkspaceHandler(mockRepo)(rw, req)
+
+			assert.Equal(t, tt.expectedStatus, rw.Code)
+			if tt.expectedStatus != http.StatusCreated {
+				return
+			}
+			var resp repository.UserWorkspace
+			require.NoError(t, json.NewDecoder(rw.Body).Decode(&resp))
+			assert.Equal(t, "Marketing", resp.Name)
+			assert.Equal(t, created.ID, resp.ID)
+			assert.Equal(t, workspace.RoleOwner, resp.Role)
+		})
+	}
+}
+
+func TestNewSetMemberHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		callerRole     workspace.Role
+		callerErr      error
+		requestBody    string
+		expectLookup   bool
+		lookupErr      error
+		expectSet      bool
+		setErr         error
+		expectedStatus int
+	}{
+		{
+			name:           "owner adds an editor",
+			callerRole:     workspace.RoleOwner,
+			requestBody:    `{"login":"Bob","role":"editor"}`,
+			expectLookup:   true,
+			expectSet:      true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "editor cannot manage members",
+			callerRole:     workspace.RoleEditor,
+			requestBody:    `{"login":"bob","role":"editor"}`,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "non-member",
+			callerErr:      repository.ErrMemberNotFound,
+			requestBody:    `{"login":"bob","role":"editor"}`,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "unknown role",
+			callerRole:     workspace.RoleOwner,
+			requestBody:    `{"login":"bob","role":"admin"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown user",
+			callerRole:     workspace.RoleOwner,
+			requestBody:    `{"login":"bob","role":"viewer"}`,
+			expectLookup:   true,
+			lookupErr:      repository.ErrUserNotFound,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "last owner demoted",
+			callerRole:     workspace.RoleOwner,
+			requestBody:    `{"login":"bob","role":"viewer"}`,
+			expectLookup:   true,
+			expectSet:      true,
+			setErr:         repository.ErrLastOwner,
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			mockRepo.EXPECT().GetMemberRole("ws1", "user123").Return(tt.callerRole, tt.callerErr)
+			if tt.expectLookup {
+				mockRepo.EXPECT().GetUserByLogin("bob").Return(repository.User{ID: "user456", Login: "bob"}, tt.lookupErr)
+			}
+			if tt.expectSet {
+				mockRepo.EXPECT().SetMember(gomock.Any()).DoAndReturn(func(member repository.Member) error {
+					assert.Equal(t, "ws1", member.WorkspaceID)
+					assert.Equal(t, "user456", member.UserID)
+					return tt.setErr
+				})
+			}
+
+			req := workspaceRequest(http.MethodPost, "/api/workspaces/ws1/members", tt.requestBody, "user123",
+				map[string]string{"id": "ws1"})
+			rw := httptest.NewRecorder()
+			NewSetMemberHandler(mockRepo)(rw, req)
+
+			assert.Equal(t, tt.expectedStatus, rw.Code)
+		})
+	}
+}
+
+func TestNewRemoveMemberHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		memberID       string
+		callerRole     workspace.Role
+		expectRemove   bool
+		removeErr      error
+		expectedStatus int
+	}{
+		{
+			name:           "owner removes a member",
+			memberID:       "user456",
+			callerRole:     workspace.RoleOwner,
+			expectRemove:   true,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "viewer leaves the workspace",
+			memberID:       "user123",
+			callerRole:     workspace.RoleViewer,
+			expectRemove:   true,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "viewer cannot remove another member",
+			memberID:       "user456",
+			callerRole:     workspace.RoleViewer,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "last owner cannot leave",
+			memberID:       "user123",
+			callerRole:     workspace.RoleOwner,
+			expectRemove:   true,
+			removeErr:      repository.ErrLastOwner,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "member not found",
+			memberID:       "user789",
+			callerRole:     workspace.RoleOwner,
+			expectRemove:   true,
+			removeErr:      repository.ErrMemberNotFound,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			mockRepo.EXPECT().GetMemberRole("ws1", "user123").Return(tt.callerRole, nil)
+			if tt.expectRemove {
+				mockRepo.EXPECT().RemoveMember("ws1", tt.memberID).Return(tt.removeErr)
+			}
+
+			req := workspaceRequest(http.MethodDelete, "/api/workspaces/ws1/members/"+tt.memberID, "", "user123",
+				map[string]string{"id": "ws1", "userID": tt.memberID})
+			rw := httptest.NewRecorder()
+			NewRemoveMemberHandler(mockRepo)(rw, req)
+
+			assert.Equal(t, tt.expectedStatus, rw.Code)
+		})
+	}
+}
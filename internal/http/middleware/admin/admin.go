@@ -0,0 +1,118 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/aifedorov/shortener/internal/http/middleware/auth"
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/problem"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+// ContextKey represents a type for context keys used in admin authorization.
+type ContextKey string
+
+// ActorKey is the context key used to store the operator identity in request context.
+const ActorKey ContextKey = "admin_actor"
+
+// TokenHeader is the request header carrying the admin credential.
+const TokenHeader = "X-Admin-Token"
+
+// TokenActor identifies operators authenticated with the admin credential.
+const TokenActor = "token"
+
+// UserStore resolves the users authenticated by the auth middleware.
+type UserStore interface {
+	// GetUserByID returns the registered user with the given ID.
+	GetUserByID(userID string) (repository.User, error)
+}
+
+// Config holds the admin access settings.
+type Config struct {
+	// Token is the admin credential accepted in the X-Admin-Token header, empty disables it.
+	Token string
+	// Logins are the logins of registered users with the admin role.
+	Logins []string
+}
+
+// Middleware restricts routes to operators.
+type Middleware struct {
+	// cfg holds the admin access settings.
+	cfg Config
+	// users resolves the authenticated users.
+	users UserStore
+}
+
+// NewMiddleware creates a new admin middleware instance.
+func NewMiddleware(cfg Config, users UserStore) *Middleware {
+	return &Middleware{
+		cfg:   cfg,
+		users: users,
+	}
+}
+
+// RequireAdmin allows requests carrying the admin credential or made by a registered user with the admin role.
+// A wrong admin credential is rejected with 401, other requests with 403, both with problem details.
+// The operator identity is stored in the request context under ActorKey.
+// It must run after the auth middleware.
+func (m *Middleware) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.Header.Get(TokenHeader); token != "" {
+			if m.cfg.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(m.cfg.Token)) != 1 {
+				logger.Log.Info("admin: invalid admin token")
+				problem.Write(w, r, problem.Unauthorized("invalid admin token"))
+				return
+			}
+			serveAs(w, r, TokenActor, next)
+			return
+		}
+
+		login, err := m.adminLogin(r)
+		if err != nil {
+			logger.Log.Error("admin: failed to resolve user", zap.Error(err))
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		if login == "" {
+			problem.Write(w, r, problem.Forbidden("admin access required"))
+			return
+		}
+		serveAs(w, r, "user:"+login, next)
+	})
+}
+
+// adminLogin returns the login of the authenticated user if it has the admin role, or an empty string.
+func (m *Middleware) adminLogin(r *http.Request) (string, error) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" || len(m.cfg.Logins) == 0 {
+		return "", nil
+	}
+
+	user, err := m.users.GetUserByID(userID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		logger.Log.Info("admin: user is not registered", zap.String("user_id", userID))
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, login := range m.cfg.Logins {
+		if strings.EqualFold(login, user.Login) {
+			return user.Login, nil
+		}
+	}
+	logger.Log.Info("admin: user is not an admin", zap.String("login", user.Login))
+	return "", nil
+}
+
+func serveAs(w http.ResponseWriter, r *http.Request, actor string, next http.Handler) {
+	logger.Log.Debug("admin: access granted", zap.String("actor", actor))
+	ctx := context.WithValue(r.Context(), ActorKey, actor)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
@@ -0,0 +1,114 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aifedorov/shortener/internal/http/middleware/auth"
+	"github.com/aifedorov/shortener/internal/mocks"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+func TestMiddleware_RequireAdmin(t *testing.T) {
+	const userID = "user123"
+
+	tests := []struct {
+		name           string
+		cfg            Config
+		token          string
+		user           repository.User
+		userErr        error
+		expectLookup   bool
+		expectedStatus int
+		expectedActor  string
+	}{
+		{
+			name:           "admin token",
+			cfg:            Config{Token: "secret"},
+			token:          "secret",
+			expectedStatus: http.StatusOK,
+			expectedActor:  TokenActor,
+		},
+		{
+			name:           "wrong admin token",
+			cfg:            Config{Token: "secret"},
+			token:          "guess",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "admin token not configured",
+			token:          "secret",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "user with admin role",
+			cfg:            Config{Logins: []string{"alice"}},
+			user:           repository.User{ID: userID, Login: "alice"},
+			expectLookup:   true,
+			expectedStatus: http.StatusOK,
+			expectedActor:  "user:alice",
+		},
+		{
+			name:           "user without admin role",
+			cfg:            Config{Logins: []string{"alice"}},
+			user:           repository.User{ID: userID, Login: "bob"},
+			expectLookup:   true,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "anonymous user",
+			cfg:            Config{Logins: []string{"alice"}},
+			userErr:        repository.ErrUserNotFound,
+			expectLookup:   true,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "no admin logins",
+			cfg:            Config{Token: "secret"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "user lookup failure",
+			cfg:            Config{Logins: []string{"alice"}},
+			userErr:        errors.New("db down"),
+			expectLookup:   true,
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			users := mocks.NewMockRepository(ctrl)
+			if tt.expectLookup {
+				users.EXPECT().GetUserByID(userID).Return(tt.user, tt.userErr)
+			}
+
+			var actor string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				actor, _ = r.Context().Value(ActorKey).(string)
+				w.WriteHeader(http.StatusOK)
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/api/admin/links", nil)
+			r = r.WithContext(context.WithValue(r.Context(), auth.UserIDKey, userID))
+			if tt.token != "" {
+				r.Header.Set(TokenHeader, tt.token)
+			}
+			w := httptest.NewRecorder()
+
+			NewMiddleware(tt.cfg, users).RequireAdmin(next).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedActor, actor)
+		})
+	}
+}
@@ -3,8 +3,8 @@ package auth
 import (
 	"context"
 	"errors"
-	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -12,6 +12,9 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/problem"
+	"github.com/aifedorov/shortener/internal/pkg/apikey"
+	"github.com/aifedorov/shortener/internal/repository"
 )
 
 // ContextKey represents a type for context keys used in authentication.
@@ -20,124 +23,359 @@ type ContextKey string
 // UserIDKey is the context key used to store the user ID in request context.
 const UserIDKey ContextKey = "user_id"
 
+// NewSessionKey is the context key set to true when the user ID was created for a request without credentials.
+const NewSessionKey ContextKey = "new_session"
+
+// AccountKey is the context key set to true when the request comes from the session of a registered account.
+const AccountKey ContextKey = "account"
+
+// APIKeyKey is the context key set to true when the request was authenticated with an API key.
+const APIKeyKey ContextKey = "api_key"
+
+// Token defaults
+const (
+	// DefaultTokenTTL is the lifetime of a JWT token and its cookie when none is configured.
+	DefaultTokenTTL = 24 * time.Hour
+	// DefaultRenewBefore is the remaining lifetime below which a token is renewed when none is configured.
+	DefaultRenewBefore = 6 * time.Hour
+)
+
 const (
-	// tokenExp defines the JWT token expiration time.
-	tokenExp = time.Hour * 3
 	// tokenName is the name of the JWT cookie.
 	tokenName = "JWT"
+	// TokenHeader is the response header carrying a new or renewed token for clients using bearer tokens.
+	TokenHeader = "X-Auth-Token"
+	// apiKeyHeader is the header carrying an API key.
+	apiKeyHeader = "X-API-Key"
+	// bearerPrefix starts the Authorization header value carrying a bearer token.
+	bearerPrefix = "Bearer "
 )
 
+// Token errors
+var (
+	// ErrTokenExpired is returned when the token has expired.
+	ErrTokenExpired = errors.New("token expired")
+	// ErrInvalidToken is returned when the token is malformed or its signature does not match.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrUnknownAPIKey is returned when the API key is unknown or revoked.
+	ErrUnknownAPIKey = errors.New("unknown api key")
+)
+
+// KeyStore resolves API keys to the users owning them.
+type KeyStore interface {
+	// GetAPIKeyUser returns the ID of the user owning the active API key with the given hash.
+	GetAPIKeyUser(keyHash string) (string, error)
+}
+
 // Claims represents the JWT claims structure for user authentication.
 type Claims struct {
 	jwt.RegisteredClaims
 	// UserID is the unique identifier for the authenticated user.
 	UserID string
+	// Account is set for the sessions of registered accounts started by IssueToken, anonymous sessions omit it.
+	Account bool `json:",omitempty"`
+}
+
+// Config holds the token settings of the middleware.
+type Config struct {
+	// Keyring signs new tokens and verifies received ones.
+	Keyring *Keyring
+	// TokenTTL is the lifetime of a token and of the cookie carrying it, DefaultTokenTTL if zero.
+	TokenTTL time.Duration
+	// RenewBefore is the remaining lifetime below which a valid token is replaced by a new one,
+	// DefaultRenewBefore if zero.
+	RenewBefore time.Duration
+}
+
+// Identity is the user authenticated by the credentials of a request.
+type Identity struct {
+	// UserID is the ID of the user.
+	UserID string
+	// NewSession is set when the user ID was created for a request without credentials.
+	NewSession bool
+	// Account is set when the token belongs to the session of a registered account.
+	Account bool
+	// APIKey is set when the user was authenticated with an API key.
+	APIKey bool
+	// Token is a new or renewed token to return to the client, empty if the client keeps its token.
+	Token string
 }
 
 // Middleware provides JWT-based authentication middleware for HTTP handlers.
 type Middleware struct {
-	// secretKey is used for signing and validating JWT tokens.
-	secretKey string
+	// cfg holds the token settings.
+	cfg Config
+	// keys resolves API keys, nil disables API key authentication.
+	keys KeyStore
+	// now returns the current time.
+	now func() time.Time
 }
 
 // NewMiddleware creates a new authentication middleware instance.
-// The secretKey is used for JWT token signing and validation.
-func NewMiddleware(secretKey string) *Middleware {
+// The config holds the JWT settings, keys resolves API keys and may be nil.
+func NewMiddleware(cfg Config, keys KeyStore) *Middleware {
+	if cfg.TokenTTL <= 0 {
+		cfg.TokenTTL = DefaultTokenTTL
+	}
+	if cfg.RenewBefore <= 0 {
+		cfg.RenewBefore = DefaultRenewBefore
+	}
 	return &Middleware{
-		secretKey: secretKey,
+		cfg:  cfg,
+		keys: keys,
+		now:  time.Now,
 	}
 }
 
 // JWTAuth provides JWT-based authentication middleware.
-// It extracts user ID from JWT cookies and creates new cookies for unauthenticated users.
+// Requests with an API key in the X-API-Key header or as an Authorization bearer token are authenticated
+// as the owner of the key and rejected with 401 if the key is unknown or revoked.
+// Otherwise the JWT is taken from the Authorization bearer token or the JWT cookie, and new users
+// get a cookie and an X-Auth-Token header. Expired tokens are rejected with 401 and the reason,
+// tokens close to expiry or signed with a retired key are re-issued through the channel they came from.
+// Rejected requests are answered with problem details.
 func (m *Middleware) JWTAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie(tokenName)
-		if errors.Is(err, http.ErrNoCookie) {
-			logger.Log.Info("auth: cookie not present", zap.String("name", tokenName))
+		if key, ok := apiKeyFromRequest(r); ok {
+			m.serveAPIKey(w, r, key, next)
+			return
+		}
 
-			logger.Log.Debug("auth: creating new user_id")
-			userID := uuid.NewString()
-			setNewCookies(userID, m.secretKey, w)
+		token, fromHeader := bearerToken(r)
+		if !fromHeader {
+			cookie, err := r.Cookie(tokenName)
+			if errors.Is(err, http.ErrNoCookie) {
+				logger.Log.Info("auth: cookie not present", zap.String("name", tokenName))
 
-			ctx := context.WithValue(r.Context(), UserIDKey, userID)
-			next.ServeHTTP(w, r.WithContext(ctx))
-			return
+				logger.Log.Debug("auth: creating new user_id")
+				userID := uuid.NewString()
+				if _, err := m.issueToken(w, userID, false, true); err != nil {
+					problem.Write(w, r, problem.Internal())
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), UserIDKey, userID)
+				ctx = context.WithValue(ctx, NewSessionKey, true)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+			token = cookie.Value
 		}
 
-		userID, err := parseUserID(cookie.Value, m.secretKey)
+		claims, kid, err := m.parseClaims(token)
+		if errors.Is(err, ErrTokenExpired) {
+			logger.Log.Info("auth: token expired", zap.Bool("bearer", fromHeader))
+			if !fromHeader {
+				clearCookie(w)
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="token expired"`)
+			problem.Write(w, r, problem.Unauthorized(ErrTokenExpired.Error()))
+			return
+		}
 		if err != nil {
-			logger.Log.Error("auth: failed to get cookie", zap.String("name", tokenName), zap.Error(err))
-			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			logger.Log.Error("auth: failed to parse token", zap.Bool("bearer", fromHeader), zap.Error(err))
+			problem.Write(w, r, problem.InvalidParameter(ErrInvalidToken.Error()))
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), UserIDKey, userID)
+		if m.needsRenewal(claims, kid) {
+			logger.Log.Debug("auth: renewing token", zap.String("user_id", claims.UserID))
+			if _, err := m.issueToken(w, claims.UserID, claims.Account, !fromHeader); err != nil {
+				problem.Write(w, r, problem.Internal())
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+		if claims.Account {
+			ctx = context.WithValue(ctx, AccountKey, true)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func parseUserID(tokenString, secretKey string) (string, error) {
+// Authenticate resolves the credentials of a request that does not come through JWTAuth, e.g. a gRPC call.
+// The API key takes precedence over the token. Without credentials a new user ID gets a new token,
+// valid tokens close to expiry or signed with a retired key are renewed like in JWTAuth.
+// It returns ErrUnknownAPIKey, ErrTokenExpired or ErrInvalidToken for rejected credentials.
+func (m *Middleware) Authenticate(key, token string) (Identity, error) {
+	if key != "" {
+		userID, err := m.apiKeyUser(key)
+		return Identity{UserID: userID, APIKey: true}, err
+	}
+
+	if token == "" {
+		logger.Log.Debug("auth: creating new user_id")
+		identity := Identity{UserID: uuid.NewString(), NewSession: true}
+		var err error
+		identity.Token, err = buildJWTString(identity.UserID, false, m.cfg.Keyring, m.now().Add(m.cfg.TokenTTL))
+		return identity, err
+	}
+
+	claims, kid, err := m.parseClaims(token)
+	if err != nil {
+		return Identity{}, err
+	}
+	identity := Identity{UserID: claims.UserID, Account: claims.Account}
+	if m.needsRenewal(claims, kid) {
+		logger.Log.Debug("auth: renewing token", zap.String("user_id", claims.UserID))
+		identity.Token, err = buildJWTString(claims.UserID, claims.Account, m.cfg.Keyring, m.now().Add(m.cfg.TokenTTL))
+	}
+	return identity, err
+}
+
+func (m *Middleware) serveAPIKey(w http.ResponseWriter, r *http.Request, key string, next http.Handler) {
+	userID, err := m.apiKeyUser(key)
+	if errors.Is(err, ErrUnknownAPIKey) {
+		problem.Write(w, r, problem.Unauthorized(ErrUnknownAPIKey.Error()))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, problem.Internal())
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), UserIDKey, userID)
+	ctx = context.WithValue(ctx, APIKeyKey, true)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// apiKeyUser returns the owner of the API key, it returns ErrUnknownAPIKey if the key is unknown or revoked.
+func (m *Middleware) apiKeyUser(key string) (string, error) {
+	if m.keys == nil {
+		logger.Log.Info("auth: api keys are not supported")
+		return "", ErrUnknownAPIKey
+	}
+
+	userID, err := m.keys.GetAPIKeyUser(apikey.Hash(key))
+	if errors.Is(err, repository.ErrAPIKeyNotFound) {
+		logger.Log.Info("auth: unknown api key", zap.String("prefix", apikey.DisplayPrefix(key)))
+		return "", ErrUnknownAPIKey
+	}
+	if err != nil {
+		logger.Log.Error("auth: failed to resolve api key", zap.Error(err))
+		return "", err
+	}
+	return userID, nil
+}
+
+// apiKeyFromRequest returns the API key sent in the X-API-Key header or as an Authorization bearer token.
+func apiKeyFromRequest(r *http.Request) (string, bool) {
+	if key := strings.TrimSpace(r.Header.Get(apiKeyHeader)); key != "" {
+		return key, true
+	}
+	token, ok := bearerToken(r)
+	if ok && apikey.IsKey(token) {
+		return token, true
+	}
+	return "", false
+}
+
+// bearerToken returns the token of the Authorization header.
+func bearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), bearerPrefix)
+	token = strings.TrimSpace(token)
+	return token, ok && token != ""
+}
+
+// parseClaims verifies the token and returns its claims and the ID of the key it was signed with.
+func (m *Middleware) parseClaims(tokenString string) (*Claims, string, error) {
 	logger.Log.Debug("auth: parsing token")
 	if tokenString == "" {
 		logger.Log.Error("auth: empty token")
-		return "", errors.New("auth: token is empty")
+		return nil, "", ErrInvalidToken
 	}
 
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims,
-		func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("auth: unexpected signing method: %v", t.Header["alg"])
-			}
-			return []byte(secretKey), nil
-		})
-	if err != nil {
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+	token, err := parser.ParseWithClaims(tokenString, claims, m.cfg.Keyring.keyFunc)
+	if err != nil || !token.Valid {
 		logger.Log.Error("auth: error parsing token", zap.Error(err))
-		return "", errors.New("auth: invalid token")
+		return nil, "", ErrInvalidToken
 	}
 
 	logger.Log.Debug("auth: checking token")
-	if !token.Valid {
-		logger.Log.Error("auth: invalid token")
-		return "", errors.New("auth: invalid token")
+	if claims.ExpiresAt == nil || !m.now().Before(claims.ExpiresAt.Time) {
+		return nil, "", ErrTokenExpired
+	}
+	if claims.UserID == "" {
+		return nil, "", ErrInvalidToken
 	}
-	return claims.UserID, nil
+	kid, _ := token.Header["kid"].(string)
+	return claims, kid, nil
+}
+
+// needsRenewal reports whether the token is close to expiry or was signed with a retired key.
+func (m *Middleware) needsRenewal(claims *Claims, kid string) bool {
+	return kid != m.cfg.Keyring.ActiveID() || claims.ExpiresAt.Time.Sub(m.now()) < m.cfg.RenewBefore
+}
+
+// IssueToken starts a session of the registered account: a new token is sent in the JWT cookie and the X-Auth-Token
+// header and returned, it replaces the token set by JWTAuth for the current request.
+func (m *Middleware) IssueToken(w http.ResponseWriter, userID string) (string, error) {
+	return m.issueToken(w, userID, true, true)
 }
 
-func setNewCookies(userID, secretKey string, w http.ResponseWriter) {
-	logger.Log.Debug("auth: setting new cookies", zap.String("user_id", userID))
-	token, err := buildJWTString(userID, secretKey)
+// issueToken sends a new token for the user in the X-Auth-Token header and, if withCookie is set, in the cookie.
+// The account flag marks the session of a registered account. The cookie expires together with the token.
+func (m *Middleware) issueToken(w http.ResponseWriter, userID string, account, withCookie bool) (string, error) {
+	expiresAt := m.now().Add(m.cfg.TokenTTL)
+	token, err := buildJWTString(userID, account, m.cfg.Keyring, expiresAt)
 	if err != nil {
 		logger.Log.Error("auth: failed to build JWT token", zap.String("error", err.Error()))
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
+		return "", err
+	}
+
+	w.Header().Set(TokenHeader, token)
+	if withCookie {
+		logger.Log.Debug("auth: setting cookie with JWT token", zap.String("user_id", userID))
+		setCookie(w, &http.Cookie{
+			Name:     tokenName,
+			Value:    token,
+			Expires:  expiresAt,
+			MaxAge:   int(m.cfg.TokenTTL.Seconds()),
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   false,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+	return token, nil
+}
+
+// setCookie sets the cookie, replacing a cookie with the same name set earlier in the response.
+func setCookie(w http.ResponseWriter, cookie *http.Cookie) {
+	header := w.Header()
+	cookies := header.Values("Set-Cookie")
+	header.Del("Set-Cookie")
+	for _, line := range cookies {
+		if !strings.HasPrefix(line, cookie.Name+"=") {
+			header.Add("Set-Cookie", line)
+		}
 	}
+	http.SetCookie(w, cookie)
+}
 
-	logger.Log.Debug("auth: setting cookie with JWT token")
-	cookie := http.Cookie{
+func clearCookie(w http.ResponseWriter) {
+	setCookie(w, &http.Cookie{
 		Name:     tokenName,
-		Value:    token,
-		Expires:  time.Now().Add(24 * time.Hour),
+		Value:    "",
+		MaxAge:   -1,
 		Path:     "/",
 		HttpOnly: true,
-		Secure:   false,
 		SameSite: http.SameSiteStrictMode,
-	}
-
-	http.SetCookie(w, &cookie)
+	})
 }
 
-func buildJWTString(userID, secretKey string) (string, error) {
+func buildJWTString(userID string, account bool, keyring *Keyring, expiresAt time.Time) (string, error) {
 	logger.Log.Debug("auth: building JWT token with user_id", zap.String("user_id", userID))
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+	tokenString, err := keyring.Sign(Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenExp)),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 		},
-		UserID: userID,
+		UserID:  userID,
+		Account: account,
 	})
-
-	tokenString, err := token.SignedString([]byte(secretKey))
 	if err != nil {
 		logger.Log.Error("auth: failed to sign JWT token", zap.String("error", err.Error()))
 		return "", err
@@ -0,0 +1,431 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aifedorov/shortener/internal/http/problem"
+	"github.com/aifedorov/shortener/internal/mocks"
+	"github.com/aifedorov/shortener/internal/pkg/apikey"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+func secretKeyring(t *testing.T, secret string) *Keyring {
+	t.Helper()
+	keyring, err := NewSecretKeyring(secret)
+	require.NoError(t, err)
+	return keyring
+}
+
+func assertProblem(t *testing.T, rr *httptest.ResponseRecorder, typ, detail string) {
+	t.Helper()
+	assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+	var p problem.Problem
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&p))
+	assert.Equal(t, typ, p.Type)
+	assert.Equal(t, detail, p.Detail)
+}
+
+func TestMiddleware_APIKey(t *testing.T) {
+	const key = "shk_testkey"
+
+	tests := []struct {
+		name           string
+		header         string
+		value          string
+		lookupUser     string
+		lookupErr      error
+		expectLookup   bool
+		expectedStatus int
+		expectedUser   string
+	}{
+		{
+			name:           "x-api-key header",
+			header:         apiKeyHeader,
+			value:          key,
+			lookupUser:     "user123",
+			expectLookup:   true,
+			expectedStatus: http.StatusOK,
+			expectedUser:   "user123",
+		},
+		{
+			name:           "bearer token",
+			header:         "Authorization",
+			value:          "Bearer " + key,
+			lookupUser:     "user123",
+			expectLookup:   true,
+			expectedStatus: http.StatusOK,
+			expectedUser:   "user123",
+		},
+		{
+			name:           "revoked or unknown key",
+			header:         apiKeyHeader,
+			value:          key,
+			lookupErr:      repository.ErrAPIKeyNotFound,
+			expectLookup:   true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "repository error",
+			header:         "Authorization",
+			value:          "Bearer " + key,
+			lookupErr:      errors.New("database error"),
+			expectLookup:   true,
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			if tt.expectLookup {
+				mockRepo.EXPECT().GetAPIKeyUser(apikey.Hash(key)).Return(tt.lookupUser, tt.lookupErr)
+			}
+
+			var gotUser string
+			var gotAPIKey bool
+			next := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				gotUser, _ = r.Context().Value(UserIDKey).(string)
+				gotAPIKey, _ = r.Context().Value(APIKeyKey).(bool)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+			req.Header.Set(tt.header, tt.value)
+			rr := httptest.NewRecorder()
+
+			NewMiddleware(Config{Keyring: secretKeyring(t, "secret")}, mockRepo).JWTAuth(next).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedUser, gotUser)
+			assert.Equal(t, tt.expectedUser != "", gotAPIKey)
+			assert.Empty(t, rr.Result().Cookies(), "api key requests get no cookie")
+		})
+	}
+}
+
+func TestMiddleware_Cookie(t *testing.T) {
+	m := NewMiddleware(Config{Keyring: secretKeyring(t, "secret")}, nil)
+
+	var firstUser string
+	var firstNew bool
+	rr := httptest.NewRecorder()
+	m.JWTAuth(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		firstUser, _ = r.Context().Value(UserIDKey).(string)
+		firstNew, _ = r.Context().Value(NewSessionKey).(bool)
+	})).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/user/urls", nil))
+
+	cookies := rr.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.NotEmpty(t, firstUser)
+		assert.True(t, firstNew)
+
+		var secondUser string
+		secondNew := true
+		req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+		req.AddCookie(cookies[0])
+		m.JWTAuth(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			secondUser, _ = r.Context().Value(UserIDKey).(string)
+			secondNew, _ = r.Context().Value(NewSessionKey).(bool)
+		})).ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, firstUser, secondUser)
+		assert.False(t, secondNew)
+	}
+
+	rr = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+	req.Header.Set(apiKeyHeader, "shk_testkey")
+	m.JWTAuth(http.NotFoundHandler()).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code, "api keys are rejected without a key store")
+	assertProblem(t, rr, problem.TypeUnauthorized, "unknown api key")
+}
+
+func TestMiddleware_Token(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	cfg := Config{Keyring: secretKeyring(t, "secret"), TokenTTL: 24 * time.Hour, RenewBefore: time.Hour}
+
+	sign := func(t *testing.T, expiresAt time.Time) string {
+		t.Helper()
+		token, err := buildJWTString("user123", false, cfg.Keyring, expiresAt)
+		require.NoError(t, err)
+		return token
+	}
+
+	tests := []struct {
+		name           string
+		expiresAt      time.Time
+		bearer         bool
+		secret         string
+		expectedStatus int
+		expectedUser   string
+		expectRenewal  bool
+	}{
+		{
+			name:           "valid cookie",
+			expiresAt:      now.Add(12 * time.Hour),
+			expectedStatus: http.StatusOK,
+			expectedUser:   "user123",
+		},
+		{
+			name:           "valid bearer token",
+			expiresAt:      now.Add(12 * time.Hour),
+			bearer:         true,
+			expectedStatus: http.StatusOK,
+			expectedUser:   "user123",
+		},
+		{
+			name:           "cookie close to expiry is renewed",
+			expiresAt:      now.Add(30 * time.Minute),
+			expectedStatus: http.StatusOK,
+			expectedUser:   "user123",
+			expectRenewal:  true,
+		},
+		{
+			name:           "bearer token close to expiry is renewed",
+			expiresAt:      now.Add(30 * time.Minute),
+			bearer:         true,
+			expectedStatus: http.StatusOK,
+			expectedUser:   "user123",
+			expectRenewal:  true,
+		},
+		{
+			name:           "expired cookie",
+			expiresAt:      now.Add(-time.Minute),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "expired bearer token",
+			expiresAt:      now.Add(-time.Minute),
+			bearer:         true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "foreign signature",
+			expiresAt:      now.Add(12 * time.Hour),
+			bearer:         true,
+			secret:         "other",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMiddleware(cfg, nil)
+			m.now = func() time.Time { return now }
+
+			token := sign(t, tt.expiresAt)
+			if tt.secret != "" {
+				var err error
+				token, err = buildJWTString("user123", false, secretKeyring(t, tt.secret), tt.expiresAt)
+				require.NoError(t, err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+			if tt.bearer {
+				req.Header.Set("Authorization", "Bearer "+token)
+			} else {
+				req.AddCookie(&http.Cookie{Name: tokenName, Value: token})
+			}
+			rr := httptest.NewRecorder()
+
+			var gotUser string
+			m.JWTAuth(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				gotUser, _ = r.Context().Value(UserIDKey).(string)
+			})).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedUser, gotUser)
+			if tt.expectedStatus == http.StatusUnauthorized {
+				assertProblem(t, rr, problem.TypeUnauthorized, "token expired")
+				assert.Contains(t, rr.Header().Get("WWW-Authenticate"), "token expired")
+			}
+			if tt.expectedStatus == http.StatusBadRequest {
+				assertProblem(t, rr, problem.TypeInvalidParameter, "invalid token")
+			}
+
+			renewed := rr.Header().Get(TokenHeader)
+			if !tt.expectRenewal {
+				assert.Empty(t, renewed)
+				return
+			}
+			claims, _, err := m.parseClaims(renewed)
+			require.NoError(t, err)
+			assert.Equal(t, "user123", claims.UserID)
+			assert.True(t, now.Add(cfg.TokenTTL).Equal(claims.ExpiresAt.Time))
+
+			cookies := rr.Result().Cookies()
+			if tt.bearer {
+				assert.Empty(t, cookies, "bearer clients get the renewed token in the header only")
+				return
+			}
+			require.Len(t, cookies, 1)
+			assert.Equal(t, renewed, cookies[0].Value)
+			assert.Equal(t, int(cfg.TokenTTL.Seconds()), cookies[0].MaxAge, "cookie lives as long as the token")
+		})
+	}
+}
+
+func TestMiddleware_IssueToken(t *testing.T) {
+	m := NewMiddleware(Config{Keyring: secretKeyring(t, "secret")}, nil)
+
+	rr := httptest.NewRecorder()
+	m.JWTAuth(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		_, err := m.IssueToken(rw, "registered")
+		require.NoError(t, err)
+	})).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/login", nil))
+
+	cookies := rr.Result().Cookies()
+	require.Len(t, cookies, 1, "the anonymous cookie is replaced")
+	assert.Equal(t, rr.Header().Get(TokenHeader), cookies[0].Value)
+
+	claims, _, err := m.parseClaims(cookies[0].Value)
+	require.NoError(t, err)
+	assert.Equal(t, "registered", claims.UserID)
+	assert.True(t, claims.Account, "login and registration start account sessions")
+}
+
+func TestMiddleware_AccountSession(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	cfg := Config{Keyring: secretKeyring(t, "secret"), TokenTTL: 24 * time.Hour, RenewBefore: time.Hour}
+	m := NewMiddleware(cfg, nil)
+	m.now = func() time.Time { return now }
+
+	tests := []struct {
+		name    string
+		account bool
+	}{
+		{name: "account session", account: true},
+		{name: "anonymous session", account: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := buildJWTString("user123", tt.account, cfg.Keyring, now.Add(30*time.Minute))
+			require.NoError(t, err)
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+			req.AddCookie(&http.Cookie{Name: tokenName, Value: token})
+			rr := httptest.NewRecorder()
+
+			var gotAccount bool
+			m.JWTAuth(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				gotAccount, _ = r.Context().Value(AccountKey).(bool)
+			})).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.account, gotAccount)
+			claims, _, err := m.parseClaims(rr.Header().Get(TokenHeader))
+			require.NoError(t, err)
+			assert.Equal(t, tt.account, claims.Account, "renewal keeps the kind of the session")
+
+			identity, err := m.Authenticate("", token)
+			require.NoError(t, err)
+			assert.Equal(t, tt.account, identity.Account)
+		})
+	}
+}
+
+func TestMiddleware_Authenticate(t *testing.T) {
+	const key = "shk_testkey"
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	cfg := Config{Keyring: secretKeyring(t, "secret"), TokenTTL: 24 * time.Hour, RenewBefore: time.Hour}
+
+	sign := func(t *testing.T, expiresAt time.Time) string {
+		t.Helper()
+		token, err := buildJWTString("user123", false, cfg.Keyring, expiresAt)
+		require.NoError(t, err)
+		return token
+	}
+
+	tests := []struct {
+		name          string
+		key           string
+		token         string
+		lookupErr     error
+		expectedErr   error
+		expectedUser  string
+		expectNew     bool
+		expectedToken bool
+	}{
+		{
+			name:         "api key",
+			key:          key,
+			expectedUser: "user123",
+		},
+		{
+			name:        "unknown api key",
+			key:         key,
+			lookupErr:   repository.ErrAPIKeyNotFound,
+			expectedErr: ErrUnknownAPIKey,
+		},
+		{
+			name:          "no credentials",
+			expectNew:     true,
+			expectedToken: true,
+		},
+		{
+			name:         "valid token",
+			token:        sign(t, now.Add(12*time.Hour)),
+			expectedUser: "user123",
+		},
+		{
+			name:          "token close to expiry is renewed",
+			token:         sign(t, now.Add(30*time.Minute)),
+			expectedUser:  "user123",
+			expectedToken: true,
+		},
+		{
+			name:        "expired token",
+			token:       sign(t, now.Add(-time.Minute)),
+			expectedErr: ErrTokenExpired,
+		},
+		{
+			name:        "malformed token",
+			token:       "garbage",
+			expectedErr: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			if tt.key != "" {
+				mockRepo.EXPECT().GetAPIKeyUser(apikey.Hash(tt.key)).Return("user123", tt.lookupErr)
+			}
+
+			m := NewMiddleware(cfg, mockRepo)
+			m.now = func() time.Time { return now }
+
+			identity, err := m.Authenticate(tt.key, tt.token)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectNew, identity.NewSession)
+			assert.Equal(t, tt.key != "", identity.APIKey)
+			if tt.expectNew {
+				assert.NotEmpty(t, identity.UserID)
+			} else {
+				assert.Equal(t, tt.expectedUser, identity.UserID)
+			}
+			assert.Equal(t, tt.expectedToken, identity.Token != "")
+			if identity.Token != "" {
+				claims, _, err := m.parseClaims(identity.Token)
+				require.NoError(t, err)
+				assert.Equal(t, identity.UserID, claims.UserID)
+			}
+		})
+	}
+}
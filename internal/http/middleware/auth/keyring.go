@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Keyring entry roles
+const (
+	// RoleActive marks the key new tokens are signed with, a keyring has exactly one.
+	RoleActive = "active"
+	// RoleVerify marks a retired key that is still accepted for verification.
+	RoleVerify = "verify"
+)
+
+// Keyring errors
+var (
+	// ErrInvalidKeyring is returned when a keyring definition cannot be parsed.
+	ErrInvalidKeyring = errors.New("invalid keyring")
+	// ErrUnknownKey is returned when a token names a key that is not in the keyring.
+	ErrUnknownKey = errors.New("unknown signing key")
+)
+
+// Key is an HMAC key of the keyring.
+type Key struct {
+	// ID is sent in the kid header of the tokens signed with the key,
+	// an empty ID matches tokens without a kid header.
+	ID string
+	// Secret is the HMAC secret.
+	Secret []byte
+}
+
+// Keyring holds the key tokens are signed with and the retired keys still accepted for verification.
+type Keyring struct {
+	// active is the signing key.
+	active Key
+	// keys maps key IDs to secrets of all accepted keys, including the active one.
+	keys map[string][]byte
+}
+
+// NewKeyring creates a keyring signing with the active key and also accepting the verify keys.
+func NewKeyring(active Key, verify ...Key) (*Keyring, error) {
+	k := &Keyring{active: active, keys: make(map[string][]byte)}
+	for _, key := range append([]Key{active}, verify...) {
+		if len(key.Secret) == 0 {
+			return nil, fmt.Errorf("%w: key %q has no secret", ErrInvalidKeyring, key.ID)
+		}
+		if _, exists := k.keys[key.ID]; exists {
+			return nil, fmt.Errorf("%w: duplicate key %q", ErrInvalidKeyring, key.ID)
+		}
+		k.keys[key.ID] = key.Secret
+	}
+	return k, nil
+}
+
+// NewSecretKeyring creates a keyring with a single key without ID,
+// it signs and accepts tokens without a kid header.
+func NewSecretKeyring(secret string) (*Keyring, error) {
+	return NewKeyring(Key{Secret: []byte(secret)})
+}
+
+// ParseKeyring creates a keyring from its definition.
+// Entries are separated by new lines or semicolons, each entry is "active <kid> <secret>" or
+// "verify <kid> <secret>", and text after # is a comment. Exactly one entry must be active.
+// If legacySecret is not empty it is accepted for tokens without a kid header,
+// so tokens issued before the keyring was introduced are re-issued instead of rejected.
+func ParseKeyring(definition, legacySecret string) (*Keyring, error) {
+	var active *Key
+	var verify []Key
+	for _, line := range strings.FieldsFunc(definition, func(r rune) bool { return r == '\n' || r == ';' }) {
+		text, _, _ := strings.Cut(line, "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%w: entry must be \"<role> <kid> <secret>\"", ErrInvalidKeyring)
+		}
+
+		key := Key{ID: fields[1], Secret: []byte(fields[2])}
+		switch strings.ToLower(fields[0]) {
+		case RoleActive:
+			if active != nil {
+				return nil, fmt.Errorf("%w: more than one active key", ErrInvalidKeyring)
+			}
+			active = &key
+		case RoleVerify:
+			verify = append(verify, key)
+		default:
+			return nil, fmt.Errorf("%w: unknown role %s", ErrInvalidKeyring, fields[0])
+		}
+	}
+	if active == nil {
+		return nil, fmt.Errorf("%w: no active key", ErrInvalidKeyring)
+	}
+	if legacySecret != "" {
+		verify = append(verify, Key{Secret: []byte(legacySecret)})
+	}
+	return NewKeyring(*active, verify...)
+}
+
+// LoadKeyring creates a keyring from the definition in the file at the given path.
+func LoadKeyring(path, legacySecret string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyring(string(data), legacySecret)
+}
+
+// ActiveID returns the ID of the signing key.
+func (k *Keyring) ActiveID() string {
+	return k.active.ID
+}
+
+// Sign signs the claims with the active key and names the key in the kid header.
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if k.active.ID != "" {
+		token.Header["kid"] = k.active.ID
+	}
+	return token.SignedString(k.active.Secret)
+}
+
+// keyFunc returns the secret of the key named in the kid header of the token.
+func (k *Keyring) keyFunc(t *jwt.Token) (interface{}, error) {
+	if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("auth: unexpected signing method: %v", t.Header["alg"])
+	}
+	kid, _ := t.Header["kid"].(string)
+	secret, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	return secret, nil
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeyring(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition string
+		legacy     string
+		wantActive string
+		wantKeys   int
+		wantErr    bool
+	}{
+		{
+			name:       "lines with comments",
+			definition: "# rotated in may\nactive k2 second\nverify k1 first\n",
+			wantActive: "k2",
+			wantKeys:   2,
+		},
+		{
+			name:       "semicolon separated",
+			definition: "active k2 second; verify k1 first",
+			wantActive: "k2",
+			wantKeys:   2,
+		},
+		{
+			name:       "legacy secret",
+			definition: "active k1 first",
+			legacy:     "legacy",
+			wantActive: "k1",
+			wantKeys:   2,
+		},
+		{name: "no active key", definition: "verify k1 first", wantErr: true},
+		{name: "two active keys", definition: "active k1 first; active k2 second", wantErr: true},
+		{name: "duplicate key id", definition: "active k1 first; verify k1 second", wantErr: true},
+		{name: "unknown role", definition: "active k1 first; retire k0 zero", wantErr: true},
+		{name: "missing secret", definition: "active k1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring, err := ParseKeyring(tt.definition, tt.legacy)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidKeyring)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantActive, keyring.ActiveID())
+			assert.Len(t, keyring.keys, tt.wantKeys)
+		})
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.txt")
+	require.NoError(t, os.WriteFile(path, []byte("active k2 second\nverify k1 first\n"), 0600))
+
+	keyring, err := LoadKeyring(path, "")
+	require.NoError(t, err)
+	assert.Equal(t, "k2", keyring.ActiveID())
+
+	_, err = LoadKeyring(filepath.Join(t.TempDir(), "missing.txt"), "")
+	assert.Error(t, err)
+}
+
+func TestMiddleware_KeyRotation(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := now.Add(12 * time.Hour)
+
+	oldKeyring, err := ParseKeyring("active k1 first", "")
+	require.NoError(t, err)
+	legacyKeyring := secretKeyring(t, "legacy")
+	unknownKeyring, err := ParseKeyring("active k9 ninth", "")
+	require.NoError(t, err)
+	keyring, err := ParseKeyring("active k2 second; verify k1 first", "legacy")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		signedWith     *Keyring
+		expectedStatus int
+		expectReissue  bool
+	}{
+		{name: "active key", signedWith: keyring, expectedStatus: http.StatusOK},
+		{name: "retired key is re-issued", signedWith: oldKeyring, expectedStatus: http.StatusOK, expectReissue: true},
+		{name: "token without kid is re-issued", signedWith: legacyKeyring, expectedStatus: http.StatusOK, expectReissue: true},
+		{name: "unknown key", signedWith: unknownKeyring, expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMiddleware(Config{Keyring: keyring, TokenTTL: 24 * time.Hour, RenewBefore: time.Hour}, nil)
+			m.now = func() time.Time { return now }
+
+			token, err := buildJWTString("user123", false, tt.signedWith, expiresAt)
+			require.NoError(t, err)
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+			req.AddCookie(&http.Cookie{Name: tokenName, Value: token})
+			rr := httptest.NewRecorder()
+
+			m.JWTAuth(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			reissued := rr.Header().Get(TokenHeader)
+			if !tt.expectReissue {
+				assert.Empty(t, reissued)
+				return
+			}
+			parsed, _, err := jwt.NewParser().ParseUnverified(reissued, &Claims{})
+			require.NoError(t, err)
+			assert.Equal(t, "k2", parsed.Header["kid"], "re-issued token is signed with the active key")
+			require.Len(t, rr.Result().Cookies(), 1)
+			assert.Equal(t, reissued, rr.Result().Cookies()[0].Value)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidLimit is returned when a limit definition cannot be parsed.
+var ErrInvalidLimit = errors.New("invalid rate limit")
+
+// Limit is the size and refill rate of a token bucket: up to Requests requests in a burst,
+// refilled evenly over Period. The zero Limit disables limiting.
+type Limit struct {
+	// Requests is the capacity of the bucket.
+	Requests int
+	// Period is the time the bucket takes to refill from empty.
+	Period time.Duration
+}
+
+// ParseLimit parses a limit written as "<requests>/<period>", e.g. "60/1m".
+// An empty value or "0" returns the zero Limit.
+func ParseLimit(value string) (Limit, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "0" {
+		return Limit{}, nil
+	}
+	requests, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("%w: %q, expected <requests>/<period>", ErrInvalidLimit, value)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(requests))
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("%w: %q, requests must be a positive integer", ErrInvalidLimit, value)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(period))
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("%w: %q, period must be a positive duration", ErrInvalidLimit, value)
+	}
+	return Limit{Requests: n, Period: d}, nil
+}
+
+// IsZero reports whether the limit disables limiting.
+func (l Limit) IsZero() bool {
+	return l.Requests <= 0 || l.Period <= 0
+}
+
+// String returns the limit in the format accepted by ParseLimit.
+func (l Limit) String() string {
+	if l.IsZero() {
+		return "0"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// rate returns the number of tokens added to the bucket per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// refill returns the tokens of a bucket holding tokens at updatedAt, refilled until now.
+func (l Limit) refill(tokens float64, updatedAt, now time.Time) float64 {
+	if elapsed := now.Sub(updatedAt); elapsed > 0 {
+		tokens += elapsed.Seconds() * l.rate()
+	}
+	return math.Min(tokens, float64(l.Requests))
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	// Allowed reports whether a token was available and the request may proceed.
+	Allowed bool
+	// Remaining is the number of whole tokens left in the bucket.
+	Remaining int
+	// RetryAfter is the time until the next token is available, zero if the request was allowed.
+	RetryAfter time.Duration
+	// ResetAfter is the time until the bucket is full again.
+	ResetAfter time.Duration
+}
+
+// result describes a bucket left with tokens after a request.
+func (l Limit) result(tokens float64, allowed bool) Result {
+	res := Result{
+		Allowed:    allowed,
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: l.wait(float64(l.Requests) - tokens),
+	}
+	if !allowed {
+		res.RetryAfter = l.wait(1 - tokens)
+	}
+	return res
+}
+
+// wait returns the time the bucket takes to gain the tokens.
+func (l Limit) wait(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.rate() * float64(time.Second))
+}
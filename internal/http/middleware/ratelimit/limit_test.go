@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		expected  Limit
+		expectErr bool
+	}{
+		{name: "per minute", value: "60/1m", expected: Limit{Requests: 60, Period: time.Minute}},
+		{name: "with spaces", value: " 5 / 10s ", expected: Limit{Requests: 5, Period: 10 * time.Second}},
+		{name: "empty disables", value: ""},
+		{name: "zero disables", value: "0"},
+		{name: "missing period", value: "60", expectErr: true},
+		{name: "negative requests", value: "-1/1m", expectErr: true},
+		{name: "invalid period", value: "10/minute", expectErr: true},
+		{name: "zero period", value: "10/0s", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit, err := ParseLimit(tt.value)
+			if tt.expectErr {
+				assert.ErrorIs(t, err, ErrInvalidLimit)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, limit)
+		})
+	}
+}
+
+func TestLimit_Result(t *testing.T) {
+	limit := Limit{Requests: 10, Period: 10 * time.Second}
+
+	res := limit.result(4.5, true)
+	assert.Equal(t, Result{Allowed: true, Remaining: 4, ResetAfter: 5500 * time.Millisecond}, res)
+
+	res = limit.result(0.25, false)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, 750*time.Millisecond, res.RetryAfter)
+	assert.Equal(t, 9750*time.Millisecond, res.ResetAfter)
+}
+
+func TestMemoryStore_Take(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 2, Period: 2 * time.Second}
+	now := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	for i := 1; i >= 0; i-- {
+		res, err := store.Take("a", limit, now)
+		assert.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+	}
+
+	res, err := store.Take("a", limit, now)
+	assert.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+
+	res, err = store.Take("b", limit, now)
+	assert.NoError(t, err)
+	assert.True(t, res.Allowed, "buckets are separate per key")
+
+	res, err = store.Take("a", limit, now.Add(time.Second))
+	assert.NoError(t, err)
+	assert.True(t, res.Allowed, "a token is refilled after a second")
+	assert.Equal(t, 0, res.Remaining)
+
+	_, err = store.Take("c", limit, now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, store.Len(), "idle buckets are removed")
+}
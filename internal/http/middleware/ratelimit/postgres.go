@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+)
+
+// createTableQuery creates the table of the token buckets.
+const createTableQuery = `CREATE TABLE IF NOT EXISTS rate_limits (
+		key TEXT PRIMARY KEY,
+		tokens DOUBLE PRECISION NOT NULL,
+		allowed BOOLEAN NOT NULL,
+		period INTERVAL NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL
+	);`
+
+// takeQuery takes a token from a bucket in a single statement, so concurrent instances share the bucket.
+// $1 is the key, $2 the capacity, $3 the refill rate per second, $4 the current time
+// and $5 the refill period in seconds.
+const takeQuery = `INSERT INTO rate_limits AS b (key, tokens, allowed, period, updated_at)
+		VALUES ($1, $2::float8 - 1, TRUE, make_interval(secs => $5), $4)
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = ` + refilledTokens + ` - CASE WHEN ` + refilledTokens + ` >= 1 THEN 1 ELSE 0 END,
+			allowed = ` + refilledTokens + ` >= 1,
+			period = make_interval(secs => $5),
+			updated_at = GREATEST(b.updated_at, $4)
+		RETURNING tokens, allowed;`
+
+// refilledTokens is the SQL expression of the tokens in the existing bucket refilled until the current time.
+const refilledTokens = `LEAST($2::float8,
+			b.tokens + GREATEST(EXTRACT(EPOCH FROM ($4::timestamptz - b.updated_at))::float8, 0) * $3::float8)`
+
+// PostgresStore keeps the token buckets in PostgreSQL, it limits all instances sharing the database.
+type PostgresStore struct {
+	// db is the database connection pool.
+	db *sql.DB
+	// ctx is the context for database operations.
+	ctx context.Context
+	// dsn is the database connection string.
+	dsn string
+	// sweptAt is the time of the latest removal of idle buckets.
+	sweptAt time.Time
+	// mu provides thread-safe access to sweptAt.
+	mu sync.Mutex
+}
+
+// NewPostgresStore creates a new PostgreSQL bucket store. It must be started with Run.
+func NewPostgresStore(ctx context.Context, dsn string) *PostgresStore {
+	return &PostgresStore{
+		ctx: ctx,
+		dsn: dsn,
+	}
+}
+
+// Run opens the database connection and creates the bucket table.
+func (s *PostgresStore) Run() error {
+	db, err := sql.Open("pgx", s.dsn)
+	if err != nil {
+		logger.Log.Error("ratelimit: failed to open postgres", zap.Error(err))
+		return err
+	}
+	s.db = db
+
+	if _, err := s.db.ExecContext(s.ctx, createTableQuery); err != nil {
+		logger.Log.Error("ratelimit: failed to create table", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// Close closes the database connection.
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+// Take takes a token from the bucket of the key.
+func (s *PostgresStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	s.sweep(now)
+
+	var tokens float64
+	var allowed bool
+	row := s.db.QueryRowContext(s.ctx, takeQuery, key, limit.Requests, limit.rate(), now, limit.Period.Seconds())
+	if err := row.Scan(&tokens, &allowed); err != nil {
+		logger.Log.Error("ratelimit: failed to take token", zap.String("key", key), zap.Error(err))
+		return Result{}, errors.New("failed to take token")
+	}
+	return limit.result(tokens, allowed), nil
+}
+
+// sweep removes the buckets idle for longer than their refill period, they would be full anyway.
+func (s *PostgresStore) sweep(now time.Time) {
+	s.mu.Lock()
+	if now.Sub(s.sweptAt) < sweepInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.sweptAt = now
+	s.mu.Unlock()
+
+	if _, err := s.db.ExecContext(s.ctx, "DELETE FROM rate_limits WHERE updated_at + period < $1;", now); err != nil {
+		logger.Log.Error("ratelimit: failed to remove idle buckets", zap.Error(err))
+	}
+}
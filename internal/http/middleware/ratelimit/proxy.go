@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/aifedorov/shortener/internal/http/middleware/auth"
+)
+
+// TrustedProxies is the set of proxy addresses whose X-Forwarded-For header is trusted.
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies parses proxy addresses and CIDR ranges, e.g. "10.0.0.0/8" or "192.168.1.1".
+func ParseTrustedProxies(values []string) (TrustedProxies, error) {
+	proxies := make(TrustedProxies, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if strings.Contains(value, "/") {
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+			}
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+		}
+		addr = addr.Unmap()
+		proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return proxies, nil
+}
+
+// contains reports whether the address belongs to a trusted proxy.
+func (p TrustedProxies) contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client sending the request.
+// The X-Forwarded-For header is only used when the connection comes from a trusted proxy, it is read
+// from the right and the first address that is not a trusted proxy is the client.
+func (p TrustedProxies) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote, err := netip.ParseAddr(host)
+	if err != nil || !p.contains(remote) {
+		return host
+	}
+
+	client := remote
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap()
+		if !p.contains(client) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// ClientKey identifies the client of the request. The user ID is only used for registered accounts and API keys,
+// anonymous sessions are free to create and a client rotating them would otherwise get a new bucket every time.
+func (p TrustedProxies) ClientKey(r *http.Request) string {
+	if key, ok := UserKey(r.Context()); ok {
+		return key
+	}
+	return "ip:" + p.ClientIP(r)
+}
+
+// UserKey returns the key of the authenticated user of the context
+// if the user signed in with a registered account or an API key.
+func UserKey(ctx context.Context) (string, bool) {
+	userID, _ := ctx.Value(auth.UserIDKey).(string)
+	account, _ := ctx.Value(auth.AccountKey).(bool)
+	apiKey, _ := ctx.Value(auth.APIKeyKey).(bool)
+	if userID == "" || !account && !apiKey {
+		return "", false
+	}
+	return "user:" + userID, true
+}
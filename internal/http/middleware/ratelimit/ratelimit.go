@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/problem"
+)
+
+// Rate limit response headers
+const (
+	// headerLimit is the capacity of the bucket.
+	headerLimit = "RateLimit-Limit"
+	// headerRemaining is the number of requests left in the bucket.
+	headerRemaining = "RateLimit-Remaining"
+	// headerReset is the number of seconds until the bucket is full again.
+	headerReset = "RateLimit-Reset"
+	// headerPolicy describes the limit as the capacity and the refill period in seconds.
+	headerPolicy = "RateLimit-Policy"
+)
+
+// Limiter limits the rate of requests with token buckets.
+// Requests of registered accounts and API keys share a bucket per user, other requests a bucket per client IP.
+type Limiter struct {
+	// store holds the buckets.
+	store Store
+	// proxies are the proxies trusted to report the client IP.
+	proxies TrustedProxies
+	// now returns the current time.
+	now func() time.Time
+}
+
+// NewLimiter creates a new rate limiter keeping its buckets in the store.
+func NewLimiter(store Store, proxies TrustedProxies) *Limiter {
+	return &Limiter{
+		store:   store,
+		proxies: proxies,
+		now:     time.Now,
+	}
+}
+
+// Limit returns a middleware applying the limit to the routes it wraps, it must run after the auth middleware.
+// Routes wrapped with the same name share the buckets. Responses carry the RateLimit-* headers,
+// requests over the limit are rejected with a 429 rate-limited problem and a Retry-After header.
+// If the store fails the request is let through. The zero Limit disables limiting.
+func (l *Limiter) Limit(name string, limit Limit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit.IsZero() {
+			return next
+		}
+		policy := strconv.Itoa(limit.Requests) + ";w=" + strconv.Itoa(int(math.Ceil(limit.Period.Seconds())))
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := l.proxies.ClientKey(r)
+			key := name + "|" + client
+			res, err := l.Take(name, client, limit)
+			if err != nil {
+				logger.Log.Error("ratelimit: failed to take token", zap.String("key", key), zap.Error(err))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Set(headerLimit, strconv.Itoa(limit.Requests))
+			header.Set(headerRemaining, strconv.Itoa(res.Remaining))
+			header.Set(headerReset, strconv.Itoa(seconds(res.ResetAfter)))
+			header.Set(headerPolicy, policy)
+			if !res.Allowed {
+				logger.Log.Info("ratelimit: limit exceeded", zap.String("key", key))
+				header.Set("Retry-After", strconv.Itoa(max(seconds(res.RetryAfter), 1)))
+				problem.Write(w, r, problem.RateLimited())
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Take takes a token for the client from the buckets of the routes limited with the name.
+// It lets other APIs, e.g. gRPC, share the buckets of the HTTP routes when they identify clients like ClientKey.
+func (l *Limiter) Take(name, client string, limit Limit) (Result, error) {
+	return l.store.Take(name+"|"+client, limit, l.now())
+}
+
+// seconds rounds the duration up to whole seconds.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,197 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aifedorov/shortener/internal/http/middleware/auth"
+	"github.com/aifedorov/shortener/internal/http/problem"
+)
+
+type failingStore struct{}
+
+func (failingStore) Take(string, Limit, time.Time) (Result, error) {
+	return Result{}, errors.New("db down")
+}
+
+func limitedRequest(remoteAddr, userID string, account bool) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/shorten", nil)
+	r.RemoteAddr = remoteAddr
+	ctx := context.WithValue(r.Context(), auth.UserIDKey, userID)
+	ctx = context.WithValue(ctx, auth.AccountKey, account)
+	return r.WithContext(ctx)
+}
+
+func TestLimiter_Limit(t *testing.T) {
+	now := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(NewMemoryStore(), nil)
+	limiter.now = func() time.Time { return now }
+	handler := limiter.Limit("shorten", Limit{Requests: 2, Period: time.Minute})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(limitedRequest("192.0.2.1:1234", "user1", true))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "2;w=60", w.Header().Get("RateLimit-Policy"))
+
+	w = serve(limitedRequest("198.51.100.7:1234", "user1", true))
+	assert.Equal(t, http.StatusCreated, w.Code, "users keep their bucket across addresses")
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	w = serve(limitedRequest("192.0.2.1:1234", "user1", true))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), problem.TypeRateLimited)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	for _, userID := range []string{"anon1", "anon2"} {
+		w = serve(limitedRequest("203.0.113.5:1234", userID, false))
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+	w = serve(limitedRequest("203.0.113.5:1234", "anon3", false))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "anonymous sessions are limited by client IP")
+
+	now = now.Add(30 * time.Second)
+	w = serve(limitedRequest("192.0.2.1:1234", "user1", true))
+	assert.Equal(t, http.StatusCreated, w.Code, "the bucket refills over time")
+}
+
+func TestLimiter_Limit_Disabled(t *testing.T) {
+	limiter := NewLimiter(failingStore{}, nil)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	limiter.Limit("redirect", Limit{})(next).ServeHTTP(w, limitedRequest("192.0.2.1:1234", "", false))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"), "the zero limit disables limiting")
+
+	w = httptest.NewRecorder()
+	limiter.Limit("redirect", Limit{Requests: 1, Period: time.Second})(next).ServeHTTP(w, limitedRequest("192.0.2.1:1234", "", false))
+	assert.Equal(t, http.StatusOK, w.Code, "requests pass when the store fails")
+}
+
+func TestTrustedProxies_ClientKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		ctx      map[auth.ContextKey]interface{}
+		expected string
+	}{
+		{
+			name:     "registered account",
+			ctx:      map[auth.ContextKey]interface{}{auth.UserIDKey: "user1", auth.AccountKey: true},
+			expected: "user:user1",
+		},
+		{
+			name:     "api key",
+			ctx:      map[auth.ContextKey]interface{}{auth.UserIDKey: "user1", auth.APIKeyKey: true},
+			expected: "user:user1",
+		},
+		{
+			name:     "anonymous session",
+			ctx:      map[auth.ContextKey]interface{}{auth.UserIDKey: "user1"},
+			expected: "ip:192.0.2.1",
+		},
+		{
+			name:     "new session",
+			ctx:      map[auth.ContextKey]interface{}{auth.UserIDKey: "user1", auth.NewSessionKey: true},
+			expected: "ip:192.0.2.1",
+		},
+		{
+			name:     "no user",
+			expected: "ip:192.0.2.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/abc", nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+			ctx := r.Context()
+			for key, value := range tt.ctx {
+				ctx = context.WithValue(ctx, key, value)
+			}
+			assert.Equal(t, tt.expected, TrustedProxies(nil).ClientKey(r.WithContext(ctx)))
+		})
+	}
+}
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.10"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		expected   string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "198.51.100.7:1234",
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "untrusted proxy cannot spoof",
+			remoteAddr: "198.51.100.7:1234",
+			forwarded:  []string{"203.0.113.5"},
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "10.1.2.3:1234",
+			forwarded:  []string{"203.0.113.5"},
+			expected:   "203.0.113.5",
+		},
+		{
+			name:       "chain of trusted proxies",
+			remoteAddr: "10.1.2.3:1234",
+			forwarded:  []string{"1.1.1.1, 203.0.113.5", "192.0.2.10"},
+			expected:   "203.0.113.5",
+		},
+		{
+			name:       "malformed entry stops the walk",
+			remoteAddr: "10.1.2.3:1234",
+			forwarded:  []string{"203.0.113.5, garbage"},
+			expected:   "10.1.2.3",
+		},
+		{
+			name:       "ipv4-mapped proxy address",
+			remoteAddr: "[::ffff:10.1.2.3]:1234",
+			forwarded:  []string{"203.0.113.5"},
+			expected:   "203.0.113.5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/abc", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			assert.Equal(t, tt.expected, proxies.ClientIP(r))
+		})
+	}
+
+	_, err = ParseTrustedProxies([]string{"not-an-ip"})
+	assert.Error(t, err)
+}
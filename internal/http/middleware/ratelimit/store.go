@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is the time between two removals of idle buckets.
+const sweepInterval = time.Minute
+
+// Store holds the token buckets of the limiter.
+type Store interface {
+	// Take takes a token from the bucket of the key, created full if it does not exist, and returns the outcome.
+	Take(key string, limit Limit, now time.Time) (Result, error)
+}
+
+// bucket is a token bucket kept in memory.
+type bucket struct {
+	// tokens is the number of tokens at updatedAt.
+	tokens float64
+	// updatedAt is the time of the latest request.
+	updatedAt time.Time
+	// period is the refill period of the bucket's limit, a bucket idle for longer is full.
+	period time.Duration
+}
+
+// MemoryStore keeps the token buckets in memory, it limits a single instance.
+type MemoryStore struct {
+	// buckets holds the buckets by key.
+	buckets map[string]*bucket
+	// sweptAt is the time of the latest removal of idle buckets.
+	sweptAt time.Time
+	// mu provides thread-safe access to the buckets.
+	mu sync.Mutex
+}
+
+// NewMemoryStore creates a new in-memory bucket store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Take takes a token from the bucket of the key.
+func (s *MemoryStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Requests), updatedAt: now}
+		s.buckets[key] = b
+	}
+	b.tokens = limit.refill(b.tokens, b.updatedAt, now)
+	if now.After(b.updatedAt) {
+		b.updatedAt = now
+	}
+	b.period = limit.Period
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return limit.result(b.tokens, allowed), nil
+}
+
+// Len returns the number of buckets in the store.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
+
+// sweep removes the buckets idle for longer than their refill period, they would be full anyway.
+// Callers must hold the lock.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.sweptAt) < sweepInterval {
+		return
+	}
+	s.sweptAt = now
+	for key, b := range s.buckets {
+		if now.Sub(b.updatedAt) >= b.period {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Package openapi holds the OpenAPI document of the HTTP API.
+// It serves the document and its docs UI and validates requests and responses against it.
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"go.uber.org/zap"
+
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+)
+
+// Routes of the document and its docs UI.
+const (
+	// SpecPath is the path the OpenAPI document is served at.
+	SpecPath = "/api/openapi.json"
+	// DocsPath is the path the docs UI is served at.
+	DocsPath = "/api/docs"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+// docsPage renders the document with Swagger UI, the UI assets are loaded from a CDN.
+//
+//go:embed docs.html
+var docsPage []byte
+
+// Spec returns the OpenAPI document as JSON.
+func Spec() []byte {
+	return spec
+}
+
+// Load parses and validates the OpenAPI document.
+func Load() (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(spec)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// NewSpecHandler creates a new HTTP handler serving the OpenAPI document.
+// This handler is available to all users (no authentication required).
+func NewSpecHandler() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		logger.Log.Debug("sending HTTP 200 response")
+		rw.WriteHeader(http.StatusOK)
+		if _, err := rw.Write(spec); err != nil {
+			logger.Log.Error("openapi: failed to write document", zap.Error(err))
+		}
+	}
+}
+
+// NewDocsHandler creates a new HTTP handler serving the docs UI of the OpenAPI document.
+// This handler is available to all users (no authentication required).
+func NewDocsHandler() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		logger.Log.Debug("sending HTTP 200 response")
+		rw.WriteHeader(http.StatusOK)
+		if _, err := rw.Write(docsPage); err != nil {
+			logger.Log.Error("openapi: failed to write docs page", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package openapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aifedorov/shortener/internal/http/handlers"
+	"github.com/aifedorov/shortener/internal/http/problem"
+	"github.com/aifedorov/shortener/internal/pkg/querymerge"
+	"github.com/aifedorov/shortener/internal/pkg/rules"
+	"github.com/aifedorov/shortener/internal/pkg/split"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+// models maps the object schemas of the document to the types encoded in the request and response bodies.
+var models = map[string]interface{}{
+	"ShortenRequest":         handlers.RequestBody{},
+	"ShortenResponse":        handlers.Response{},
+	"BatchRequest":           handlers.BatchRequest{},
+	"BatchResponse":          handlers.BatchResponse{},
+	"LinkRequest":            handlers.LinkRequest{},
+	"LinkBatchRequest":       handlers.LinkBatchRequest{},
+	"LinkBatchItem":          handlers.LinkBatchItem{},
+	"DeleteLinksRequest":     handlers.DeleteLinksRequest{},
+	"LinkResponse":           handlers.LinkResponse{},
+	"LinkBatchResult":        handlers.LinkBatchResult{},
+	"LinkData":               handlers.DataResponse{},
+	"LinkListData":           handlers.DataResponse{},
+	"LinkBatchData":          handlers.DataResponse{},
+	"Variant":                split.Variant{},
+	"UTM":                    querymerge.UTM{},
+	"URLOutput":              repository.URLOutput{},
+	"Rule":                   rules.Rule{},
+	"APIKeyRequest":          handlers.APIKeyRequest{},
+	"APIKeyResponse":         handlers.APIKeyResponse{},
+	"CredentialsRequest":     handlers.CredentialsRequest{},
+	"AccountResponse":        handlers.AccountResponse{},
+	"MergeResponse":          handlers.MergeResponse{},
+	"WorkspaceRequest":       handlers.WorkspaceRequest{},
+	"UserWorkspace":          repository.UserWorkspace{},
+	"MemberRequest":          handlers.MemberRequest{},
+	"Member":                 repository.Member{},
+	"QuotaErrorResponse":     handlers.QuotaErrorResponse{},
+	"Problem":                problem.Problem{},
+	"QuotaResponse":          handlers.QuotaResponse{},
+	"ReportRequest":          handlers.ReportRequest{},
+	"ReportResponse":         handlers.ReportResponse{},
+	"DisableLinkRequest":     handlers.DisableLinkRequest{},
+	"ReassignLinkRequest":    handlers.ReassignLinkRequest{},
+	"ReassignLinkResponse":   handlers.ReassignLinkResponse{},
+	"LinkRecord":             repository.LinkRecord{},
+	"OwnerStats":             repository.OwnerStats{},
+	"AuditEntry":             repository.AuditEntry{},
+	"Report":                 repository.Report{},
+	"ResolveReportsResponse": handlers.ResolveReportsResponse{},
+}
+
+// jsonFields returns the JSON field names of the struct type and whether they are omitted when empty.
+// Fields of embedded structs without a JSON name are promoted like encoding/json does.
+func jsonFields(typ reflect.Type) map[string]bool {
+	fields := make(map[string]bool)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		embedded := field.Type
+		if embedded.Kind() == reflect.Ptr {
+			embedded = embedded.Elem()
+		}
+		if field.Anonymous && name == "" && embedded.Kind() == reflect.Struct {
+			for k, v := range jsonFields(embedded) {
+				fields[k] = v
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = strings.Contains(opts, "omitempty")
+	}
+	return fields
+}
+
+func TestLoad(t *testing.T) {
+	doc, err := Load()
+	require.NoError(t, err)
+	assert.NotEmpty(t, doc.Paths.Map())
+
+	_, err = NewValidator(doc)
+	assert.NoError(t, err)
+}
+
+func TestSchemas_MatchModels(t *testing.T) {
+	doc, err := Load()
+	require.NoError(t, err)
+
+	for name, schemaRef := range doc.Components.Schemas {
+		schema := schemaRef.Value
+		if !schema.Type.Is("object") {
+			continue
+		}
+
+		t.Run(name, func(t *testing.T) {
+			model, ok := models[name]
+			require.True(t, ok, "schema %s has no model", name)
+
+			var properties, required, optional []string
+			for field, omitEmpty := range jsonFields(reflect.TypeOf(model)) {
+				properties = append(properties, field)
+				if omitEmpty {
+					optional = append(optional, field)
+				} else {
+					required = append(required, field)
+				}
+			}
+			sort.Strings(properties)
+
+			documented := make([]string, 0, len(schema.Properties))
+			for property := range schema.Properties {
+				documented = append(documented, property)
+			}
+			sort.Strings(documented)
+
+			assert.Equal(t, properties, documented, "properties of %s", name)
+			assert.ElementsMatch(t, required, schema.Required, "required properties of %s", name)
+			for _, field := range optional {
+				assert.NotContains(t, schema.Required, field, "%s is omitted when empty", field)
+			}
+		})
+	}
+}
+
+func TestNewSpecHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, SpecPath, nil)
+	rr := httptest.NewRecorder()
+
+	NewSpecHandler().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+}
+
+func TestNewDocsHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, DocsPath, nil)
+	rr := httptest.NewRecorder()
+
+	NewDocsHandler().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, rr.Body.String(), SpecPath)
+}
+
+func TestValidator_Middleware(t *testing.T) {
+	doc, err := Load()
+	require.NoError(t, err)
+	validator, err := NewValidator(doc)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		contentType    string
+		body           string
+		expectHandler  bool
+		expectedStatus int
+	}{
+		{
+			name:           "valid request",
+			method:         http.MethodPost,
+			path:           "/api/shorten",
+			contentType:    "application/json",
+			body:           `{"url": "https://example.com"}`,
+			expectHandler:  true,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "missing required property",
+			method:         http.MethodPost,
+			path:           "/api/shorten",
+			contentType:    "application/json",
+			body:           `{"max_clicks": 3}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown property",
+			method:         http.MethodPost,
+			path:           "/api/shorten",
+			contentType:    "application/json",
+			body:           `{"url": "https://example.com", "alias": "x"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid query parameter",
+			method:         http.MethodGet,
+			path:           "/api/user/urls?status=alive",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "undocumented route",
+			method:         http.MethodGet,
+			path:           "/debug/pprof/",
+			expectHandler:  true,
+			expectedStatus: http.StatusCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			var body string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				called = true
+				data, _ := io.ReadAll(r.Body)
+				body = string(data)
+
+				rw.Header().Set("Content-Type", "application/json")
+				rw.WriteHeader(http.StatusCreated)
+				_, _ = rw.Write([]byte(`{"result":"http://localhost:8080/abc123"}`))
+			})
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rr := httptest.NewRecorder()
+
+			validator.Middleware(next).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectHandler, called)
+			if tt.expectedStatus == http.StatusBadRequest {
+				assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+			}
+			if tt.expectHandler {
+				assert.Equal(t, tt.body, body, "the handler reads the whole body")
+				assert.JSONEq(t, `{"result":"http://localhost:8080/abc123"}`, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestValidator_ValidateResponse(t *testing.T) {
+	doc, err := Load()
+	require.NoError(t, err)
+	validator, err := NewValidator(doc)
+	require.NoError(t, err)
+
+	jsonHeader := http.Header{"Content-Type": []string{"application/json"}}
+	textHeader := http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}}
+
+	tests := []struct {
+		name    string
+		status  int
+		header  http.Header
+		body    string
+		wantErr bool
+	}{
+		{
+			name:   "documented response",
+			status: http.StatusCreated,
+			header: jsonHeader,
+			body:   `{"result":"http://localhost:8080/abc123"}`,
+		},
+		{
+			name:    "missing property",
+			status:  http.StatusCreated,
+			header:  jsonHeader,
+			body:    `{}`,
+			wantErr: true,
+		},
+		{
+			name:    "undocumented property",
+			status:  http.StatusCreated,
+			header:  jsonHeader,
+			body:    `{"result":"http://localhost:8080/abc123","alias":"abc123"}`,
+			wantErr: true,
+		},
+		{
+			name:   "plain text error",
+			status: http.StatusInternalServerError,
+			header: textHeader,
+			body:   "Internal Server Error\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten", nil)
+			err := validator.ValidateResponse(req, tt.status, tt.header, []byte(tt.body))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package openapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"go.uber.org/zap"
+
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/problem"
+)
+
+func init() {
+	openapi3filter.RegisterBodyDecoder("text/html", textBodyDecoder)
+}
+
+// textBodyDecoder decodes a body as a string, like the text/plain decoder of openapi3filter.
+func textBodyDecoder(body io.Reader, _ http.Header, _ *openapi3.SchemaRef, _ openapi3filter.EncodingFn) (interface{}, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// validationOptions skips the security requirements, the auth and admin middlewares enforce them.
+var validationOptions = &openapi3filter.Options{
+	AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+	IncludeResponseStatus: true,
+}
+
+// Validator validates requests and responses against the OpenAPI document.
+type Validator struct {
+	// router finds the operation of a request in the document.
+	router routers.Router
+}
+
+// NewValidator creates a validator for the OpenAPI document.
+func NewValidator(doc *openapi3.T) (*Validator, error) {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &Validator{router: router}, nil
+}
+
+// ValidateRequest validates the request against its operation, the body is left readable.
+// Requests of routes the document does not describe are valid.
+func (v *Validator) ValidateRequest(r *http.Request) error {
+	input, ok := v.requestInput(r)
+	if !ok {
+		return nil
+	}
+	return openapi3filter.ValidateRequest(r.Context(), input)
+}
+
+// ValidateResponse validates a response to the request against its operation.
+// Responses of routes the document does not describe are valid.
+func (v *Validator) ValidateResponse(r *http.Request, status int, header http.Header, body []byte) error {
+	input, ok := v.requestInput(r)
+	if !ok {
+		return nil
+	}
+	return openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 status,
+		Header:                 header,
+		Body:                   io.NopCloser(bytes.NewReader(body)),
+		Options:                validationOptions,
+	})
+}
+
+// requestInput finds the operation of the request, it reports false for routes the document does not describe.
+func (v *Validator) requestInput(r *http.Request) (*openapi3filter.RequestValidationInput, bool) {
+	route, pathParams, err := v.router.FindRoute(r)
+	if errors.Is(err, routers.ErrPathNotFound) || errors.Is(err, routers.ErrMethodNotAllowed) {
+		return nil, false
+	}
+	if err != nil {
+		logger.Log.Error("openapi: failed to find route", zap.String("path", r.URL.Path), zap.Error(err))
+		return nil, false
+	}
+	return &openapi3filter.RequestValidationInput{
+		Request:    r,
+		PathParams: pathParams,
+		Route:      route,
+		Options:    validationOptions,
+	}, true
+}
+
+// requestProblem describes a request rejected by validation, errors of the body are invalid body problems.
+func requestProblem(err error) *problem.Problem {
+	var reqErr *openapi3filter.RequestError
+	if errors.As(err, &reqErr) && reqErr.RequestBody != nil {
+		return problem.InvalidBody(err.Error())
+	}
+	return problem.InvalidParameter(err.Error())
+}
+
+// Middleware validates requests and responses against the OpenAPI document.
+// Invalid requests are rejected with a 400 problem holding the validation error. Responses are buffered and
+// sent unchanged, responses that do not match the document are logged as errors.
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := v.ValidateRequest(r); err != nil {
+			logger.Log.Info("openapi: invalid request", zap.String("method", r.Method),
+				zap.String("path", r.URL.Path), zap.Error(err))
+			problem.Write(w, r, requestProblem(err))
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if err := v.ValidateResponse(r, rec.status, w.Header(), rec.body.Bytes()); err != nil {
+			logger.Log.Error("openapi: response does not match the document", zap.String("method", r.Method),
+				zap.String("path", r.URL.Path), zap.Int("status", rec.status), zap.Error(err))
+		}
+
+		w.WriteHeader(rec.status)
+		if _, err := w.Write(rec.body.Bytes()); err != nil {
+			logger.Log.Error("openapi: failed to write response", zap.Error(err))
+		}
+	})
+}
+
+// responseRecorder buffers the status code and body of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	// status is the status code of the response.
+	status int
+	// body holds the written body.
+	body bytes.Buffer
+	// wroteHeader reports whether the status code was written.
+	wroteHeader bool
+}
+
+// WriteHeader records the status code of the response.
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.wroteHeader {
+		return
+	}
+	r.status = status
+	r.wroteHeader = true
+}
+
+// Write buffers the body of the response.
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.body.Write(b)
+}
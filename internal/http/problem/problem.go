@@ -0,0 +1,232 @@
+// Package problem describes failed HTTP requests with RFC 7807 problem details.
+// Every problem has a type identifying the kind of failure, clients should rely on the type rather than
+// the title or detail, which are meant for humans.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/pkg/validate"
+	"github.com/aifedorov/shortener/internal/repository"
+	"github.com/aifedorov/shortener/internal/service"
+)
+
+// ContentType is the media type of problem details.
+const ContentType = "application/problem+json"
+
+// requestIDHeader is the response header carrying the ID of the request.
+const requestIDHeader = "X-Request-Id"
+
+// Problem types
+const (
+	// TypeInvalidBody is the type of requests whose body is empty or cannot be decoded.
+	TypeInvalidBody = "urn:shortener:problem:invalid-body"
+	// TypeInvalidParameter is the type of requests with an invalid field or query parameter.
+	TypeInvalidParameter = "urn:shortener:problem:invalid-parameter"
+	// TypeInvalidURL is the type of requests with a URL rejected by validation.
+	TypeInvalidURL = "urn:shortener:problem:invalid-url"
+	// TypeBlockedURL is the type of requests with a URL rejected by the domain policy.
+	TypeBlockedURL = "urn:shortener:problem:blocked-url"
+	// TypeUnauthorized is the type of requests without valid credentials.
+	TypeUnauthorized = "urn:shortener:problem:unauthorized"
+	// TypeForbidden is the type of requests the user is not allowed to make.
+	TypeForbidden = "urn:shortener:problem:forbidden"
+	// TypeNotFound is the type of requests for a resource that does not exist.
+	TypeNotFound = "urn:shortener:problem:not-found"
+	// TypeLinkDeleted is the type of requests for a deleted link.
+	TypeLinkDeleted = "urn:shortener:problem:link-deleted"
+	// TypeLinkDisabled is the type of requests for a link disabled by an operator.
+	TypeLinkDisabled = "urn:shortener:problem:link-disabled"
+	// TypeConflict is the type of requests conflicting with the current state of a resource.
+	TypeConflict = "urn:shortener:problem:conflict"
+	// TypeQuotaExceeded is the type of requests that would exceed a quota.
+	TypeQuotaExceeded = "urn:shortener:problem:quota-exceeded"
+	// TypeRateLimited is the type of requests over the rate limit.
+	TypeRateLimited = "urn:shortener:problem:rate-limited"
+	// TypeInternal is the type of requests failed by the server.
+	TypeInternal = "urn:shortener:problem:internal"
+)
+
+// titles holds the short summaries of the problem types.
+var titles = map[string]string{
+	TypeInvalidBody:      "Invalid request body",
+	TypeInvalidParameter: "Invalid parameter",
+	TypeInvalidURL:       "Invalid URL",
+	TypeBlockedURL:       "URL blocked by policy",
+	TypeUnauthorized:     "Unauthorized",
+	TypeForbidden:        "Forbidden",
+	TypeNotFound:         "Not found",
+	TypeLinkDeleted:      "Link deleted",
+	TypeLinkDisabled:     "Link disabled",
+	TypeConflict:         "Conflict",
+	TypeQuotaExceeded:    "Quota exceeded",
+	TypeRateLimited:      "Too many requests",
+	TypeInternal:         "Internal server error",
+}
+
+// Problem is the body of a failed request as defined by RFC 7807.
+type Problem struct {
+	// Type is a URI identifying the kind of problem.
+	Type string `json:"type"`
+	// Title is a short summary of the problem type.
+	Title string `json:"title"`
+	// Status is the HTTP status code of the response.
+	Status int `json:"status"`
+	// Detail explains this occurrence of the problem.
+	Detail string `json:"detail,omitempty"`
+	// Instance is the path of the request the problem occurred in.
+	Instance string `json:"instance,omitempty"`
+	// RequestID is the ID of the request, it is also sent in the X-Request-Id header.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// New creates a problem of the type answered with the status code.
+func New(typ string, status int, detail string) *Problem {
+	title, ok := titles[typ]
+	if !ok {
+		title = http.StatusText(status)
+	}
+	return &Problem{Type: typ, Title: title, Status: status, Detail: detail}
+}
+
+// Error returns the title and the detail of the problem.
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+	return fmt.Sprintf("%s: %s", p.Title, p.Detail)
+}
+
+// InvalidBody creates a problem for a request body that is empty or cannot be decoded.
+func InvalidBody(detail string) *Problem {
+	return New(TypeInvalidBody, http.StatusBadRequest, detail)
+}
+
+// InvalidParameter creates a problem for an invalid field or query parameter.
+func InvalidParameter(detail string) *Problem {
+	return New(TypeInvalidParameter, http.StatusBadRequest, detail)
+}
+
+// Unauthorized creates a problem for a request without valid credentials.
+func Unauthorized(detail string) *Problem {
+	return New(TypeUnauthorized, http.StatusUnauthorized, detail)
+}
+
+// Forbidden creates a problem for a request the user is not allowed to make.
+func Forbidden(detail string) *Problem {
+	return New(TypeForbidden, http.StatusForbidden, detail)
+}
+
+// NotFound creates a problem for a resource that does not exist.
+func NotFound(detail string) *Problem {
+	return New(TypeNotFound, http.StatusNotFound, detail)
+}
+
+// Conflict creates a problem for a request conflicting with the current state of a resource.
+func Conflict(detail string) *Problem {
+	return New(TypeConflict, http.StatusConflict, detail)
+}
+
+// RateLimited creates a problem for a request over the rate limit.
+func RateLimited() *Problem {
+	return New(TypeRateLimited, http.StatusTooManyRequests, "")
+}
+
+// Internal creates a problem for a request failed by the server, the cause is not disclosed.
+func Internal() *Problem {
+	return New(TypeInternal, http.StatusInternalServerError, "")
+}
+
+// FromError maps repository, validation and link service errors to problems.
+// Unknown errors are internal problems, their message is not disclosed.
+func FromError(err error) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+	var pErr *validate.PolicyError
+	if errors.As(err, &pErr) {
+		return New(TypeBlockedURL, http.StatusUnprocessableEntity, pErr.Error())
+	}
+	var uErr *validate.URLError
+	if errors.As(err, &uErr) {
+		return New(TypeInvalidURL, http.StatusBadRequest, uErr.Error())
+	}
+	var iErr *service.InvalidError
+	if errors.As(err, &iErr) {
+		return InvalidParameter(iErr.Error())
+	}
+	var cErr *repository.ConflictError
+	if errors.As(err, &cErr) {
+		return Conflict(fmt.Sprintf("url exists: %s", cErr.ShortURL))
+	}
+	var dErr *repository.DisabledError
+	if errors.As(err, &dErr) {
+		return New(TypeLinkDisabled, dErr.StatusCode, repository.ErrLinkDisabled.Error())
+	}
+	var qErr *repository.QuotaError
+	if errors.As(err, &qErr) {
+		return New(TypeQuotaExceeded, http.StatusForbidden, qErr.Error())
+	}
+
+	switch {
+	case errors.Is(err, repository.ErrShortURLNotFound),
+		errors.Is(err, repository.ErrAPIKeyNotFound),
+		errors.Is(err, repository.ErrUserNotFound),
+		errors.Is(err, repository.ErrWorkspaceNotFound),
+		errors.Is(err, repository.ErrMemberNotFound),
+		errors.Is(err, repository.ErrVariantNotFound):
+		return NotFound(err.Error())
+	case errors.Is(err, repository.ErrURLDeleted):
+		return New(TypeLinkDeleted, http.StatusGone, err.Error())
+	case errors.Is(err, repository.ErrLinkDisabled):
+		return New(TypeLinkDisabled, http.StatusGone, err.Error())
+	case errors.Is(err, repository.ErrURLExists),
+		errors.Is(err, repository.ErrLoginTaken),
+		errors.Is(err, repository.ErrLastOwner),
+		errors.Is(err, repository.ErrReportExists):
+		return Conflict(err.Error())
+	default:
+		return Internal()
+	}
+}
+
+// Write sends the problem as the response to the request.
+func Write(rw http.ResponseWriter, r *http.Request, p *Problem) {
+	WriteExtended(rw, r, p, p)
+}
+
+// WriteExtended sends body as the response to the request, body embeds the problem and adds extension members.
+// The instance and the request ID of the problem are set from the request.
+func WriteExtended(rw http.ResponseWriter, r *http.Request, p *Problem, body interface{}) {
+	p.Instance = r.URL.Path
+	p.RequestID = chimiddleware.GetReqID(r.Context())
+	if p.RequestID != "" {
+		rw.Header().Set(requestIDHeader, p.RequestID)
+	}
+
+	rw.Header().Del("Content-Length")
+	rw.Header().Set("Content-Type", ContentType)
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	logger.Log.Debug("sending problem response", zap.Int("status", p.Status), zap.String("type", p.Type))
+	rw.WriteHeader(p.Status)
+	if err := json.NewEncoder(rw).Encode(body); err != nil {
+		logger.Log.Error("problem: failed to encode response", zap.Error(err))
+	}
+}
+
+// WriteError sends the problem the error maps to as the response to the request.
+func WriteError(rw http.ResponseWriter, r *http.Request, err error) {
+	p := FromError(err)
+	if p.Status >= http.StatusInternalServerError {
+		logger.Log.Error("request failed", zap.String("path", r.URL.Path), zap.Error(err))
+	}
+	Write(rw, r, p)
+}
@@ -0,0 +1,160 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aifedorov/shortener/internal/pkg/validate"
+	"github.com/aifedorov/shortener/internal/repository"
+	"github.com/aifedorov/shortener/internal/service"
+)
+
+func TestFromError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedType   string
+		expectedStatus int
+		expectedDetail string
+	}{
+		{
+			name:           "problem",
+			err:            fmt.Errorf("wrapped: %w", InvalidParameter("limit must be positive")),
+			expectedType:   TypeInvalidParameter,
+			expectedStatus: http.StatusBadRequest,
+			expectedDetail: "limit must be positive",
+		},
+		{
+			name:           "policy error",
+			err:            &validate.PolicyError{Host: "evil.com", Err: validate.ErrHostDenied},
+			expectedType:   TypeBlockedURL,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedDetail: "host is denied: evil.com",
+		},
+		{
+			name:           "url error",
+			err:            &validate.URLError{Err: validate.ErrMalformedURL, Detail: "contains invalid characters"},
+			expectedType:   TypeInvalidURL,
+			expectedStatus: http.StatusBadRequest,
+			expectedDetail: "url is malformed: contains invalid characters",
+		},
+		{
+			name:           "invalid input",
+			err:            &service.InvalidError{Err: errors.New("max_clicks must not be negative")},
+			expectedType:   TypeInvalidParameter,
+			expectedStatus: http.StatusBadRequest,
+			expectedDetail: "max_clicks must not be negative",
+		},
+		{
+			name:           "conflict error",
+			err:            repository.NewConflictError("http://localhost:8080/abc", repository.ErrURLExists),
+			expectedType:   TypeConflict,
+			expectedStatus: http.StatusConflict,
+			expectedDetail: "url exists: http://localhost:8080/abc",
+		},
+		{
+			name:           "disabled error",
+			err:            &repository.DisabledError{StatusCode: http.StatusUnavailableForLegalReasons},
+			expectedType:   TypeLinkDisabled,
+			expectedStatus: http.StatusUnavailableForLegalReasons,
+			expectedDetail: repository.ErrLinkDisabled.Error(),
+		},
+		{
+			name:           "quota error",
+			err:            &repository.QuotaError{Quota: repository.QuotaActiveLinks, Limit: 10, Used: 10, Requested: 1},
+			expectedType:   TypeQuotaExceeded,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "not found",
+			err:            fmt.Errorf("get: %w", repository.ErrShortURLNotFound),
+			expectedType:   TypeNotFound,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "deleted link",
+			err:            repository.ErrURLDeleted,
+			expectedType:   TypeLinkDeleted,
+			expectedStatus: http.StatusGone,
+		},
+		{
+			name:           "login taken",
+			err:            repository.ErrLoginTaken,
+			expectedType:   TypeConflict,
+			expectedStatus: http.StatusConflict,
+			expectedDetail: repository.ErrLoginTaken.Error(),
+		},
+		{
+			name:           "unknown error",
+			err:            errors.New("connection refused"),
+			expectedType:   TypeInternal,
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := FromError(tt.err)
+
+			assert.Equal(t, tt.expectedType, p.Type)
+			assert.Equal(t, tt.expectedStatus, p.Status)
+			assert.NotEmpty(t, p.Title)
+			if tt.expectedDetail != "" {
+				assert.Equal(t, tt.expectedDetail, p.Detail)
+			}
+			assert.NotContains(t, p.Detail, "connection refused")
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten?workspace=ws1", nil)
+	req = req.WithContext(context.WithValue(req.Context(), chimiddleware.RequestIDKey, "host/req-000001"))
+	rw := httptest.NewRecorder()
+	rw.Header().Set("Content-Type", "application/json")
+
+	Write(rw, req, InvalidBody("request body is empty"))
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	assert.Equal(t, ContentType, rw.Header().Get("Content-Type"))
+	assert.Equal(t, "host/req-000001", rw.Header().Get("X-Request-Id"))
+	assert.JSONEq(t, `{
+		"type": "urn:shortener:problem:invalid-body",
+		"title": "Invalid request body",
+		"status": 400,
+		"detail": "request body is empty",
+		"instance": "/api/shorten",
+		"request_id": "host/req-000001"
+	}`, rw.Body.String())
+}
+
+func TestWriteExtended(t *testing.T) {
+	type extended struct {
+		*Problem
+		Limit int `json:"limit"`
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", nil)
+	rw := httptest.NewRecorder()
+	body := extended{Problem: New(TypeQuotaExceeded, http.StatusForbidden, "batch too large"), Limit: 2}
+
+	WriteExtended(rw, req, body.Problem, body)
+
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+	assert.Empty(t, rw.Header().Get("X-Request-Id"))
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &got))
+	assert.Equal(t, TypeQuotaExceeded, got["type"])
+	assert.Equal(t, "/api/shorten/batch", got["instance"])
+	assert.Equal(t, float64(2), got["limit"])
+	assert.NotContains(t, got, "request_id")
+}
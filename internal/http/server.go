@@ -4,7 +4,11 @@ import (
 	"context"
 	"errors"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/aifedorov/shortener/internal/pkg/validate"
 	"github.com/go-chi/chi/v5"
@@ -12,10 +16,15 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/aifedorov/shortener/internal/config"
+	grpcserver "github.com/aifedorov/shortener/internal/grpc"
 	"github.com/aifedorov/shortener/internal/http/handlers"
+	"github.com/aifedorov/shortener/internal/http/middleware/admin"
 	"github.com/aifedorov/shortener/internal/http/middleware/auth"
 	"github.com/aifedorov/shortener/internal/http/middleware/compress"
 	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/http/middleware/ratelimit"
+	"github.com/aifedorov/shortener/internal/http/openapi"
+	"github.com/aifedorov/shortener/internal/linkcheck"
 	"github.com/aifedorov/shortener/internal/repository"
 )
 
@@ -25,6 +34,12 @@ var (
 	ErrShortURLMissing = errors.New("short URL is missing")
 )
 
+// policyReloadInterval is the interval of checking the domain policy file for changes.
+const policyReloadInterval = 5 * time.Second
+
+// shutdownTimeout limits the time in-flight requests are given to complete on shutdown.
+const shutdownTimeout = 10 * time.Second
+
 // supportedContentTypes defines the content types that the server accepts.
 var supportedContentTypes = []string{
 	"application/json",
@@ -44,8 +59,12 @@ type Server struct {
 	repo repository.Repository
 	// urlChecker is used for validating URLs before processing.
 	urlChecker validate.URLChecker
-	// ctx is the background context for the server.
+	// ctx is the context of the running server, it is cancelled on shutdown to stop the background jobs.
 	ctx context.Context
+	// limiter limits the rate of requests, nil disables rate limiting.
+	limiter *ratelimit.Limiter
+	// proxies are the proxies trusted to report the client IP.
+	proxies ratelimit.TrustedProxies
 }
 
 // NewServer creates a new HTTP server instance with the provided configuration and repository.
@@ -62,11 +81,17 @@ func NewServer(cfg *config.Config, repo repository.Repository) *Server {
 
 // Run starts the HTTP server and begins listening for requests.
 // It initializes the logger, repository, middleware, and mounts all route handlers.
-func (s *Server) Run() {
+// Once ctx is done the server stops accepting requests, waits for the in-flight ones
+// and stops the background jobs before the repository is closed.
+func (s *Server) Run(ctx context.Context) {
 	if err := logger.Initialize(s.config.LogLevel); err != nil {
 		log.Fatal(err)
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.ctx = ctx
+
 	err := s.repo.Run()
 	if err != nil {
 		logger.Log.Fatal("server: failed to run repository", zap.Error(err))
@@ -78,36 +103,281 @@ func (s *Server) Run() {
 		}
 	}()
 
+	s.router.Use(chimiddleware.RequestID)
 	s.router.Use(chimiddleware.AllowContentType(supportedContentTypes...))
 	s.router.Use(compress.GzipMiddleware)
 	s.router.Use(logger.RequestLogger)
 	s.router.Use(logger.ResponseLogger)
 
-	m := auth.NewMiddleware(s.config.SecretKey)
+	m := auth.NewMiddleware(auth.Config{
+		Keyring:     s.newKeyring(),
+		TokenTTL:    s.config.TokenTTL,
+		RenewBefore: s.config.TokenRenewBefore,
+	}, s.repo)
 	s.router.Use(m.JWTAuth)
+	if s.config.OpenAPIValidate {
+		s.router.Use(s.newOpenAPIValidator().Middleware)
+	}
+
+	s.urlChecker = s.newURLChecker()
+	s.proxies = s.newTrustedProxies()
+	limiter, closeLimiter := s.newLimiter()
+	defer closeLimiter()
+	s.limiter = limiter
+	s.mountHandlers(m)
+
+	checker := linkcheck.NewChecker(s.repo, linkcheck.Config{
+		Interval:        s.config.LinkCheckInterval,
+		HostConcurrency: s.config.LinkCheckHostConcurrency,
+		HostInterval:    s.config.LinkCheckHostInterval,
+	})
+	go checker.Run(s.ctx)
+
+	if s.config.GRPCAddr != "" {
+		go s.runGRPC(m)
+	}
 
-	s.mountHandlers()
+	httpServer := &http.Server{Addr: s.config.RunAddr, Handler: s.router}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			logger.Log.Error("server: failed to shut down", zap.Error(err))
+		}
+	}()
 
 	logger.Log.Info("server: running on", zap.String("address", s.config.RunAddr))
-	lsErr := http.ListenAndServe(s.config.RunAddr, s.router)
-	if lsErr != nil {
+	lsErr := httpServer.ListenAndServe()
+	if lsErr != nil && !errors.Is(lsErr, http.ErrServerClosed) {
 		logger.Log.Fatal("server: failed to run", zap.Error(lsErr))
 	}
+	logger.Log.Info("server: stopped")
 
 	s.router.Mount("/debug", chimiddleware.Profiler())
 }
 
+// runGRPC serves the gRPC API on its own address with the repository, URL validation, authentication
+// and rate limits of the HTTP server.
+func (s *Server) runGRPC(authenticator grpcserver.Authenticator) {
+	listen, err := net.Listen("tcp", s.config.GRPCAddr)
+	if err != nil {
+		logger.Log.Fatal("server: failed to listen for gRPC", zap.Error(err))
+	}
+
+	var limiter grpcserver.RateLimiter
+	if s.limiter != nil {
+		limiter = s.limiter
+	}
+	limits := grpcserver.RateLimits{
+		Shorten:  s.parseLimit("shorten", s.config.RateLimitShorten),
+		Redirect: s.parseLimit("redirect", s.config.RateLimitRedirect),
+		User:     s.parseLimit("user", s.config.RateLimitUser),
+	}
+	srv := grpcserver.NewServer(grpcserver.NewService(s.config, s.repo, s.urlChecker), authenticator, limiter, limits)
+	go func() {
+		<-s.ctx.Done()
+		srv.GracefulStop()
+	}()
+	logger.Log.Info("server: gRPC running on", zap.String("address", s.config.GRPCAddr))
+	if err := srv.Serve(listen); err != nil {
+		logger.Log.Fatal("server: failed to run gRPC", zap.Error(err))
+	}
+}
+
+// newOpenAPIValidator creates the validator of requests and responses against the OpenAPI document.
+func (s *Server) newOpenAPIValidator() *openapi.Validator {
+	doc, err := openapi.Load()
+	if err != nil {
+		logger.Log.Fatal("server: failed to load OpenAPI document", zap.Error(err))
+	}
+	validator, err := openapi.NewValidator(doc)
+	if err != nil {
+		logger.Log.Fatal("server: failed to create OpenAPI validator", zap.Error(err))
+	}
+	logger.Log.Info("server: validating requests and responses against the OpenAPI document")
+	return validator
+}
+
+// newKeyring creates the JWT keyring from the configuration.
+// Without a keyring definition tokens are signed with the secret key and carry no key ID.
+func (s *Server) newKeyring() *auth.Keyring {
+	var keyring *auth.Keyring
+	var err error
+	switch {
+	case s.config.JWTKeys != "":
+		keyring, err = auth.ParseKeyring(s.config.JWTKeys, s.config.SecretKey)
+	case s.config.JWTKeysFile != "":
+		keyring, err = auth.LoadKeyring(s.config.JWTKeysFile, s.config.SecretKey)
+	default:
+		keyring, err = auth.NewSecretKeyring(s.config.SecretKey)
+	}
+	if err != nil {
+		logger.Log.Fatal("server: failed to load JWT keyring", zap.Error(err))
+	}
+	logger.Log.Info("server: JWT keyring loaded", zap.String("active_kid", keyring.ActiveID()))
+	return keyring
+}
+
+// newURLChecker creates the URL validator from the configuration.
+// The domain policy file, if configured, is watched for changes in the background.
+func (s *Server) newURLChecker() *validate.Service {
+	checker := validate.NewService()
+	if schemes := splitList(s.config.URLSchemes); len(schemes) > 0 {
+		checker.Schemes = schemes
+	}
+	if s.config.URLMaxLength > 0 {
+		checker.MaxLength = s.config.URLMaxLength
+	}
+
+	selfHosts := splitList(s.config.ServedHosts)
+	if baseURL, err := url.Parse(s.config.BaseURL); err == nil && baseURL.Host != "" {
+		selfHosts = append(selfHosts, strings.ToLower(baseURL.Host))
+	}
+	if err := checker.SetSelfHosts(selfHosts); err != nil {
+		logger.Log.Fatal("server: invalid served hosts", zap.Strings("hosts", selfHosts), zap.Error(err))
+	}
+	if shorteners := splitList(s.config.Shorteners); len(shorteners) > 0 {
+		if err := checker.SetShorteners(shorteners); err != nil {
+			logger.Log.Fatal("server: invalid shortener domains", zap.Strings("domains", shorteners), zap.Error(err))
+		}
+	}
+	if s.config.ResolveShorteners {
+		checker.Resolver = validate.NewResolver(validate.DefaultResolveTimeout)
+	}
+
+	if s.config.DomainPolicyFile != "" {
+		policy, err := validate.LoadPolicy(s.config.DomainPolicyFile)
+		if err != nil {
+			logger.Log.Fatal("server: failed to load domain policy", zap.String("file", s.config.DomainPolicyFile), zap.Error(err))
+		}
+		checker.Policy = policy
+		go policy.Watch(s.ctx, policyReloadInterval, func(err error) {
+			logger.Log.Error("server: failed to reload domain policy", zap.String("file", s.config.DomainPolicyFile), zap.Error(err))
+		})
+	}
+	return checker
+}
+
+// newTrustedProxies parses the proxies trusted to report the client IP from the configuration.
+func (s *Server) newTrustedProxies() ratelimit.TrustedProxies {
+	proxies, err := ratelimit.ParseTrustedProxies(splitList(s.config.TrustedProxies))
+	if err != nil {
+		logger.Log.Fatal("server: invalid trusted proxies", zap.Error(err))
+	}
+	return proxies
+}
+
+// newLimiter creates the rate limiter from the configuration and returns it with a function releasing its store.
+func (s *Server) newLimiter() (*ratelimit.Limiter, func()) {
+	if s.config.RateLimitStore != config.RateLimitStorePostgres {
+		return ratelimit.NewLimiter(ratelimit.NewMemoryStore(), s.proxies), func() {}
+	}
+	store := ratelimit.NewPostgresStore(s.ctx, s.config.DSN)
+	if err := store.Run(); err != nil {
+		logger.Log.Fatal("server: failed to run rate limit store", zap.Error(err))
+	}
+	return ratelimit.NewLimiter(store, s.proxies), func() {
+		if err := store.Close(); err != nil {
+			logger.Log.Error("server: failed to close rate limit store", zap.Error(err))
+		}
+	}
+}
+
+// rateLimit returns the middleware applying the configured limit to a route group.
+// Requests pass unlimited when the server has no limiter.
+func (s *Server) rateLimit(name, value string) func(http.Handler) http.Handler {
+	if s.limiter == nil {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	return s.limiter.Limit(name, s.parseLimit(name, value))
+}
+
+// parseLimit parses the configured limit of a route group.
+func (s *Server) parseLimit(name, value string) ratelimit.Limit {
+	limit, err := ratelimit.ParseLimit(value)
+	if err != nil {
+		logger.Log.Fatal("server: invalid rate limit", zap.String("name", name), zap.Error(err))
+	}
+	return limit
+}
+
+// splitList splits a comma-separated configuration value into trimmed, lower case items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // mountHandlers registers all HTTP route handlers with the router.
-func (s *Server) mountHandlers() {
-	s.router.Post("/", handlers.NewSavePlainTextHandler(s.config, s.repo, s.urlChecker))
-	s.router.Post("/api/shorten", handlers.NewSaveJSONHandler(s.config, s.repo, s.urlChecker))
-	s.router.Post("/api/shorten/batch", handlers.NewSaveJSONBatchHandler(s.config, s.repo, s.urlChecker))
-	s.router.Get("/{shortURL}", handlers.NewRedirectHandler(s.repo))
+// The issuer starts the sessions of users logging in.
+// Shortening, redirects and the user APIs, including abuse reports, are rate limited separately.
+// The /api/v2 links API shares the shortening and user limits with the routes it supersedes.
+func (s *Server) mountHandlers(issuer handlers.TokenIssuer) {
+	s.router.Group(func(r chi.Router) {
+		r.Use(s.rateLimit("shorten", s.config.RateLimitShorten))
+		r.Post("/", handlers.NewSavePlainTextHandler(s.config, s.repo, s.urlChecker))
+		r.Post("/api/shorten", handlers.NewSaveJSONHandler(s.config, s.repo, s.urlChecker))
+		r.Post("/api/shorten/batch", handlers.NewSaveJSONBatchHandler(s.config, s.repo, s.urlChecker))
+	})
+	s.router.With(s.rateLimit("redirect", s.config.RateLimitRedirect)).Get("/{shortURL}", handlers.NewRedirectHandler(s.config, s.repo))
 	s.router.Get("/", func(res http.ResponseWriter, r *http.Request) {
 		logger.Log.Debug("server: got request with bad data", zap.String("method", r.Method))
 		http.Error(res, ErrShortURLMissing.Error(), http.StatusBadRequest)
 	})
 	s.router.Get("/ping", handlers.NewPingHandler(s.repo))
-	s.router.Get("/api/user/urls", handlers.NewURLsHandler(s.config, s.repo))
-	s.router.Delete("/api/user/urls", handlers.NewDeleteHandler(s.repo))
+	s.router.Get(openapi.SpecPath, openapi.NewSpecHandler())
+	if s.config.OpenAPIDocs {
+		s.router.Get(openapi.DocsPath, openapi.NewDocsHandler())
+	}
+	s.router.Group(func(r chi.Router) {
+		r.Use(s.rateLimit("user", s.config.RateLimitUser))
+		r.Post("/api/register", handlers.NewRegisterHandler(s.repo, issuer))
+		r.Post("/api/login", handlers.NewLoginHandler(s.repo, issuer))
+		r.Post("/api/report", handlers.NewReportHandler(s.config, s.repo, s.proxies))
+		r.Get("/api/user/urls", handlers.NewURLsHandler(s.config, s.repo))
+		r.Get("/api/user/quota", handlers.NewQuotaHandler(s.config, s.repo))
+		r.Delete("/api/user/urls", handlers.NewDeleteHandler(s.config, s.repo))
+		r.Get("/api/user/urls/{alias}/rules", handlers.NewGetRulesHandler(s.repo))
+		r.Put("/api/user/urls/{alias}/rules", handlers.NewSetRulesHandler(s.repo, s.urlChecker))
+		r.Post("/api/user/keys", handlers.NewCreateAPIKeyHandler(s.repo))
+		r.Get("/api/user/keys", handlers.NewAPIKeysHandler(s.repo))
+		r.Delete("/api/user/keys/{id}", handlers.NewRevokeAPIKeyHandler(s.repo))
+		r.Post("/api/workspaces", handlers.NewCreateWorkspaceHandler(s.repo))
+		r.Get("/api/workspaces", handlers.NewWorkspacesHandler(s.repo))
+		r.Get("/api/workspaces/{id}/members", handlers.NewMembersHandler(s.repo))
+		r.Post("/api/workspaces/{id}/members", handlers.NewSetMemberHandler(s.repo))
+		r.Delete("/api/workspaces/{id}/members/{userID}", handlers.NewRemoveMemberHandler(s.repo))
+	})
+	s.router.Route("/api/v2", func(r chi.Router) {
+		r.With(s.rateLimit("shorten", s.config.RateLimitShorten)).Group(func(r chi.Router) {
+			r.Post("/links", handlers.NewCreateLinkHandler(s.config, s.repo, s.urlChecker))
+			r.Post("/links/batch", handlers.NewCreateLinksBatchHandler(s.config, s.repo, s.urlChecker))
+		})
+		r.With(s.rateLimit("user", s.config.RateLimitUser)).Group(func(r chi.Router) {
+			r.Get("/links", handlers.NewListLinksHandler(s.config, s.repo))
+			r.Delete("/links", handlers.NewDeleteLinksHandler(s.config, s.repo))
+		})
+	})
+
+	adminMiddleware := admin.NewMiddleware(admin.Config{
+		Token:  s.config.AdminToken,
+		Logins: splitList(s.config.AdminLogins),
+	}, s.repo)
+	s.router.Route("/api/admin", func(r chi.Router) {
+		r.Use(adminMiddleware.RequireAdmin)
+		r.Get("/links", handlers.NewAdminSearchHandler(s.config, s.repo))
+		r.Post("/links/{alias}/disable", handlers.NewAdminDisableHandler(s.repo))
+		r.Post("/links/{alias}/enable", handlers.NewAdminEnableHandler(s.repo))
+		r.Post("/links/{alias}/owner", handlers.NewAdminReassignHandler(s.repo))
+		r.Get("/users", handlers.NewAdminOwnerStatsHandler(s.repo))
+		r.Get("/audit", handlers.NewAdminAuditHandler(s.repo))
+		r.Get("/reports", handlers.NewAdminReportsHandler(s.repo))
+		r.Post("/reports/{alias}/dismiss", handlers.NewAdminDismissReportsHandler(s.repo))
+		r.Post("/reports/{alias}/disable", handlers.NewAdminDisableReportedHandler(s.repo))
+	})
 }
@@ -6,13 +6,18 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/golang/mock/gomock"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/aifedorov/shortener/internal/config"
 	"github.com/aifedorov/shortener/internal/http/middleware/auth"
+	"github.com/aifedorov/shortener/internal/http/middleware/ratelimit"
+	"github.com/aifedorov/shortener/internal/http/openapi"
 	"github.com/aifedorov/shortener/internal/mocks"
 	"github.com/aifedorov/shortener/internal/repository"
 )
@@ -27,14 +32,14 @@ func TestServer_Integration(t *testing.T) {
 		mockRepo := mocks.NewMockRepository(ctrl)
 
 		// Setup expectations
-		mockRepo.EXPECT().Store(gomock.Any(), gomock.Any(), "https://example.com").Return("http://localhost:8080/abc123", nil).Times(2)
+		mockRepo.EXPECT().Store(gomock.Any(), gomock.Any(), "https://example.com", gomock.Any()).Return("http://localhost:8080/abc123", nil).Times(2)
 		mockRepo.EXPECT().GetAll(gomock.Any(), gomock.Any()).Return([]repository.URLOutput{
 			{ShortURL: "http://localhost:8080/abc123", OriginalURL: "https://example.com"},
 		}, nil)
 		mockRepo.EXPECT().Ping().Return(nil)
 
 		server := NewServer(config.NewConfig(), mockRepo)
-		server.mountHandlers()
+		server.mountHandlers(nil)
 
 		userID := uuid.NewString()
 		ctx := context.WithValue(context.Background(), auth.UserIDKey, userID)
@@ -85,7 +90,7 @@ func TestServer_Integration(t *testing.T) {
 
 		mockRepo := mocks.NewMockRepository(ctrl)
 		server := NewServer(config.NewConfig(), mockRepo)
-		server.mountHandlers()
+		server.mountHandlers(nil)
 
 		// Test without user ID (should return unauthorized for plain text)
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com"))
@@ -94,6 +99,47 @@ func TestServer_Integration(t *testing.T) {
 	})
 }
 
+func TestServer_RunShutdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockRepo.EXPECT().Run().Return(nil)
+	checking := make(chan struct{})
+	mockRepo.EXPECT().GetCheckTargets(gomock.Any(), gomock.Any()).DoAndReturn(func(time.Time, int) ([]repository.CheckTarget, error) {
+		close(checking)
+		return nil, nil
+	})
+	mockRepo.EXPECT().Close().Return(nil)
+
+	cfg := config.NewConfig()
+	cfg.RunAddr = "127.0.0.1:0"
+	cfg.LogLevel = "error"
+	cfg.SecretKey = "secret"
+	cfg.LinkCheckInterval = time.Hour
+	server := NewServer(cfg, mockRepo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.Run(ctx)
+	}()
+	select {
+	case <-checking:
+	case <-time.After(time.Second):
+		t.Fatal("link checker did not start")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("server did not stop")
+	}
+	assert.Error(t, server.ctx.Err(), "the background jobs are stopped")
+}
+
 func TestServer_ErrorHandling(t *testing.T) {
 	t.Parallel()
 
@@ -102,9 +148,9 @@ func TestServer_ErrorHandling(t *testing.T) {
 		defer ctrl.Finish()
 
 		mockRepo := mocks.NewMockRepository(ctrl)
-		mockRepo.EXPECT().Get("nonexistent").Return("", repository.ErrShortURLNotFound)
+		mockRepo.EXPECT().Resolve("nonexistent").Return(repository.Link{}, repository.ErrShortURLNotFound)
 		server := NewServer(config.NewConfig(), mockRepo)
-		server.mountHandlers()
+		server.mountHandlers(nil)
 
 		req := httptest.NewRequest(http.MethodGet, "/nonexistent", nil)
 		res := executeRequest(req, server)
@@ -117,7 +163,7 @@ func TestServer_ErrorHandling(t *testing.T) {
 
 		mockRepo := mocks.NewMockRepository(ctrl)
 		server := NewServer(config.NewConfig(), mockRepo)
-		server.mountHandlers()
+		server.mountHandlers(nil)
 
 		req := httptest.NewRequest(http.MethodPut, "/", nil)
 		res := executeRequest(req, server)
@@ -125,6 +171,141 @@ func TestServer_ErrorHandling(t *testing.T) {
 	})
 }
 
+func TestServer_RateLimit(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockRepo.EXPECT().Store(gomock.Any(), gomock.Any(), "https://example.com", gomock.Any()).Return("http://localhost:8080/abc123", nil)
+	mockRepo.EXPECT().Resolve("abc123").Return(repository.Link{Alias: "abc123", OriginalURL: "https://example.com"}, nil)
+
+	cfg := config.NewConfig()
+	cfg.RateLimitShorten = "1/1m"
+	cfg.RateLimitRedirect = "1/1m"
+	server := NewServer(cfg, mockRepo)
+	server.limiter = ratelimit.NewLimiter(ratelimit.NewMemoryStore(), nil)
+	server.mountHandlers(nil)
+
+	ctx := context.WithValue(context.Background(), auth.UserIDKey, uuid.NewString())
+	shorten := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com")).WithContext(ctx)
+		req.Header.Set("Content-Type", "text/plain")
+		return executeRequest(req, server)
+	}
+
+	assert.Equal(t, http.StatusCreated, shorten().Code)
+	res := shorten()
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+	assert.NotEmpty(t, res.Header().Get("Retry-After"))
+
+	req := httptest.NewRequest(http.MethodGet, "/abc123", nil).WithContext(ctx)
+	res = executeRequest(req, server)
+	assert.Equal(t, http.StatusTemporaryRedirect, res.Code, "redirects have their own limit")
+
+	req = httptest.NewRequest(http.MethodGet, "/ping", nil)
+	mockRepo.EXPECT().Ping().Return(nil).Times(2)
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, executeRequest(req, server).Code, "ping is not limited")
+	}
+}
+
+func TestServer_OpenAPIRoutes(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := config.NewConfig()
+	cfg.OpenAPIDocs = true
+	server := NewServer(cfg, mocks.NewMockRepository(ctrl))
+	server.mountHandlers(nil)
+
+	mounted := make([]string, 0)
+	err := chi.Walk(server.router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		mounted = append(mounted, method+" "+route)
+		return nil
+	})
+	require.NoError(t, err)
+
+	doc, err := openapi.Load()
+	require.NoError(t, err)
+	documented := make([]string, 0)
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented = append(documented, method+" "+path)
+		}
+	}
+
+	assert.ElementsMatch(t, documented, mounted, "every route must be described in the OpenAPI document")
+}
+
+func TestServer_OpenAPIResponses(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockRepo.EXPECT().Store(gomock.Any(), gomock.Any(), "https://example.com", gomock.Any()).Return("http://localhost:8080/abc123", nil)
+	mockRepo.EXPECT().Store(gomock.Any(), gomock.Any(), "https://example.org", gomock.Any()).
+		Return("", repository.NewConflictError("http://localhost:8080/def456", repository.ErrURLExists))
+	mockRepo.EXPECT().StoreBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return([]repository.BatchURLOutput{{CID: "1", ShortURL: "http://localhost:8080/abc123", Existing: true}}, nil).Times(2)
+	mockRepo.EXPECT().GetAll(gomock.Any(), gomock.Any()).Return([]repository.URLOutput{
+		{ShortURL: "http://localhost:8080/abc123", OriginalURL: "https://example.com"},
+	}, nil).Times(2)
+	mockRepo.EXPECT().Resolve("abc123").Return(repository.Link{Alias: "abc123", OriginalURL: "https://example.com"}, nil)
+	mockRepo.EXPECT().Ping().Return(nil)
+
+	doc, err := openapi.Load()
+	require.NoError(t, err)
+	validator, err := openapi.NewValidator(doc)
+	require.NoError(t, err)
+
+	server := NewServer(config.NewConfig(), mockRepo)
+	server.mountHandlers(nil)
+
+	ctx := context.WithValue(context.Background(), auth.UserIDKey, uuid.NewString())
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{name: "shorten", method: http.MethodPost, path: "/api/shorten", body: `{"url": "https://example.com"}`, expectedStatus: http.StatusCreated},
+		{name: "batch with existing url", method: http.MethodPost, path: "/api/shorten/batch",
+			body: `[{"correlation_id": "1", "original_url": "https://example.com"}, {"correlation_id": "2", "original_url": "not a url"}]`, expectedStatus: http.StatusMultiStatus},
+		{name: "invalid url", method: http.MethodPost, path: "/api/shorten", body: `{"url": "not a url"}`, expectedStatus: http.StatusBadRequest},
+		{name: "user urls", method: http.MethodGet, path: "/api/user/urls", expectedStatus: http.StatusOK},
+		{name: "redirect", method: http.MethodGet, path: "/abc123", expectedStatus: http.StatusTemporaryRedirect},
+		{name: "ping", method: http.MethodGet, path: "/ping", expectedStatus: http.StatusOK},
+		{name: "v2 existing link", method: http.MethodPost, path: "/api/v2/links", body: `{"url": "https://example.org"}`,
+			expectedStatus: http.StatusOK},
+		{name: "v2 batch", method: http.MethodPost, path: "/api/v2/links/batch",
+			body: `{"items": [{"correlation_id": "1", "url": "https://example.com"}, {"correlation_id": "2", "url": "not a url"}]}`, expectedStatus: http.StatusOK},
+		{name: "v2 empty batch", method: http.MethodPost, path: "/api/v2/links/batch", body: `{"items": []}`,
+			expectedStatus: http.StatusBadRequest},
+		{name: "v2 links", method: http.MethodGet, path: "/api/v2/links", expectedStatus: http.StatusOK},
+		{name: "openapi document", method: http.MethodGet, path: "/api/openapi.json", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)).WithContext(ctx)
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			res := executeRequest(req, server)
+			require.Equal(t, tt.expectedStatus, res.Code)
+
+			assert.NoError(t, validator.ValidateResponse(req, res.Code, res.Header(), res.Body.Bytes()))
+		})
+	}
+}
+
 func executeRequest(req *http.Request, s *Server) *httptest.ResponseRecorder {
 	r := httptest.NewRecorder()
 	s.router.ServeHTTP(r, req)
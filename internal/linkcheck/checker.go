@@ -0,0 +1,250 @@
+package linkcheck
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+// Checker defaults
+const (
+	// DefaultBatchSize is the number of links read from the repository at once.
+	DefaultBatchSize = 100
+	// DefaultWorkers is the number of links probed at the same time.
+	DefaultWorkers = 8
+	// DefaultHostConcurrency is the number of requests sent to a single host at the same time.
+	DefaultHostConcurrency = 2
+	// DefaultTimeout is the timeout of a single probe.
+	DefaultTimeout = 10 * time.Second
+	// maxBodyBytes is the number of response body bytes drained before a connection is reused.
+	maxBodyBytes = 64 << 10
+)
+
+// Config holds the settings of the dead-link checker.
+type Config struct {
+	// Interval is the time between two checks of the same link and between two passes of the checker.
+	Interval time.Duration
+	// BatchSize is the number of links read from the repository at once, a pass reads batches until no link is due.
+	BatchSize int
+	// Workers is the number of links probed at the same time.
+	Workers int
+	// HostConcurrency is the number of requests sent to a single host at the same time.
+	HostConcurrency int
+	// HostInterval is the minimal time between two requests to a single host.
+	HostInterval time.Duration
+	// Timeout is the timeout of a single probe.
+	Timeout time.Duration
+}
+
+// Checker periodically probes the original URLs of stored links and records the outcome.
+// A target is probed with HEAD, GET is used if the target does not answer HEAD successfully.
+// Targets resolving to loopback, private or link-local addresses are reported as unreachable without being requested.
+type Checker struct {
+	// repo is the repository the links are read from and the results are saved to.
+	repo repository.Repository
+	// client is the HTTP client used for probing.
+	client *http.Client
+	// cfg holds the checker settings.
+	cfg Config
+	// now returns the current time.
+	now func() time.Time
+	// hosts holds the request limiters of the probed hosts, idle limiters are dropped after every pass.
+	hosts map[string]*hostLimiter
+	// mu provides thread-safe access to the hosts map.
+	mu sync.Mutex
+}
+
+// NewChecker creates a new dead-link checker. Zero settings are replaced with the defaults.
+func NewChecker(repo repository.Repository, cfg Config) *Checker {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = DefaultWorkers
+	}
+	if cfg.HostConcurrency <= 0 {
+		cfg.HostConcurrency = DefaultHostConcurrency
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	return &Checker{
+		repo:   repo,
+		client: &http.Client{Timeout: cfg.Timeout, Transport: newTransport(cfg.Timeout)},
+		cfg:    cfg,
+		now:    time.Now,
+		hosts:  make(map[string]*hostLimiter),
+	}
+}
+
+// Run checks the stored links every interval until the context is canceled.
+func (c *Checker) Run(ctx context.Context) {
+	if c.cfg.Interval <= 0 {
+		logger.Log.Info("linkcheck: disabled")
+		return
+	}
+
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := c.CheckOnce(ctx); err != nil {
+			logger.Log.Error("linkcheck: pass failed", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckOnce probes all links that are due for a check in batches and saves the results.
+// It stops once a batch is not full or none of its results could be saved.
+func (c *Checker) CheckOnce(ctx context.Context) error {
+	defer c.pruneLimiters()
+
+	checkedBefore := c.now().Add(-c.cfg.Interval)
+	for {
+		targets, saved, err := c.checkBatch(ctx, checkedBefore)
+		if err != nil {
+			return err
+		}
+		if targets < c.cfg.BatchSize || saved == 0 {
+			return nil
+		}
+	}
+}
+
+// checkBatch probes a batch of links checked before the time and returns the number of links and saved results.
+func (c *Checker) checkBatch(ctx context.Context, checkedBefore time.Time) (int, int, error) {
+	targets, err := c.repo.GetCheckTargets(checkedBefore, c.cfg.BatchSize)
+	if err != nil {
+		return 0, 0, err
+	}
+	logger.Log.Debug("linkcheck: checking links", zap.Int("count", len(targets)))
+
+	var saved int32
+	jobs := make(chan repository.CheckTarget)
+	var wg sync.WaitGroup
+	for i := 0; i < c.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range jobs {
+				if c.check(ctx, target) {
+					atomic.AddInt32(&saved, 1)
+				}
+			}
+		}()
+	}
+
+	for _, target := range targets {
+		select {
+		case jobs <- target:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return len(targets), int(saved), ctx.Err()
+}
+
+// Probe requests the target and returns the status code of the response, zero if the target is unreachable.
+// Requests to a single host respect the configured concurrency and rate limits.
+func (c *Checker) Probe(ctx context.Context, target string) int {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return 0
+	}
+
+	limiter := c.limiter(u.Host)
+	if err := limiter.acquire(ctx); err != nil {
+		return 0
+	}
+	defer limiter.release()
+
+	status := c.request(ctx, http.MethodHead, target)
+	if status != 0 && status < http.StatusBadRequest {
+		return status
+	}
+	if err := limiter.wait(ctx); err != nil {
+		return status
+	}
+	return c.request(ctx, http.MethodGet, target)
+}
+
+// check probes the target and saves the result, it reports whether the result was saved.
+func (c *Checker) check(ctx context.Context, target repository.CheckTarget) bool {
+	status := c.Probe(ctx, target.OriginalURL)
+	if ctx.Err() != nil {
+		return false
+	}
+
+	result := repository.CheckResult{
+		StatusCode: status,
+		CheckedAt:  c.now(),
+	}
+	if err := c.repo.SaveCheckResult(target.Alias, result); err != nil {
+		logger.Log.Error("linkcheck: failed to save check result", zap.String("alias", target.Alias), zap.Error(err))
+		return false
+	}
+	logger.Log.Debug("linkcheck: link checked", zap.String("alias", target.Alias), zap.Int("status", status))
+	return true
+}
+
+func (c *Checker) request(ctx context.Context, method, target string) int {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return 0
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		logger.Log.Debug("linkcheck: request failed", zap.String("method", method), zap.String("url", target), zap.Error(err))
+		return 0
+	}
+	defer func() {
+		_, _ = io.CopyN(io.Discard, resp.Body, maxBodyBytes)
+		if err := resp.Body.Close(); err != nil {
+			logger.Log.Debug("linkcheck: failed to close response body", zap.Error(err))
+		}
+	}()
+	return resp.StatusCode
+}
+
+func (c *Checker) limiter(host string) *hostLimiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	limiter, exists := c.hosts[host]
+	if !exists {
+		limiter = newHostLimiter(c.cfg.HostConcurrency, c.cfg.HostInterval)
+		c.hosts[host] = limiter
+	}
+	return limiter
+}
+
+// pruneLimiters drops the limiters of hosts without requests in flight whose interval has passed,
+// so the map does not keep every host ever probed.
+func (c *Checker) pruneLimiters() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for host, limiter := range c.hosts {
+		if limiter.idle(now) {
+			delete(c.hosts, host)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package linkcheck
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+func newTargetServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/no-head", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			rw.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/gone", func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusGone)
+	})
+	mux.HandleFunc("/moved", func(rw http.ResponseWriter, r *http.Request) {
+		http.Redirect(rw, r, "/ok", http.StatusMovedPermanently)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newLocalChecker creates a checker that may probe the test servers listening on the loopback interface.
+func newLocalChecker(repo repository.Repository, cfg Config) *Checker {
+	checker := NewChecker(repo, cfg)
+	checker.client.Transport = http.DefaultTransport
+	return checker
+}
+
+func TestChecker_Probe(t *testing.T) {
+	srv := newTargetServer(t)
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedURL := closed.URL
+	closed.Close()
+
+	tests := []struct {
+		name   string
+		target string
+		want   int
+	}{
+		{name: "head succeeds", target: srv.URL + "/ok", want: http.StatusOK},
+		{name: "get fallback", target: srv.URL + "/no-head", want: http.StatusOK},
+		{name: "redirect is followed", target: srv.URL + "/moved", want: http.StatusOK},
+		{name: "broken target", target: srv.URL + "/gone", want: http.StatusGone},
+		{name: "unreachable target", target: closedURL + "/ok", want: 0},
+		{name: "invalid target", target: "://invalid", want: 0},
+	}
+
+	checker := newLocalChecker(repository.NewMemoryRepository(), Config{Interval: time.Hour, Timeout: time.Second})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, checker.Probe(context.Background(), tt.target))
+		})
+	}
+}
+
+func TestChecker_CheckOnce(t *testing.T) {
+	srv := newTargetServer(t)
+
+	repo := repository.NewMemoryRepository()
+	_, err := repo.Store("user123", "http://localhost:8080", srv.URL+"/ok", repository.LinkOptions{})
+	require.NoError(t, err)
+	_, err = repo.Store("user123", "http://localhost:8080", srv.URL+"/gone", repository.LinkOptions{})
+	require.NoError(t, err)
+
+	checkedAt := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	checker := newLocalChecker(repo, Config{Interval: time.Hour, Timeout: time.Second})
+	checker.now = func() time.Time { return checkedAt }
+
+	require.NoError(t, checker.CheckOnce(context.Background()))
+
+	urls, err := repo.GetAll("user123", "http://localhost:8080")
+	require.NoError(t, err)
+	statuses := make(map[string]int)
+	for _, u := range urls {
+		require.NotNil(t, u.CheckedAt)
+		assert.Equal(t, checkedAt, *u.CheckedAt)
+		statuses[u.OriginalURL] = u.LastStatus
+		assert.Equal(t, u.LastStatus == http.StatusGone, u.IsBroken())
+	}
+	assert.Equal(t, map[string]int{srv.URL + "/ok": http.StatusOK, srv.URL + "/gone": http.StatusGone}, statuses)
+
+	targets, err := repo.GetCheckTargets(checkedAt.Add(-time.Hour), 10)
+	require.NoError(t, err)
+	assert.Empty(t, targets, "checked links are not due until the interval passes")
+}
+
+func TestChecker_CheckOnceBatches(t *testing.T) {
+	srv := newTargetServer(t)
+
+	repo := repository.NewMemoryRepository()
+	for i := 0; i < 5; i++ {
+		_, err := repo.Store("user123", "http://localhost:8080", fmt.Sprintf("%s/ok?n=%d", srv.URL, i), repository.LinkOptions{})
+		require.NoError(t, err)
+	}
+
+	checker := newLocalChecker(repo, Config{Interval: time.Hour, BatchSize: 2, Timeout: time.Second})
+	require.NoError(t, checker.CheckOnce(context.Background()))
+
+	targets, err := repo.GetCheckTargets(time.Now().Add(-time.Hour), 10)
+	require.NoError(t, err)
+	assert.Empty(t, targets, "a pass checks every due link, not a single batch")
+	assert.Empty(t, checker.hosts, "idle host limiters are dropped after the pass")
+}
+
+// recordingTransport records the time every request leaves the client.
+type recordingTransport struct {
+	mu     sync.Mutex
+	starts []time.Time
+}
+
+func (rt *recordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	rt.starts = append(rt.starts, time.Now())
+	rt.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestChecker_HostLimits(t *testing.T) {
+	var inFlight, maxInFlight int32
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			peak := atomic.LoadInt32(&maxInFlight)
+			if current <= peak || atomic.CompareAndSwapInt32(&maxInFlight, peak, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		rw.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	repo := repository.NewMemoryRepository()
+	for i := 0; i < 4; i++ {
+		_, err := repo.Store("user123", "http://localhost:8080", fmt.Sprintf("%s/page?n=%d", srv.URL, i), repository.LinkOptions{})
+		require.NoError(t, err)
+	}
+
+	hostInterval := 20 * time.Millisecond
+	checker := NewChecker(repo, Config{
+		Interval:        time.Hour,
+		Workers:         4,
+		HostConcurrency: 1,
+		HostInterval:    hostInterval,
+		Timeout:         time.Second,
+	})
+	transport := &recordingTransport{}
+	checker.client.Transport = transport
+	started := time.Now()
+	require.NoError(t, checker.CheckOnce(context.Background()))
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&maxInFlight))
+	require.Len(t, transport.starts, 4)
+	// The limiter gives the n-th request of the pass a start time n intervals after the first one,
+	// timers never fire early, so the n-th request leaves no sooner than n intervals after the pass began.
+	sort.Slice(transport.starts, func(i, j int) bool { return transport.starts[i].Before(transport.starts[j]) })
+	for i, start := range transport.starts {
+		assert.GreaterOrEqual(t, start.Sub(started), time.Duration(i)*hostInterval, "request %d is spaced out", i)
+	}
+}
+
+func TestChecker_Run(t *testing.T) {
+	srv := newTargetServer(t)
+
+	repo := repository.NewMemoryRepository()
+	_, err := repo.Store("user123", "http://localhost:8080", srv.URL+"/ok", repository.LinkOptions{})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		newLocalChecker(repo, Config{Interval: time.Hour, Timeout: time.Second}).Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		targets, err := repo.GetCheckTargets(time.Now().Add(-time.Minute), 10)
+		return err == nil && len(targets) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("checker did not stop after the context was canceled")
+	}
+}
@@ -0,0 +1,73 @@
+package linkcheck
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// errPrivateAddress is returned when a probe would connect to an address outside the public internet.
+var errPrivateAddress = errors.New("address is not public")
+
+// reservedPrefixes lists the special-purpose ranges that the netip predicates do not cover.
+var reservedPrefixes = []netip.Prefix{
+	// "This network", only valid as a source address.
+	netip.MustParsePrefix("0.0.0.0/8"),
+	// Shared address space of carrier-grade NAT.
+	netip.MustParsePrefix("100.64.0.0/10"),
+	// IETF protocol assignments.
+	netip.MustParsePrefix("192.0.0.0/24"),
+	// Benchmarking networks.
+	netip.MustParsePrefix("198.18.0.0/15"),
+	// NAT64 prefixes embedding IPv4 addresses.
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+// newTransport creates the transport of the probing client.
+// It connects to public addresses only and ignores the proxy environment, so stored links cannot probe internal services.
+func newTransport(timeout time.Duration) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: publicOnly,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// publicOnly refuses connections to loopback, private, link-local and other non-public addresses.
+// It runs after the host name is resolved, so names pointing to internal addresses and redirects to them are refused as well.
+func publicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !isPublic(ip) {
+		return fmt.Errorf("%w: %s", errPrivateAddress, ip)
+	}
+	return nil
+}
+
+// isPublic reports whether the address is a globally routable unicast address.
+func isPublic(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package linkcheck
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "93.184.216.34", want: true},
+		{addr: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{addr: "127.0.0.1", want: false},
+		{addr: "::1", want: false},
+		{addr: "10.0.0.1", want: false},
+		{addr: "172.16.5.4", want: false},
+		{addr: "192.168.1.1", want: false},
+		{addr: "169.254.169.254", want: false},
+		{addr: "fe80::1", want: false},
+		{addr: "fd00:ec2::254", want: false},
+		{addr: "::ffff:127.0.0.1", want: false},
+		{addr: "0.0.0.0", want: false},
+		{addr: "100.64.0.1", want: false},
+		{addr: "224.0.0.1", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			assert.Equal(t, tt.want, isPublic(netip.MustParseAddr(tt.addr)))
+		})
+	}
+}
+
+func TestChecker_ProbePrivateTarget(t *testing.T) {
+	srv := newTargetServer(t)
+
+	checker := NewChecker(repository.NewMemoryRepository(), Config{Interval: time.Hour, Timeout: time.Second})
+
+	assert.Equal(t, 0, checker.Probe(context.Background(), srv.URL+"/ok"), "loopback targets are not requested")
+	localhost := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	assert.Equal(t, 0, checker.Probe(context.Background(), localhost+"/ok"), "names resolving to loopback are not requested")
+}
@@ -0,0 +1,82 @@
+package linkcheck
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// hostLimiter limits the number of concurrent requests to a host and spaces them out in time.
+type hostLimiter struct {
+	// slots holds a token for every request in flight.
+	slots chan struct{}
+	// interval is the minimal time between two requests.
+	interval time.Duration
+	// next is the earliest time the next request may start.
+	next time.Time
+	// mu provides thread-safe access to next.
+	mu sync.Mutex
+}
+
+func newHostLimiter(concurrency int, interval time.Duration) *hostLimiter {
+	return &hostLimiter{
+		slots:    make(chan struct{}, concurrency),
+		interval: interval,
+	}
+}
+
+// acquire takes a concurrency slot and waits for the turn of the request.
+// Every successful acquire must be followed by release.
+func (l *hostLimiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if err := l.wait(ctx); err != nil {
+		l.release()
+		return err
+	}
+	return nil
+}
+
+// release frees the concurrency slot taken by acquire.
+func (l *hostLimiter) release() {
+	<-l.slots
+}
+
+// idle reports whether no request is in flight and the next request may start at the time without waiting.
+func (l *hostLimiter) idle(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.slots) == 0 && !l.next.After(now)
+}
+
+// wait blocks until the next request to the host may start.
+func (l *hostLimiter) wait(ctx context.Context) error {
+	if l.interval <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	start := l.next
+	if start.Before(now) {
+		start = now
+	}
+	l.next = start.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := time.Until(start)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
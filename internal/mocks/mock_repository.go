@@ -6,7 +6,10 @@ package mocks
 
 import (
 	reflect "reflect"
+	time "time"
 
+	rules "github.com/aifedorov/shortener/internal/pkg/rules"
+	workspace "github.com/aifedorov/shortener/internal/pkg/workspace"
 	repository "github.com/aifedorov/shortener/internal/repository"
 	gomock "github.com/golang/mock/gomock"
 )
@@ -34,6 +37,35 @@ func (m *MockRepository) EXPECT() *MockRepositoryMockRecorder {
 	return m.recorder
 }
 
+// AddReport mocks base method.
+func (m *MockRepository) AddReport(report repository.Report, threshold int) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddReport", report, threshold)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddReport indicates an expected call of AddReport.
+func (mr *MockRepositoryMockRecorder) AddReport(report, threshold interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddReport", reflect.TypeOf((*MockRepository)(nil).AddReport), report, threshold)
+}
+
+// AppendAudit mocks base method.
+func (m *MockRepository) AppendAudit(entry repository.AuditEntry) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AppendAudit", entry)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AppendAudit indicates an expected call of AppendAudit.
+func (mr *MockRepositoryMockRecorder) AppendAudit(entry interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AppendAudit", reflect.TypeOf((*MockRepository)(nil).AppendAudit), entry)
+}
+
 // Close mocks base method.
 func (m *MockRepository) Close() error {
 	m.ctrl.T.Helper()
@@ -48,6 +80,34 @@ func (mr *MockRepositoryMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockRepository)(nil).Close))
 }
 
+// CreateUser mocks base method.
+func (m *MockRepository) CreateUser(user repository.User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUser", user)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateUser indicates an expected call of CreateUser.
+func (mr *MockRepositoryMockRecorder) CreateUser(user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockRepository)(nil).CreateUser), user)
+}
+
+// CreateWorkspace mocks base method.
+func (m *MockRepository) CreateWorkspace(ws repository.Workspace, ownerID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWorkspace", ws, ownerID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateWorkspace indicates an expected call of CreateWorkspace.
+func (mr *MockRepositoryMockRecorder) CreateWorkspace(ws, ownerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWorkspace", reflect.TypeOf((*MockRepository)(nil).CreateWorkspace), ws, ownerID)
+}
+
 // DeleteBatch mocks base method.
 func (m *MockRepository) DeleteBatch(userID string, aliases []string) error {
 	m.ctrl.T.Helper()
@@ -77,6 +137,36 @@ func (mr *MockRepositoryMockRecorder) Get(shortURL interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockRepository)(nil).Get), shortURL)
 }
 
+// GetAPIKeyUser mocks base method.
+func (m *MockRepository) GetAPIKeyUser(keyHash string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIKeyUser", keyHash)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAPIKeyUser indicates an expected call of GetAPIKeyUser.
+func (mr *MockRepositoryMockRecorder) GetAPIKeyUser(keyHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIKeyUser", reflect.TypeOf((*MockRepository)(nil).GetAPIKeyUser), keyHash)
+}
+
+// GetAPIKeys mocks base method.
+func (m *MockRepository) GetAPIKeys(userID string) ([]repository.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIKeys", userID)
+	ret0, _ := ret[0].([]repository.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAPIKeys indicates an expected call of GetAPIKeys.
+func (mr *MockRepositoryMockRecorder) GetAPIKeys(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIKeys", reflect.TypeOf((*MockRepository)(nil).GetAPIKeys), userID)
+}
+
 // GetAll mocks base method.
 func (m *MockRepository) GetAll(userID, baseURL string) ([]repository.URLOutput, error) {
 	m.ctrl.T.Helper()
@@ -92,6 +182,186 @@ func (mr *MockRepositoryMockRecorder) GetAll(userID, baseURL interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAll", reflect.TypeOf((*MockRepository)(nil).GetAll), userID, baseURL)
 }
 
+// GetAuditLog mocks base method.
+func (m *MockRepository) GetAuditLog(limit int) ([]repository.AuditEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAuditLog", limit)
+	ret0, _ := ret[0].([]repository.AuditEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAuditLog indicates an expected call of GetAuditLog.
+func (mr *MockRepositoryMockRecorder) GetAuditLog(limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAuditLog", reflect.TypeOf((*MockRepository)(nil).GetAuditLog), limit)
+}
+
+// GetCheckTargets mocks base method.
+func (m *MockRepository) GetCheckTargets(checkedBefore time.Time, limit int) ([]repository.CheckTarget, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCheckTargets", checkedBefore, limit)
+	ret0, _ := ret[0].([]repository.CheckTarget)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCheckTargets indicates an expected call of GetCheckTargets.
+func (mr *MockRepositoryMockRecorder) GetCheckTargets(checkedBefore, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCheckTargets", reflect.TypeOf((*MockRepository)(nil).GetCheckTargets), checkedBefore, limit)
+}
+
+// GetMemberRole mocks base method.
+func (m *MockRepository) GetMemberRole(workspaceID, userID string) (workspace.Role, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMemberRole", workspaceID, userID)
+	ret0, _ := ret[0].(workspace.Role)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMemberRole indicates an expected call of GetMemberRole.
+func (mr *MockRepositoryMockRecorder) GetMemberRole(workspaceID, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMemberRole", reflect.TypeOf((*MockRepository)(nil).GetMemberRole), workspaceID, userID)
+}
+
+// GetMembers mocks base method.
+func (m *MockRepository) GetMembers(workspaceID string) ([]repository.Member, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMembers", workspaceID)
+	ret0, _ := ret[0].([]repository.Member)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMembers indicates an expected call of GetMembers.
+func (mr *MockRepositoryMockRecorder) GetMembers(workspaceID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMembers", reflect.TypeOf((*MockRepository)(nil).GetMembers), workspaceID)
+}
+
+// GetOwnerStats mocks base method.
+func (m *MockRepository) GetOwnerStats() ([]repository.OwnerStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOwnerStats")
+	ret0, _ := ret[0].([]repository.OwnerStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOwnerStats indicates an expected call of GetOwnerStats.
+func (mr *MockRepositoryMockRecorder) GetOwnerStats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOwnerStats", reflect.TypeOf((*MockRepository)(nil).GetOwnerStats))
+}
+
+// GetReports mocks base method.
+func (m *MockRepository) GetReports(status string, limit int) ([]repository.Report, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReports", status, limit)
+	ret0, _ := ret[0].([]repository.Report)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReports indicates an expected call of GetReports.
+func (mr *MockRepositoryMockRecorder) GetReports(status, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReports", reflect.TypeOf((*MockRepository)(nil).GetReports), status, limit)
+}
+
+// GetRules mocks base method.
+func (m *MockRepository) GetRules(userID, alias string) ([]rules.Rule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRules", userID, alias)
+	ret0, _ := ret[0].([]rules.Rule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRules indicates an expected call of GetRules.
+func (mr *MockRepositoryMockRecorder) GetRules(userID, alias interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRules", reflect.TypeOf((*MockRepository)(nil).GetRules), userID, alias)
+}
+
+// GetUsage mocks base method.
+func (m *MockRepository) GetUsage(userID string) (repository.Usage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUsage", userID)
+	ret0, _ := ret[0].(repository.Usage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUsage indicates an expected call of GetUsage.
+func (mr *MockRepositoryMockRecorder) GetUsage(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUsage", reflect.TypeOf((*MockRepository)(nil).GetUsage), userID)
+}
+
+// GetUserByID mocks base method.
+func (m *MockRepository) GetUserByID(userID string) (repository.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByID", userID)
+	ret0, _ := ret[0].(repository.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByID indicates an expected call of GetUserByID.
+func (mr *MockRepositoryMockRecorder) GetUserByID(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByID", reflect.TypeOf((*MockRepository)(nil).GetUserByID), userID)
+}
+
+// GetUserByLogin mocks base method.
+func (m *MockRepository) GetUserByLogin(login string) (repository.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByLogin", login)
+	ret0, _ := ret[0].(repository.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByLogin indicates an expected call of GetUserByLogin.
+func (mr *MockRepositoryMockRecorder) GetUserByLogin(login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByLogin", reflect.TypeOf((*MockRepository)(nil).GetUserByLogin), login)
+}
+
+// GetWorkspaces mocks base method.
+func (m *MockRepository) GetWorkspaces(userID string) ([]repository.UserWorkspace, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWorkspaces", userID)
+	ret0, _ := ret[0].([]repository.UserWorkspace)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWorkspaces indicates an expected call of GetWorkspaces.
+func (mr *MockRepositoryMockRecorder) GetWorkspaces(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWorkspaces", reflect.TypeOf((*MockRepository)(nil).GetWorkspaces), userID)
+}
+
+// MergeLinks mocks base method.
+func (m *MockRepository) MergeLinks(fromUserID, toUserID string, mergedAt time.Time) (repository.LinkMerge, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MergeLinks", fromUserID, toUserID, mergedAt)
+	ret0, _ := ret[0].(repository.LinkMerge)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MergeLinks indicates an expected call of MergeLinks.
+func (mr *MockRepositoryMockRecorder) MergeLinks(fromUserID, toUserID, mergedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MergeLinks", reflect.TypeOf((*MockRepository)(nil).MergeLinks), fromUserID, toUserID, mergedAt)
+}
+
 // Ping mocks base method.
 func (m *MockRepository) Ping() error {
 	m.ctrl.T.Helper()
@@ -106,6 +376,79 @@ func (mr *MockRepositoryMockRecorder) Ping() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockRepository)(nil).Ping))
 }
 
+// ReassignLink mocks base method.
+func (m *MockRepository) ReassignLink(alias, ownerID string, entry repository.AuditEntry) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReassignLink", alias, ownerID, entry)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReassignLink indicates an expected call of ReassignLink.
+func (mr *MockRepositoryMockRecorder) ReassignLink(alias, ownerID, entry interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReassignLink", reflect.TypeOf((*MockRepository)(nil).ReassignLink), alias, ownerID, entry)
+}
+
+// RemoveMember mocks base method.
+func (m *MockRepository) RemoveMember(workspaceID, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveMember", workspaceID, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveMember indicates an expected call of RemoveMember.
+func (mr *MockRepositoryMockRecorder) RemoveMember(workspaceID, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveMember", reflect.TypeOf((*MockRepository)(nil).RemoveMember), workspaceID, userID)
+}
+
+// Resolve mocks base method.
+func (m *MockRepository) Resolve(shortURL string) (repository.Link, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Resolve", shortURL)
+	ret0, _ := ret[0].(repository.Link)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Resolve indicates an expected call of Resolve.
+func (mr *MockRepositoryMockRecorder) Resolve(shortURL interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resolve", reflect.TypeOf((*MockRepository)(nil).Resolve), shortURL)
+}
+
+// ResolveReports mocks base method.
+func (m *MockRepository) ResolveReports(alias, status string, entry repository.AuditEntry) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResolveReports", alias, status, entry)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResolveReports indicates an expected call of ResolveReports.
+func (mr *MockRepositoryMockRecorder) ResolveReports(alias, status, entry interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResolveReports", reflect.TypeOf((*MockRepository)(nil).ResolveReports), alias, status, entry)
+}
+
+// RevokeAPIKey mocks base method.
+func (m *MockRepository) RevokeAPIKey(userID, keyID string, revokedAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", userID, keyID, revokedAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey.
+func (mr *MockRepositoryMockRecorder) RevokeAPIKey(userID, keyID, revokedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockRepository)(nil).RevokeAPIKey), userID, keyID, revokedAt)
+}
+
 // Run mocks base method.
 func (m *MockRepository) Run() error {
 	m.ctrl.T.Helper()
@@ -120,19 +463,116 @@ func (mr *MockRepositoryMockRecorder) Run() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Run", reflect.TypeOf((*MockRepository)(nil).Run))
 }
 
+// SaveCheckResult mocks base method.
+func (m *MockRepository) SaveCheckResult(alias string, result repository.CheckResult) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveCheckResult", alias, result)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveCheckResult indicates an expected call of SaveCheckResult.
+func (mr *MockRepositoryMockRecorder) SaveCheckResult(alias, result interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveCheckResult", reflect.TypeOf((*MockRepository)(nil).SaveCheckResult), alias, result)
+}
+
+// SearchLinks mocks base method.
+func (m *MockRepository) SearchLinks(filter repository.LinkFilter, baseURL string) ([]repository.LinkRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchLinks", filter, baseURL)
+	ret0, _ := ret[0].([]repository.LinkRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchLinks indicates an expected call of SearchLinks.
+func (mr *MockRepositoryMockRecorder) SearchLinks(filter, baseURL interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchLinks", reflect.TypeOf((*MockRepository)(nil).SearchLinks), filter, baseURL)
+}
+
+// SetLinkDisabled mocks base method.
+func (m *MockRepository) SetLinkDisabled(alias string, statusCode int, reason string, entry repository.AuditEntry) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetLinkDisabled", alias, statusCode, reason, entry)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetLinkDisabled indicates an expected call of SetLinkDisabled.
+func (mr *MockRepositoryMockRecorder) SetLinkDisabled(alias, statusCode, reason, entry interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetLinkDisabled", reflect.TypeOf((*MockRepository)(nil).SetLinkDisabled), alias, statusCode, reason, entry)
+}
+
+// SetMember mocks base method.
+func (m *MockRepository) SetMember(member repository.Member) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetMember", member)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetMember indicates an expected call of SetMember.
+func (mr *MockRepositoryMockRecorder) SetMember(member interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMember", reflect.TypeOf((*MockRepository)(nil).SetMember), member)
+}
+
+// SetQuota mocks base method.
+func (m *MockRepository) SetQuota(quota repository.Quota) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetQuota", quota)
+}
+
+// SetQuota indicates an expected call of SetQuota.
+func (mr *MockRepositoryMockRecorder) SetQuota(quota interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetQuota", reflect.TypeOf((*MockRepository)(nil).SetQuota), quota)
+}
+
+// SetRules mocks base method.
+func (m *MockRepository) SetRules(userID, alias string, linkRules []rules.Rule) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetRules", userID, alias, linkRules)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetRules indicates an expected call of SetRules.
+func (mr *MockRepositoryMockRecorder) SetRules(userID, alias, linkRules interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetRules", reflect.TypeOf((*MockRepository)(nil).SetRules), userID, alias, linkRules)
+}
+
 // Store mocks base method.
-func (m *MockRepository) Store(userID, baseURL, targetURL string) (string, error) {
+func (m *MockRepository) Store(userID, baseURL, targetURL string, opts repository.LinkOptions) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Store", userID, baseURL, targetURL)
+	ret := m.ctrl.Call(m, "Store", userID, baseURL, targetURL, opts)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Store indicates an expected call of Store.
-func (mr *MockRepositoryMockRecorder) Store(userID, baseURL, targetURL interface{}) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) Store(userID, baseURL, targetURL, opts interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Store", reflect.TypeOf((*MockRepository)(nil).Store), userID, baseURL, targetURL)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Store", reflect.TypeOf((*MockRepository)(nil).Store), userID, baseURL, targetURL, opts)
+}
+
+// StoreAPIKey mocks base method.
+func (m *MockRepository) StoreAPIKey(key repository.APIKey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StoreAPIKey", key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StoreAPIKey indicates an expected call of StoreAPIKey.
+func (mr *MockRepositoryMockRecorder) StoreAPIKey(key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StoreAPIKey", reflect.TypeOf((*MockRepository)(nil).StoreAPIKey), key)
 }
 
 // StoreBatch mocks base method.
@@ -149,3 +589,17 @@ func (mr *MockRepositoryMockRecorder) StoreBatch(userID, baseURL, urls interface
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StoreBatch", reflect.TypeOf((*MockRepository)(nil).StoreBatch), userID, baseURL, urls)
 }
+
+// TrackVariant mocks base method.
+func (m *MockRepository) TrackVariant(alias string, variant int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TrackVariant", alias, variant)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TrackVariant indicates an expected call of TrackVariant.
+func (mr *MockRepositoryMockRecorder) TrackVariant(alias, variant interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TrackVariant", reflect.TypeOf((*MockRepository)(nil).TrackVariant), alias, variant)
+}
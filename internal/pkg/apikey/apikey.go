@@ -0,0 +1,48 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// Key format
+const (
+	// Prefix starts every API key, it tells keys apart from other bearer tokens.
+	Prefix = "shk_"
+	// secretSize is the number of random bytes of a key.
+	secretSize = 32
+	// displayLength is the number of leading key characters kept to identify a key in listings.
+	displayLength = len(Prefix) + 6
+)
+
+// Generate creates a new random API key.
+func Generate() (string, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return Prefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// Hash returns the hex encoded SHA-256 hash of the key, only the hash is stored.
+// Keys carry enough entropy that a slow password hash is not needed.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsKey reports whether the token has the API key format.
+func IsKey(token string) bool {
+	return strings.HasPrefix(token, Prefix) && len(token) > len(Prefix)
+}
+
+// DisplayPrefix returns the leading characters of the key shown in listings.
+func DisplayPrefix(key string) string {
+	if len(key) <= displayLength {
+		return key
+	}
+	return key[:displayLength]
+}
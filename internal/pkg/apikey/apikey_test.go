@@ -0,0 +1,47 @@
+package apikey
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	first, err := Generate()
+	require.NoError(t, err)
+	second, err := Generate()
+	require.NoError(t, err)
+
+	assert.True(t, IsKey(first))
+	assert.NotEqual(t, first, second)
+	assert.Len(t, DisplayPrefix(first), displayLength)
+	assert.Equal(t, first[:displayLength], DisplayPrefix(first))
+}
+
+func TestHash(t *testing.T) {
+	key, err := Generate()
+	require.NoError(t, err)
+
+	assert.Equal(t, Hash(key), Hash(key))
+	assert.NotEqual(t, key, Hash(key))
+	assert.Len(t, Hash(key), 64)
+}
+
+func TestIsKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		{name: "api key", token: "shk_abc", want: true},
+		{name: "prefix only", token: "shk_"},
+		{name: "jwt", token: "eyJhbGciOiJIUzI1NiJ9.e30.sig"},
+		{name: "empty", token: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsKey(tt.token))
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package canonical
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/aifedorov/shortener/internal/pkg/validate"
+)
+
+// Canonicalization rule names, used in the comma-separated rule list of the configuration.
+const (
+	// RuleHost lowercases the scheme and the host and converts internationalized hosts to punycode.
+	RuleHost = "host"
+	// RulePort drops the default port of the scheme.
+	RulePort = "port"
+	// RuleDotSegments resolves "." and ".." path segments.
+	RuleDotSegments = "dot-segments"
+	// RuleSortQuery sorts the query parameters by name.
+	RuleSortQuery = "sort-query"
+	// RuleStripTracking removes tracking query parameters.
+	RuleStripTracking = "strip-tracking"
+	// RuleStripFragment removes the fragment.
+	RuleStripFragment = "strip-fragment"
+)
+
+// DefaultRules lists the rules applied when none are configured.
+var DefaultRules = []string{RuleHost, RulePort, RuleDotSegments, RuleSortQuery}
+
+// DefaultTrackingParams lists the query parameters removed by the strip-tracking rule.
+// A trailing * matches every parameter with the prefix.
+var DefaultTrackingParams = []string{"utm_*", "gclid", "fbclid", "msclkid", "yclid", "dclid", "mc_eid", "igshid"}
+
+// ErrUnknownRule is returned when a rule list contains an unsupported rule.
+var ErrUnknownRule = errors.New("canonical: unknown rule")
+
+// defaultPorts maps schemes to their default ports.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+}
+
+// Options selects the canonicalization rules.
+type Options struct {
+	// LowercaseHost lowercases the scheme and the host and converts internationalized hosts to punycode.
+	LowercaseHost bool
+	// DropDefaultPort drops the default port of the scheme.
+	DropDefaultPort bool
+	// RemoveDotSegments resolves "." and ".." path segments, an empty path becomes "/".
+	RemoveDotSegments bool
+	// SortQuery sorts the query parameters by name, values of a repeated parameter keep their order.
+	SortQuery bool
+	// StripTracking removes the query parameters listed in TrackingParams.
+	StripTracking bool
+	// StripFragment removes the fragment.
+	StripFragment bool
+	// TrackingParams lists the parameters removed by StripTracking, DefaultTrackingParams if empty.
+	TrackingParams []string
+}
+
+// ParseRules builds options from a list of rule names.
+func ParseRules(rules []string) (Options, error) {
+	var opts Options
+	for _, rule := range rules {
+		switch strings.ToLower(strings.TrimSpace(rule)) {
+		case RuleHost:
+			opts.LowercaseHost = true
+		case RulePort:
+			opts.DropDefaultPort = true
+		case RuleDotSegments:
+			opts.RemoveDotSegments = true
+		case RuleSortQuery:
+			opts.SortQuery = true
+		case RuleStripTracking:
+			opts.StripTracking = true
+		case RuleStripFragment:
+			opts.StripFragment = true
+		case "":
+		default:
+			return Options{}, fmt.Errorf("%w: %s", ErrUnknownRule, rule)
+		}
+	}
+	return opts, nil
+}
+
+// IsZero reports whether no rule is enabled.
+func (o Options) IsZero() bool {
+	return !o.LowercaseHost && !o.DropDefaultPort && !o.RemoveDotSegments &&
+		!o.SortQuery && !o.StripTracking && !o.StripFragment
+}
+
+// Canonicalize returns the canonical form of the URL according to the options.
+func Canonicalize(rawURL string, opts Options) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	if opts.LowercaseHost {
+		u.Scheme = strings.ToLower(u.Scheme)
+		host, err := validate.ToASCII(u.Hostname())
+		if err != nil {
+			return "", err
+		}
+		u.Host = joinHostPort(host, u.Port())
+	}
+	if opts.DropDefaultPort && u.Port() != "" && u.Port() == defaultPorts[strings.ToLower(u.Scheme)] {
+		u.Host = joinHostPort(u.Hostname(), "")
+	}
+	if opts.RemoveDotSegments {
+		if u.Path == "" && u.Host != "" {
+			u.Path = "/"
+		}
+		u.Path = removeDotSegments(u.Path)
+		if u.RawPath != "" {
+			u.RawPath = removeDotSegments(u.RawPath)
+		}
+	}
+	if opts.StripTracking || opts.SortQuery {
+		u.RawQuery = canonicalQuery(u.RawQuery, opts)
+		u.ForceQuery = false
+	}
+	if opts.StripFragment {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+	return u.String(), nil
+}
+
+func canonicalQuery(rawQuery string, opts Options) string {
+	if rawQuery == "" {
+		return ""
+	}
+	trackingParams := opts.TrackingParams
+	if len(trackingParams) == 0 {
+		trackingParams = DefaultTrackingParams
+	}
+
+	params := strings.Split(rawQuery, "&")
+	kept := params[:0]
+	for _, param := range params {
+		if param == "" {
+			continue
+		}
+		if opts.StripTracking {
+			name, _, _ := strings.Cut(param, "=")
+			if decoded, err := url.QueryUnescape(name); err == nil {
+				name = decoded
+			}
+			if isTrackingParam(name, trackingParams) {
+				continue
+			}
+		}
+		kept = append(kept, param)
+	}
+	if opts.SortQuery {
+		sort.SliceStable(kept, func(i, j int) bool {
+			nameI, _, _ := strings.Cut(kept[i], "=")
+			nameJ, _, _ := strings.Cut(kept[j], "=")
+			return nameI < nameJ
+		})
+	}
+	return strings.Join(kept, "&")
+}
+
+func isTrackingParam(name string, trackingParams []string) bool {
+	name = strings.ToLower(name)
+	for _, param := range trackingParams {
+		param = strings.ToLower(param)
+		if prefix, ok := strings.CutSuffix(param, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+			continue
+		}
+		if name == param {
+			return true
+		}
+	}
+	return false
+}
+
+// removeDotSegments implements the remove_dot_segments algorithm of RFC 3986, section 5.2.4.
+func removeDotSegments(path string) string {
+	var out []string
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 0 && (len(out) > 1 || out[0] != "") {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, segment)
+		}
+	}
+	res := strings.Join(out, "/")
+	if strings.HasPrefix(path, "/") && !strings.HasPrefix(res, "/") {
+		res = "/" + res
+	}
+	return res
+}
+
+func joinHostPort(host, port string) string {
+	if port != "" {
+		return net.JoinHostPort(host, port)
+	}
+	if strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
+	return host
+}
@@ -0,0 +1,63 @@
+package canonical
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalize(t *testing.T) {
+	defaults, err := ParseRules(DefaultRules)
+	assert.NoError(t, err)
+	all, err := ParseRules(append(DefaultRules, RuleStripTracking, RuleStripFragment))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name string
+		url  string
+		opts Options
+		want string
+	}{
+		{name: "lowercase scheme and host", url: "HTTP://Example.COM/Path", opts: defaults, want: "http://example.com/Path"},
+		{name: "drop default http port", url: "http://example.com:80/a", opts: defaults, want: "http://example.com/a"},
+		{name: "drop default https port", url: "https://example.com:443/a", opts: defaults, want: "https://example.com/a"},
+		{name: "keep custom port", url: "https://example.com:8443/a", opts: defaults, want: "https://example.com:8443/a"},
+		{name: "resolve dot segments", url: "http://example.com/a/./b/../c", opts: defaults, want: "http://example.com/a/c"},
+		{name: "dot segments above root", url: "http://example.com/../a", opts: defaults, want: "http://example.com/a"},
+		{name: "trailing dot segment", url: "http://example.com/a/b/..", opts: defaults, want: "http://example.com/a/"},
+		{name: "empty path", url: "http://example.com", opts: defaults, want: "http://example.com/"},
+		{name: "sort query", url: "http://example.com/?b=2&a=1&b=1", opts: defaults, want: "http://example.com/?a=1&b=2&b=1"},
+		{name: "keep tracking and fragment by default", url: "http://example.com/?utm_source=x#frag", opts: defaults, want: "http://example.com/?utm_source=x#frag"},
+		{name: "idn host", url: "https://Bücher.example/", opts: defaults, want: "https://xn--bcher-kva.example/"},
+		{name: "ipv6 host with default port", url: "http://[2001:DB8::1]:80/", opts: defaults, want: "http://[2001:db8::1]/"},
+		{
+			name: "request example",
+			url:  "http://Example.com:80/a/../b?utm_source=x#frag",
+			opts: all,
+			want: "http://example.com/b",
+		},
+		{name: "strip tracking keeps other params", url: "http://example.com/?id=7&fbclid=abc&UTM_medium=mail", opts: all, want: "http://example.com/?id=7"},
+		{name: "custom tracking params", url: "http://example.com/?ref=x&id=7", opts: Options{StripTracking: true, TrackingParams: []string{"ref"}}, want: "http://example.com/?id=7"},
+		{name: "no rules", url: "HTTP://Example.com:80/a/../b?b=1&a=2#x", opts: Options{}, want: "http://Example.com:80/a/../b?b=1&a=2#x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Canonicalize(tt.url, tt.opts)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	opts, err := ParseRules([]string{"host", " strip-fragment ", ""})
+	assert.NoError(t, err)
+	assert.Equal(t, Options{LowercaseHost: true, StripFragment: true}, opts)
+
+	_, err = ParseRules([]string{"host", "lowercase-path"})
+	assert.ErrorIs(t, err, ErrUnknownRule)
+
+	opts, err = ParseRules(nil)
+	assert.NoError(t, err)
+	assert.True(t, opts.IsZero())
+}
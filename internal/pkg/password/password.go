@@ -0,0 +1,67 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password limits
+const (
+	// MinLength is the minimum password length in bytes.
+	MinLength = 8
+	// MaxLength is the maximum password length in bytes, bcrypt ignores longer input.
+	MaxLength = 72
+)
+
+// dummyHash is a bcrypt hash of DefaultCost that no login uses, CompareDummy compares passwords against it.
+const dummyHash = "$2a$10$CTiqV1/Y3F2FA.Ca09L1fOBcZFtZ70g.jXkYcW0bB0acL8aI77uXa"
+
+// Password errors
+var (
+	// ErrTooShort is returned when the password is shorter than MinLength.
+	ErrTooShort = fmt.Errorf("password must be at least %d bytes long", MinLength)
+	// ErrTooLong is returned when the password is longer than MaxLength.
+	ErrTooLong = fmt.Errorf("password must be at most %d bytes long", MaxLength)
+	// ErrMismatch is returned when the password does not match the hash.
+	ErrMismatch = errors.New("password does not match")
+)
+
+// Validate checks the length limits of a new password.
+func Validate(password string) error {
+	if len(password) < MinLength {
+		return ErrTooShort
+	}
+	if len(password) > MaxLength {
+		return ErrTooLong
+	}
+	return nil
+}
+
+// Hash returns the bcrypt hash of the password.
+func Hash(password string) (string, error) {
+	if err := Validate(password); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Compare returns ErrMismatch if the password does not match the hash.
+func Compare(hash, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrMismatch
+	}
+	return err
+}
+
+// CompareDummy compares the password against a fixed hash and discards the result.
+// Calling it for unknown logins takes as long as Compare, so response times do not reveal which logins exist.
+func CompareDummy(password string) {
+	_ = bcrypt.CompareHashAndPassword([]byte(dummyHash), []byte(password))
+}
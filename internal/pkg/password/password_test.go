@@ -0,0 +1,50 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHash(t *testing.T) {
+	hash, err := Hash("correct horse")
+	require.NoError(t, err)
+	assert.NotEqual(t, "correct horse", hash)
+
+	assert.NoError(t, Compare(hash, "correct horse"))
+	assert.ErrorIs(t, Compare(hash, "wrong horse"), ErrMismatch)
+	assert.Error(t, Compare("not a hash", "correct horse"))
+}
+
+func TestCompareDummy(t *testing.T) {
+	cost, err := bcrypt.Cost([]byte(dummyHash))
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.DefaultCost, cost, "the dummy compare takes as long as a real one")
+	assert.ErrorIs(t, Compare(dummyHash, "correct horse"), ErrMismatch)
+
+	CompareDummy("correct horse")
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  error
+	}{
+		{name: "valid", password: "12345678"},
+		{name: "too short", password: "1234567", wantErr: ErrTooShort},
+		{name: "too long", password: strings.Repeat("a", MaxLength+1), wantErr: ErrTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, Validate(tt.password), tt.wantErr)
+			if tt.wantErr != nil {
+				_, err := Hash(tt.password)
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package querymerge
+
+import (
+	"net/url"
+)
+
+// UTM query parameter names.
+const (
+	// ParamSource is the query parameter of the campaign source.
+	ParamSource = "utm_source"
+	// ParamMedium is the query parameter of the campaign medium.
+	ParamMedium = "utm_medium"
+	// ParamCampaign is the query parameter of the campaign name.
+	ParamCampaign = "utm_campaign"
+)
+
+// UTM holds the campaign parameters appended to a redirect target.
+type UTM struct {
+	// Source identifies the referrer, for example newsletter.
+	Source string `json:"source,omitempty"`
+	// Medium identifies the marketing medium, for example email.
+	Medium string `json:"medium,omitempty"`
+	// Campaign identifies the campaign name.
+	Campaign string `json:"campaign,omitempty"`
+}
+
+// IsZero reports whether no UTM parameter is configured.
+func (u UTM) IsZero() bool {
+	return u == UTM{}
+}
+
+// Values returns the configured UTM parameters as query values.
+func (u UTM) Values() url.Values {
+	values := url.Values{}
+	if u.Source != "" {
+		values.Set(ParamSource, u.Source)
+	}
+	if u.Medium != "" {
+		values.Set(ParamMedium, u.Medium)
+	}
+	if u.Campaign != "" {
+		values.Set(ParamCampaign, u.Campaign)
+	}
+	return values
+}
+
+// Merge adds the UTM parameters and the incoming query parameters to the target URL.
+//
+// The precedence is defined per key:
+//  1. keys already present in the target query are kept untouched,
+//  2. configured UTM parameters are added next,
+//  3. incoming query parameters fill in the remaining keys with all their values.
+//
+// The existing target query is preserved byte for byte, new parameters are appended in key order.
+func Merge(target string, incoming url.Values, utm UTM) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+
+	existing, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return "", err
+	}
+
+	extra := url.Values{}
+	for key, values := range utm.Values() {
+		if _, ok := existing[key]; !ok {
+			extra[key] = values
+		}
+	}
+	for key, values := range incoming {
+		if _, ok := existing[key]; ok {
+			continue
+		}
+		if _, ok := extra[key]; ok {
+			continue
+		}
+		extra[key] = values
+	}
+	if len(extra) == 0 {
+		return target, nil
+	}
+
+	if u.RawQuery == "" {
+		u.RawQuery = extra.Encode()
+	} else {
+		u.RawQuery += "&" + extra.Encode()
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,72 @@
+package querymerge
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		incoming url.Values
+		utm      UTM
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:   "nothing to merge",
+			target: "https://example.com/page?b=2&a=1",
+			want:   "https://example.com/page?b=2&a=1",
+		},
+		{
+			name:     "incoming parameters are appended",
+			target:   "https://example.com/page",
+			incoming: url.Values{"ref": {"mail"}, "tag": {"x", "y"}},
+			want:     "https://example.com/page?ref=mail&tag=x&tag=y",
+		},
+		{
+			name:     "target keys win over incoming keys",
+			target:   "https://example.com/page?ref=site#top",
+			incoming: url.Values{"ref": {"mail"}, "lang": {"de"}},
+			want:     "https://example.com/page?ref=site&lang=de#top",
+		},
+		{
+			name:   "utm parameters are appended",
+			target: "https://example.com/page?id=7",
+			utm:    UTM{Source: "newsletter", Medium: "email", Campaign: "spring"},
+			want:   "https://example.com/page?id=7&utm_campaign=spring&utm_medium=email&utm_source=newsletter",
+		},
+		{
+			name:     "target keys win over utm, utm wins over incoming",
+			target:   "https://example.com/page?utm_source=partner",
+			incoming: url.Values{"utm_source": {"spoofed"}, "utm_medium": {"spoofed"}, "q": {"1"}},
+			utm:      UTM{Source: "newsletter", Medium: "email"},
+			want:     "https://example.com/page?utm_source=partner&q=1&utm_medium=email",
+		},
+		{
+			name:    "invalid target",
+			target:  "https://example.com/%zz",
+			utm:     UTM{Source: "newsletter"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Merge(tt.target, tt.incoming, tt.utm)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestUTM_IsZero(t *testing.T) {
+	assert.True(t, UTM{}.IsZero())
+	assert.False(t, UTM{Campaign: "spring"}.IsZero())
+}
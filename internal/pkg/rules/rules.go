@@ -0,0 +1,237 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Device classes recognized by the rules engine.
+const (
+	// DeviceIOS matches iPhone, iPad and iPod user agents.
+	DeviceIOS = "ios"
+	// DeviceAndroid matches Android user agents.
+	DeviceAndroid = "android"
+	// DeviceDesktop matches every other user agent.
+	DeviceDesktop = "desktop"
+)
+
+// timeOfDayLayout is the layout of the time-of-day window bounds.
+const timeOfDayLayout = "15:04"
+
+// Rule errors
+var (
+	// ErrEmptyTarget is returned when a rule has no target URL.
+	ErrEmptyTarget = errors.New("rules: target is empty")
+	// ErrUnknownDevice is returned when a rule references an unsupported device class.
+	ErrUnknownDevice = errors.New("rules: unknown device")
+	// ErrInvalidTimeOfDay is returned when a time-of-day bound is not in HH:MM format.
+	ErrInvalidTimeOfDay = errors.New("rules: time of day must be in HH:MM format")
+	// ErrIncompleteTimeOfDay is returned when only one bound of a time-of-day window is set.
+	ErrIncompleteTimeOfDay = errors.New("rules: time_from and time_to must be set together")
+	// ErrInvalidDateWindow is returned when a date window ends before it starts.
+	ErrInvalidDateWindow = errors.New("rules: date_to must be after date_from")
+	// ErrInvalidTimezone is returned when a rule references an unknown time zone.
+	ErrInvalidTimezone = errors.New("rules: unknown timezone")
+)
+
+// Rule describes a conditional redirect target.
+// A rule matches a request when all of its conditions match, unset conditions always match.
+type Rule struct {
+	// Target is the URL the request is redirected to when the rule matches.
+	Target string `json:"target"`
+	// Device is the device class of the client: ios, android or desktop.
+	Device string `json:"device,omitempty"`
+	// Languages lists language tags matched against the preferred language of the client.
+	// A primary tag such as "de" also matches regional variants such as "de-AT".
+	Languages []string `json:"languages,omitempty"`
+	// TimeFrom is the start of the daily time window in HH:MM format.
+	TimeFrom string `json:"time_from,omitempty"`
+	// TimeTo is the end of the daily time window in HH:MM format, exclusive.
+	// A window ending before it starts spans midnight.
+	TimeTo string `json:"time_to,omitempty"`
+	// DateFrom is the moment the rule becomes active.
+	DateFrom *time.Time `json:"date_from,omitempty"`
+	// DateTo is the moment the rule stops being active.
+	DateTo *time.Time `json:"date_to,omitempty"`
+	// Timezone is the IANA time zone the daily time window is evaluated in, UTC by default.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// Validate checks that the rule is well-formed.
+func (r Rule) Validate() error {
+	if r.Target == "" {
+		return ErrEmptyTarget
+	}
+
+	switch r.Device {
+	case "", DeviceIOS, DeviceAndroid, DeviceDesktop:
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownDevice, r.Device)
+	}
+
+	if (r.TimeFrom == "") != (r.TimeTo == "") {
+		return ErrIncompleteTimeOfDay
+	}
+	if r.TimeFrom != "" {
+		if _, err := parseTimeOfDay(r.TimeFrom); err != nil {
+			return err
+		}
+		if _, err := parseTimeOfDay(r.TimeTo); err != nil {
+			return err
+		}
+	}
+
+	if r.DateFrom != nil && r.DateTo != nil && !r.DateTo.After(*r.DateFrom) {
+		return ErrInvalidDateWindow
+	}
+
+	if _, err := r.location(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Matches reports whether the request satisfies all conditions of the rule at the given moment.
+func (r Rule) Matches(req *http.Request, now time.Time) bool {
+	if r.Device != "" && r.Device != DetectDevice(req.UserAgent()) {
+		return false
+	}
+	if len(r.Languages) > 0 && !matchLanguage(r.Languages, PreferredLanguage(req.Header.Get("Accept-Language"))) {
+		return false
+	}
+	if r.DateFrom != nil && now.Before(*r.DateFrom) {
+		return false
+	}
+	if r.DateTo != nil && !now.Before(*r.DateTo) {
+		return false
+	}
+	if r.TimeFrom != "" && !r.matchTimeOfDay(now) {
+		return false
+	}
+	return true
+}
+
+// Match returns the first rule matching the request at the given moment.
+// The second return value is false if no rule matches and the default target should be used.
+func Match(rules []Rule, req *http.Request, now time.Time) (Rule, bool) {
+	for _, rule := range rules {
+		if rule.Matches(req, now) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// DetectDevice returns the device class for a User-Agent header value.
+func DetectDevice(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return DeviceIOS
+	case strings.Contains(ua, "android"):
+		return DeviceAndroid
+	default:
+		return DeviceDesktop
+	}
+}
+
+// PreferredLanguage returns the language tag with the highest quality value from an Accept-Language header value.
+// It returns an empty string if the header does not accept any language.
+func PreferredLanguage(acceptLanguage string) string {
+	type language struct {
+		tag     string
+		quality float64
+	}
+
+	var languages []language
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if quality <= 0 {
+			continue
+		}
+		languages = append(languages, language{tag: tag, quality: quality})
+	}
+	if len(languages) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].quality > languages[j].quality
+	})
+	return languages[0].tag
+}
+
+func matchLanguage(tags []string, preferred string) bool {
+	if preferred == "" {
+		return false
+	}
+	for _, tag := range tags {
+		if strings.EqualFold(tag, preferred) {
+			return true
+		}
+		if !strings.Contains(tag, "-") && len(preferred) > len(tag) &&
+			strings.EqualFold(preferred[:len(tag)+1], tag+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) matchTimeOfDay(now time.Time) bool {
+	loc, err := r.location()
+	if err != nil {
+		return false
+	}
+	from, err := parseTimeOfDay(r.TimeFrom)
+	if err != nil {
+		return false
+	}
+	to, err := parseTimeOfDay(r.TimeTo)
+	if err != nil {
+		return false
+	}
+
+	local := now.In(loc)
+	current := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
+	if from <= to {
+		return current >= from && current < to
+	}
+	return current >= from || current < to
+}
+
+func (r Rule) location() (*time.Location, error) {
+	if r.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTimezone, r.Timezone)
+	}
+	return loc, nil
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse(timeOfDayLayout, value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidTimeOfDay, value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,129 @@
+package rules
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	iPhoneUA  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148"
+	androidUA = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36"
+	desktopUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36"
+)
+
+func TestDetectDevice(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{name: "iphone", userAgent: iPhoneUA, want: DeviceIOS},
+		{name: "ipad", userAgent: "Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X)", want: DeviceIOS},
+		{name: "android", userAgent: androidUA, want: DeviceAndroid},
+		{name: "desktop", userAgent: desktopUA, want: DeviceDesktop},
+		{name: "empty", userAgent: "", want: DeviceDesktop},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, DetectDevice(tt.userAgent))
+		})
+	}
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "single language", header: "de", want: "de"},
+		{name: "first wins on equal quality", header: "fr-CH, fr", want: "fr-CH"},
+		{name: "highest quality wins", header: "en;q=0.5, de;q=0.9", want: "de"},
+		{name: "zero quality is ignored", header: "de;q=0, en;q=0.1", want: "en"},
+		{name: "wildcard is ignored", header: "*", want: ""},
+		{name: "empty header", header: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, PreferredLanguage(tt.header))
+		})
+	}
+}
+
+func TestRule_Validate(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr error
+	}{
+		{name: "valid device rule", rule: Rule{Target: "https://apps.apple.com", Device: DeviceIOS}},
+		{name: "valid full rule", rule: Rule{Target: "https://example.com", Languages: []string{"de"}, TimeFrom: "22:00", TimeTo: "06:00", DateFrom: &from, DateTo: &to, Timezone: "Europe/Berlin"}},
+		{name: "empty target", rule: Rule{Device: DeviceIOS}, wantErr: ErrEmptyTarget},
+		{name: "unknown device", rule: Rule{Target: "https://example.com", Device: "watch"}, wantErr: ErrUnknownDevice},
+		{name: "incomplete time window", rule: Rule{Target: "https://example.com", TimeFrom: "10:00"}, wantErr: ErrIncompleteTimeOfDay},
+		{name: "invalid time of day", rule: Rule{Target: "https://example.com", TimeFrom: "25:00", TimeTo: "10:00"}, wantErr: ErrInvalidTimeOfDay},
+		{name: "inverted date window", rule: Rule{Target: "https://example.com", DateFrom: &to, DateTo: &from}, wantErr: ErrInvalidDateWindow},
+		{name: "unknown timezone", rule: Rule{Target: "https://example.com", Timezone: "Mars/Olympus"}, wantErr: ErrInvalidTimezone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.Validate()
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	noon := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	night := time.Date(2026, 3, 10, 23, 30, 0, 0, time.UTC)
+	campaignStart := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	campaignEnd := time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)
+
+	rules := []Rule{
+		{Target: "https://apps.apple.com/app", Device: DeviceIOS},
+		{Target: "https://play.google.com/app", Device: DeviceAndroid},
+		{Target: "https://example.com/campaign", DateFrom: &campaignStart, DateTo: &campaignEnd},
+		{Target: "https://example.de", Languages: []string{"de"}},
+		{Target: "https://example.com/night", TimeFrom: "22:00", TimeTo: "06:00"},
+	}
+
+	tests := []struct {
+		name       string
+		userAgent  string
+		language   string
+		now        time.Time
+		wantTarget string
+		wantOK     bool
+	}{
+		{name: "ios device", userAgent: iPhoneUA, now: noon, wantTarget: "https://apps.apple.com/app", wantOK: true},
+		{name: "android device", userAgent: androidUA, now: noon, wantTarget: "https://play.google.com/app", wantOK: true},
+		{name: "regional language variant", userAgent: desktopUA, language: "de-AT,en;q=0.5", now: noon, wantTarget: "https://example.de", wantOK: true},
+		{name: "night window across midnight", userAgent: desktopUA, language: "en", now: night, wantTarget: "https://example.com/night", wantOK: true},
+		{name: "inside date window", userAgent: desktopUA, now: campaignStart.Add(time.Hour), wantTarget: "https://example.com/campaign", wantOK: true},
+		{name: "no rule matches", userAgent: desktopUA, language: "en", now: noon, wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			if tt.language != "" {
+				req.Header.Set("Accept-Language", tt.language)
+			}
+
+			rule, ok := Match(rules, req, tt.now)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantTarget, rule.Target)
+		})
+	}
+}
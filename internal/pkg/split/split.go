@@ -0,0 +1,86 @@
+package split
+
+import (
+	"errors"
+	"hash/fnv"
+)
+
+// Split limits
+const (
+	// MinVariants is the minimum number of variants of a split link.
+	MinVariants = 2
+	// MaxWeight is the maximum weight of a variant, it keeps the sum of the weights far from overflowing.
+	MaxWeight = 10000
+)
+
+// Split errors
+var (
+	// ErrTooFewVariants is returned when a split link has less than MinVariants variants.
+	ErrTooFewVariants = errors.New("split: at least two variants are required")
+	// ErrEmptyVariantURL is returned when a variant has no destination URL.
+	ErrEmptyVariantURL = errors.New("split: variant url is empty")
+	// ErrInvalidWeight is returned when a variant has a non-positive weight.
+	ErrInvalidWeight = errors.New("split: variant weight must be positive")
+	// ErrWeightTooLarge is returned when a variant has a weight above MaxWeight.
+	ErrWeightTooLarge = errors.New("split: variant weight must not exceed 10000")
+)
+
+// Variant represents a weighted destination of a split link.
+type Variant struct {
+	// URL is the destination URL of the variant.
+	URL string `json:"url"`
+	// Weight is the relative share of visits served by the variant.
+	Weight int `json:"weight"`
+	// Clicks is the number of redirects served by the variant.
+	Clicks int `json:"clicks,omitempty"`
+}
+
+// Validate checks that the variants form a valid split.
+func Validate(variants []Variant) error {
+	if len(variants) < MinVariants {
+		return ErrTooFewVariants
+	}
+	for _, variant := range variants {
+		if variant.URL == "" {
+			return ErrEmptyVariantURL
+		}
+		if variant.Weight <= 0 {
+			return ErrInvalidWeight
+		}
+		if variant.Weight > MaxWeight {
+			return ErrWeightTooLarge
+		}
+	}
+	return nil
+}
+
+// Pick returns the index of the variant serving the visitor identified by key.
+// The choice is proportional to the variant weights and stable for the same key and variants.
+// It returns -1 if there are no variants with a positive weight.
+func Pick(variants []Variant, key string) int {
+	var total uint64
+	for _, variant := range variants {
+		if variant.Weight > 0 {
+			total += uint64(variant.Weight)
+		}
+	}
+	if total == 0 {
+		return -1
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	point := uint64(h.Sum32()) % total
+
+	for i, variant := range variants {
+		if variant.Weight <= 0 {
+			continue
+		}
+		weight := uint64(variant.Weight)
+		if point < weight {
+			return i
+		}
+		point -= weight
+	}
+	return -1
+}
@@ -0,0 +1,92 @@
+package split
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		variants []Variant
+		wantErr  error
+	}{
+		{
+			name:     "valid split",
+			variants: []Variant{{URL: "https://a.example.com", Weight: 1}, {URL: "https://b.example.com", Weight: 3}},
+		},
+		{
+			name:     "single variant",
+			variants: []Variant{{URL: "https://a.example.com", Weight: 1}},
+			wantErr:  ErrTooFewVariants,
+		},
+		{
+			name:     "empty url",
+			variants: []Variant{{URL: "https://a.example.com", Weight: 1}, {Weight: 1}},
+			wantErr:  ErrEmptyVariantURL,
+		},
+		{
+			name:     "zero weight",
+			variants: []Variant{{URL: "https://a.example.com", Weight: 1}, {URL: "https://b.example.com"}},
+			wantErr:  ErrInvalidWeight,
+		},
+		{
+			name:     "maximum weight",
+			variants: []Variant{{URL: "https://a.example.com", Weight: 1}, {URL: "https://b.example.com", Weight: MaxWeight}},
+		},
+		{
+			name:     "weight too large",
+			variants: []Variant{{URL: "https://a.example.com", Weight: 1}, {URL: "https://b.example.com", Weight: MaxWeight + 1}},
+			wantErr:  ErrWeightTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.variants)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestPick(t *testing.T) {
+	variants := []Variant{
+		{URL: "https://a.example.com", Weight: 1},
+		{URL: "https://b.example.com", Weight: 3},
+	}
+
+	t.Run("stable for the same visitor", func(t *testing.T) {
+		first := Pick(variants, "visitor-1")
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, first, Pick(variants, "visitor-1"))
+		}
+	})
+
+	t.Run("follows the weights", func(t *testing.T) {
+		counts := make([]int, len(variants))
+		for i := 0; i < 4000; i++ {
+			counts[Pick(variants, fmt.Sprintf("visitor-%d", i))]++
+		}
+		assert.InDelta(t, 1000, counts[0], 150)
+		assert.InDelta(t, 3000, counts[1], 150)
+	})
+
+	t.Run("weights summing past uint32", func(t *testing.T) {
+		huge := []Variant{
+			{URL: "https://a.example.com", Weight: math.MaxInt32},
+			{URL: "https://b.example.com", Weight: math.MaxInt32},
+			{URL: "https://c.example.com", Weight: 2},
+		}
+		assert.NotEqual(t, -1, Pick(huge, "visitor-1"), "the sum does not wrap around to zero")
+	})
+
+	t.Run("no variants", func(t *testing.T) {
+		assert.Equal(t, -1, Pick(nil, "visitor-1"))
+	})
+}
@@ -0,0 +1,270 @@
+package validate
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy list actions
+const (
+	// ActionDeny rejects URLs whose host matches the entry.
+	ActionDeny = "deny"
+	// ActionAllow approves URLs whose host matches the entry.
+	// Once the policy has an allow entry, URLs whose host matches no allow entry are rejected.
+	ActionAllow = "allow"
+)
+
+// Policy errors
+var (
+	// ErrHostDenied is returned when the host of a URL matches a deny entry.
+	ErrHostDenied = errors.New("host is denied")
+	// ErrHostNotAllowed is returned in allowlist mode when the host of a URL matches no allow entry.
+	ErrHostNotAllowed = errors.New("host is not allowed")
+	// ErrInvalidPolicyEntry is returned when a policy file line cannot be parsed.
+	ErrInvalidPolicyEntry = errors.New("invalid policy entry")
+)
+
+// PolicyError describes a URL rejected by the domain policy.
+type PolicyError struct {
+	// Host is the rejected host.
+	Host string
+	// Err is ErrHostDenied or ErrHostNotAllowed.
+	Err error
+}
+
+// Error returns the reason of the rejection.
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Err.Error(), e.Host)
+}
+
+// Unwrap returns ErrHostDenied or ErrHostNotAllowed.
+func (e *PolicyError) Unwrap() error {
+	return e.Err
+}
+
+// hostList holds the entries of one policy action.
+type hostList struct {
+	// domains holds exact host names.
+	domains map[string]struct{}
+	// suffixes holds the parent domains of wildcard entries, with a leading dot.
+	suffixes []string
+	// networks holds the IP ranges of CIDR and IP entries.
+	networks []*net.IPNet
+}
+
+func newHostList() hostList {
+	return hostList{domains: make(map[string]struct{})}
+}
+
+func (l *hostList) empty() bool {
+	return len(l.domains) == 0 && len(l.suffixes) == 0 && len(l.networks) == 0
+}
+
+func (l *hostList) add(entry string) error {
+	if strings.Contains(entry, "/") {
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidPolicyEntry, entry)
+		}
+		l.networks = append(l.networks, network)
+		return nil
+	}
+	if ip := net.ParseIP(entry); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 8 * net.IPv4len
+		}
+		l.networks = append(l.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		return nil
+	}
+	if suffix, ok := strings.CutPrefix(entry, "*."); ok {
+		if suffix == "" || strings.Contains(suffix, "*") {
+			return fmt.Errorf("%w: %s", ErrInvalidPolicyEntry, entry)
+		}
+		l.suffixes = append(l.suffixes, "."+normalizeHost(suffix))
+		return nil
+	}
+	if strings.Contains(entry, "*") {
+		return fmt.Errorf("%w: %s", ErrInvalidPolicyEntry, entry)
+	}
+	l.domains[normalizeHost(entry)] = struct{}{}
+	return nil
+}
+
+func (l *hostList) matches(host string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		for _, network := range l.networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	if _, ok := l.domains[host]; ok {
+		return true
+	}
+	for _, suffix := range l.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// policyRules is an immutable set of parsed policy entries.
+type policyRules struct {
+	// deny holds the entries rejecting hosts.
+	deny hostList
+	// allow holds the entries approving hosts, empty unless the allowlist mode is on.
+	allow hostList
+}
+
+func parsePolicy(file *os.File) (*policyRules, error) {
+	rules := &policyRules{deny: newHostList(), allow: newHostList()}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%w: line %d", ErrInvalidPolicyEntry, line)
+		}
+
+		var err error
+		switch strings.ToLower(fields[0]) {
+		case ActionDeny:
+			err = rules.deny.add(fields[1])
+		case ActionAllow:
+			err = rules.allow.add(fields[1])
+		default:
+			err = fmt.Errorf("%w: line %d: unknown action %s", ErrInvalidPolicyEntry, line, fields[0])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Policy decides which hosts may be shortened.
+// Entries are loaded from a file with one "deny <entry>" or "allow <entry>" line per entry, where an entry is
+// an exact domain, a wildcard such as *.example.com matching every subdomain, an IP address or a CIDR range.
+// Lines starting with # are comments. Deny entries take precedence over allow entries.
+type Policy struct {
+	// path is the path to the policy file.
+	path string
+	// rules holds the entries of the latest successfully loaded file.
+	rules *policyRules
+	// modTime is the modification time of the loaded file.
+	modTime time.Time
+	// size is the size of the loaded file.
+	size int64
+	// mu provides thread-safe access to the loaded entries.
+	mu sync.RWMutex
+}
+
+// LoadPolicy creates a policy from the file at the given path.
+func LoadPolicy(path string) (*Policy, error) {
+	p := &Policy{path: path}
+	if _, err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload loads the policy file again if it changed since the last load.
+// It reports whether the entries were replaced. The previous entries are kept if the file is invalid.
+func (p *Policy) Reload() (bool, error) {
+	file, err := os.Open(p.path)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	p.mu.RLock()
+	unchanged := p.rules != nil && info.ModTime().Equal(p.modTime) && info.Size() == p.size
+	p.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	rules, err := parsePolicy(file)
+	if err != nil {
+		return false, err
+	}
+
+	p.mu.Lock()
+	p.rules = rules
+	p.modTime = info.ModTime()
+	p.size = info.Size()
+	p.mu.Unlock()
+	return true, nil
+}
+
+// Watch reloads the policy file every interval until the context is canceled.
+// Failed reloads are reported to onError, which may be nil.
+func (p *Policy) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := p.Reload(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// CheckHost returns a *PolicyError if the policy rejects the host.
+func (p *Policy) CheckHost(host string) error {
+	host = normalizeHost(host)
+
+	p.mu.RLock()
+	rules := p.rules
+	p.mu.RUnlock()
+
+	if rules.deny.matches(host) {
+		return &PolicyError{Host: host, Err: ErrHostDenied}
+	}
+	if !rules.allow.empty() && !rules.allow.matches(host) {
+		return &PolicyError{Host: host, Err: ErrHostNotAllowed}
+	}
+	return nil
+}
+
+// CheckURL returns a *PolicyError if the policy rejects the host of the URL.
+func (p *Policy) CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	return p.CheckHost(u.Hostname())
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
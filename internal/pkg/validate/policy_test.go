@@ -0,0 +1,132 @@
+package validate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePolicy(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestPolicy_CheckURL(t *testing.T) {
+	denylist := `
+# known bad actors
+deny evil.com
+deny *.phishing.net
+deny 10.0.0.0/8
+deny 2001:db8::/32
+deny 192.168.1.10
+`
+	allowlist := denylist + `
+allow example.com
+allow *.example.org
+`
+
+	tests := []struct {
+		name    string
+		policy  string
+		url     string
+		wantErr error
+	}{
+		{name: "unlisted domain", policy: denylist, url: "https://google.com"},
+		{name: "exact domain", policy: denylist, url: "https://evil.com/path", wantErr: ErrHostDenied},
+		{name: "exact domain is case insensitive", policy: denylist, url: "https://EVIL.com./", wantErr: ErrHostDenied},
+		{name: "exact domain does not match subdomain", policy: denylist, url: "https://www.evil.com"},
+		{name: "wildcard subdomain", policy: denylist, url: "https://login.bank.phishing.net", wantErr: ErrHostDenied},
+		{name: "wildcard does not match apex", policy: denylist, url: "https://phishing.net"},
+		{name: "wildcard does not match lookalike", policy: denylist, url: "https://notphishing.net"},
+		{name: "ipv4 range", policy: denylist, url: "http://10.1.2.3:8080/", wantErr: ErrHostDenied},
+		{name: "ipv6 range", policy: denylist, url: "http://[2001:db8::1]/", wantErr: ErrHostDenied},
+		{name: "single ip", policy: denylist, url: "http://192.168.1.10/", wantErr: ErrHostDenied},
+		{name: "ip outside ranges", policy: denylist, url: "http://192.168.1.11/"},
+		{name: "allowed domain", policy: allowlist, url: "https://example.com"},
+		{name: "allowed wildcard", policy: allowlist, url: "https://docs.example.org"},
+		{name: "not allowed domain", policy: allowlist, url: "https://google.com", wantErr: ErrHostNotAllowed},
+		{name: "deny wins over allow", policy: allowlist + "deny bad.example.org\n", url: "https://bad.example.org", wantErr: ErrHostDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.txt")
+			writePolicy(t, path, tt.policy)
+			policy, err := LoadPolicy(path)
+			require.NoError(t, err)
+
+			err = policy.CheckURL(tt.url)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantErr)
+			var pErr *PolicyError
+			assert.True(t, errors.As(err, &pErr))
+		})
+	}
+}
+
+func TestLoadPolicy_InvalidEntries(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+	}{
+		{name: "unknown action", policy: "block evil.com"},
+		{name: "missing entry", policy: "deny"},
+		{name: "invalid cidr", policy: "deny 10.0.0.0/33"},
+		{name: "inner wildcard", policy: "deny evil.*.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.txt")
+			writePolicy(t, path, tt.policy)
+			_, err := LoadPolicy(path)
+			assert.ErrorIs(t, err, ErrInvalidPolicyEntry)
+		})
+	}
+
+	_, err := LoadPolicy(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestPolicy_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.txt")
+	writePolicy(t, path, "deny evil.com\n")
+	policy, err := LoadPolicy(path)
+	require.NoError(t, err)
+
+	reloaded, err := policy.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded, "unchanged file is not reloaded")
+
+	writePolicy(t, path, "deny other.com\ndeny evil.org\n")
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+	reloaded, err = policy.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.NoError(t, policy.CheckURL("https://evil.com"))
+	assert.ErrorIs(t, policy.CheckURL("https://evil.org"), ErrHostDenied)
+
+	writePolicy(t, path, "deny\n")
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Second)))
+	_, err = policy.Reload()
+	assert.ErrorIs(t, err, ErrInvalidPolicyEntry)
+	assert.ErrorIs(t, policy.CheckURL("https://evil.org"), ErrHostDenied, "invalid file keeps previous entries")
+}
+
+func TestService_CheckURLWithPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.txt")
+	writePolicy(t, path, "deny evil.com\n")
+	policy, err := LoadPolicy(path)
+	require.NoError(t, err)
+
+	s := NewServiceWithPolicy(policy)
+	assert.NoError(t, s.CheckURL("https://google.com"))
+	assert.ErrorIs(t, s.CheckURL("https://evil.com"), ErrHostDenied)
+	assert.Error(t, s.CheckURL("abc"))
+}
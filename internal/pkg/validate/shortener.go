@@ -0,0 +1,204 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Resolver defaults
+const (
+	// DefaultMaxHops is the maximum number of redirects followed when resolving a shortener link.
+	DefaultMaxHops = 5
+	// DefaultResolveTimeout is the timeout of a single request when resolving a shortener link.
+	DefaultResolveTimeout = 5 * time.Second
+)
+
+// DefaultShorteners lists the well-known URL shortener domains.
+var DefaultShorteners = []string{
+	"bit.ly", "bitly.com", "tinyurl.com", "t.co", "goo.gl", "ow.ly", "is.gd", "buff.ly",
+	"rebrand.ly", "cutt.ly", "tiny.cc", "shorturl.at", "rb.gy",
+}
+
+// Self-reference and shortener errors
+var (
+	// ErrSelfReference is returned when the URL points at a host served by this shortener.
+	ErrSelfReference = errors.New("url points to this shortener")
+	// ErrShortenerURL is returned when the URL points at another URL shortener.
+	ErrShortenerURL = errors.New("url points to another shortener")
+	// ErrUnresolvedURL is returned when a shortener link cannot be resolved to its destination.
+	ErrUnresolvedURL = errors.New("shortener url cannot be resolved")
+	// ErrRedirectLoop is returned when a shortener link redirects in a loop.
+	ErrRedirectLoop = errors.New("url redirects in a loop")
+)
+
+// defaultPorts maps schemes to their default ports.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// URLResolver is implemented by URL checkers that can replace a URL with the URL to store.
+type URLResolver interface {
+	// ResolveURL validates a URL and returns the URL to store,
+	// which is the final destination of a known shortener link when resolution is enabled.
+	ResolveURL(url string) (string, error)
+}
+
+// selfHost is a host served by this shortener.
+type selfHost struct {
+	// host is the punycode host name or IP address in lower case.
+	host string
+	// port is the port of the host, empty if every port is served.
+	port string
+}
+
+// SetSelfHosts configures the hosts served by this shortener, given as host or host:port.
+// URLs pointing at these hosts are rejected because they would create redirect loops.
+func (s *Service) SetSelfHosts(hosts []string) error {
+	selfHosts := make([]selfHost, 0, len(hosts))
+	for _, entry := range hosts {
+		host, port := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			host, port = h, p
+		}
+		asciiHost, err := ToASCII(host)
+		if err != nil {
+			return err
+		}
+		selfHosts = append(selfHosts, selfHost{host: asciiHost, port: port})
+	}
+	s.selfHosts = selfHosts
+	return nil
+}
+
+// SetShorteners configures the known shortener domains, wildcards such as *.example.com are accepted.
+func (s *Service) SetShorteners(domains []string) error {
+	list := newHostList()
+	for _, domain := range domains {
+		if err := list.add(strings.ToLower(domain)); err != nil {
+			return err
+		}
+	}
+	s.shorteners = list
+	return nil
+}
+
+func (s *Service) isSelfHost(u *url.URL, host string) bool {
+	port := u.Port()
+	if port == "" {
+		port = defaultPorts[strings.ToLower(u.Scheme)]
+	}
+	for _, self := range s.selfHosts {
+		if self.host == host && (self.port == "" || self.port == port) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) isShortener(host string) bool {
+	return s.shorteners.matches(host)
+}
+
+// ResolveURL validates the URL and returns the URL to store.
+// Links to known shorteners are resolved to their final destination if a Resolver is configured,
+// the destination is validated like a submitted URL.
+func (s *Service) ResolveURL(rawURL string) (string, error) {
+	host, err := s.check(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if !s.isShortener(host) {
+		return rawURL, nil
+	}
+	if s.Resolver == nil {
+		return "", &URLError{Err: ErrShortenerURL, Detail: host}
+	}
+
+	destination, err := s.Resolver.Resolve(rawURL, func(u *url.URL) bool {
+		host, err := ToASCII(u.Hostname())
+		return err == nil && s.isShortener(host)
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := s.CheckURL(destination); err != nil {
+		return "", err
+	}
+	return destination, nil
+}
+
+// Resolver follows the redirects of shortener links.
+type Resolver struct {
+	// Client sends the requests, it must not follow redirects.
+	Client *http.Client
+	// MaxHops is the maximum number of redirects followed.
+	MaxHops int
+}
+
+// NewResolver creates a resolver following up to DefaultMaxHops redirects with the given request timeout.
+func NewResolver(timeout time.Duration) *Resolver {
+	return &Resolver{
+		Client: &http.Client{
+			Timeout: timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		MaxHops: DefaultMaxHops,
+	}
+}
+
+// Resolve follows the redirects of the URL while follow reports true for the current URL
+// and returns the first URL that is not followed.
+// Returns a *URLError if a request fails, the URL redirects in a loop or the hop limit is exceeded.
+func (r *Resolver) Resolve(rawURL string, follow func(u *url.URL) bool) (string, error) {
+	current, err := url.Parse(rawURL)
+	if err != nil {
+		return "", &URLError{Err: ErrMalformedURL, Detail: err.Error()}
+	}
+	visited := map[string]struct{}{}
+	for hops := 0; follow(current); hops++ {
+		if _, ok := visited[current.String()]; ok {
+			return "", &URLError{Err: ErrRedirectLoop, Detail: current.String()}
+		}
+		visited[current.String()] = struct{}{}
+		if hops >= r.MaxHops {
+			return "", &URLError{Err: ErrUnresolvedURL, Detail: fmt.Sprintf("more than %d redirects", r.MaxHops)}
+		}
+
+		next, err := r.next(current)
+		if err != nil {
+			return "", &URLError{Err: ErrUnresolvedURL, Detail: err.Error()}
+		}
+		current = next
+	}
+	return current.String(), nil
+}
+
+func (r *Resolver) next(u *url.URL) (*url.URL, error) {
+	res, err := r.Client.Head(u.String())
+	if err == nil && res.StatusCode == http.StatusMethodNotAllowed {
+		_ = res.Body.Close()
+		res, err = r.Client.Get(u.String())
+	}
+	if err != nil {
+		var uErr *url.Error
+		if errors.As(err, &uErr) {
+			err = uErr.Err
+		}
+		return nil, err
+	}
+	_ = res.Body.Close()
+
+	location := res.Header.Get("Location")
+	if res.StatusCode < 300 || res.StatusCode >= 400 || location == "" {
+		return nil, fmt.Errorf("%s did not redirect, status %d", u.Host, res.StatusCode)
+	}
+	return u.Parse(location)
+}
@@ -0,0 +1,106 @@
+package validate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_SelfReference(t *testing.T) {
+	s := NewService()
+	require.NoError(t, s.SetSelfHosts([]string{"localhost:8080", "Sho.rt"}))
+
+	tests := []struct {
+		name    string
+		url     string
+		wantErr error
+	}{
+		{name: "base url host", url: "http://localhost:8080/abc", wantErr: ErrSelfReference},
+		{name: "base url host on another port", url: "http://localhost:3000/abc"},
+		{name: "served host on any port", url: "https://sho.rt/abc", wantErr: ErrSelfReference},
+		{name: "served host is case insensitive", url: "http://SHO.RT.:8443/abc", wantErr: ErrSelfReference},
+		{name: "subdomain of served host", url: "https://www.sho.rt/abc"},
+		{name: "known shortener", url: "https://bit.ly/abc", wantErr: ErrShortenerURL},
+		{name: "unrelated host", url: "https://example.com/abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.CheckURL(tt.url)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestService_ResolveURL(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/final", func(rw http.ResponseWriter, r *http.Request) {
+		http.Redirect(rw, r, "https://example.com/final", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/chain", func(rw http.ResponseWriter, r *http.Request) {
+		http.Redirect(rw, r, "/final", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(rw http.ResponseWriter, r *http.Request) {
+		http.Redirect(rw, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/self", func(rw http.ResponseWriter, r *http.Request) {
+		http.Redirect(rw, r, "https://sho.rt/abc", http.StatusFound)
+	})
+	mux.HandleFunc("/no-head", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			rw.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		http.Redirect(rw, r, "https://example.com/get", http.StatusFound)
+	})
+	mux.HandleFunc("/page", func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	newService := func(resolve bool) *Service {
+		s := NewService()
+		require.NoError(t, s.SetSelfHosts([]string{"sho.rt"}))
+		require.NoError(t, s.SetShorteners([]string{"127.0.0.1"}))
+		if resolve {
+			s.Resolver = NewResolver(time.Second)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		resolve bool
+		url     string
+		want    string
+		wantErr error
+	}{
+		{name: "regular url is kept", resolve: true, url: "https://example.com/page", want: "https://example.com/page"},
+		{name: "shortener is rejected without resolution", url: srv.URL + "/final", wantErr: ErrShortenerURL},
+		{name: "final destination", resolve: true, url: srv.URL + "/final", want: "https://example.com/final"},
+		{name: "chain of shortener hops", resolve: true, url: srv.URL + "/chain", want: "https://example.com/final"},
+		{name: "get fallback", resolve: true, url: srv.URL + "/no-head", want: "https://example.com/get"},
+		{name: "redirect loop", resolve: true, url: srv.URL + "/loop", wantErr: ErrRedirectLoop},
+		{name: "destination is this shortener", resolve: true, url: srv.URL + "/self", wantErr: ErrSelfReference},
+		{name: "shortener does not redirect", resolve: true, url: srv.URL + "/page", wantErr: ErrUnresolvedURL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newService(tt.resolve).ResolveURL(tt.url)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -2,41 +2,192 @@ package validate
 
 import (
 	"errors"
-	"regexp"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
 )
 
+// Validation defaults
 const (
-	urlPatternString = `(https?:\/\/)([\da-z\.-]+)\.([a-z]{2,6})(\/[\da-z\.-]+)*`
+	// DefaultMaxLength is the maximum accepted URL length in bytes.
+	DefaultMaxLength = 2048
+)
+
+// DefaultSchemes lists the URL schemes accepted by default.
+var DefaultSchemes = []string{"http", "https"}
+
+// hostProfile converts host names for lookup and rejects empty or overlong labels.
+var hostProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.StrictDomainName(true),
+	idna.VerifyDNSLength(true),
+)
+
+// Validation errors
+var (
+	// ErrEmptyURL is returned when the URL is empty.
+	ErrEmptyURL = errors.New("url is empty")
+	// ErrURLTooLong is returned when the URL exceeds the maximum length.
+	ErrURLTooLong = errors.New("url is too long")
+	// ErrMalformedURL is returned when the URL cannot be parsed or is not absolute.
+	ErrMalformedURL = errors.New("url is malformed")
+	// ErrUnsupportedScheme is returned when the scheme of the URL is not allowed.
+	ErrUnsupportedScheme = errors.New("url scheme is not supported")
+	// ErrMissingHost is returned when the URL has no host.
+	ErrMissingHost = errors.New("url host is missing")
+	// ErrInvalidHost is returned when the host of the URL is not a valid domain name or IP address.
+	ErrInvalidHost = errors.New("url host is invalid")
 )
 
+// URLError describes a URL rejected by the validator.
+type URLError struct {
+	// Err is one of the validation errors.
+	Err error
+	// Detail describes the offending part of the URL, it may be empty.
+	Detail string
+}
+
+// Error returns the reason of the rejection.
+func (e *URLError) Error() string {
+	if e.Detail == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.Err.Error(), e.Detail)
+}
+
+// Unwrap returns the validation error.
+func (e *URLError) Unwrap() error {
+	return e.Err
+}
+
 // URLChecker defines the interface for URL validation operations.
-// It provides methods to validate URLs against configured patterns.
 type URLChecker interface {
-	// CheckURL validates a URL against the configured pattern.
+	// CheckURL validates a URL.
 	// Returns an error if the URL is invalid or empty.
 	CheckURL(url string) error
 }
 
-// Service provides URL validation functionality using regular expressions.
-// It implements the URLChecker interface for validating URL formats.
+// Service provides URL validation based on the net/url parser.
+// It implements the URLChecker interface.
 type Service struct {
-	// URLPattern is the compiled regular expression used for URL validation.
-	URLPattern *regexp.Regexp
+	// Schemes lists the accepted URL schemes in lower case.
+	Schemes []string
+	// MaxLength is the maximum accepted URL length in bytes, zero disables the limit.
+	MaxLength int
+	// Policy rejects URLs by host, nil disables the domain policy.
+	Policy *Policy
+	// Resolver resolves links to known shorteners in ResolveURL, nil rejects them.
+	Resolver *Resolver
+	// selfHosts lists the hosts served by this shortener.
+	selfHosts []selfHost
+	// shorteners holds the known shortener domains.
+	shorteners hostList
 }
 
-// NewService creates a new URL validation service with the default URL pattern.
+// NewService creates a new URL validation service accepting http and https URLs up to the default length
+// and rejecting links to the default shortener domains.
 // The service is ready to use immediately after creation.
 func NewService() *Service {
-	return &Service{
-		URLPattern: regexp.MustCompile(urlPatternString),
+	s := &Service{
+		Schemes:   DefaultSchemes,
+		MaxLength: DefaultMaxLength,
 	}
+	_ = s.SetShorteners(DefaultShorteners)
+	return s
+}
+
+// NewServiceWithPolicy creates a new URL validation service that also applies the domain policy.
+func NewServiceWithPolicy(policy *Policy) *Service {
+	s := NewService()
+	s.Policy = policy
+	return s
 }
 
-// CheckURL validates a URL against the configured pattern.
-// Returns an error if the URL is invalid or empty.
-func (s *Service) CheckURL(url string) error {
-	if url != "" && !s.URLPattern.MatchString(url) {
-		return errors.New("url is not valid")
+// CheckURL validates that the URL is an absolute URL with an allowed scheme and a valid host
+// that is neither served by this shortener nor a known shortener.
+// Internationalized domain names are accepted in Unicode and punycode form.
+// Returns a *URLError describing the problem, or a *PolicyError if the domain policy rejects the host.
+func (s *Service) CheckURL(rawURL string) error {
+	host, err := s.check(rawURL)
+	if err != nil {
+		return err
+	}
+	if s.isShortener(host) {
+		return &URLError{Err: ErrShortenerURL, Detail: host}
 	}
 	return nil
 }
+
+// check validates the URL except for links to known shorteners and returns its punycode host.
+func (s *Service) check(rawURL string) (string, error) {
+	if strings.TrimSpace(rawURL) == "" {
+		return "", &URLError{Err: ErrEmptyURL}
+	}
+	if s.MaxLength > 0 && len(rawURL) > s.MaxLength {
+		return "", &URLError{Err: ErrURLTooLong, Detail: fmt.Sprintf("%d bytes, at most %d allowed", len(rawURL), s.MaxLength)}
+	}
+	if !utf8.ValidString(rawURL) || strings.ContainsAny(rawURL, " \t\r\n") {
+		return "", &URLError{Err: ErrMalformedURL, Detail: "contains invalid characters"}
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		var uErr *url.Error
+		if errors.As(err, &uErr) {
+			err = uErr.Err
+		}
+		return "", &URLError{Err: ErrMalformedURL, Detail: err.Error()}
+	}
+	if u.Scheme == "" || u.Opaque != "" {
+		return "", &URLError{Err: ErrMalformedURL, Detail: "url must be absolute"}
+	}
+	if !s.allowedScheme(u.Scheme) {
+		return "", &URLError{Err: ErrUnsupportedScheme, Detail: u.Scheme}
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		return "", &URLError{Err: ErrMissingHost}
+	}
+	asciiHost, err := ToASCII(host)
+	if err != nil {
+		return "", err
+	}
+	if s.isSelfHost(u, asciiHost) {
+		return "", &URLError{Err: ErrSelfReference, Detail: u.Host}
+	}
+
+	if s.Policy != nil {
+		if err := s.Policy.CheckHost(asciiHost); err != nil {
+			return "", err
+		}
+	}
+	return asciiHost, nil
+}
+
+// ToASCII converts an internationalized host name to its punycode form.
+// IP addresses and ASCII host names are returned in lower case.
+func ToASCII(host string) (string, error) {
+	if net.ParseIP(host) != nil {
+		return strings.ToLower(host), nil
+	}
+	ascii, err := hostProfile.ToASCII(strings.TrimSuffix(host, "."))
+	if err != nil {
+		return "", &URLError{Err: ErrInvalidHost, Detail: host}
+	}
+	return ascii, nil
+}
+
+func (s *Service) allowedScheme(scheme string) bool {
+	for _, allowed := range s.Schemes {
+		if strings.EqualFold(allowed, scheme) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package validate
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -11,55 +12,177 @@ func TestValidateURL(t *testing.T) {
 		name       string
 		urlChecker URLChecker
 		url        string
-		hasErr     bool
+		wantErr    error
 	}{
 		{
 			name:       "url is empty",
 			urlChecker: NewService(),
 			url:        "",
-			hasErr:     false,
+			wantErr:    ErrEmptyURL,
+		},
+		{
+			name:       "url is blank",
+			urlChecker: NewService(),
+			url:        "   ",
+			wantErr:    ErrEmptyURL,
 		},
 		{
 			name:       "url is not valid",
 			urlChecker: NewService(),
 			url:        "abc",
-			hasErr:     true,
+			wantErr:    ErrMalformedURL,
 		},
 		{
 			name:       "url is valid: https://google.com",
 			urlChecker: NewService(),
 			url:        "https://google.com",
-			hasErr:     false,
 		},
 		{
 			name:       "url is valid: http://google.com",
 			urlChecker: NewService(),
 			url:        "http://google.com",
-			hasErr:     false,
 		},
 		{
 			name:       "complex url is valid: https://google.tr.com",
 			urlChecker: NewService(),
 			url:        "https://google.tr.com",
-			hasErr:     false,
 		},
 		{
 			name:       "complex url is valid: https://google.tr.com/",
 			urlChecker: NewService(),
 			url:        "https://google.tr.com/",
-			hasErr:     false,
 		},
 		{
 			name:       "complex url is valid: https://google.tr.com/2a/2b/2c",
 			urlChecker: NewService(),
 			url:        "https://google.tr.com/2a/2b/2c",
-			hasErr:     false,
+		},
+		{
+			name:       "uppercase path, port, query and fragment",
+			urlChecker: NewService(),
+			url:        "https://Example.com:8443/Docs/Index.HTML?q=Go&page=2#Section",
+		},
+		{
+			name:       "ipv4 host",
+			urlChecker: NewService(),
+			url:        "http://192.168.0.1:8080/status",
+		},
+		{
+			name:       "ipv6 host",
+			urlChecker: NewService(),
+			url:        "http://[2001:db8::1]/",
+		},
+		{
+			name:       "long tld",
+			urlChecker: NewService(),
+			url:        "https://shop.photography/gallery",
+		},
+		{
+			name:       "unicode idn",
+			urlChecker: NewService(),
+			url:        "https://bücher.example/katalog",
+		},
+		{
+			name:       "punycode idn",
+			urlChecker: NewService(),
+			url:        "https://xn--bcher-kva.example/katalog",
+		},
+		{
+			name:       "garbage around a url",
+			urlChecker: NewService(),
+			url:        "see https://google.com now",
+			wantErr:    ErrMalformedURL,
+		},
+		{
+			name:       "relative url",
+			urlChecker: NewService(),
+			url:        "/path/only",
+			wantErr:    ErrMalformedURL,
+		},
+		{
+			name:       "unsupported scheme",
+			urlChecker: NewService(),
+			url:        "javascript:alert(1)",
+			wantErr:    ErrMalformedURL,
+		},
+		{
+			name:       "ftp scheme is not allowed by default",
+			urlChecker: NewService(),
+			url:        "ftp://files.example.com/archive.zip",
+			wantErr:    ErrUnsupportedScheme,
+		},
+		{
+			name:       "ftp scheme allowed by configuration",
+			urlChecker: &Service{Schemes: []string{"ftp"}},
+			url:        "ftp://files.example.com/archive.zip",
+		},
+		{
+			name:       "missing host",
+			urlChecker: NewService(),
+			url:        "https:///path",
+			wantErr:    ErrMissingHost,
+		},
+		{
+			name:       "invalid host",
+			urlChecker: NewService(),
+			url:        "https://exa_mple.com",
+			wantErr:    ErrInvalidHost,
+		},
+		{
+			name:       "empty host label",
+			urlChecker: NewService(),
+			url:        "https://example..com",
+			wantErr:    ErrInvalidHost,
+		},
+		{
+			name:       "invalid port",
+			urlChecker: NewService(),
+			url:        "https://example.com:port/",
+			wantErr:    ErrMalformedURL,
+		},
+		{
+			name:       "url is too long",
+			urlChecker: NewService(),
+			url:        "https://example.com/" + strings.Repeat("a", DefaultMaxLength),
+			wantErr:    ErrURLTooLong,
+		},
+		{
+			name:       "custom maximum length",
+			urlChecker: &Service{Schemes: DefaultSchemes, MaxLength: 20},
+			url:        "https://example.com/long",
+			wantErr:    ErrURLTooLong,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			err := tt.urlChecker.CheckURL(tt.url)
-			assert.Equal(t, tt.hasErr, err != nil)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantErr)
+			var uErr *URLError
+			assert.ErrorAs(t, err, &uErr)
+		})
+	}
+}
+
+func TestToASCII(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		want string
+	}{
+		{name: "ascii", host: "Example.COM", want: "example.com"},
+		{name: "unicode", host: "bücher.example", want: "xn--bcher-kva.example"},
+		{name: "trailing dot", host: "example.com.", want: "example.com"},
+		{name: "ipv6", host: "2001:DB8::1", want: "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToASCII(tt.host)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
 		})
 	}
 }
@@ -0,0 +1,60 @@
+package workspace
+
+import (
+	"errors"
+	"strings"
+)
+
+// Role is the role of a member in a workspace.
+type Role string
+
+// Workspace roles
+const (
+	// RoleOwner manages the membership of the workspace and has all permissions of an editor.
+	RoleOwner Role = "owner"
+	// RoleEditor creates, updates and deletes the links of the workspace.
+	RoleEditor Role = "editor"
+	// RoleViewer lists the links of the workspace and reads their settings.
+	RoleViewer Role = "viewer"
+)
+
+// Permission is an action on a workspace that depends on the role of the member.
+type Permission int
+
+// Workspace permissions
+const (
+	// PermissionRead allows listing the links of the workspace and reading their settings.
+	PermissionRead Permission = iota
+	// PermissionWrite allows creating, updating and deleting the links of the workspace.
+	PermissionWrite
+	// PermissionManage allows changing the membership of the workspace.
+	PermissionManage
+)
+
+// ErrUnknownRole is returned when parsing a role that is not owner, editor or viewer.
+var ErrUnknownRole = errors.New("role must be owner, editor or viewer")
+
+// ParseRole returns the role with the given name, names are case insensitive.
+func ParseRole(name string) (Role, error) {
+	role := Role(strings.ToLower(strings.TrimSpace(name)))
+	switch role {
+	case RoleOwner, RoleEditor, RoleViewer:
+		return role, nil
+	default:
+		return "", ErrUnknownRole
+	}
+}
+
+// Can reports whether a member with the role has the permission.
+func (r Role) Can(p Permission) bool {
+	switch r {
+	case RoleOwner:
+		return true
+	case RoleEditor:
+		return p == PermissionRead || p == PermissionWrite
+	case RoleViewer:
+		return p == PermissionRead
+	default:
+		return false
+	}
+}
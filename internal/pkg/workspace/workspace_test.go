@@ -0,0 +1,54 @@
+package workspace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRole(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Role
+		wantErr  bool
+	}{
+		{name: "owner", input: "owner", expected: RoleOwner},
+		{name: "case insensitive", input: " Editor ", expected: RoleEditor},
+		{name: "viewer", input: "viewer", expected: RoleViewer},
+		{name: "unknown role", input: "admin", wantErr: true},
+		{name: "empty role", input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role, err := ParseRole(tt.input)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrUnknownRole)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, role)
+		})
+	}
+}
+
+func TestRole_Can(t *testing.T) {
+	tests := []struct {
+		role     Role
+		expected map[Permission]bool
+	}{
+		{role: RoleOwner, expected: map[Permission]bool{PermissionRead: true, PermissionWrite: true, PermissionManage: true}},
+		{role: RoleEditor, expected: map[Permission]bool{PermissionRead: true, PermissionWrite: true, PermissionManage: false}},
+		{role: RoleViewer, expected: map[Permission]bool{PermissionRead: true, PermissionWrite: false, PermissionManage: false}},
+		{role: Role("unknown"), expected: map[Permission]bool{PermissionRead: false, PermissionWrite: false, PermissionManage: false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.role), func(t *testing.T) {
+			for perm, expected := range tt.expected {
+				assert.Equal(t, expected, tt.role.Can(perm), "permission %d", perm)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Audit details added by the repository
+const (
+	// AuditDetailFrom is the previous owner of a reassigned link.
+	AuditDetailFrom = "from"
+	// AuditDetailResolved is the number of reports closed by the action.
+	AuditDetailResolved = "resolved"
+)
+
+// Admin search limits
+const (
+	// DefaultSearchLimit is the number of links returned by a search without a limit.
+	DefaultSearchLimit = 100
+	// MaxSearchLimit is the maximum number of links returned by a search.
+	MaxSearchLimit = 1000
+)
+
+// searchLimit returns the limit of the filter within the allowed range.
+func (f LinkFilter) searchLimit() int {
+	if f.Limit <= 0 {
+		return DefaultSearchLimit
+	}
+	if f.Limit > MaxSearchLimit {
+		return MaxSearchLimit
+	}
+	return f.Limit
+}
+
+// matches reports whether the mapping matches the filter.
+func (f LinkFilter) matches(m *URLMapping) bool {
+	if f.Alias != "" && !strings.HasPrefix(m.ShortURL, f.Alias) {
+		return false
+	}
+	if f.OwnerID != "" && m.UserID != f.OwnerID {
+		return false
+	}
+	return f.Domain == "" || matchesDomain(m.OriginalURL, f.Domain)
+}
+
+// matchesDomain reports whether the host of the URL is the domain or one of its subdomains.
+func matchesDomain(rawURL, domain string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	domain = strings.ToLower(domain)
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// searchLinks returns the mappings matching the filter ordered by alias. Callers must hold the repository lock.
+func searchLinks(records map[string]*URLMapping, filter LinkFilter, baseURL string) []LinkRecord {
+	res := make([]LinkRecord, 0)
+	for _, record := range records {
+		if filter.matches(record) {
+			res = append(res, record.linkRecord(baseURL))
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Alias < res[j].Alias
+	})
+	if limit := filter.searchLimit(); len(res) > limit {
+		res = res[:limit]
+	}
+	return res
+}
+
+// linkRecord converts the mapping to a LinkRecord.
+func (m *URLMapping) linkRecord(baseURL string) LinkRecord {
+	return LinkRecord{
+		Alias:          m.ShortURL,
+		ShortURL:       baseURL + "/" + m.ShortURL,
+		OriginalURL:    m.OriginalURL,
+		OwnerID:        m.UserID,
+		IsDeleted:      m.IsDeleted,
+		Clicks:         m.Clicks,
+		DisabledStatus: m.DisabledStatus,
+		DisabledReason: m.DisabledReason,
+		Quarantined:    m.Quarantined,
+	}
+}
+
+// ownerStats counts the mappings of every owner. Callers must hold the repository lock.
+func ownerStats(records map[string]*URLMapping) []OwnerStats {
+	byOwner := make(map[string]*OwnerStats)
+	for _, record := range records {
+		stats, ok := byOwner[record.UserID]
+		if !ok {
+			stats = &OwnerStats{OwnerID: record.UserID}
+			byOwner[record.UserID] = stats
+		}
+		switch {
+		case record.IsDeleted:
+			stats.Deleted++
+		case record.DisabledStatus != 0:
+			stats.Disabled++
+		default:
+			stats.Active++
+		}
+		stats.Clicks += record.Clicks
+	}
+
+	res := make([]OwnerStats, 0, len(byOwner))
+	for _, stats := range byOwner {
+		res = append(res, *stats)
+	}
+	sortOwnerStats(res)
+	return res
+}
+
+// sortOwnerStats orders owners by their number of active links, most first.
+func sortOwnerStats(stats []OwnerStats) {
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Active != stats[j].Active {
+			return stats[i].Active > stats[j].Active
+		}
+		return stats[i].OwnerID < stats[j].OwnerID
+	})
+}
+
+// withDetail returns a copy of the audit entry with the detail set, an empty value leaves the entry unchanged.
+func (e AuditEntry) withDetail(key, value string) AuditEntry {
+	if value == "" {
+		return e
+	}
+	details := make(map[string]string, len(e.Details)+1)
+	for k, v := range e.Details {
+		details[k] = v
+	}
+	details[key] = value
+	e.Details = details
+	return e
+}
+
+// withResolved returns a copy of the audit entry with the number of closed reports.
+func (e AuditEntry) withResolved(resolved int) AuditEntry {
+	return e.withDetail(AuditDetailResolved, strconv.Itoa(resolved))
+}
+
+// latestAudit returns up to limit entries of the audit log, newest first.
+func latestAudit(entries []AuditEntry, limit int) []AuditEntry {
+	if limit <= 0 || limit > len(entries) {
+		limit = len(entries)
+	}
+	res := make([]AuditEntry, 0, limit)
+	for i := len(entries) - 1; i >= 0 && len(res) < limit; i-- {
+		res = append(res, entries[i])
+	}
+	return res
+}
+
+// findUserByID returns the registered user with the given ID.
+func findUserByID(users map[string]*User, userID string) (User, error) {
+	for _, user := range users {
+		if user.ID == userID {
+			return *user, nil
+		}
+	}
+	return User{}, ErrUserNotFound
+}
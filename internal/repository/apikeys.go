@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"sort"
+	"time"
+)
+
+// activeAPIKeys returns the active API keys of the user, oldest first.
+func activeAPIKeys(keys map[string]*APIKey, userID string) []APIKey {
+	res := make([]APIKey, 0)
+	for _, key := range keys {
+		if key.UserID == userID && key.RevokedAt == nil {
+			res = append(res, *key)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+	return res
+}
+
+// findActiveAPIKey returns the active API key with the given ID owned by the user.
+func findActiveAPIKey(keys map[string]*APIKey, userID, keyID string) (*APIKey, error) {
+	key, exists := keys[keyID]
+	if !exists || key.UserID != userID || key.RevokedAt != nil {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+// apiKeyUser returns the owner of the active API key with the given hash.
+func apiKeyUser(keys map[string]*APIKey, keyHash string) (string, error) {
+	for _, key := range keys {
+		if key.Hash == keyHash && key.RevokedAt == nil {
+			return key.UserID, nil
+		}
+	}
+	return "", ErrAPIKeyNotFound
+}
+
+// revoked returns a copy of the key revoked at the given time.
+func (k APIKey) revoked(revokedAt time.Time) *APIKey {
+	k.RevokedAt = &revokedAt
+	return &k
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/pkg/canonical"
+)
+
+// CanonicalRepository canonicalizes URLs before they are stored by the wrapped repository,
+// so that equivalent URLs are detected as conflicts.
+// The URL as submitted is kept in the link options when it differs from the canonical form.
+type CanonicalRepository struct {
+	// Repository is the wrapped repository.
+	Repository
+	// opts selects the canonicalization rules.
+	opts canonical.Options
+}
+
+// NewCanonicalRepository wraps the repository with URL canonicalization.
+func NewCanonicalRepository(repo Repository, opts canonical.Options) *CanonicalRepository {
+	return &CanonicalRepository{
+		Repository: repo,
+		opts:       opts,
+	}
+}
+
+// Store canonicalizes the URL and saves it to the wrapped repository.
+func (r *CanonicalRepository) Store(userID, baseURL, targetURL string, opts LinkOptions) (string, error) {
+	targetURL, opts = r.canonicalize(targetURL, opts)
+	return r.Repository.Store(userID, baseURL, targetURL, opts)
+}
+
+// StoreBatch canonicalizes the URLs and saves them to the wrapped repository.
+func (r *CanonicalRepository) StoreBatch(userID, baseURL string, urls []BatchURLInput) ([]BatchURLOutput, error) {
+	canonicalURLs := make([]BatchURLInput, len(urls))
+	for i, url := range urls {
+		canonicalURLs[i] = url
+		canonicalURLs[i].OriginalURL, canonicalURLs[i].Options = r.canonicalize(url.OriginalURL, url.Options)
+	}
+	return r.Repository.StoreBatch(userID, baseURL, canonicalURLs)
+}
+
+func (r *CanonicalRepository) canonicalize(targetURL string, opts LinkOptions) (string, LinkOptions) {
+	canonicalURL, err := canonical.Canonicalize(targetURL, r.opts)
+	if err != nil {
+		logger.Log.Debug("repository: url is stored as submitted", zap.String("url", targetURL), zap.Error(err))
+		return targetURL, opts
+	}
+	if canonicalURL != targetURL {
+		opts.SubmittedURL = targetURL
+	}
+	return canonicalURL, opts
+}
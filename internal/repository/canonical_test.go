@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aifedorov/shortener/internal/pkg/canonical"
+)
+
+func TestCanonicalRepository_Store(t *testing.T) {
+	opts, err := canonical.ParseRules([]string{
+		canonical.RuleHost, canonical.RulePort, canonical.RuleDotSegments,
+		canonical.RuleSortQuery, canonical.RuleStripTracking, canonical.RuleStripFragment,
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		url           string
+		wantURL       string
+		wantSubmitted string
+	}{
+		{
+			name:          "equivalent url is canonicalized",
+			url:           "HTTPS://Example.COM:443/a/./b/../c?z=1&a=2&utm_source=mail#top",
+			wantURL:       "https://example.com/a/c?a=2&z=1",
+			wantSubmitted: "HTTPS://Example.COM:443/a/./b/../c?z=1&a=2&utm_source=mail#top",
+		},
+		{
+			name:    "canonical url is kept without submitted form",
+			url:     "https://example.com/a/c?a=2&z=1",
+			wantURL: "https://example.com/a/c?a=2&z=1",
+		},
+		{
+			name:    "unparsable url is stored as submitted",
+			url:     "https://exa_mple.com/",
+			wantURL: "https://exa_mple.com/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory := NewMemoryRepository()
+			repo := NewCanonicalRepository(memory, opts)
+
+			_, err := repo.Store("user123", "http://localhost:8080", tt.url, LinkOptions{})
+			require.NoError(t, err)
+
+			urls, err := repo.GetAll("user123", "http://localhost:8080")
+			require.NoError(t, err)
+			require.Len(t, urls, 1)
+			assert.Equal(t, tt.wantURL, urls[0].OriginalURL)
+			assert.Equal(t, tt.wantSubmitted, urls[0].SubmittedURL)
+		})
+	}
+}
+
+func TestCanonicalRepository_StoreConflict(t *testing.T) {
+	repo := NewCanonicalRepository(NewMemoryRepository(), canonical.Options{LowercaseHost: true, SortQuery: true})
+
+	shortURL, err := repo.Store("user123", "http://localhost:8080", "https://example.com/?b=1&a=2", LinkOptions{})
+	require.NoError(t, err)
+
+	_, err = repo.Store("user123", "http://localhost:8080", "https://EXAMPLE.com/?a=2&b=1", LinkOptions{})
+	var cErr *ConflictError
+	require.ErrorAs(t, err, &cErr, "an equivalent url conflicts with the stored one")
+	assert.Equal(t, shortURL, cErr.ShortURL)
+}
+
+func TestCanonicalRepository_StoreBatch(t *testing.T) {
+	memory := NewMemoryRepository()
+	repo := NewCanonicalRepository(memory, canonical.Options{LowercaseHost: true, SortQuery: true})
+
+	input := []BatchURLInput{
+		{CID: "1", OriginalURL: "https://EXAMPLE.com/?b=1&a=2"},
+		{CID: "2", OriginalURL: "https://example.org/"},
+	}
+	res, err := repo.StoreBatch("user123", "http://localhost:8080", input)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, "https://EXAMPLE.com/?b=1&a=2", input[0].OriginalURL, "input is not modified")
+
+	for _, out := range res {
+		alias := out.ShortURL[len("http://localhost:8080/"):]
+		mapping := memory.PathToURL[alias]
+		require.NotNil(t, mapping)
+		switch out.CID {
+		case "1":
+			assert.Equal(t, "https://example.com/?a=2&b=1", mapping.OriginalURL)
+			assert.Equal(t, "https://EXAMPLE.com/?b=1&a=2", mapping.SubmittedURL)
+		case "2":
+			assert.Equal(t, "https://example.org/", mapping.OriginalURL)
+			assert.Empty(t, mapping.SubmittedURL)
+		}
+	}
+}
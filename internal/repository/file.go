@@ -2,11 +2,16 @@ package repository
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/aifedorov/shortener/internal/pkg/random"
-	"github.com/google/uuid"
+	"github.com/aifedorov/shortener/internal/pkg/rules"
+	"github.com/aifedorov/shortener/internal/pkg/workspace"
 	"go.uber.org/zap"
 
 	"github.com/aifedorov/shortener/internal/http/middleware/logger"
@@ -24,41 +29,133 @@ const (
 	FileOpenFlagsRead = os.O_RDONLY
 )
 
-// URLMapping represents a single URL mapping stored in the file repository.
-// It contains the user ID, short URL, and original URL for persistence.
-type URLMapping struct {
-	// ID is the user ID who created the URL mapping.
-	ID string `json:"id"`
-	// ShortURL is the generated short URL path.
-	ShortURL string `json:"short_url"`
-	// OriginalURL is the original URL that was shortened.
-	OriginalURL string `json:"original_url"`
+// Storage file entry kinds
+const (
+	// entryKindAPIKey marks a line holding an API key.
+	entryKindAPIKey = "api_key"
+	// entryKindUser marks a line holding a registered user.
+	entryKindUser = "user"
+	// entryKindMerge marks a line holding a link merge, loading it moves the listed links to the account.
+	entryKindMerge = "merge"
+	// entryKindWorkspace marks a line holding a workspace.
+	entryKindWorkspace = "workspace"
+	// entryKindMember marks a line holding a workspace member.
+	entryKindMember = "member"
+	// entryKindMemberRemoved marks a line holding a member removed from a workspace.
+	entryKindMemberRemoved = "member_removed"
+	// entryKindAudit marks a line holding an admin audit log entry.
+	entryKindAudit = "audit"
+	// entryKindReport marks a line holding an abuse report, a review appends the resolved report.
+	entryKindReport = "report"
+	// entryKindClick marks a line holding the click counter of a link after a redirect.
+	entryKindClick = "click"
+	// entryKindVariantClick marks a line holding the click counter of a split link variant after a redirect.
+	entryKindVariantClick = "variant_click"
+	// entryKindCheck marks a line holding the latest dead-link check result of a link.
+	entryKindCheck = "check"
+	// entryKindDelete marks a line holding the links deleted by their owner.
+	entryKindDelete = "delete"
+)
+
+// fileEntry is a storage file line holding a record other than a URL mapping.
+// Lines without a kind hold URL mappings, so files written before entries were introduced stay readable.
+type fileEntry struct {
+	// Kind identifies the type of the record.
+	Kind string `json:"kind"`
+	// Data is the JSON encoded record.
+	Data json.RawMessage `json:"data"`
+}
+
+// clickEntry is the storage file record of a redirect, written instead of the whole URL mapping.
+// It holds the counter rather than the increment, so the last entry of a link wins like a full record.
+type clickEntry struct {
+	// Alias is the short URL identifier of the link.
+	Alias string `json:"alias"`
+	// Clicks is the number of successful redirects after the redirect.
+	Clicks int `json:"clicks"`
+	// IsDeleted indicates if the redirect used up the click limit of the link.
+	IsDeleted bool `json:"is_deleted,omitempty"`
+}
+
+// variantClickEntry is the storage file record of a redirect served by a variant of a split link.
+type variantClickEntry struct {
+	// Alias is the short URL identifier of the link.
+	Alias string `json:"alias"`
+	// Variant is the index of the variant.
+	Variant int `json:"variant"`
+	// Clicks is the number of redirects served by the variant after the redirect.
+	Clicks int `json:"clicks"`
+}
+
+// checkEntry is the storage file record of a dead-link check result.
+type checkEntry struct {
+	// Alias is the short URL identifier of the link.
+	Alias string `json:"alias"`
+	// StatusCode is the HTTP status code returned by the target, zero if the target was unreachable.
+	StatusCode int `json:"status_code,omitempty"`
+	// CheckedAt is the time of the check.
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// deleteEntry is the storage file record of a batch deletion, it lists the links the owner deleted.
+type deleteEntry struct {
+	// UserID is the owner of the deleted links.
+	UserID string `json:"user_id"`
+	// Aliases are the short URL identifiers of the deleted links.
+	Aliases []string `json:"aliases"`
 }
 
 // FileRepository provides a file-based implementation of the Repository interface.
-// It stores URL mappings in a JSON file with append-only writes for persistence.
+// It stores URL mappings, API keys, registered users, workspaces, the audit log and abuse reports in a JSON file
+// with append-only writes for persistence.
+// Every change of a record is appended as a new line, the last line for a record wins on load.
+// Redirects, deletions and dead-link checks append small entries with the changed fields only,
+// and the file is compacted to a single line per record when the repository starts.
 type FileRepository struct {
 	// fname is the path to the storage file.
 	fname string
 	// file is the open file handle for writing.
 	file *os.File
 	// pathToURL stores all URL mappings in memory for fast access.
-	pathToURL []URLMapping
+	pathToURL map[string]*URLMapping
+	// apiKeys maps API key IDs to API keys.
+	apiKeys map[string]*APIKey
+	// users maps logins to registered users.
+	users map[string]*User
+	// merges lists the recorded link merges, oldest first.
+	merges []LinkMerge
+	// workspaces maps workspace IDs to workspaces.
+	workspaces map[string]*Workspace
+	// members maps workspace IDs to the members of the workspace by user ID.
+	members map[string]map[string]*Member
+	// audit lists the admin audit log, oldest first.
+	audit []AuditEntry
+	// reports maps report IDs to abuse reports.
+	reports map[string]*Report
+	// quota limits the links stored per owner.
+	quota Quota
 	// rand is used for generating random short URL identifiers.
 	rand random.Randomizer
+	// mu provides thread-safe access to the in-memory maps and the file.
+	mu sync.RWMutex
 }
 
 // NewFileRepository creates a new file-based repository instance.
 // The repository will use the specified file path for persistence.
 func NewFileRepository(filePath string) *FileRepository {
 	return &FileRepository{
-		fname:     filePath,
-		pathToURL: make([]URLMapping, 0),
-		rand:      random.NewService(),
+		fname:      filePath,
+		pathToURL:  make(map[string]*URLMapping),
+		apiKeys:    make(map[string]*APIKey),
+		users:      make(map[string]*User),
+		workspaces: make(map[string]*Workspace),
+		members:    make(map[string]map[string]*Member),
+		reports:    make(map[string]*Report),
+		rand:       random.NewService(),
 	}
 }
 
-// Run initializes the file repository by opening the storage file.
+// Run initializes the file repository by opening the storage file and loading stored mappings.
 func (fs *FileRepository) Run() error {
 	file, err := os.OpenFile(fs.fname, FileOpenFlagsWrite, FilePermissionsWrite)
 	fs.file = file
@@ -66,6 +163,12 @@ func (fs *FileRepository) Run() error {
 		logger.Log.Error("fileStorage: failed to open file", zap.String("file", fs.fname), zap.Error(err))
 		return err
 	}
+	if err := fs.load(); err != nil {
+		return err
+	}
+	if err := fs.compact(); err != nil {
+		logger.Log.Warn("fileStorage: failed to compact file, appending to it as is", zap.String("file", fs.fname), zap.Error(err))
+	}
 	return nil
 }
 
@@ -85,159 +188,971 @@ func (fs *FileRepository) Close() error {
 
 // Get retrieves the original URL for a given short URL from the file storage.
 func (fs *FileRepository) Get(shortURL string) (string, error) {
-	file, err := os.OpenFile(fs.fname, FileOpenFlagsRead, FilePermissionsRead)
-	if err != nil {
-		logger.Log.Error("fileStorage: failed to open file", zap.String("file", fs.fname), zap.Error(err))
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	record, exists := fs.pathToURL[shortURL]
+	if !exists {
+		logger.Log.Debug("fileStorage: url is not found", zap.String("short_url", shortURL))
+		return "", ErrShortURLNotFound
+	}
+	if err := record.available(); err != nil {
 		return "", err
 	}
-	defer func() {
-		err := file.Close()
-		if err != nil {
-			logger.Log.Error("fileStorage: failed to close file", zap.String("file", fs.fname), zap.Error(err))
-		}
-	}()
+	if record.Quarantined {
+		return "", ErrLinkQuarantined
+	}
+	return record.OriginalURL, nil
+}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		var record URLMapping
-		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
-			logger.Log.Error("fileStorage: failed to unmarshal record", zap.String("file", fs.fname), zap.Error(err))
-			return "", err
-		}
-		if record.ShortURL == shortURL {
-			return record.OriginalURL, nil
-		}
+// Resolve retrieves the link for a given short URL from the file storage and counts the redirect.
+// The updated click counter is persisted before the link is returned.
+func (fs *FileRepository) Resolve(shortURL string) (Link, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	record, exists := fs.pathToURL[shortURL]
+	if !exists {
+		logger.Log.Debug("fileStorage: url is not found", zap.String("short_url", shortURL))
+		return Link{}, ErrShortURLNotFound
 	}
 
-	logger.Log.Debug("fileStorage: url is not found", zap.String("short_url", shortURL))
-	return "", ErrShortURLNotFound
+	updated := *record
+	link, err := updated.visit()
+	if err != nil {
+		return Link{}, err
+	}
+	if link.Quarantined {
+		return link, nil
+	}
+	click := clickEntry{Alias: updated.ShortURL, Clicks: updated.Clicks, IsDeleted: updated.IsDeleted}
+	if err := fs.appendEntry(entryKindClick, &click); err != nil {
+		logger.Log.Error("fileStorage: failed to save click", zap.String("short_url", shortURL), zap.Error(err))
+		return Link{}, err
+	}
+	*record = updated
+	return link, nil
 }
 
 // GetAll retrieves all URLs belonging to a specific user from the file storage.
-func (fs *FileRepository) GetAll(_, _ string) ([]URLOutput, error) {
-	panic("implement me")
+func (fs *FileRepository) GetAll(userID, baseURL string) ([]URLOutput, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	res := make([]URLOutput, 0)
+	for _, record := range fs.pathToURL {
+		if record.IsDeleted || record.UserID != userID {
+			continue
+		}
+		res = append(res, record.output(baseURL))
+	}
+	if len(res) == 0 {
+		return nil, ErrUserHasNoData
+	}
+	return res, nil
 }
 
 // Store saves a new URL to the file storage and returns the generated short URL.
-func (fs *FileRepository) Store(_, baseURL, targetURL string) (string, error) {
+// It returns a ConflictError with the existing short URL if the URL is already stored.
+func (fs *FileRepository) Store(userID, baseURL, targetURL string, opts LinkOptions) (string, error) {
 	alias, err := fs.rand.GenRandomString()
 	if err != nil {
 		logger.Log.Error("fileStorage: generate random string failed", zap.Error(err))
 		return "", err
 	}
 
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if existing, exists := findByOriginalURL(fs.pathToURL, targetURL); exists {
+		return "", NewConflictError(baseURL+"/"+existing.ShortURL, ErrURLExists)
+	}
+	if err := fs.quota.check(ownerUsage(fs.pathToURL, userID, time.Now()), 1); err != nil {
+		return "", err
+	}
+
 	shortURL := baseURL + "/" + alias
-	err = fs.addNewURL(alias, targetURL)
-	if err != nil {
+	logger.Log.Debug("fileStorage: storing new url", zap.String("short_url", alias), zap.String("original_url", targetURL))
+	record := newURLMapping(userID, alias, targetURL, opts)
+	if err := fs.appendRecords(record); err != nil {
 		logger.Log.Error("fileStorage: failed to add new url", zap.Error(err))
 		return "", err
 	}
+	fs.pathToURL[alias] = record
 
 	logger.Log.Debug("fileStorage: saved url to file", zap.String("file", fs.fname), zap.String("res_url", shortURL))
 	return shortURL, nil
 }
 
 // StoreBatch saves multiple URLs to the file storage in a single operation.
-func (fs *FileRepository) StoreBatch(_, baseURL string, urls []BatchURLInput) ([]BatchURLOutput, error) {
+// URLs that are already stored or repeated within the batch are answered with the existing link,
+// only the new links count against the quota.
+func (fs *FileRepository) StoreBatch(userID, baseURL string, urls []BatchURLInput) ([]BatchURLOutput, error) {
 	if len(urls) == 0 {
 		return nil, nil
 	}
 
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
 	logger.Log.Debug("fileStorage: storing batch of urls", zap.Int("count", len(urls)))
-	res, err := fs.addNewURLs(baseURL, urls)
+	res, records, err := newBatchMappings(fs.pathToURL, fs.rand, userID, baseURL, urls)
 	if err != nil {
-		logger.Log.Error("fileStorage: failed to add url", zap.Error(err))
+		logger.Log.Debug("fileStorage: generation of random string failed", zap.Error(err))
+		return nil, err
+	}
+	if len(records) == 0 {
+		return res, nil
+	}
+	if err := fs.quota.check(ownerUsage(fs.pathToURL, userID, time.Now()), len(records)); err != nil {
 		return nil, err
 	}
 
+	if err := fs.appendRecords(records...); err != nil {
+		logger.Log.Error("fileStorage: failed to add url", zap.Error(err))
+		return nil, err
+	}
+	for _, record := range records {
+		fs.pathToURL[record.ShortURL] = record
+	}
 	return res, nil
 }
 
-// DeleteBatch marks multiple URLs as deleted for a specific user.
-func (fs *FileRepository) DeleteBatch(_ string, _ []string) error {
-	panic("implement me")
+// SetQuota sets the quota enforced by Store and StoreBatch.
+func (fs *FileRepository) SetQuota(quota Quota) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.quota = quota
+}
+
+// GetUsage counts the links of the owner in the file storage against the quota.
+func (fs *FileRepository) GetUsage(userID string) (Usage, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return ownerUsage(fs.pathToURL, userID, time.Now()), nil
 }
 
-// addNewURL adds a new URL mapping to the file storage.
-func (fs *FileRepository) addNewURL(shortURL string, originalURL string) error {
-	logger.Log.Debug("fileStorage: storing new url", zap.String("short_url", shortURL), zap.String("original_url", originalURL))
-	record := URLMapping{
-		ID:          uuid.New().String(),
-		ShortURL:    shortURL,
-		OriginalURL: originalURL,
+// DeleteBatch marks multiple URLs as deleted for a specific user in the file storage.
+// Aliases of links owned by someone else are skipped.
+func (fs *FileRepository) DeleteBatch(userID string, aliases []string) error {
+	if len(aliases) == 0 {
+		return errors.New("fileStorage: aliases is empty")
 	}
 
-	data, err := json.Marshal(record)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	deletion := deleteEntry{UserID: userID}
+	for _, alias := range aliases {
+		if record, exists := fs.pathToURL[alias]; exists && record.UserID == userID && !record.IsDeleted {
+			deletion.Aliases = append(deletion.Aliases, alias)
+		}
+	}
+	if len(deletion.Aliases) == 0 {
+		return nil
+	}
+	if err := fs.appendEntry(entryKindDelete, &deletion); err != nil {
+		logger.Log.Error("fileStorage: failed to save deletion", zap.String("user_id", userID), zap.Error(err))
+		return err
+	}
+	fs.applyDelete(deletion)
+	return nil
+}
+
+// applyDelete marks the links listed in the deletion as deleted. Callers must hold the write lock.
+func (fs *FileRepository) applyDelete(deletion deleteEntry) {
+	for _, alias := range deletion.Aliases {
+		if record, exists := fs.pathToURL[alias]; exists && record.UserID == deletion.UserID {
+			record.IsDeleted = true
+		}
+	}
+}
+
+// GetRules retrieves the conditional redirect rules of a link owned by the user from the file storage.
+func (fs *FileRepository) GetRules(userID, alias string) ([]rules.Rule, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	record, err := findOwned(fs.pathToURL, alias, userID)
+	if err != nil {
+		return nil, err
+	}
+	return record.Rules, nil
+}
+
+// SetRules replaces the conditional redirect rules of a link owned by the user in the file storage.
+func (fs *FileRepository) SetRules(userID, alias string, linkRules []rules.Rule) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	record, err := findOwned(fs.pathToURL, alias, userID)
 	if err != nil {
-		logger.Log.Error("fileStorage: failed to marshal record", zap.String("file", fs.fname), zap.Error(err))
 		return err
 	}
 
-	writer := bufio.NewWriter(fs.file)
+	updated := *record
+	updated.Rules = linkRules
+	if err := fs.appendRecords(&updated); err != nil {
+		logger.Log.Error("fileStorage: failed to save rules", zap.String("alias", alias), zap.Error(err))
+		return err
+	}
+	*record = updated
+	return nil
+}
+
+// TrackVariant counts a redirect served by the variant of a split link in the file storage.
+func (fs *FileRepository) TrackVariant(alias string, variant int) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	record, exists := fs.pathToURL[alias]
+	if !exists {
+		return ErrShortURLNotFound
+	}
+
+	updated := *record
+	if err := updated.trackVariant(variant); err != nil {
+		return err
+	}
+	click := variantClickEntry{Alias: alias, Variant: variant, Clicks: updated.Variants[variant].Clicks}
+	if err := fs.appendEntry(entryKindVariantClick, &click); err != nil {
+		logger.Log.Error("fileStorage: failed to save variant click", zap.String("alias", alias), zap.Error(err))
+		return err
+	}
+	*record = updated
+	return nil
+}
+
+// GetCheckTargets returns up to limit active links from the file storage that are due for a dead-link check.
+func (fs *FileRepository) GetCheckTargets(checkedBefore time.Time, limit int) ([]CheckTarget, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	return checkTargets(fs.pathToURL, checkedBefore, limit), nil
+}
+
+// SaveCheckResult records the outcome of the latest dead-link check of a link in the file storage.
+func (fs *FileRepository) SaveCheckResult(alias string, result CheckResult) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	record, exists := fs.pathToURL[alias]
+	if !exists {
+		return ErrShortURLNotFound
+	}
 
-	if _, err := writer.Write(data); err != nil {
-		logger.Log.Error("fileStorage: failed to write data to buffer", zap.String("file", fs.fname), zap.Error(err))
+	checkedAt := result.CheckedAt
+	updated := *record
+	updated.LastStatus = result.StatusCode
+	updated.CheckedAt = &checkedAt
+	check := checkEntry{Alias: alias, StatusCode: result.StatusCode, CheckedAt: checkedAt}
+	if err := fs.appendEntry(entryKindCheck, &check); err != nil {
+		logger.Log.Error("fileStorage: failed to save check result", zap.String("alias", alias), zap.Error(err))
 		return err
 	}
+	*record = updated
+	return nil
+}
 
-	if err := writer.WriteByte('\n'); err != nil {
-		logger.Log.Error("fileStorage: failed to write newline to buffer", zap.String("file", fs.fname), zap.Error(err))
+// StoreAPIKey saves a new API key to the file storage.
+func (fs *FileRepository) StoreAPIKey(key APIKey) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.appendEntry(entryKindAPIKey, &key); err != nil {
 		return err
 	}
+	fs.apiKeys[key.ID] = &key
+	return nil
+}
 
-	if err := writer.Flush(); err != nil {
-		logger.Log.Error("fileStorage: failed to flush buffer to disk", zap.String("file", fs.fname), zap.Error(err))
+// GetAPIKeys retrieves the active API keys of a user from the file storage.
+func (fs *FileRepository) GetAPIKeys(userID string) ([]APIKey, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	return activeAPIKeys(fs.apiKeys, userID), nil
+}
+
+// RevokeAPIKey revokes an active API key of a user in the file storage.
+func (fs *FileRepository) RevokeAPIKey(userID, keyID string, revokedAt time.Time) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	key, err := findActiveAPIKey(fs.apiKeys, userID, keyID)
+	if err != nil {
+		return err
+	}
+	updated := key.revoked(revokedAt)
+	if err := fs.appendEntry(entryKindAPIKey, updated); err != nil {
 		return err
 	}
+	fs.apiKeys[keyID] = updated
+	return nil
+}
+
+// GetAPIKeyUser returns the owner of the active API key with the given hash from the file storage.
+func (fs *FileRepository) GetAPIKeyUser(keyHash string) (string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
 
+	return apiKeyUser(fs.apiKeys, keyHash)
+}
+
+// CreateUser saves a new registered user to the file storage.
+func (fs *FileRepository) CreateUser(user User) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, exists := fs.users[user.Login]; exists {
+		return ErrLoginTaken
+	}
+	if err := fs.appendEntry(entryKindUser, &user); err != nil {
+		return err
+	}
+	fs.users[user.Login] = &user
 	return nil
 }
 
-// addNewURLs adds multiple URL mappings to the file storage in batch.
-func (fs *FileRepository) addNewURLs(baseURL string, urls []BatchURLInput) ([]BatchURLOutput, error) {
-	res := make([]BatchURLOutput, len(urls))
-	writer := bufio.NewWriter(fs.file)
-	for i, url := range urls {
-		alias, err := fs.rand.GenRandomString()
+// GetUserByLogin retrieves the registered user with the given login from the file storage.
+func (fs *FileRepository) GetUserByLogin(login string) (User, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	user, exists := fs.users[login]
+	if !exists {
+		return User{}, ErrUserNotFound
+	}
+	return *user, nil
+}
+
+// GetUserByID retrieves the registered user with the given ID from the file storage.
+func (fs *FileRepository) GetUserByID(userID string) (User, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	return findUserByID(fs.users, userID)
+}
+
+// MergeLinks moves the active links of an anonymous user to a registered account in the file storage.
+// The merge is written as a single line, so it is either applied as a whole on load or not at all.
+func (fs *FileRepository) MergeLinks(fromUserID, toUserID string, mergedAt time.Time) (LinkMerge, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if isRegistered(fs.users, fromUserID) {
+		return LinkMerge{}, ErrRegisteredUser
+	}
+	moved, skipped := planMerge(fs.pathToURL, fromUserID, toUserID)
+	merge := newLinkMerge(fromUserID, toUserID, moved, skipped, mergedAt)
+	if merge.IsEmpty() {
+		return merge, nil
+	}
+	if err := fs.appendEntry(entryKindMerge, &merge); err != nil {
+		return LinkMerge{}, err
+	}
+	fs.applyMerge(merge)
+	return merge, nil
+}
+
+// applyMerge moves the links listed in the merge to the account. Callers must hold the write lock.
+func (fs *FileRepository) applyMerge(merge LinkMerge) {
+	for _, alias := range merge.Moved {
+		if record, exists := fs.pathToURL[alias]; exists {
+			record.UserID = merge.ToUserID
+		}
+	}
+	fs.merges = append(fs.merges, merge)
+}
+
+// CreateWorkspace saves a new workspace with the user as its owner to the file storage.
+func (fs *FileRepository) CreateWorkspace(ws Workspace, ownerID string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	owner := Member{WorkspaceID: ws.ID, UserID: ownerID, Role: workspace.RoleOwner, AddedAt: ws.CreatedAt}
+	if err := fs.appendEntry(entryKindWorkspace, &ws); err != nil {
+		return err
+	}
+	if err := fs.appendEntry(entryKindMember, &owner); err != nil {
+		return err
+	}
+	fs.workspaces[ws.ID] = &ws
+	fs.members[ws.ID] = map[string]*Member{ownerID: &owner}
+	return nil
+}
+
+// GetWorkspaces retrieves the workspaces the user is a member of from the file storage.
+func (fs *FileRepository) GetWorkspaces(userID string) ([]UserWorkspace, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	return userWorkspaces(fs.workspaces, fs.members, userID), nil
+}
+
+// GetMembers retrieves the members of a workspace from the file storage.
+func (fs *FileRepository) GetMembers(workspaceID string) ([]Member, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	if _, exists := fs.workspaces[workspaceID]; !exists {
+		return nil, ErrWorkspaceNotFound
+	}
+	return memberList(fs.members[workspaceID]), nil
+}
+
+// GetMemberRole returns the role of the user in the workspace from the file storage.
+func (fs *FileRepository) GetMemberRole(workspaceID, userID string) (workspace.Role, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	member, exists := fs.members[workspaceID][userID]
+	if !exists {
+		return "", ErrMemberNotFound
+	}
+	return member.Role, nil
+}
+
+// SetMember adds a member to a workspace or changes the role of a member in the file storage.
+func (fs *FileRepository) SetMember(member Member) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, exists := fs.workspaces[member.WorkspaceID]; !exists {
+		return ErrWorkspaceNotFound
+	}
+	if err := checkOwnerRemains(memberList(fs.members[member.WorkspaceID]), member.UserID, member.Role); err != nil {
+		return err
+	}
+	if err := fs.appendEntry(entryKindMember, &member); err != nil {
+		return err
+	}
+	fs.addMember(member)
+	return nil
+}
+
+// RemoveMember removes a member from a workspace in the file storage.
+func (fs *FileRepository) RemoveMember(workspaceID, userID string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	members := fs.members[workspaceID]
+	member, exists := members[userID]
+	if !exists {
+		return ErrMemberNotFound
+	}
+	if err := checkOwnerRemains(memberList(members), userID, ""); err != nil {
+		return err
+	}
+	if err := fs.appendEntry(entryKindMemberRemoved, member); err != nil {
+		return err
+	}
+	delete(members, userID)
+	return nil
+}
+
+// addMember adds the member to the in-memory maps. Callers must hold the write lock.
+func (fs *FileRepository) addMember(member Member) {
+	if fs.members[member.WorkspaceID] == nil {
+		fs.members[member.WorkspaceID] = make(map[string]*Member)
+	}
+	fs.members[member.WorkspaceID][member.UserID] = &member
+}
+
+// SearchLinks returns the links of all owners matching the filter from the file storage.
+func (fs *FileRepository) SearchLinks(filter LinkFilter, baseURL string) ([]LinkRecord, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	return searchLinks(fs.pathToURL, filter, baseURL), nil
+}
+
+// SetLinkDisabled disables or enables a link and records the audit entry in the file storage.
+// Both are written in a single append, so a failed write saves neither.
+func (fs *FileRepository) SetLinkDisabled(alias string, statusCode int, reason string, entry AuditEntry) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	record, exists := fs.pathToURL[alias]
+	if !exists {
+		return ErrShortURLNotFound
+	}
+	updated := *record
+	updated.DisabledStatus = statusCode
+	updated.DisabledReason = reason
+	if err := fs.appendAudited(entry, &updated); err != nil {
+		logger.Log.Error("fileStorage: failed to disable link", zap.String("alias", alias), zap.Error(err))
+		return err
+	}
+	*record = updated
+	fs.audit = append(fs.audit, entry)
+	return nil
+}
+
+// ReassignLink moves a link to another owner and records the audit entry in the file storage.
+func (fs *FileRepository) ReassignLink(alias, ownerID string, entry AuditEntry) (string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	record, exists := fs.pathToURL[alias]
+	if !exists {
+		return "", ErrShortURLNotFound
+	}
+	previous := record.UserID
+	updated := *record
+	updated.UserID = ownerID
+	entry = entry.withDetail(AuditDetailFrom, previous)
+	if err := fs.appendAudited(entry, &updated); err != nil {
+		logger.Log.Error("fileStorage: failed to reassign link", zap.String("alias", alias), zap.Error(err))
+		return "", err
+	}
+	*record = updated
+	fs.audit = append(fs.audit, entry)
+	return previous, nil
+}
+
+// GetOwnerStats returns the link counts of every owner from the file storage.
+func (fs *FileRepository) GetOwnerStats() ([]OwnerStats, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	return ownerStats(fs.pathToURL), nil
+}
+
+// AppendAudit records an admin action in the file storage.
+func (fs *FileRepository) AppendAudit(entry AuditEntry) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.appendEntry(entryKindAudit, &entry); err != nil {
+		return err
+	}
+	fs.audit = append(fs.audit, entry)
+	return nil
+}
+
+// GetAuditLog returns the latest audit log entries from the file storage.
+func (fs *FileRepository) GetAuditLog(limit int) ([]AuditEntry, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	return latestAudit(fs.audit, limit), nil
+}
+
+// AddReport files an abuse report against a link in the file storage.
+// The report is persisted before the link is quarantined.
+func (fs *FileRepository) AddReport(report Report, threshold int) (bool, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	record, exists := fs.pathToURL[report.Alias]
+	if !exists {
+		return false, ErrShortURLNotFound
+	}
+	if err := record.available(); err != nil {
+		return false, err
+	}
+	if hasOpenReport(fs.reports, report.Alias, report.Reporter) {
+		return false, ErrReportExists
+	}
+	if err := fs.appendEntry(entryKindReport, report); err != nil {
+		logger.Log.Error("fileStorage: failed to save report", zap.String("alias", report.Alias), zap.Error(err))
+		return false, err
+	}
+	fs.reports[report.ID] = &report
+
+	if !shouldQuarantine(record, fs.reports, threshold) {
+		return record.Quarantined, nil
+	}
+	updated := *record
+	updated.Quarantined = true
+	if err := fs.appendRecords(&updated); err != nil {
+		logger.Log.Error("fileStorage: failed to quarantine link", zap.String("alias", report.Alias), zap.Error(err))
+		return false, err
+	}
+	*record = updated
+	return true, nil
+}
+
+// GetReports returns the latest reports with the status from the file storage.
+func (fs *FileRepository) GetReports(status string, limit int) ([]Report, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	return latestReports(fs.reports, status, limit), nil
+}
+
+// ResolveReports closes the open reports against a link, lifts its quarantine and records the audit entry
+// in the file storage. The reports, the link and the entry are written in a single append.
+func (fs *FileRepository) ResolveReports(alias, status string, entry AuditEntry) (int, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	record, exists := fs.pathToURL[alias]
+	if !exists {
+		return 0, ErrShortURLNotFound
+	}
+	resolved := resolveReports(fs.reports, alias, status, entry.Actor, entry.CreatedAt)
+	entry = entry.withResolved(len(resolved))
+	updated := *record
+	updated.Quarantined = false
+
+	lines := make([][]byte, 0, len(resolved)+2)
+	for i := range resolved {
+		line, err := encodeLine(entryKindReport, &resolved[i])
 		if err != nil {
-			logger.Log.Debug("fileStorage: generation of random string failed", zap.Error(err))
-			return nil, err
+			return 0, err
+		}
+		lines = append(lines, line)
+	}
+	line, err := encodeLine("", &updated)
+	if err != nil {
+		return 0, err
+	}
+	lines = append(lines, line)
+	if line, err = encodeLine(entryKindAudit, &entry); err != nil {
+		return 0, err
+	}
+	if err := fs.appendLines(append(lines, line)...); err != nil {
+		logger.Log.Error("fileStorage: failed to resolve reports", zap.String("alias", alias), zap.Error(err))
+		return 0, err
+	}
+
+	for i := range resolved {
+		fs.reports[resolved[i].ID] = &resolved[i]
+	}
+	*record = updated
+	fs.audit = append(fs.audit, entry)
+	return len(resolved), nil
+}
+
+// load reads all records from the storage file into memory.
+func (fs *FileRepository) load() error {
+	file, err := os.OpenFile(fs.fname, FileOpenFlagsRead, FilePermissionsRead)
+	if err != nil {
+		logger.Log.Error("fileStorage: failed to open file", zap.String("file", fs.fname), zap.Error(err))
+		return err
+	}
+	defer func() {
+		err := file.Close()
+		if err != nil {
+			logger.Log.Error("fileStorage: failed to close file", zap.String("file", fs.fname), zap.Error(err))
+		}
+	}()
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if err := fs.loadLine(scanner.Bytes()); err != nil {
+			logger.Log.Error("fileStorage: failed to unmarshal record", zap.String("file", fs.fname), zap.Error(err))
+			return err
 		}
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Log.Error("fileStorage: failed to read file", zap.String("file", fs.fname), zap.Error(err))
+		return err
+	}
+
+	logger.Log.Debug("fileStorage: loaded urls", zap.String("file", fs.fname), zap.Int("count", len(fs.pathToURL)))
+	return nil
+}
+
+// loadLine decodes a storage file line into the in-memory maps. Callers must hold the write lock.
+func (fs *FileRepository) loadLine(line []byte) error {
+	var entry fileEntry
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return err
+	}
 
-		record := URLMapping{
-			ID:          uuid.New().String(),
-			ShortURL:    alias,
-			OriginalURL: url.OriginalURL,
+	switch entry.Kind {
+	case "":
+		var record URLMapping
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		fs.pathToURL[record.ShortURL] = &record
+	case entryKindAPIKey:
+		var key APIKey
+		if err := json.Unmarshal(entry.Data, &key); err != nil {
+			return err
+		}
+		fs.apiKeys[key.ID] = &key
+	case entryKindUser:
+		var user User
+		if err := json.Unmarshal(entry.Data, &user); err != nil {
+			return err
+		}
+		fs.users[user.Login] = &user
+	case entryKindMerge:
+		var merge LinkMerge
+		if err := json.Unmarshal(entry.Data, &merge); err != nil {
+			return err
+		}
+		fs.applyMerge(merge)
+	case entryKindWorkspace:
+		var ws Workspace
+		if err := json.Unmarshal(entry.Data, &ws); err != nil {
+			return err
+		}
+		fs.workspaces[ws.ID] = &ws
+	case entryKindMember:
+		var member Member
+		if err := json.Unmarshal(entry.Data, &member); err != nil {
+			return err
+		}
+		fs.addMember(member)
+	case entryKindMemberRemoved:
+		var member Member
+		if err := json.Unmarshal(entry.Data, &member); err != nil {
+			return err
+		}
+		delete(fs.members[member.WorkspaceID], member.UserID)
+	case entryKindAudit:
+		var audit AuditEntry
+		if err := json.Unmarshal(entry.Data, &audit); err != nil {
+			return err
+		}
+		fs.audit = append(fs.audit, audit)
+	case entryKindReport:
+		var report Report
+		if err := json.Unmarshal(entry.Data, &report); err != nil {
+			return err
+		}
+		fs.reports[report.ID] = &report
+	case entryKindClick:
+		var click clickEntry
+		if err := json.Unmarshal(entry.Data, &click); err != nil {
+			return err
+		}
+		if record, exists := fs.pathToURL[click.Alias]; exists {
+			record.Clicks = click.Clicks
+			record.IsDeleted = record.IsDeleted || click.IsDeleted
+		}
+	case entryKindVariantClick:
+		var click variantClickEntry
+		if err := json.Unmarshal(entry.Data, &click); err != nil {
+			return err
 		}
+		if record, exists := fs.pathToURL[click.Alias]; exists && click.Variant >= 0 && click.Variant < len(record.Variants) {
+			record.Variants[click.Variant].Clicks = click.Clicks
+		}
+	case entryKindCheck:
+		var check checkEntry
+		if err := json.Unmarshal(entry.Data, &check); err != nil {
+			return err
+		}
+		if record, exists := fs.pathToURL[check.Alias]; exists {
+			checkedAt := check.CheckedAt
+			record.LastStatus = check.StatusCode
+			record.CheckedAt = &checkedAt
+		}
+	case entryKindDelete:
+		var deletion deleteEntry
+		if err := json.Unmarshal(entry.Data, &deletion); err != nil {
+			return err
+		}
+		fs.applyDelete(deletion)
+	default:
+		logger.Log.Warn("fileStorage: skipping unknown entry", zap.String("file", fs.fname), zap.String("kind", entry.Kind))
+	}
+	return nil
+}
+
+// compact rewrites the storage file with a single line per record, dropping the lines superseded by later ones.
+// The records are written to a temporary file that replaces the storage file, so a failed compaction keeps it intact.
+func (fs *FileRepository) compact() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
 
-		logger.Log.Debug("fileStorage: storing new url", zap.String("short_url", url.OriginalURL), zap.String("original_url", url.OriginalURL))
+	tmpName := fs.fname + ".tmp"
+	tmp, err := os.OpenFile(tmpName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, FilePermissionsWrite)
+	if err != nil {
+		return err
+	}
+	if err := fs.writeSnapshot(tmp); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, fs.fname); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+
+	file, err := os.OpenFile(fs.fname, FileOpenFlagsWrite, FilePermissionsWrite)
+	if err != nil {
+		return err
+	}
+	if err := fs.file.Close(); err != nil {
+		logger.Log.Error("fileStorage: failed to close file", zap.String("file", fs.fname), zap.Error(err))
+	}
+	fs.file = file
+	logger.Log.Debug("fileStorage: compacted file", zap.String("file", fs.fname))
+	return nil
+}
+
+// writeSnapshot writes the in-memory state to the file as a single line per record and syncs it to disk.
+// Merges are written before the URL mappings, so loading them does not move links again. Callers must hold the write lock.
+func (fs *FileRepository) writeSnapshot(file *os.File) error {
+	writer := bufio.NewWriter(file)
+	write := func(kind string, record interface{}) error {
+		line, err := encodeLine(kind, record)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(line)
+		return err
+	}
+
+	for _, user := range fs.users {
+		if err := write(entryKindUser, user); err != nil {
+			return err
+		}
+	}
+	for _, key := range fs.apiKeys {
+		if err := write(entryKindAPIKey, key); err != nil {
+			return err
+		}
+	}
+	for _, ws := range fs.workspaces {
+		if err := write(entryKindWorkspace, ws); err != nil {
+			return err
+		}
+	}
+	for _, members := range fs.members {
+		for _, member := range members {
+			if err := write(entryKindMember, member); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range fs.merges {
+		if err := write(entryKindMerge, &fs.merges[i]); err != nil {
+			return err
+		}
+	}
+	for i := range fs.audit {
+		if err := write(entryKindAudit, &fs.audit[i]); err != nil {
+			return err
+		}
+	}
+	for _, report := range fs.reports {
+		if err := write(entryKindReport, report); err != nil {
+			return err
+		}
+	}
+	for _, record := range fs.pathToURL {
+		if err := write("", record); err != nil {
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// encodeLine encodes a record as a storage file line. URL mappings are written without a kind.
+func encodeLine(kind string, record interface{}) ([]byte, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	if kind != "" {
+		data, err = json.Marshal(fileEntry{Kind: kind, Data: data})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return append(data, '\n'), nil
+}
+
+// appendAudited writes the URL mapping and the audit entry of the change to the end of the storage file
+// in a single write. Callers must hold the write lock.
+func (fs *FileRepository) appendAudited(entry AuditEntry, record *URLMapping) error {
+	recordLine, err := encodeLine("", record)
+	if err != nil {
+		return err
+	}
+	auditLine, err := encodeLine(entryKindAudit, &entry)
+	if err != nil {
+		return err
+	}
+	return fs.appendLines(recordLine, auditLine)
+}
+
+// appendLines writes encoded lines to the end of the storage file in a single write. Callers must hold the write lock.
+func (fs *FileRepository) appendLines(lines ...[]byte) error {
+	if fs.file == nil {
+		return errors.New("fileStorage: file is not opened")
+	}
+	if _, err := fs.file.Write(bytes.Join(lines, nil)); err != nil {
+		logger.Log.Error("fileStorage: failed to write entries", zap.String("file", fs.fname), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// appendEntry writes a record other than a URL mapping to the end of the storage file.
+// Callers must hold the write lock.
+func (fs *FileRepository) appendEntry(kind string, record interface{}) error {
+	if fs.file == nil {
+		return errors.New("fileStorage: file is not opened")
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		logger.Log.Error("fileStorage: failed to marshal record", zap.String("file", fs.fname), zap.Error(err))
+		return err
+	}
+	line, err := json.Marshal(fileEntry{Kind: kind, Data: data})
+	if err != nil {
+		logger.Log.Error("fileStorage: failed to marshal entry", zap.String("file", fs.fname), zap.Error(err))
+		return err
+	}
+
+	if _, err := fs.file.Write(append(line, '\n')); err != nil {
+		logger.Log.Error("fileStorage: failed to write entry", zap.String("file", fs.fname), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// appendRecords writes URL mappings to the end of the storage file. Callers must hold the write lock.
+func (fs *FileRepository) appendRecords(records ...*URLMapping) error {
+	if fs.file == nil {
+		return errors.New("fileStorage: file is not opened")
+	}
+
+	writer := bufio.NewWriter(fs.file)
+	for _, record := range records {
 		data, err := json.Marshal(record)
 		if err != nil {
 			logger.Log.Error("fileStorage: failed to marshal record", zap.String("file", fs.fname), zap.Error(err))
-			return nil, err
+			return err
 		}
 
 		if _, err := writer.Write(data); err != nil {
 			logger.Log.Error("fileStorage: failed to write data to buffer", zap.String("file", fs.fname), zap.Error(err))
-			return nil, err
+			return err
 		}
 
 		if err := writer.WriteByte('\n'); err != nil {
 			logger.Log.Error("fileStorage: failed to write newline to buffer", zap.String("file", fs.fname), zap.Error(err))
-			return nil, err
+			return err
 		}
-
-		resURL := baseURL + "/" + alias
-		ou := BatchURLOutput{
-			CID:      url.CID,
-			ShortURL: resURL,
-		}
-		res[i] = ou
 	}
 
 	if err := writer.Flush(); err != nil {
 		logger.Log.Error("fileStorage: failed to flush buffer to disk", zap.String("file", fs.fname), zap.Error(err))
-		return nil, err
+		return err
 	}
-	return res, nil
+	return nil
 }
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aifedorov/shortener/internal/pkg/split"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openFileStorage(t *testing.T, fname string) *FileRepository {
+	t.Helper()
+
+	storage := NewFileRepository(fname)
+	require.NoError(t, storage.Run())
+	t.Cleanup(func() { _ = storage.Close() })
+	return storage
+}
+
+func countLines(t *testing.T, fname string) int {
+	t.Helper()
+
+	data, err := os.ReadFile(fname)
+	require.NoError(t, err)
+	return bytes.Count(data, []byte{'\n'})
+}
+
+func countBytes(t *testing.T, fname string) int {
+	t.Helper()
+
+	info, err := os.Stat(fname)
+	require.NoError(t, err)
+	return int(info.Size())
+}
+
+func TestFileStorage_EventsAndCompaction(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "storage.json")
+	userID := uuid.NewString()
+	checkedAt := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	storage := openFileStorage(t, fname)
+	shortURL, err := storage.Store(userID, "http://localhost:8080", "https://google.com", LinkOptions{
+		MaxClicks: 3,
+		Variants: []split.Variant{
+			{URL: "https://a.example.com", Weight: 1},
+			{URL: "https://b.example.com", Weight: 1},
+		},
+	})
+	require.NoError(t, err)
+	alias := shortURL[len("http://localhost:8080/"):]
+	recordSize := countBytes(t, fname)
+
+	for i := 0; i < 2; i++ {
+		_, err = storage.Resolve(alias)
+		require.NoError(t, err)
+		require.NoError(t, storage.TrackVariant(alias, 1))
+	}
+	require.NoError(t, storage.SaveCheckResult(alias, CheckResult{StatusCode: 404, CheckedAt: checkedAt}))
+	require.NoError(t, storage.Close())
+	assert.Equal(t, 6, countLines(t, fname))
+	assert.Less(t, countBytes(t, fname), 4*recordSize, "events are appended as small entries")
+
+	storage = openFileStorage(t, fname)
+	assert.Equal(t, 1, countLines(t, fname), "the file is compacted on load")
+	urls, err := storage.GetAll(userID, "http://localhost:8080")
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, 0, urls[0].Variants[0].Clicks)
+	assert.Equal(t, 2, urls[0].Variants[1].Clicks)
+	assert.Equal(t, 404, urls[0].LastStatus)
+	require.NotNil(t, urls[0].CheckedAt)
+	assert.True(t, checkedAt.Equal(*urls[0].CheckedAt))
+
+	_, err = storage.Resolve(alias)
+	require.NoError(t, err)
+	require.NoError(t, storage.Close())
+
+	storage = openFileStorage(t, fname)
+	_, err = storage.Get(alias)
+	assert.ErrorIs(t, err, ErrURLDeleted, "the click limit used up before the restart is kept")
+}
+
+func TestFileStorage_DeleteBatch(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "storage.json")
+	userID, otherID := uuid.NewString(), uuid.NewString()
+
+	storage := openFileStorage(t, fname)
+	ownURL, err := storage.Store(userID, "http://localhost:8080", "https://example.com/own", LinkOptions{})
+	require.NoError(t, err)
+	otherURL, err := storage.Store(otherID, "http://localhost:8080", "https://example.com/other", LinkOptions{})
+	require.NoError(t, err)
+	ownAlias := ownURL[len("http://localhost:8080/"):]
+	otherAlias := otherURL[len("http://localhost:8080/"):]
+
+	require.NoError(t, storage.DeleteBatch(userID, []string{ownAlias, otherAlias, "missing"}))
+	_, err = storage.Get(ownAlias)
+	assert.ErrorIs(t, err, ErrURLDeleted)
+	_, err = storage.Get(otherAlias)
+	assert.NoError(t, err, "links of another owner are kept")
+	require.NoError(t, storage.Close())
+	assert.Equal(t, 3, countLines(t, fname), "the deletion is appended as a single entry")
+
+	storage = openFileStorage(t, fname)
+	_, err = storage.Get(ownAlias)
+	assert.ErrorIs(t, err, ErrURLDeleted, "the deletion is kept after a restart")
+	_, err = storage.Get(otherAlias)
+	assert.NoError(t, err)
+	assert.Error(t, storage.DeleteBatch(userID, nil))
+}
+
+func TestFileStorage_StoreConflict(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "storage.json")
+
+	storage := openFileStorage(t, fname)
+	shortURL, err := storage.Store(uuid.NewString(), "http://localhost", "https://example.com", LinkOptions{})
+	require.NoError(t, err)
+	require.NoError(t, storage.Close())
+
+	storage = openFileStorage(t, fname)
+	_, err = storage.Store(uuid.NewString(), "http://localhost", "https://example.com", LinkOptions{})
+	var cErr *ConflictError
+	require.ErrorAs(t, err, &cErr)
+	assert.Equal(t, shortURL, cErr.ShortURL, "the stored link is found after a restart")
+	require.NoError(t, storage.Close())
+	assert.Equal(t, 1, countLines(t, fname), "a conflicting link is not written")
+}
+
+func TestFileStorage_StoreBatchDuplicates(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "storage.json")
+	userID, otherID := uuid.NewString(), uuid.NewString()
+
+	storage := openFileStorage(t, fname)
+	storage.SetQuota(Quota{MaxActiveLinks: 1})
+	otherURL, err := storage.Store(otherID, "http://localhost", "https://example.com/taken", LinkOptions{})
+	require.NoError(t, err)
+
+	res, err := storage.StoreBatch(userID, "http://localhost", []BatchURLInput{
+		{CID: "1", OriginalURL: "https://example.com/repeated"},
+		{CID: "2", OriginalURL: "https://example.com/repeated"},
+		{CID: "3", OriginalURL: "https://example.com/taken"},
+	})
+	require.NoError(t, err, "only the new link counts against the quota")
+	require.Len(t, res, 3)
+	assert.False(t, res[0].Existing)
+	assert.Equal(t, BatchURLOutput{CID: "2", ShortURL: res[0].ShortURL, Existing: true}, res[1],
+		"a URL listed twice is stored once")
+	assert.Equal(t, BatchURLOutput{CID: "3", ShortURL: otherURL, Existing: true}, res[2],
+		"a URL of another user is answered with its link")
+	require.NoError(t, storage.Close())
+	assert.Equal(t, 2, countLines(t, fname), "repeated and existing URLs are not written")
+
+	storage = openFileStorage(t, fname)
+	_, err = storage.Store(userID, "http://localhost", "https://example.com/repeated", LinkOptions{})
+	var cErr *ConflictError
+	require.ErrorAs(t, err, &cErr)
+	assert.Equal(t, res[0].ShortURL, cErr.ShortURL)
+}
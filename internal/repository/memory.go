@@ -3,8 +3,12 @@ package repository
 import (
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/aifedorov/shortener/internal/pkg/random"
+	"github.com/aifedorov/shortener/internal/pkg/rules"
+	"github.com/aifedorov/shortener/internal/pkg/workspace"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 
 	"github.com/aifedorov/shortener/internal/http/middleware/logger"
@@ -13,11 +17,27 @@ import (
 // MemoryRepository provides an in-memory implementation of the Repository interface.
 // It stores URL mappings in a map with thread-safe access using read-write mutex.
 type MemoryRepository struct {
-	// PathToURL maps short URL paths to original URLs.
-	PathToURL map[string]string
+	// PathToURL maps short URL paths to URL mappings.
+	PathToURL map[string]*URLMapping
+	// APIKeys maps API key IDs to API keys.
+	APIKeys map[string]*APIKey
+	// Users maps logins to registered users.
+	Users map[string]*User
+	// Merges lists the recorded link merges, oldest first.
+	Merges []LinkMerge
+	// Workspaces maps workspace IDs to workspaces.
+	Workspaces map[string]*Workspace
+	// Members maps workspace IDs to the members of the workspace by user ID.
+	Members map[string]map[string]*Member
+	// Audit lists the admin audit log, oldest first.
+	Audit []AuditEntry
+	// Reports maps report IDs to abuse reports.
+	Reports map[string]*Report
+	// Quota limits the links stored per owner.
+	Quota Quota
 	// Rand is used for generating random short URL identifiers.
 	Rand random.Randomizer
-	// mu provides thread-safe access to the PathToURL map.
+	// mu provides thread-safe access to the links, keys, users, merges, workspaces, audit log and reports.
 	mu sync.RWMutex
 }
 
@@ -25,8 +45,13 @@ type MemoryRepository struct {
 // The repository is ready to use immediately after creation.
 func NewMemoryRepository() *MemoryRepository {
 	return &MemoryRepository{
-		PathToURL: make(map[string]string),
-		Rand:      random.NewService(),
+		PathToURL:  make(map[string]*URLMapping),
+		APIKeys:    make(map[string]*APIKey),
+		Users:      make(map[string]*User),
+		Workspaces: make(map[string]*Workspace),
+		Members:    make(map[string]map[string]*Member),
+		Reports:    make(map[string]*Report),
+		Rand:       random.NewService(),
 	}
 }
 
@@ -50,57 +75,80 @@ func (ms *MemoryRepository) Get(shortURL string) (string, error) {
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
 
-	targetURL, exists := ms.PathToURL[shortURL]
+	record, exists := ms.PathToURL[shortURL]
 	if !exists {
 		logger.Log.Debug("memory: short url not found", zap.String("short_url", shortURL))
 		return "", ErrShortURLNotFound
 	}
+	if err := record.available(); err != nil {
+		return "", err
+	}
+	if record.Quarantined {
+		return "", ErrLinkQuarantined
+	}
+
+	return record.OriginalURL, nil
+}
+
+// Resolve retrieves the link for a given short URL from memory storage and counts the redirect.
+func (ms *MemoryRepository) Resolve(shortURL string) (Link, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
 
-	return targetURL, nil
+	record, exists := ms.PathToURL[shortURL]
+	if !exists {
+		logger.Log.Debug("memory: short url not found", zap.String("short_url", shortURL))
+		return Link{}, ErrShortURLNotFound
+	}
+
+	return record.visit()
 }
 
 // GetAll retrieves all URLs belonging to a specific user from memory storage.
-func (ms *MemoryRepository) GetAll(_, baseURL string) ([]URLOutput, error) {
+func (ms *MemoryRepository) GetAll(userID, baseURL string) ([]URLOutput, error) {
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
 
-	res := make([]URLOutput, len(ms.PathToURL))
-	i := 0
-	for alias, url := range ms.PathToURL {
-		res[i] = URLOutput{
-			ShortURL:    baseURL + "/" + alias,
-			OriginalURL: url,
+	res := make([]URLOutput, 0)
+	for _, record := range ms.PathToURL {
+		if record.IsDeleted || record.UserID != userID {
+			continue
 		}
-		i++
+		res = append(res, record.output(baseURL))
+	}
+	if len(res) == 0 {
+		return nil, ErrUserHasNoData
 	}
 	return res, nil
 }
 
 // Store saves a new URL to memory storage and returns the generated short URL.
-func (ms *MemoryRepository) Store(_, baseURL, targetURL string) (string, error) {
+// It returns a ConflictError with the existing short URL if the URL is already stored.
+func (ms *MemoryRepository) Store(userID, baseURL, targetURL string, opts LinkOptions) (string, error) {
 	alias, err := ms.Rand.GenRandomString()
 	if err != nil {
 		logger.Log.Debug("memory: generation of random string failed", zap.Error(err))
 		return "", err
 	}
 
-	resURL := baseURL + "/" + alias
-	ms.mu.RLock()
-	if _, exists := ms.PathToURL[resURL]; exists {
-		logger.Log.Debug("memory: short url already exists", zap.String("resURL", resURL))
-		return resURL, nil
-	}
-	ms.mu.RUnlock()
-
 	ms.mu.Lock()
-	ms.PathToURL[alias] = targetURL
-	ms.mu.Unlock()
+	defer ms.mu.Unlock()
+
+	if existing, exists := findByOriginalURL(ms.PathToURL, targetURL); exists {
+		return "", NewConflictError(baseURL+"/"+existing.ShortURL, ErrURLExists)
+	}
+	if err := ms.Quota.check(ownerUsage(ms.PathToURL, userID, time.Now()), 1); err != nil {
+		return "", err
+	}
+	ms.PathToURL[alias] = newURLMapping(userID, alias, targetURL, opts)
 
-	return resURL, nil
+	return baseURL + "/" + alias, nil
 }
 
 // StoreBatch saves multiple URLs to memory storage in a single operation.
-func (ms *MemoryRepository) StoreBatch(_, baseURL string, urls []BatchURLInput) ([]BatchURLOutput, error) {
+// URLs that are already stored or repeated within the batch are answered with the existing link,
+// only the new links count against the quota.
+func (ms *MemoryRepository) StoreBatch(userID, baseURL string, urls []BatchURLInput) ([]BatchURLOutput, error) {
 	if len(urls) == 0 {
 		return nil, nil
 	}
@@ -109,37 +157,438 @@ func (ms *MemoryRepository) StoreBatch(_, baseURL string, urls []BatchURLInput)
 	defer ms.mu.Unlock()
 
 	logger.Log.Debug("memory: storing batch of urls", zap.Int("count", len(urls)))
-	res := make([]BatchURLOutput, len(urls))
-	for i, url := range urls {
-		alias, err := ms.Rand.GenRandomString()
-		if err != nil {
-			logger.Log.Debug("memory: generation of random string failed", zap.Error(err))
+	res, created, err := newBatchMappings(ms.PathToURL, ms.Rand, userID, baseURL, urls)
+	if err != nil {
+		logger.Log.Debug("memory: generation of random string failed", zap.Error(err))
+		return nil, err
+	}
+	if len(created) > 0 {
+		if err := ms.Quota.check(ownerUsage(ms.PathToURL, userID, time.Now()), len(created)); err != nil {
 			return nil, err
 		}
-
-		resURL := baseURL + "/" + alias
-		ou := BatchURLOutput{
-			CID:      url.CID,
-			ShortURL: resURL,
-		}
-		res[i] = ou
-		ms.PathToURL[alias] = url.OriginalURL
+	}
+	for _, record := range created {
+		ms.PathToURL[record.ShortURL] = record
 	}
 
 	logger.Log.Debug("memory: store updated", zap.Any("store", ms.PathToURL))
 	return res, nil
 }
 
+// SetQuota sets the quota enforced by Store and StoreBatch.
+func (ms *MemoryRepository) SetQuota(quota Quota) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.Quota = quota
+}
+
+// GetUsage counts the links of the owner in memory storage against the quota.
+func (ms *MemoryRepository) GetUsage(userID string) (Usage, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ownerUsage(ms.PathToURL, userID, time.Now()), nil
+}
+
 // DeleteBatch marks multiple URLs as deleted for a specific user in memory storage.
-func (ms *MemoryRepository) DeleteBatch(_ string, aliases []string) error {
+// Aliases of links owned by someone else are skipped.
+func (ms *MemoryRepository) DeleteBatch(userID string, aliases []string) error {
 	if len(aliases) == 0 {
 		return errors.New("memory: aliases is empty")
 	}
 
 	ms.mu.Lock()
 	for _, alias := range aliases {
-		delete(ms.PathToURL, alias)
+		if record, exists := ms.PathToURL[alias]; exists && record.UserID == userID {
+			record.IsDeleted = true
+		}
 	}
 	ms.mu.Unlock()
 	return nil
 }
+
+// GetRules retrieves the conditional redirect rules of a link owned by the user from memory storage.
+func (ms *MemoryRepository) GetRules(userID, alias string) ([]rules.Rule, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	record, err := findOwned(ms.PathToURL, alias, userID)
+	if err != nil {
+		return nil, err
+	}
+	return record.Rules, nil
+}
+
+// SetRules replaces the conditional redirect rules of a link owned by the user in memory storage.
+func (ms *MemoryRepository) SetRules(userID, alias string, linkRules []rules.Rule) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	record, err := findOwned(ms.PathToURL, alias, userID)
+	if err != nil {
+		return err
+	}
+	record.Rules = linkRules
+	return nil
+}
+
+// TrackVariant counts a redirect served by the variant of a split link in memory storage.
+func (ms *MemoryRepository) TrackVariant(alias string, variant int) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	record, exists := ms.PathToURL[alias]
+	if !exists {
+		return ErrShortURLNotFound
+	}
+	return record.trackVariant(variant)
+}
+
+// GetCheckTargets returns up to limit active links from memory storage that are due for a dead-link check.
+func (ms *MemoryRepository) GetCheckTargets(checkedBefore time.Time, limit int) ([]CheckTarget, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return checkTargets(ms.PathToURL, checkedBefore, limit), nil
+}
+
+// SaveCheckResult records the outcome of the latest dead-link check of a link in memory storage.
+func (ms *MemoryRepository) SaveCheckResult(alias string, result CheckResult) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	record, exists := ms.PathToURL[alias]
+	if !exists {
+		return ErrShortURLNotFound
+	}
+	checkedAt := result.CheckedAt
+	record.LastStatus = result.StatusCode
+	record.CheckedAt = &checkedAt
+	return nil
+}
+
+// StoreAPIKey saves a new API key to memory storage.
+func (ms *MemoryRepository) StoreAPIKey(key APIKey) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.APIKeys[key.ID] = &key
+	return nil
+}
+
+// GetAPIKeys retrieves the active API keys of a user from memory storage.
+func (ms *MemoryRepository) GetAPIKeys(userID string) ([]APIKey, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return activeAPIKeys(ms.APIKeys, userID), nil
+}
+
+// RevokeAPIKey revokes an active API key of a user in memory storage.
+func (ms *MemoryRepository) RevokeAPIKey(userID, keyID string, revokedAt time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	key, err := findActiveAPIKey(ms.APIKeys, userID, keyID)
+	if err != nil {
+		return err
+	}
+	ms.APIKeys[keyID] = key.revoked(revokedAt)
+	return nil
+}
+
+// GetAPIKeyUser returns the owner of the active API key with the given hash from memory storage.
+func (ms *MemoryRepository) GetAPIKeyUser(keyHash string) (string, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return apiKeyUser(ms.APIKeys, keyHash)
+}
+
+// CreateUser saves a new registered user to memory storage.
+func (ms *MemoryRepository) CreateUser(user User) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, exists := ms.Users[user.Login]; exists {
+		return ErrLoginTaken
+	}
+	ms.Users[user.Login] = &user
+	return nil
+}
+
+// GetUserByLogin retrieves the registered user with the given login from memory storage.
+func (ms *MemoryRepository) GetUserByLogin(login string) (User, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	user, exists := ms.Users[login]
+	if !exists {
+		return User{}, ErrUserNotFound
+	}
+	return *user, nil
+}
+
+// GetUserByID retrieves the registered user with the given ID from memory storage.
+func (ms *MemoryRepository) GetUserByID(userID string) (User, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return findUserByID(ms.Users, userID)
+}
+
+// MergeLinks moves the active links of an anonymous user to a registered account in memory storage.
+func (ms *MemoryRepository) MergeLinks(fromUserID, toUserID string, mergedAt time.Time) (LinkMerge, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if isRegistered(ms.Users, fromUserID) {
+		return LinkMerge{}, ErrRegisteredUser
+	}
+	moved, skipped := planMerge(ms.PathToURL, fromUserID, toUserID)
+	merge := newLinkMerge(fromUserID, toUserID, moved, skipped, mergedAt)
+	if merge.IsEmpty() {
+		return merge, nil
+	}
+	for _, alias := range moved {
+		ms.PathToURL[alias].UserID = toUserID
+	}
+	ms.Merges = append(ms.Merges, merge)
+	return merge, nil
+}
+
+// CreateWorkspace saves a new workspace with the user as its owner to memory storage.
+func (ms *MemoryRepository) CreateWorkspace(ws Workspace, ownerID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.Workspaces[ws.ID] = &ws
+	ms.Members[ws.ID] = map[string]*Member{
+		ownerID: {WorkspaceID: ws.ID, UserID: ownerID, Role: workspace.RoleOwner, AddedAt: ws.CreatedAt},
+	}
+	return nil
+}
+
+// GetWorkspaces retrieves the workspaces the user is a member of from memory storage.
+func (ms *MemoryRepository) GetWorkspaces(userID string) ([]UserWorkspace, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return userWorkspaces(ms.Workspaces, ms.Members, userID), nil
+}
+
+// GetMembers retrieves the members of a workspace from memory storage.
+func (ms *MemoryRepository) GetMembers(workspaceID string) ([]Member, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if _, exists := ms.Workspaces[workspaceID]; !exists {
+		return nil, ErrWorkspaceNotFound
+	}
+	return memberList(ms.Members[workspaceID]), nil
+}
+
+// GetMemberRole returns the role of the user in the workspace from memory storage.
+func (ms *MemoryRepository) GetMemberRole(workspaceID, userID string) (workspace.Role, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	member, exists := ms.Members[workspaceID][userID]
+	if !exists {
+		return "", ErrMemberNotFound
+	}
+	return member.Role, nil
+}
+
+// SetMember adds a member to a workspace or changes the role of a member in memory storage.
+func (ms *MemoryRepository) SetMember(member Member) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, exists := ms.Workspaces[member.WorkspaceID]; !exists {
+		return ErrWorkspaceNotFound
+	}
+	members := ms.Members[member.WorkspaceID]
+	if err := checkOwnerRemains(memberList(members), member.UserID, member.Role); err != nil {
+		return err
+	}
+	members[member.UserID] = &member
+	return nil
+}
+
+// RemoveMember removes a member from a workspace in memory storage.
+func (ms *MemoryRepository) RemoveMember(workspaceID, userID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	members := ms.Members[workspaceID]
+	if _, exists := members[userID]; !exists {
+		return ErrMemberNotFound
+	}
+	if err := checkOwnerRemains(memberList(members), userID, ""); err != nil {
+		return err
+	}
+	delete(members, userID)
+	return nil
+}
+
+// SearchLinks returns the links of all owners matching the filter from memory storage.
+func (ms *MemoryRepository) SearchLinks(filter LinkFilter, baseURL string) ([]LinkRecord, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return searchLinks(ms.PathToURL, filter, baseURL), nil
+}
+
+// SetLinkDisabled disables or enables a link and records the audit entry in memory storage.
+func (ms *MemoryRepository) SetLinkDisabled(alias string, statusCode int, reason string, entry AuditEntry) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	record, exists := ms.PathToURL[alias]
+	if !exists {
+		return ErrShortURLNotFound
+	}
+	record.DisabledStatus = statusCode
+	record.DisabledReason = reason
+	ms.Audit = append(ms.Audit, entry)
+	return nil
+}
+
+// ReassignLink moves a link to another owner and records the audit entry in memory storage.
+func (ms *MemoryRepository) ReassignLink(alias, ownerID string, entry AuditEntry) (string, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	record, exists := ms.PathToURL[alias]
+	if !exists {
+		return "", ErrShortURLNotFound
+	}
+	previous := record.UserID
+	record.UserID = ownerID
+	ms.Audit = append(ms.Audit, entry.withDetail(AuditDetailFrom, previous))
+	return previous, nil
+}
+
+// GetOwnerStats returns the link counts of every owner from memory storage.
+func (ms *MemoryRepository) GetOwnerStats() ([]OwnerStats, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return ownerStats(ms.PathToURL), nil
+}
+
+// AppendAudit records an admin action in memory storage.
+func (ms *MemoryRepository) AppendAudit(entry AuditEntry) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.Audit = append(ms.Audit, entry)
+	return nil
+}
+
+// GetAuditLog returns the latest audit log entries from memory storage.
+func (ms *MemoryRepository) GetAuditLog(limit int) ([]AuditEntry, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return latestAudit(ms.Audit, limit), nil
+}
+
+// AddReport files an abuse report against a link in memory storage.
+func (ms *MemoryRepository) AddReport(report Report, threshold int) (bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	record, exists := ms.PathToURL[report.Alias]
+	if !exists {
+		return false, ErrShortURLNotFound
+	}
+	if err := record.available(); err != nil {
+		return false, err
+	}
+	if hasOpenReport(ms.Reports, report.Alias, report.Reporter) {
+		return false, ErrReportExists
+	}
+	ms.Reports[report.ID] = &report
+	if shouldQuarantine(record, ms.Reports, threshold) {
+		record.Quarantined = true
+	}
+	return record.Quarantined, nil
+}
+
+// GetReports returns the latest reports with the status from memory storage.
+func (ms *MemoryRepository) GetReports(status string, limit int) ([]Report, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return latestReports(ms.Reports, status, limit), nil
+}
+
+// ResolveReports closes the open reports against a link, lifts its quarantine and records the audit entry
+// in memory storage.
+func (ms *MemoryRepository) ResolveReports(alias, status string, entry AuditEntry) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	record, exists := ms.PathToURL[alias]
+	if !exists {
+		return 0, ErrShortURLNotFound
+	}
+	resolved := resolveReports(ms.Reports, alias, status, entry.Actor, entry.CreatedAt)
+	for i := range resolved {
+		ms.Reports[resolved[i].ID] = &resolved[i]
+	}
+	record.Quarantined = false
+	ms.Audit = append(ms.Audit, entry.withResolved(len(resolved)))
+	return len(resolved), nil
+}
+
+// newURLMapping creates a URL mapping for a newly stored link.
+func newURLMapping(userID, alias, originalURL string, opts LinkOptions) *URLMapping {
+	record := &URLMapping{
+		ID:             uuid.NewString(),
+		UserID:         userID,
+		ShortURL:       alias,
+		OriginalURL:    originalURL,
+		SubmittedURL:   opts.SubmittedURL,
+		MaxClicks:      opts.MaxClicks,
+		Variants:       opts.Variants,
+		PassQuery:      opts.PassQuery,
+		RedirectStatus: opts.RedirectStatus,
+		CreatedAt:      time.Now().UTC(),
+	}
+	if !opts.UTM.IsZero() {
+		utm := opts.UTM
+		record.UTM = &utm
+	}
+	return record
+}
+
+// newBatchMappings creates the URL mappings of a batch without saving them, so a rejected batch stores no links.
+// URLs stored before or listed earlier in the batch are answered with the existing link and get no new mapping.
+// Callers must hold the repository lock.
+func newBatchMappings(records map[string]*URLMapping, rnd random.Randomizer, userID, baseURL string, urls []BatchURLInput) ([]BatchURLOutput, []*URLMapping, error) {
+	res := make([]BatchURLOutput, len(urls))
+	created := make([]*URLMapping, 0, len(urls))
+	first := make(map[string]int, len(urls))
+	for i, url := range urls {
+		if j, ok := first[url.OriginalURL]; ok {
+			res[i] = BatchURLOutput{CID: url.CID, ShortURL: res[j].ShortURL, Existing: true}
+			continue
+		}
+		first[url.OriginalURL] = i
+
+		if existing, exists := findByOriginalURL(records, url.OriginalURL); exists {
+			res[i] = BatchURLOutput{CID: url.CID, ShortURL: baseURL + "/" + existing.ShortURL, Existing: true}
+			continue
+		}
+
+		alias, err := rnd.GenRandomString()
+		if err != nil {
+			return nil, nil, err
+		}
+		created = append(created, newURLMapping(userID, alias, url.OriginalURL, url.Options))
+		res[i] = BatchURLOutput{CID: url.CID, ShortURL: baseURL + "/" + alias}
+	}
+	return res, created, nil
+}
@@ -1,11 +1,19 @@
 package repository
 
 import (
+	"fmt"
+	"net/http"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aifedorov/shortener/internal/pkg/random"
+	"github.com/aifedorov/shortener/internal/pkg/rules"
+	"github.com/aifedorov/shortener/internal/pkg/split"
+	"github.com/aifedorov/shortener/internal/pkg/workspace"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMemoryStorage_GetURL(t *testing.T) {
@@ -20,8 +28,8 @@ func TestMemoryStorage_GetURL(t *testing.T) {
 			name: "get URL with existing value",
 			storage: &MemoryRepository{
 				Rand: random.NewService(),
-				PathToURL: map[string]string{
-					"1": "https://google.com",
+				PathToURL: map[string]*URLMapping{
+					"1": {ShortURL: "1", OriginalURL: "https://google.com"},
 				},
 			},
 			shortURL: "1",
@@ -32,8 +40,8 @@ func TestMemoryStorage_GetURL(t *testing.T) {
 			name: "get URL with not existing value",
 			storage: &MemoryRepository{
 				Rand: random.NewService(),
-				PathToURL: map[string]string{
-					"1": "https://google.com",
+				PathToURL: map[string]*URLMapping{
+					"1": {ShortURL: "1", OriginalURL: "https://google.com"},
 				},
 			},
 			shortURL: "2",
@@ -79,7 +87,7 @@ func TestMemoryStorage_SaveURL(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := tt.storage.Store(uuid.NewString(), tt.baseURL, tt.targetURL)
+			got, err := tt.storage.Store(uuid.NewString(), tt.baseURL, tt.targetURL, LinkOptions{})
 			assert.ErrorIs(t, err, tt.wantErr)
 
 			if tt.wantPrefix != "" {
@@ -92,3 +100,472 @@ func TestMemoryStorage_SaveURL(t *testing.T) {
 		})
 	}
 }
+
+func TestMemoryStorage_StoreConflict(t *testing.T) {
+	storage := NewMemoryRepository()
+	shortURL, err := storage.Store("user1", "http://localhost", "https://example.com", LinkOptions{})
+	require.NoError(t, err)
+
+	for _, userID := range []string{"user1", "user2"} {
+		_, err = storage.Store(userID, "http://localhost", "https://example.com", LinkOptions{})
+		var cErr *ConflictError
+		require.ErrorAs(t, err, &cErr)
+		assert.Equal(t, shortURL, cErr.ShortURL)
+	}
+	assert.Len(t, storage.PathToURL, 1)
+}
+
+func TestMemoryStorage_StoreBatchDuplicates(t *testing.T) {
+	storage := NewMemoryRepository()
+	storage.SetQuota(Quota{MaxActiveLinks: 1})
+	otherURL, err := storage.Store("user2", "http://localhost", "https://example.com/taken", LinkOptions{})
+	require.NoError(t, err)
+
+	res, err := storage.StoreBatch("user1", "http://localhost", []BatchURLInput{
+		{CID: "1", OriginalURL: "https://example.com/repeated"},
+		{CID: "2", OriginalURL: "https://example.com/repeated"},
+		{CID: "3", OriginalURL: "https://example.com/taken"},
+	})
+	require.NoError(t, err, "only the new link counts against the quota")
+	require.Len(t, res, 3)
+	assert.False(t, res[0].Existing)
+	assert.Equal(t, BatchURLOutput{CID: "2", ShortURL: res[0].ShortURL, Existing: true}, res[1],
+		"a URL listed twice is stored once")
+	assert.Equal(t, BatchURLOutput{CID: "3", ShortURL: otherURL, Existing: true}, res[2],
+		"a URL of another user is answered with its link")
+	assert.Len(t, storage.PathToURL, 2)
+
+	res, err = storage.StoreBatch("user1", "http://localhost", []BatchURLInput{
+		{CID: "1", OriginalURL: "https://example.com/repeated"},
+	})
+	require.NoError(t, err, "a batch of stored URLs is answered over the quota")
+	assert.Equal(t, []BatchURLOutput{{CID: "1", ShortURL: res[0].ShortURL, Existing: true}}, res)
+}
+
+func TestMemoryStorage_Resolve(t *testing.T) {
+	storage := NewMemoryRepository()
+	shortURL, err := storage.Store(uuid.NewString(), "http://localhost:8080", "https://google.com", LinkOptions{MaxClicks: 2})
+	assert.NoError(t, err)
+	alias := shortURL[len("http://localhost:8080/"):]
+
+	link, err := storage.Resolve(alias)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://google.com", link.OriginalURL)
+	assert.Equal(t, 1, link.Clicks)
+
+	link, err = storage.Resolve(alias)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, link.Clicks)
+
+	_, err = storage.Resolve(alias)
+	assert.ErrorIs(t, err, ErrURLDeleted)
+
+	_, err = storage.Get(alias)
+	assert.ErrorIs(t, err, ErrURLDeleted)
+
+	_, err = storage.Resolve("unknown")
+	assert.ErrorIs(t, err, ErrShortURLNotFound)
+}
+
+func TestMemoryStorage_ResolveConcurrent(t *testing.T) {
+	const maxClicks = 5
+
+	storage := NewMemoryRepository()
+	shortURL, err := storage.Store(uuid.NewString(), "http://localhost:8080", "https://google.com", LinkOptions{MaxClicks: maxClicks})
+	assert.NoError(t, err)
+	alias := shortURL[len("http://localhost:8080/"):]
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		successes int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := storage.Resolve(alias); err == nil {
+				mu.Lock()
+				successes++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, maxClicks, successes)
+}
+
+func TestMemoryStorage_Rules(t *testing.T) {
+	storage := NewMemoryRepository()
+	owner := uuid.NewString()
+	shortURL, err := storage.Store(owner, "http://localhost:8080", "https://google.com", LinkOptions{})
+	assert.NoError(t, err)
+	alias := shortURL[len("http://localhost:8080/"):]
+
+	linkRules := []rules.Rule{{Target: "https://apps.apple.com/app", Device: rules.DeviceIOS}}
+	assert.NoError(t, storage.SetRules(owner, alias, linkRules))
+	assert.ErrorIs(t, storage.SetRules(uuid.NewString(), alias, nil), ErrShortURLNotFound)
+
+	got, err := storage.GetRules(owner, alias)
+	assert.NoError(t, err)
+	assert.Equal(t, linkRules, got)
+
+	link, err := storage.Resolve(alias)
+	assert.NoError(t, err)
+	assert.Equal(t, linkRules, link.Rules)
+}
+
+func TestMemoryStorage_TrackVariant(t *testing.T) {
+	storage := NewMemoryRepository()
+	userID := uuid.NewString()
+	variants := []split.Variant{
+		{URL: "https://a.example.com", Weight: 1},
+		{URL: "https://b.example.com", Weight: 1},
+	}
+	shortURL, err := storage.Store(userID, "http://localhost:8080", "https://google.com", LinkOptions{Variants: variants})
+	assert.NoError(t, err)
+	alias := shortURL[len("http://localhost:8080/"):]
+
+	assert.NoError(t, storage.TrackVariant(alias, 1))
+	assert.NoError(t, storage.TrackVariant(alias, 1))
+	assert.ErrorIs(t, storage.TrackVariant(alias, 2), ErrVariantNotFound)
+	assert.ErrorIs(t, storage.TrackVariant("unknown", 0), ErrShortURLNotFound)
+
+	urls, err := storage.GetAll(userID, "http://localhost:8080")
+	assert.NoError(t, err)
+	assert.Len(t, urls, 1)
+	assert.Equal(t, 0, urls[0].Variants[0].Clicks)
+	assert.Equal(t, 2, urls[0].Variants[1].Clicks)
+	assert.Equal(t, 0, variants[1].Clicks, "stored variants must not alias the input")
+}
+
+func TestMemoryStorage_CheckTargets(t *testing.T) {
+	storage := NewMemoryRepository()
+	userID := uuid.NewString()
+	aliases := make([]string, 3)
+	for i := range aliases {
+		shortURL, err := storage.Store(userID, "http://localhost:8080", fmt.Sprintf("https://example.com/%d", i), LinkOptions{})
+		assert.NoError(t, err)
+		aliases[i] = shortURL[len("http://localhost:8080/"):]
+	}
+
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, storage.SaveCheckResult(aliases[0], CheckResult{StatusCode: 200, CheckedAt: now}))
+	assert.NoError(t, storage.SaveCheckResult(aliases[1], CheckResult{StatusCode: 404, CheckedAt: now.Add(-2 * time.Hour)}))
+	assert.ErrorIs(t, storage.SaveCheckResult("unknown", CheckResult{CheckedAt: now}), ErrShortURLNotFound)
+
+	targets, err := storage.GetCheckTargets(now.Add(-time.Hour), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []CheckTarget{
+		{Alias: aliases[2], OriginalURL: "https://example.com/2"},
+		{Alias: aliases[1], OriginalURL: "https://example.com/1"},
+	}, targets, "never checked links come first")
+
+	targets, err = storage.GetCheckTargets(now.Add(-time.Hour), 1)
+	assert.NoError(t, err)
+	assert.Len(t, targets, 1)
+
+	assert.NoError(t, storage.DeleteBatch(userID, []string{aliases[2]}))
+	targets, err = storage.GetCheckTargets(now.Add(-time.Hour), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []CheckTarget{{Alias: aliases[1], OriginalURL: "https://example.com/1"}}, targets)
+}
+
+func TestMemoryStorage_APIKeys(t *testing.T) {
+	storage := NewMemoryRepository()
+	createdAt := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, storage.StoreAPIKey(APIKey{ID: "2", UserID: "user123", Name: "deploy", Hash: "hash2", CreatedAt: createdAt.Add(time.Hour)}))
+	assert.NoError(t, storage.StoreAPIKey(APIKey{ID: "1", UserID: "user123", Name: "ci", Hash: "hash1", CreatedAt: createdAt}))
+	assert.NoError(t, storage.StoreAPIKey(APIKey{ID: "3", UserID: "other", Name: "ci", Hash: "hash3", CreatedAt: createdAt}))
+
+	keys, err := storage.GetAPIKeys("user123")
+	assert.NoError(t, err)
+	if assert.Len(t, keys, 2) {
+		assert.Equal(t, "1", keys[0].ID)
+		assert.Equal(t, "2", keys[1].ID)
+	}
+
+	userID, err := storage.GetAPIKeyUser("hash1")
+	assert.NoError(t, err)
+	assert.Equal(t, "user123", userID)
+
+	assert.ErrorIs(t, storage.RevokeAPIKey("user123", "3", createdAt), ErrAPIKeyNotFound, "key of another user")
+	assert.NoError(t, storage.RevokeAPIKey("user123", "1", createdAt))
+	assert.ErrorIs(t, storage.RevokeAPIKey("user123", "1", createdAt), ErrAPIKeyNotFound, "already revoked")
+
+	_, err = storage.GetAPIKeyUser("hash1")
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+	keys, err = storage.GetAPIKeys("user123")
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+}
+
+func TestMemoryStorage_Users(t *testing.T) {
+	storage := NewMemoryRepository()
+	user := User{ID: "user123", Login: "alice", PasswordHash: "hash"}
+
+	_, err := storage.GetUserByLogin("alice")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	assert.NoError(t, storage.CreateUser(user))
+	assert.ErrorIs(t, storage.CreateUser(User{ID: "other", Login: "alice"}), ErrLoginTaken)
+
+	got, err := storage.GetUserByLogin("alice")
+	assert.NoError(t, err)
+	assert.Equal(t, user, got)
+}
+
+func TestMemoryStorage_MergeLinks(t *testing.T) {
+	storage := NewMemoryRepository()
+	mergedAt := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	storage.PathToURL = map[string]*URLMapping{
+		"acc1":  {UserID: "account", ShortURL: "acc1", OriginalURL: "https://example.com/shared"},
+		"anon1": {UserID: "anonymous", ShortURL: "anon1", OriginalURL: "https://example.com/shared"},
+		"anon2": {UserID: "anonymous", ShortURL: "anon2", OriginalURL: "https://example.com/new"},
+		"anon3": {UserID: "anonymous", ShortURL: "anon3", OriginalURL: "https://example.com/new"},
+		"anon4": {UserID: "anonymous", ShortURL: "anon4", OriginalURL: "https://example.com/gone", IsDeleted: true},
+		"other": {UserID: "other", ShortURL: "other", OriginalURL: "https://example.com/other"},
+	}
+	assert.NoError(t, storage.CreateUser(User{ID: "account", Login: "alice"}))
+
+	_, err := storage.MergeLinks("account", "other", mergedAt)
+	assert.ErrorIs(t, err, ErrRegisteredUser, "links of an account are not claimed")
+
+	merge, err := storage.MergeLinks("anonymous", "account", mergedAt)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, merge.ID)
+	assert.Equal(t, []string{"anon2"}, merge.Moved)
+	assert.Equal(t, []string{"anon1", "anon3"}, merge.Skipped)
+	assert.Equal(t, mergedAt, merge.MergedAt)
+	assert.Equal(t, []LinkMerge{merge}, storage.Merges)
+
+	owners := make(map[string]string)
+	for alias, record := range storage.PathToURL {
+		owners[alias] = record.UserID
+	}
+	assert.Equal(t, map[string]string{
+		"acc1":  "account",
+		"anon1": "anonymous",
+		"anon2": "account",
+		"anon3": "anonymous",
+		"anon4": "anonymous",
+		"other": "other",
+	}, owners)
+
+	merge, err = storage.MergeLinks("fresh", "account", mergedAt)
+	assert.NoError(t, err)
+	assert.True(t, merge.IsEmpty())
+	assert.Len(t, storage.Merges, 1, "empty merges are not recorded")
+}
+
+func TestMemoryStorage_Workspaces(t *testing.T) {
+	storage := NewMemoryRepository()
+	createdAt := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	ws := Workspace{ID: "ws1", Name: "Marketing", CreatedAt: createdAt}
+
+	assert.NoError(t, storage.CreateWorkspace(ws, "owner"))
+	role, err := storage.GetMemberRole("ws1", "owner")
+	assert.NoError(t, err)
+	assert.Equal(t, workspace.RoleOwner, role)
+
+	_, err = storage.GetMemberRole("ws1", "editor")
+	assert.ErrorIs(t, err, ErrMemberNotFound)
+	assert.ErrorIs(t, storage.SetMember(Member{WorkspaceID: "missing", UserID: "editor", Role: workspace.RoleEditor}), ErrWorkspaceNotFound)
+	assert.NoError(t, storage.SetMember(Member{WorkspaceID: "ws1", UserID: "editor", Role: workspace.RoleEditor, AddedAt: createdAt.Add(time.Hour)}))
+
+	workspaces, err := storage.GetWorkspaces("editor")
+	assert.NoError(t, err)
+	assert.Equal(t, []UserWorkspace{{Workspace: ws, Role: workspace.RoleEditor}}, workspaces)
+
+	assert.ErrorIs(t, storage.SetMember(Member{WorkspaceID: "ws1", UserID: "owner", Role: workspace.RoleViewer}), ErrLastOwner)
+	assert.ErrorIs(t, storage.RemoveMember("ws1", "owner"), ErrLastOwner)
+
+	assert.NoError(t, storage.SetMember(Member{WorkspaceID: "ws1", UserID: "editor", Role: workspace.RoleOwner, AddedAt: createdAt.Add(time.Hour)}))
+	assert.NoError(t, storage.RemoveMember("ws1", "owner"), "another owner remains")
+	assert.ErrorIs(t, storage.RemoveMember("ws1", "owner"), ErrMemberNotFound)
+
+	members, err := storage.GetMembers("ws1")
+	assert.NoError(t, err)
+	assert.Equal(t, []Member{{WorkspaceID: "ws1", UserID: "editor", Role: workspace.RoleOwner, AddedAt: createdAt.Add(time.Hour)}}, members)
+
+	_, err = storage.GetMembers("missing")
+	assert.ErrorIs(t, err, ErrWorkspaceNotFound)
+}
+
+func TestMemoryStorage_OwnerScope(t *testing.T) {
+	storage := NewMemoryRepository()
+	storage.PathToURL["own"] = newURLMapping("user1", "own", "https://example.com/own", LinkOptions{})
+	storage.PathToURL["other"] = newURLMapping("user2", "other", "https://example.com/other", LinkOptions{})
+
+	urls, err := storage.GetAll("user1", "http://localhost")
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, "http://localhost/own", urls[0].ShortURL)
+
+	require.NoError(t, storage.DeleteBatch("user1", []string{"own", "other", "missing"}))
+	assert.True(t, storage.PathToURL["own"].IsDeleted)
+	assert.False(t, storage.PathToURL["other"].IsDeleted, "links of another owner are kept")
+
+	_, err = storage.GetAll("user1", "http://localhost")
+	assert.ErrorIs(t, err, ErrUserHasNoData)
+}
+
+func TestMemoryStorage_Admin(t *testing.T) {
+	storage := NewMemoryRepository()
+	storage.PathToURL = map[string]*URLMapping{
+		"abc1": {UserID: "alice", ShortURL: "abc1", OriginalURL: "https://example.com/a", Clicks: 3},
+		"abc2": {UserID: "bob", ShortURL: "abc2", OriginalURL: "https://docs.example.com/b"},
+		"xyz1": {UserID: "bob", ShortURL: "xyz1", OriginalURL: "https://notexample.com/c"},
+		"xyz2": {UserID: "bob", ShortURL: "xyz2", OriginalURL: "https://example.org/d", IsDeleted: true},
+	}
+
+	links, err := storage.SearchLinks(LinkFilter{Domain: "Example.com"}, "http://localhost")
+	assert.NoError(t, err)
+	require.Len(t, links, 2)
+	assert.Equal(t, "abc1", links[0].Alias)
+	assert.Equal(t, "http://localhost/abc1", links[0].ShortURL)
+	assert.Equal(t, "abc2", links[1].Alias)
+
+	links, err = storage.SearchLinks(LinkFilter{Alias: "xyz", OwnerID: "bob", Limit: 1}, "http://localhost")
+	assert.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, "xyz1", links[0].Alias)
+
+	disable := AuditEntry{ID: "1", Actor: "token", Action: "disable_link", Target: "abc1"}
+	assert.ErrorIs(t, storage.SetLinkDisabled("missing", http.StatusGone, "", disable), ErrShortURLNotFound)
+	assert.Empty(t, storage.Audit, "a failed action is not audited")
+	assert.NoError(t, storage.SetLinkDisabled("abc1", http.StatusUnavailableForLegalReasons, "court order", disable))
+	_, err = storage.Resolve("abc1")
+	var dErr *DisabledError
+	require.ErrorAs(t, err, &dErr)
+	assert.Equal(t, http.StatusUnavailableForLegalReasons, dErr.StatusCode)
+	assert.Equal(t, "court order", dErr.Reason)
+	assert.ErrorIs(t, err, ErrLinkDisabled)
+
+	reassign := AuditEntry{ID: "2", Actor: "token", Action: "reassign_link", Target: "abc1", Details: map[string]string{"to": "bob"}}
+	previous, err := storage.ReassignLink("abc1", "bob", reassign)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", previous)
+	_, err = storage.ReassignLink("missing", "bob", reassign)
+	assert.ErrorIs(t, err, ErrShortURLNotFound)
+
+	stats, err := storage.GetOwnerStats()
+	assert.NoError(t, err)
+	assert.Equal(t, []OwnerStats{{OwnerID: "bob", Active: 2, Deleted: 1, Disabled: 1, Clicks: 3}}, stats)
+
+	enable := AuditEntry{ID: "3", Actor: "token", Action: "enable_link", Target: "abc1"}
+	assert.NoError(t, storage.SetLinkDisabled("abc1", 0, "", enable))
+	link, err := storage.Resolve("abc1")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/a", link.OriginalURL)
+
+	view := AuditEntry{ID: "4", Actor: "token", Action: "view_audit_log"}
+	assert.NoError(t, storage.AppendAudit(view))
+	entries, err := storage.GetAuditLog(0)
+	assert.NoError(t, err)
+	reassign.Details = map[string]string{"to": "bob", AuditDetailFrom: "alice"}
+	assert.Equal(t, []AuditEntry{view, enable, reassign, disable}, entries, "actions are audited with their changes")
+	entries, err = storage.GetAuditLog(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []AuditEntry{view}, entries)
+}
+
+func TestMemoryStorage_Quota(t *testing.T) {
+	storage := NewMemoryRepository()
+	storage.PathToURL = map[string]*URLMapping{
+		"old":     {UserID: "user1", ShortURL: "old", OriginalURL: "https://example.com/old", CreatedAt: time.Now().Add(-48 * time.Hour)},
+		"deleted": {UserID: "user1", ShortURL: "deleted", OriginalURL: "https://example.com/deleted", IsDeleted: true, CreatedAt: time.Now()},
+		"other":   {UserID: "user2", ShortURL: "other", OriginalURL: "https://example.com/other", CreatedAt: time.Now()},
+	}
+	storage.SetQuota(Quota{MaxActiveLinks: 10, MaxLinksPerDay: 2})
+
+	usage, err := storage.GetUsage("user1")
+	assert.NoError(t, err)
+	assert.Equal(t, Usage{ActiveLinks: 1, LinksToday: 1}, usage)
+
+	_, err = storage.Store("user1", "http://localhost", "https://example.com/a", LinkOptions{})
+	assert.NoError(t, err)
+
+	_, err = storage.StoreBatch("user1", "http://localhost", []BatchURLInput{
+		{CID: "1", OriginalURL: "https://example.com/b"},
+		{CID: "2", OriginalURL: "https://example.com/c"},
+	})
+	var qErr *QuotaError
+	require.ErrorAs(t, err, &qErr)
+	assert.Equal(t, QuotaError{Quota: QuotaDailyLinks, Limit: 2, Used: 2, Requested: 2}, *qErr)
+	assert.Len(t, storage.PathToURL, 4, "a rejected batch stores no links")
+
+	storage.SetQuota(Quota{MaxActiveLinks: 2})
+	_, err = storage.Store("user1", "http://localhost", "https://example.com/b", LinkOptions{})
+	require.ErrorAs(t, err, &qErr)
+	assert.Equal(t, QuotaActiveLinks, qErr.Quota)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+	_, err = storage.Store("user2", "http://localhost", "https://example.com/b", LinkOptions{})
+	assert.NoError(t, err, "quotas are counted per owner")
+}
+
+func TestMemoryStorage_Reports(t *testing.T) {
+	storage := NewMemoryRepository()
+	storage.PathToURL = map[string]*URLMapping{
+		"abc1": {UserID: "alice", ShortURL: "abc1", OriginalURL: "https://example.com/a"},
+		"gone": {UserID: "alice", ShortURL: "gone", OriginalURL: "https://example.com/g", IsDeleted: true},
+	}
+	now := time.Now().UTC()
+	report := func(id, reporter string, createdAt time.Time) Report {
+		return Report{ID: id, Alias: "abc1", Category: "phishing", Reporter: reporter, Status: ReportOpen, CreatedAt: createdAt}
+	}
+
+	_, err := storage.AddReport(Report{ID: "0", Alias: "missing", Reporter: "r1", Status: ReportOpen}, 2)
+	assert.ErrorIs(t, err, ErrShortURLNotFound)
+	_, err = storage.AddReport(Report{ID: "0", Alias: "gone", Reporter: "r1", Status: ReportOpen}, 2)
+	assert.ErrorIs(t, err, ErrURLDeleted)
+
+	quarantined, err := storage.AddReport(report("1", "r1", now), 2)
+	assert.NoError(t, err)
+	assert.False(t, quarantined)
+	_, err = storage.AddReport(report("2", "r1", now), 2)
+	assert.ErrorIs(t, err, ErrReportExists, "a reporter counts once")
+
+	quarantined, err = storage.AddReport(report("3", "r2", now.Add(time.Second)), 2)
+	assert.NoError(t, err)
+	assert.True(t, quarantined)
+
+	link, err := storage.Resolve("abc1")
+	assert.NoError(t, err)
+	assert.True(t, link.Quarantined)
+	assert.Equal(t, 0, storage.PathToURL["abc1"].Clicks, "quarantined visits are not counted")
+	_, err = storage.Get("abc1")
+	assert.ErrorIs(t, err, ErrLinkQuarantined)
+
+	reports, err := storage.GetReports(ReportOpen, 0)
+	assert.NoError(t, err)
+	require.Len(t, reports, 2)
+	assert.Equal(t, "3", reports[0].ID, "newest first")
+
+	dismiss := AuditEntry{ID: "1", Actor: "token", Action: "dismiss_reports", Target: "abc1", CreatedAt: now}
+	resolved, err := storage.ResolveReports("abc1", ReportDismissed, dismiss)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, resolved)
+	_, err = storage.ResolveReports("missing", ReportDismissed, dismiss)
+	assert.ErrorIs(t, err, ErrShortURLNotFound)
+	require.Len(t, storage.Audit, 1)
+	assert.Equal(t, "2", storage.Audit[0].Details[AuditDetailResolved])
+
+	link, err = storage.Resolve("abc1")
+	assert.NoError(t, err)
+	assert.False(t, link.Quarantined)
+	assert.Equal(t, 1, link.Clicks)
+
+	reports, err = storage.GetReports(ReportDismissed, 1)
+	assert.NoError(t, err)
+	require.Len(t, reports, 1)
+	assert.Equal(t, "token", reports[0].ResolvedBy)
+	require.NotNil(t, reports[0].ResolvedAt)
+
+	quarantined, err = storage.AddReport(report("4", "r1", now), 0)
+	assert.NoError(t, err, "a dismissed report does not block a new one")
+	assert.False(t, quarantined, "zero threshold never quarantines")
+}
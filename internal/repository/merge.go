@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LinkMerge records the transfer of the links of an anonymous user to a registered account.
+//
+// Conflicts are resolved in favour of the account: an active anonymous link whose original URL
+// the account already has an active link for is left with the anonymous user and listed as skipped,
+// so the account keeps a single link per original URL and no short URL stops redirecting.
+// Among anonymous links sharing an original URL the one with the smallest alias is moved.
+// Deleted anonymous links are neither moved nor listed.
+type LinkMerge struct {
+	// ID is the unique identifier of the merge.
+	ID string `json:"id"`
+	// FromUserID is the ID of the anonymous user the links were taken from.
+	FromUserID string `json:"from_user_id"`
+	// ToUserID is the ID of the registered account the links were moved to.
+	ToUserID string `json:"to_user_id"`
+	// Moved lists the aliases of the links moved to the account.
+	Moved []string `json:"moved"`
+	// Skipped lists the aliases of the links left with the anonymous user because of a conflict.
+	Skipped []string `json:"skipped,omitempty"`
+	// MergedAt is the time of the merge.
+	MergedAt time.Time `json:"merged_at"`
+}
+
+// IsEmpty reports whether the anonymous user had no active links, such merges are not recorded.
+func (m LinkMerge) IsEmpty() bool {
+	return len(m.Moved) == 0 && len(m.Skipped) == 0
+}
+
+// newLinkMerge creates a merge of the links of fromUserID into toUserID with the given aliases.
+func newLinkMerge(fromUserID, toUserID string, moved, skipped []string, mergedAt time.Time) LinkMerge {
+	sort.Strings(moved)
+	sort.Strings(skipped)
+	return LinkMerge{
+		ID:         uuid.NewString(),
+		FromUserID: fromUserID,
+		ToUserID:   toUserID,
+		Moved:      moved,
+		Skipped:    skipped,
+		MergedAt:   mergedAt,
+	}
+}
+
+// planMerge splits the active links of fromUserID into the ones moved to toUserID and the conflicting ones.
+func planMerge(links map[string]*URLMapping, fromUserID, toUserID string) (moved, skipped []string) {
+	owned := make(map[string]bool)
+	var candidates []*URLMapping
+	for _, record := range links {
+		if record.IsDeleted {
+			continue
+		}
+		switch record.UserID {
+		case toUserID:
+			owned[record.OriginalURL] = true
+		case fromUserID:
+			candidates = append(candidates, record)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].ShortURL < candidates[j].ShortURL
+	})
+
+	for _, record := range candidates {
+		if owned[record.OriginalURL] {
+			skipped = append(skipped, record.ShortURL)
+			continue
+		}
+		owned[record.OriginalURL] = true
+		moved = append(moved, record.ShortURL)
+	}
+	return moved, skipped
+}
+
+// isRegistered reports whether the user ID belongs to a registered user.
+func isRegistered(users map[string]*User, userID string) bool {
+	for _, user := range users {
+		if user.ID == userID {
+			return true
+		}
+	}
+	return false
+}
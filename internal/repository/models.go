@@ -1,5 +1,16 @@
 package repository
 
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aifedorov/shortener/internal/pkg/querymerge"
+	"github.com/aifedorov/shortener/internal/pkg/rules"
+	"github.com/aifedorov/shortener/internal/pkg/split"
+	"github.com/aifedorov/shortener/internal/pkg/workspace"
+)
+
 // BatchURLInput represents a single URL input for batch operations.
 // Used internally by the repository layer for batch URL storage.
 type BatchURLInput struct {
@@ -7,6 +18,8 @@ type BatchURLInput struct {
 	CID string
 	// OriginalURL is the original URL to be shortened.
 	OriginalURL string
+	// Options holds the optional settings of the link.
+	Options LinkOptions
 }
 
 // BatchURLOutput represents a single URL output from batch operations.
@@ -16,6 +29,8 @@ type BatchURLOutput struct {
 	CID string
 	// ShortURL is the generated short URL.
 	ShortURL string
+	// Existing is set when the URL was shortened before and ShortURL is the existing link.
+	Existing bool
 }
 
 // URLOutput represents a URL entry in the user's URL list.
@@ -25,4 +40,415 @@ type URLOutput struct {
 	ShortURL string `json:"short_url"`
 	// OriginalURL is the original URL that was shortened.
 	OriginalURL string `json:"original_url"`
+	// SubmittedURL is the URL as submitted by the client, omitted if it equals the canonical original URL.
+	SubmittedURL string `json:"submitted_url,omitempty"`
+	// Variants lists the weighted destinations of a split link with their click counts.
+	Variants []split.Variant `json:"variants,omitempty"`
+	// RedirectStatus is the redirect status code of the link, omitted if the server default is used.
+	RedirectStatus int `json:"redirect_status,omitempty"`
+	// LastStatus is the status code of the latest dead-link check, zero if the target was unreachable.
+	LastStatus int `json:"last_status,omitempty"`
+	// CheckedAt is the time of the latest dead-link check, omitted if the link was never checked.
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+}
+
+// IsBroken reports whether the latest dead-link check of the link failed.
+// A link that was never checked is not considered broken.
+func (o URLOutput) IsBroken() bool {
+	return o.CheckedAt != nil && (o.LastStatus == 0 || o.LastStatus >= http.StatusBadRequest)
+}
+
+// CheckTarget identifies a link probed by the dead-link checker.
+type CheckTarget struct {
+	// Alias is the short URL path/alias.
+	Alias string
+	// OriginalURL is the URL that is probed.
+	OriginalURL string
+}
+
+// CheckResult holds the outcome of a dead-link check.
+type CheckResult struct {
+	// StatusCode is the HTTP status code returned by the target, zero if the target was unreachable.
+	StatusCode int
+	// CheckedAt is the time of the check.
+	CheckedAt time.Time
+}
+
+// APIKey is a named credential of a user for programmatic clients.
+// Only the hash of the key is stored, the key itself is shown once on creation.
+type APIKey struct {
+	// ID is the unique identifier of the key.
+	ID string `json:"id"`
+	// UserID is the ID of the user the key authenticates as.
+	UserID string `json:"user_id"`
+	// Name is the label given to the key by the user.
+	Name string `json:"name"`
+	// Prefix holds the leading characters of the key to identify it in listings.
+	Prefix string `json:"prefix"`
+	// Hash is the hash of the key.
+	Hash string `json:"hash"`
+	// CreatedAt is the time the key was created.
+	CreatedAt time.Time `json:"created_at"`
+	// RevokedAt is the time the key was revoked, nil while the key is active.
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// User is a registered account. Its ID is used as the user ID of the links like the IDs of anonymous users.
+type User struct {
+	// ID is the unique identifier of the user.
+	ID string `json:"id"`
+	// Login is the unique login name in lower case.
+	Login string `json:"login"`
+	// PasswordHash is the hash of the password.
+	PasswordHash string `json:"password_hash"`
+	// CreatedAt is the time the account was registered.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Workspace is a link collection shared by its members.
+// Its ID is used as the user ID of the links it owns, so the link storage does not tell users and workspaces apart.
+type Workspace struct {
+	// ID is the unique identifier of the workspace.
+	ID string `json:"id"`
+	// Name is the display name of the workspace.
+	Name string `json:"name"`
+	// CreatedAt is the time the workspace was created.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Member is the membership of a user in a workspace.
+type Member struct {
+	// WorkspaceID is the ID of the workspace.
+	WorkspaceID string `json:"workspace_id"`
+	// UserID is the ID of the member.
+	UserID string `json:"user_id"`
+	// Role is the role of the member, it decides what the member may do with the links of the workspace.
+	Role workspace.Role `json:"role"`
+	// AddedAt is the time the user joined the workspace or got the current role.
+	AddedAt time.Time `json:"added_at"`
+}
+
+// UserWorkspace is a workspace as seen by one of its members.
+type UserWorkspace struct {
+	Workspace
+	// Role is the role of the member in the workspace.
+	Role workspace.Role `json:"role"`
+}
+
+// LinkFilter selects links in an admin search, empty fields match every link.
+type LinkFilter struct {
+	// Alias matches links whose alias starts with the value.
+	Alias string
+	// Domain matches links to the host or its subdomains.
+	Domain string
+	// OwnerID matches links of the user or workspace.
+	OwnerID string
+	// Limit is the maximum number of links returned.
+	Limit int
+}
+
+// LinkRecord is a link of any owner as seen by operators.
+type LinkRecord struct {
+	// Alias is the short URL path/alias.
+	Alias string `json:"alias"`
+	// ShortURL is the generated short URL.
+	ShortURL string `json:"short_url"`
+	// OriginalURL is the original URL that was shortened.
+	OriginalURL string `json:"original_url"`
+	// OwnerID is the ID of the user or workspace owning the link.
+	OwnerID string `json:"owner_id"`
+	// IsDeleted indicates if the link has been deleted by its owner.
+	IsDeleted bool `json:"is_deleted"`
+	// Clicks is the number of successful redirects.
+	Clicks int `json:"clicks"`
+	// DisabledStatus is the status code served instead of the redirect, omitted while the link is enabled.
+	DisabledStatus int `json:"disabled_status,omitempty"`
+	// DisabledReason is the note left by the operator who disabled the link.
+	DisabledReason string `json:"disabled_reason,omitempty"`
+	// Quarantined indicates if the redirect shows a warning because of abuse reports.
+	Quarantined bool `json:"quarantined,omitempty"`
+}
+
+// OwnerStats holds the link counts of a user or workspace.
+type OwnerStats struct {
+	// OwnerID is the ID of the user or workspace.
+	OwnerID string `json:"owner_id"`
+	// Active is the number of links that are neither deleted nor disabled.
+	Active int `json:"active"`
+	// Deleted is the number of deleted links.
+	Deleted int `json:"deleted"`
+	// Disabled is the number of links disabled by operators and not deleted.
+	Disabled int `json:"disabled"`
+	// Clicks is the number of redirects served by all links of the owner.
+	Clicks int `json:"clicks"`
+}
+
+// AuditEntry records an action taken through the admin API.
+type AuditEntry struct {
+	// ID is the unique identifier of the entry.
+	ID string `json:"id"`
+	// Actor identifies the operator: "token" for the admin credential or "user:<login>".
+	Actor string `json:"actor"`
+	// Action is the name of the action.
+	Action string `json:"action"`
+	// Target is the alias or ID the action was applied to, empty for searches and reports.
+	Target string `json:"target,omitempty"`
+	// Details holds the parameters of the action.
+	Details map[string]string `json:"details,omitempty"`
+	// CreatedAt is the time of the action.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Report statuses
+const (
+	// ReportOpen marks a report waiting for review.
+	ReportOpen = "open"
+	// ReportDismissed marks a report an operator found unfounded.
+	ReportDismissed = "dismissed"
+	// ReportActioned marks a report that got the link disabled.
+	ReportActioned = "actioned"
+)
+
+// Report is an abuse report filed against a link.
+type Report struct {
+	// ID is the unique identifier of the report.
+	ID string `json:"id"`
+	// Alias is the short URL path/alias of the reported link.
+	Alias string `json:"alias"`
+	// Category is the kind of abuse: phishing, spam, malware or other.
+	Category string `json:"category"`
+	// Reason is the description given by the reporter.
+	Reason string `json:"reason,omitempty"`
+	// Reporter is a hash identifying the reporter, every reporter counts once towards the quarantine threshold.
+	Reporter string `json:"reporter"`
+	// Status is the review status of the report.
+	Status string `json:"status"`
+	// CreatedAt is the time the report was filed.
+	CreatedAt time.Time `json:"created_at"`
+	// ResolvedAt is the time the report was reviewed, nil while the report is open.
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	// ResolvedBy identifies the operator who reviewed the report.
+	ResolvedBy string `json:"resolved_by,omitempty"`
+}
+
+// LinkOptions holds the optional settings supplied when a link is created.
+type LinkOptions struct {
+	// MaxClicks limits the number of successful redirects, zero means unlimited.
+	MaxClicks int
+	// Variants lists the weighted destinations of a split link, the visits are shared between them.
+	Variants []split.Variant
+	// PassQuery enables merging the query parameters of the short URL into the redirect target.
+	PassQuery bool
+	// UTM holds the campaign parameters appended to the redirect target.
+	UTM querymerge.UTM
+	// RedirectStatus overrides the server-wide redirect status code, zero means the server default.
+	RedirectStatus int
+	// SubmittedURL is the URL as submitted by the client, empty if it equals the stored canonical URL.
+	SubmittedURL string
+}
+
+// Link represents a stored short link as seen by the redirect handler.
+type Link struct {
+	// Alias is the short URL path/alias.
+	Alias string
+	// OriginalURL is the original URL that was shortened.
+	OriginalURL string
+	// Options holds the optional settings the link was created with.
+	Options LinkOptions
+	// Clicks is the number of successful redirects, including the current one.
+	Clicks int
+	// Rules lists the conditional redirect rules of the link, evaluated in order.
+	Rules []rules.Rule
+	// Quarantined indicates if the link is quarantined by abuse reports, such a visit is not counted.
+	Quarantined bool
+}
+
+// Quota limits the links an owner may create, zero fields are unlimited.
+type Quota struct {
+	// MaxActiveLinks is the maximum number of links of an owner that are not deleted.
+	MaxActiveLinks int `json:"max_active_links"`
+	// MaxLinksPerDay is the maximum number of links an owner creates per UTC day.
+	MaxLinksPerDay int `json:"max_links_per_day"`
+}
+
+// Usage holds the links of an owner counted against the quota.
+type Usage struct {
+	// ActiveLinks is the number of links that are not deleted.
+	ActiveLinks int `json:"active_links"`
+	// LinksToday is the number of links created since the start of the current UTC day.
+	LinksToday int `json:"links_today"`
+}
+
+// URLMapping represents a single URL mapping kept by the memory and file repositories.
+// The file repository persists it as one JSON line per change.
+type URLMapping struct {
+	// ID is the unique identifier of the URL mapping.
+	ID string `json:"id"`
+	// UserID is the ID of the user or workspace owning the URL mapping.
+	UserID string `json:"user_id,omitempty"`
+	// ShortURL is the generated short URL path.
+	ShortURL string `json:"short_url"`
+	// OriginalURL is the original URL that was shortened.
+	OriginalURL string `json:"original_url"`
+	// SubmittedURL is the URL as submitted by the client, empty if it equals OriginalURL.
+	SubmittedURL string `json:"submitted_url,omitempty"`
+	// IsDeleted indicates if the URL has been marked as deleted.
+	IsDeleted bool `json:"is_deleted,omitempty"`
+	// MaxClicks limits the number of successful redirects, zero means unlimited.
+	MaxClicks int `json:"max_clicks,omitempty"`
+	// Clicks is the number of successful redirects.
+	Clicks int `json:"clicks,omitempty"`
+	// Rules lists the conditional redirect rules of the link.
+	Rules []rules.Rule `json:"rules,omitempty"`
+	// Variants lists the weighted destinations of a split link with their click counts.
+	Variants []split.Variant `json:"variants,omitempty"`
+	// PassQuery enables merging the query parameters of the short URL into the redirect target.
+	PassQuery bool `json:"pass_query,omitempty"`
+	// UTM holds the campaign parameters appended to the redirect target, nil if none are configured.
+	UTM *querymerge.UTM `json:"utm,omitempty"`
+	// RedirectStatus overrides the server-wide redirect status code, zero means the server default.
+	RedirectStatus int `json:"redirect_status,omitempty"`
+	// LastStatus is the status code of the latest dead-link check, zero if the target was unreachable.
+	LastStatus int `json:"last_status,omitempty"`
+	// CheckedAt is the time of the latest dead-link check, nil if the link was never checked.
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	// DisabledStatus is the status code served instead of the redirect, zero while the link is enabled.
+	DisabledStatus int `json:"disabled_status,omitempty"`
+	// DisabledReason is the note left by the operator who disabled the link.
+	DisabledReason string `json:"disabled_reason,omitempty"`
+	// CreatedAt is the time the link was created, zero for links stored before it was recorded.
+	CreatedAt time.Time `json:"created_at"`
+	// Quarantined indicates if the redirect shows a warning because of abuse reports.
+	Quarantined bool `json:"quarantined,omitempty"`
+}
+
+// available returns ErrURLDeleted if the mapping is deleted and a DisabledError if an operator disabled it.
+func (m *URLMapping) available() error {
+	if m.IsDeleted {
+		return ErrURLDeleted
+	}
+	if m.DisabledStatus != 0 {
+		return &DisabledError{StatusCode: m.DisabledStatus, Reason: m.DisabledReason}
+	}
+	return nil
+}
+
+// visit counts a redirect of the mapping and marks it as deleted once its click limit is used up.
+// It returns ErrURLDeleted if the mapping is already deleted and a DisabledError if it is disabled.
+// A visit of a quarantined mapping is not counted. Callers must hold the repository lock.
+func (m *URLMapping) visit() (Link, error) {
+	if err := m.available(); err != nil {
+		return Link{}, err
+	}
+	if m.Quarantined {
+		return m.link(), nil
+	}
+	m.Clicks++
+	if m.MaxClicks > 0 && m.Clicks >= m.MaxClicks {
+		m.IsDeleted = true
+	}
+	return m.link(), nil
+}
+
+// link converts the mapping to a Link.
+func (m *URLMapping) link() Link {
+	link := Link{
+		Alias:       m.ShortURL,
+		OriginalURL: m.OriginalURL,
+		Options: LinkOptions{
+			MaxClicks:      m.MaxClicks,
+			Variants:       m.Variants,
+			PassQuery:      m.PassQuery,
+			RedirectStatus: m.RedirectStatus,
+		},
+		Clicks:      m.Clicks,
+		Rules:       m.Rules,
+		Quarantined: m.Quarantined,
+	}
+	if m.UTM != nil {
+		link.Options.UTM = *m.UTM
+	}
+	return link
+}
+
+// output converts the mapping to a URLOutput for the user's URL list.
+func (m *URLMapping) output(baseURL string) URLOutput {
+	return URLOutput{
+		ShortURL:       baseURL + "/" + m.ShortURL,
+		OriginalURL:    m.OriginalURL,
+		SubmittedURL:   m.SubmittedURL,
+		Variants:       m.Variants,
+		RedirectStatus: m.RedirectStatus,
+		LastStatus:     m.LastStatus,
+		CheckedAt:      m.CheckedAt,
+	}
+}
+
+// checkTargets returns up to limit active mappings that were never checked or last checked before the given moment.
+// Mappings that were never checked come first, then the ones with the oldest check.
+// Callers must hold the repository lock.
+func checkTargets(records map[string]*URLMapping, checkedBefore time.Time, limit int) []CheckTarget {
+	stale := make([]*URLMapping, 0)
+	for _, record := range records {
+		if record.IsDeleted {
+			continue
+		}
+		if record.CheckedAt == nil || record.CheckedAt.Before(checkedBefore) {
+			stale = append(stale, record)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool {
+		if stale[i].CheckedAt == nil || stale[j].CheckedAt == nil {
+			return stale[i].CheckedAt == nil && stale[j].CheckedAt != nil
+		}
+		return stale[i].CheckedAt.Before(*stale[j].CheckedAt)
+	})
+	if limit > 0 && len(stale) > limit {
+		stale = stale[:limit]
+	}
+
+	res := make([]CheckTarget, len(stale))
+	for i, record := range stale {
+		res[i] = CheckTarget{
+			Alias:       record.ShortURL,
+			OriginalURL: record.OriginalURL,
+		}
+	}
+	return res
+}
+
+// trackVariant counts a redirect served by the variant of the mapping.
+// Callers must hold the repository lock.
+func (m *URLMapping) trackVariant(variant int) error {
+	if variant < 0 || variant >= len(m.Variants) {
+		return ErrVariantNotFound
+	}
+	variants := make([]split.Variant, len(m.Variants))
+	copy(variants, m.Variants)
+	variants[variant].Clicks++
+	m.Variants = variants
+	return nil
+}
+
+// findOwned returns the mapping of the alias if it belongs to the user and is not deleted.
+func findOwned(records map[string]*URLMapping, alias, userID string) (*URLMapping, error) {
+	record, exists := records[alias]
+	if !exists || record.UserID != userID {
+		return nil, ErrShortURLNotFound
+	}
+	if record.IsDeleted {
+		return nil, ErrURLDeleted
+	}
+	return record, nil
+}
+
+// findByOriginalURL returns the mapping of the original URL, deleted mappings included.
+// Original URLs are unique across all owners, like in the PostgreSQL schema.
+func findByOriginalURL(records map[string]*URLMapping, originalURL string) (*URLMapping, bool) {
+	for _, record := range records {
+		if record.OriginalURL == originalURL {
+			return record, true
+		}
+	}
+	return nil, false
 }
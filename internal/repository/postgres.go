@@ -3,12 +3,19 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/pkg/querymerge"
 	"github.com/aifedorov/shortener/internal/pkg/random"
+	"github.com/aifedorov/shortener/internal/pkg/rules"
+	"github.com/aifedorov/shortener/internal/pkg/split"
+	"github.com/aifedorov/shortener/internal/pkg/workspace"
 	"github.com/google/uuid"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -26,6 +33,10 @@ type PostgresRepository struct {
 	dsn string
 	// rand is used for generating random short URL identifiers.
 	rand random.Randomizer
+	// quota limits the links stored per owner.
+	quota Quota
+	// mu provides thread-safe access to the quota.
+	mu sync.RWMutex
 }
 
 // Model represents a URL mapping model for database operations.
@@ -39,10 +50,34 @@ type Model struct {
 	alias string
 	// originalURL is the original URL that was shortened.
 	originalURL string
+	// submittedURL is the URL as submitted by the client, NULL if it equals originalURL.
+	submittedURL sql.NullString
 	// baseURL is the base URL used for generating short URLs.
 	baseURL string
 	// isDeleted indicates if the URL has been marked as deleted.
 	isDeleted bool
+	// maxClicks limits the number of successful redirects, zero means unlimited.
+	maxClicks int
+	// clicks is the number of successful redirects.
+	clicks int
+	// rules is the JSON encoded list of conditional redirect rules.
+	rules []byte
+	// variants is the JSON encoded list of weighted destinations.
+	variants []byte
+	// passQuery enables merging the query parameters of the short URL into the redirect target.
+	passQuery bool
+	// utm is the JSON encoded set of campaign parameters.
+	utm []byte
+	// redirectStatus is the redirect status code of the link, zero means the server default.
+	redirectStatus int
+	// lastStatus is the status code of the latest dead-link check.
+	lastStatus int
+	// checkedAt is the time of the latest dead-link check, NULL if the link was never checked.
+	checkedAt sql.NullTime
+	// disabledStatus is the status code served instead of the redirect, zero while the link is enabled.
+	disabledStatus int
+	// disabledReason is the note left by the operator who disabled the link.
+	disabledReason sql.NullString
 }
 
 // NewPosgresRepository creates a new PostgreSQL repository instance.
@@ -107,12 +142,40 @@ func (p *PostgresRepository) Get(shortURL string) (string, error) {
 	if errors.Is(err, ErrURLDeleted) {
 		return "", ErrURLDeleted
 	}
+	if errors.Is(err, ErrLinkQuarantined) {
+		return "", ErrLinkQuarantined
+	}
+	var dErr *DisabledError
+	if errors.As(err, &dErr) {
+		return "", dErr
+	}
 	if err != nil {
 		return "", errors.New("failed to get original URL")
 	}
 	return oURL, nil
 }
 
+// Resolve retrieves the link for a given short URL from the PostgreSQL database and counts the redirect.
+// The click counter is updated with a single conditional UPDATE, so concurrent redirects
+// can never exceed the click limit of the link.
+func (p *PostgresRepository) Resolve(shortURL string) (Link, error) {
+	link, err := p.resolve(shortURL)
+	if errors.Is(err, ErrShortURLNotFound) {
+		return Link{}, ErrShortURLNotFound
+	}
+	if errors.Is(err, ErrURLDeleted) {
+		return Link{}, ErrURLDeleted
+	}
+	var dErr *DisabledError
+	if errors.As(err, &dErr) {
+		return Link{}, dErr
+	}
+	if err != nil {
+		return Link{}, errors.New("failed to resolve short URL")
+	}
+	return link, nil
+}
+
 // GetAll retrieves all URLs belonging to a specific user from the PostgreSQL database.
 func (p *PostgresRepository) GetAll(userID, baseURL string) ([]URLOutput, error) {
 	res, err := p.fetchURs(userID, baseURL)
@@ -126,8 +189,8 @@ func (p *PostgresRepository) GetAll(userID, baseURL string) ([]URLOutput, error)
 }
 
 // Store saves a new URL to the PostgreSQL database and returns the generated short URL.
-func (p *PostgresRepository) Store(userID, baseURL, targetURL string) (string, error) {
-	return p.store(userID, baseURL, targetURL)
+func (p *PostgresRepository) Store(userID, baseURL, targetURL string, opts LinkOptions) (string, error) {
+	return p.store(userID, baseURL, targetURL, opts)
 }
 
 // StoreBatch saves multiple URLs to the PostgreSQL database in a single operation.
@@ -135,19 +198,27 @@ func (p *PostgresRepository) StoreBatch(userID, baseURL string, urls []BatchURLI
 	return p.storeBatch(userID, baseURL, urls)
 }
 
+// SetQuota sets the quota enforced by Store and StoreBatch.
+func (p *PostgresRepository) SetQuota(quota Quota) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.quota = quota
+}
+
+// GetUsage counts the links of the owner in the PostgreSQL database against the quota.
+func (p *PostgresRepository) GetUsage(userID string) (Usage, error) {
+	return p.fetchUsage(userID)
+}
+
 // DeleteBatch marks multiple URLs as deleted for a specific user in the PostgreSQL database.
 func (p *PostgresRepository) DeleteBatch(userID string, aliases []string) error {
 	return p.deleteBatch(userID, aliases)
 }
 
-func (p *PostgresRepository) createTable() error {
-	tx, err := p.db.BeginTx(p.ctx, nil)
-	if err != nil {
-		logger.Log.Error("postgres: failed to create table", zap.Error(err))
-		return err
-	}
-
-	query := `CREATE TABLE IF NOT EXISTS urls (
+// migrations lists the schema statements executed on start, in order.
+// New columns are added with ADD COLUMN IF NOT EXISTS so existing databases are upgraded in place.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS urls (
     		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     		cid CHAR(36) NOT NULL,
     		user_id CHAR(36) NOT NULL,
@@ -156,20 +227,268 @@ func (p *PostgresRepository) createTable() error {
 		 	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		 	is_deleted BOOLEAN DEFAULT FALSE,
             UNIQUE (user_id, original_url)
-		);
-		`
-	ctx, cancel := context.WithTimeout(p.ctx, defaultDBTimeout)
-	defer cancel()
+		);`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS max_clicks INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS clicks INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS rules JSONB;`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS variants JSONB;`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS pass_query BOOLEAN NOT NULL DEFAULT FALSE;`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS utm JSONB;`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS redirect_status INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS last_status INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS checked_at TIMESTAMPTZ;`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS submitted_url TEXT;`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS disabled_status INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS disabled_reason TEXT;`,
+	`CREATE TABLE IF NOT EXISTS api_keys (
+			id UUID PRIMARY KEY,
+			user_id CHAR(36) NOT NULL,
+			name TEXT NOT NULL,
+			prefix TEXT NOT NULL,
+			key_hash TEXT NOT NULL UNIQUE,
+			created_at TIMESTAMPTZ NOT NULL,
+			revoked_at TIMESTAMPTZ
+		);`,
+	`CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);`,
+	`CREATE TABLE IF NOT EXISTS users (
+			id UUID PRIMARY KEY,
+			login TEXT NOT NULL UNIQUE,
+			password_hash TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL
+		);`,
+	`CREATE TABLE IF NOT EXISTS link_merges (
+			id UUID PRIMARY KEY,
+			from_user_id CHAR(36) NOT NULL,
+			to_user_id CHAR(36) NOT NULL,
+			moved JSONB NOT NULL,
+			skipped JSONB NOT NULL,
+			merged_at TIMESTAMPTZ NOT NULL
+		);`,
+	`CREATE TABLE IF NOT EXISTS workspaces (
+			id UUID PRIMARY KEY,
+			name TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL
+		);`,
+	`CREATE TABLE IF NOT EXISTS workspace_members (
+			workspace_id UUID NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+			user_id CHAR(36) NOT NULL,
+			role TEXT NOT NULL,
+			added_at TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (workspace_id, user_id)
+		);`,
+	`CREATE INDEX IF NOT EXISTS workspace_members_user_id_idx ON workspace_members (user_id);`,
+	`CREATE TABLE IF NOT EXISTS audit_log (
+			id UUID PRIMARY KEY,
+			actor TEXT NOT NULL,
+			action TEXT NOT NULL,
+			target TEXT,
+			details JSONB,
+			created_at TIMESTAMPTZ NOT NULL
+		);`,
+	`CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at);`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS quarantined BOOLEAN NOT NULL DEFAULT FALSE;`,
+	`CREATE TABLE IF NOT EXISTS reports (
+			id UUID PRIMARY KEY,
+			alias TEXT NOT NULL,
+			category TEXT NOT NULL,
+			reason TEXT,
+			reporter TEXT NOT NULL,
+			status TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			resolved_at TIMESTAMPTZ,
+			resolved_by TEXT
+		);`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS reports_open_reporter_idx ON reports (alias, reporter) WHERE status = 'open';`,
+	`CREATE INDEX IF NOT EXISTS reports_created_at_idx ON reports (created_at);`,
+}
+
+// GetRules retrieves the conditional redirect rules of a link owned by the user from the PostgreSQL database.
+func (p *PostgresRepository) GetRules(userID, alias string) ([]rules.Rule, error) {
+	return p.fetchRules(userID, alias)
+}
+
+// SetRules replaces the conditional redirect rules of a link owned by the user in the PostgreSQL database.
+func (p *PostgresRepository) SetRules(userID, alias string, linkRules []rules.Rule) error {
+	return p.updateRules(userID, alias, linkRules)
+}
+
+// TrackVariant counts a redirect served by the variant of a split link in the PostgreSQL database.
+// The counter is incremented inside the JSON document with a single UPDATE.
+func (p *PostgresRepository) TrackVariant(alias string, variant int) error {
+	return p.incrementVariantClicks(alias, variant)
+}
+
+// GetCheckTargets returns up to limit active links from the PostgreSQL database that are due for a dead-link check.
+func (p *PostgresRepository) GetCheckTargets(checkedBefore time.Time, limit int) ([]CheckTarget, error) {
+	return p.fetchCheckTargets(checkedBefore, limit)
+}
+
+// SaveCheckResult records the outcome of the latest dead-link check of a link in the PostgreSQL database.
+func (p *PostgresRepository) SaveCheckResult(alias string, result CheckResult) error {
+	return p.updateCheckResult(alias, result)
+}
+
+// StoreAPIKey saves a new API key to the PostgreSQL database.
+func (p *PostgresRepository) StoreAPIKey(key APIKey) error {
+	return p.insertAPIKey(key)
+}
+
+// GetAPIKeys retrieves the active API keys of a user from the PostgreSQL database.
+func (p *PostgresRepository) GetAPIKeys(userID string) ([]APIKey, error) {
+	return p.fetchAPIKeys(userID)
+}
+
+// RevokeAPIKey revokes an active API key of a user in the PostgreSQL database.
+func (p *PostgresRepository) RevokeAPIKey(userID, keyID string, revokedAt time.Time) error {
+	return p.updateAPIKeyRevoked(userID, keyID, revokedAt)
+}
+
+// GetAPIKeyUser returns the owner of the active API key with the given hash from the PostgreSQL database.
+func (p *PostgresRepository) GetAPIKeyUser(keyHash string) (string, error) {
+	return p.fetchAPIKeyUser(keyHash)
+}
+
+// CreateUser saves a new registered user to the PostgreSQL database.
+func (p *PostgresRepository) CreateUser(user User) error {
+	return p.insertUser(user)
+}
+
+// GetUserByLogin retrieves the registered user with the given login from the PostgreSQL database.
+func (p *PostgresRepository) GetUserByLogin(login string) (User, error) {
+	return p.fetchUserByLogin(login)
+}
+
+// GetUserByID retrieves the registered user with the given ID from the PostgreSQL database.
+func (p *PostgresRepository) GetUserByID(userID string) (User, error) {
+	return p.fetchUserByID(userID)
+}
+
+// MergeLinks moves the active links of an anonymous user to a registered account in the PostgreSQL database.
+// The links are moved and the merge is recorded in a single transaction.
+func (p *PostgresRepository) MergeLinks(fromUserID, toUserID string, mergedAt time.Time) (LinkMerge, error) {
+	return p.mergeLinks(fromUserID, toUserID, mergedAt)
+}
+
+// CreateWorkspace saves a new workspace with the user as its owner to the PostgreSQL database.
+func (p *PostgresRepository) CreateWorkspace(ws Workspace, ownerID string) error {
+	return p.insertWorkspace(ws, ownerID)
+}
+
+// GetWorkspaces retrieves the workspaces the user is a member of from the PostgreSQL database.
+func (p *PostgresRepository) GetWorkspaces(userID string) ([]UserWorkspace, error) {
+	return p.fetchWorkspaces(userID)
+}
+
+// GetMembers retrieves the members of a workspace from the PostgreSQL database.
+func (p *PostgresRepository) GetMembers(workspaceID string) ([]Member, error) {
+	return p.fetchMembers(workspaceID)
+}
+
+// GetMemberRole returns the role of the user in the workspace from the PostgreSQL database.
+func (p *PostgresRepository) GetMemberRole(workspaceID, userID string) (workspace.Role, error) {
+	return p.fetchMemberRole(workspaceID, userID)
+}
+
+// SetMember adds a member to a workspace or changes the role of a member in the PostgreSQL database.
+// The members of the workspace are locked while the owner check runs.
+func (p *PostgresRepository) SetMember(member Member) error {
+	return p.upsertMember(member)
+}
+
+// RemoveMember removes a member from a workspace in the PostgreSQL database.
+func (p *PostgresRepository) RemoveMember(workspaceID, userID string) error {
+	return p.deleteMember(workspaceID, userID)
+}
 
-	_, err = tx.ExecContext(ctx, query)
+// SearchLinks returns the links of all owners matching the filter from the PostgreSQL database.
+func (p *PostgresRepository) SearchLinks(filter LinkFilter, baseURL string) ([]LinkRecord, error) {
+	return p.searchLinks(filter, baseURL)
+}
+
+// SetLinkDisabled disables or enables a link and records the audit entry in one PostgreSQL transaction.
+func (p *PostgresRepository) SetLinkDisabled(alias string, statusCode int, reason string, entry AuditEntry) error {
+	return p.updateLinkDisabled(alias, statusCode, reason, entry)
+}
+
+// ReassignLink moves a link to another owner and records the audit entry in one PostgreSQL transaction.
+func (p *PostgresRepository) ReassignLink(alias, ownerID string, entry AuditEntry) (string, error) {
+	return p.updateLinkOwner(alias, ownerID, entry)
+}
+
+// GetOwnerStats returns the link counts of every owner from the PostgreSQL database.
+func (p *PostgresRepository) GetOwnerStats() ([]OwnerStats, error) {
+	return p.fetchOwnerStats()
+}
+
+// AppendAudit records an admin action in the PostgreSQL database.
+func (p *PostgresRepository) AppendAudit(entry AuditEntry) error {
+	return p.insertAudit(p.db, entry)
+}
+
+// GetAuditLog returns the latest audit log entries from the PostgreSQL database.
+func (p *PostgresRepository) GetAuditLog(limit int) ([]AuditEntry, error) {
+	return p.fetchAuditLog(limit)
+}
+
+// AddReport files an abuse report against a link in the PostgreSQL database.
+func (p *PostgresRepository) AddReport(report Report, threshold int) (bool, error) {
+	return p.insertReport(report, threshold)
+}
+
+// GetReports returns the latest reports with the status from the PostgreSQL database.
+func (p *PostgresRepository) GetReports(status string, limit int) ([]Report, error) {
+	return p.fetchReports(status, limit)
+}
+
+// ResolveReports closes the open reports against a link, lifts its quarantine and records the audit entry
+// in one PostgreSQL transaction.
+func (p *PostgresRepository) ResolveReports(alias, status string, entry AuditEntry) (int, error) {
+	return p.updateReportsResolved(alias, status, entry)
+}
+
+func (p *PostgresRepository) createTable() error {
+	tx, err := p.db.BeginTx(p.ctx, nil)
 	if err != nil {
 		logger.Log.Error("postgres: failed to create table", zap.Error(err))
-		return tx.Rollback()
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(p.ctx, defaultDBTimeout)
+	defer cancel()
+
+	for _, query := range migrations {
+		_, err = tx.ExecContext(ctx, query)
+		if err != nil {
+			logger.Log.Error("postgres: failed to create table", zap.Error(err))
+			return tx.Rollback()
+		}
 	}
 	return tx.Commit()
 }
 
-func (p *PostgresRepository) store(userID, baseURL, targetURL string) (string, error) {
+func (p *PostgresRepository) store(userID, baseURL, targetURL string, opts LinkOptions) (string, error) {
+	tx, err := p.db.BeginTx(p.ctx, nil)
+	if err != nil {
+		logger.Log.Error("postgres: failed to begin transaction", zap.Error(err))
+		return "", errors.New("failed to begin transaction")
+	}
+	defer rollback(tx)
+
+	shortURL, err := p.storeTx(tx, userID, baseURL, targetURL, opts)
+	if err != nil {
+		return "", err
+	}
+	if err := p.checkQuota(tx, userID, 1); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Log.Error("postgres: failed to commit transaction", zap.Error(err))
+		return "", errors.New("failed to commit transaction")
+	}
+	return shortURL, nil
+}
+
+func (p *PostgresRepository) storeTx(tx *sql.Tx, userID, baseURL, targetURL string, opts LinkOptions) (string, error) {
 	if targetURL == "" {
 		logger.Log.Error("postgres: target URL is empty")
 		return "", errors.New("target URL is empty")
@@ -182,12 +501,27 @@ func (p *PostgresRepository) store(userID, baseURL, targetURL string) (string, e
 		return "", errors.New("failed to generate random string")
 	}
 
-	shortURL, err := p.insert(Model{
-		userID:      userID,
-		cid:         uuid.NewString(),
-		alias:       alias,
-		originalURL: targetURL,
-		baseURL:     baseURL,
+	variants, err := encodeVariants(opts.Variants)
+	if err != nil {
+		return "", err
+	}
+	utm, err := encodeUTM(opts.UTM)
+	if err != nil {
+		return "", err
+	}
+
+	shortURL, err := p.insert(tx, Model{
+		userID:         userID,
+		cid:            uuid.NewString(),
+		alias:          alias,
+		originalURL:    targetURL,
+		submittedURL:   sql.NullString{String: opts.SubmittedURL, Valid: opts.SubmittedURL != ""},
+		baseURL:        baseURL,
+		maxClicks:      opts.MaxClicks,
+		variants:       variants,
+		passQuery:      opts.PassQuery,
+		utm:            utm,
+		redirectStatus: opts.RedirectStatus,
 	})
 	var cErr *ConflictError
 	if errors.As(err, &cErr) {
@@ -199,37 +533,44 @@ func (p *PostgresRepository) store(userID, baseURL, targetURL string) (string, e
 	return shortURL, nil
 }
 
+// storeBatch stores the URLs in a single transaction, an exceeded quota stores none of them.
+// Conflicting URLs are reported with their existing short URL and do not count against the quota,
+// a URL listed more than once is stored for its first item and the later ones report that link as existing.
 func (p *PostgresRepository) storeBatch(userID, baseURL string, urls []BatchURLInput) ([]BatchURLOutput, error) {
 	if len(urls) == 0 {
 		return nil, errors.New("urls is empty")
 	}
 
 	logger.Log.Debug("postgres: begin transaction for storing batch of urls")
-	tx, err := p.db.Begin()
+	tx, err := p.db.BeginTx(p.ctx, nil)
 	if err != nil {
 		logger.Log.Error("postgres: failed to begin transaction", zap.Error(err))
-		err := tx.Rollback()
-		if err != nil {
-			logger.Log.Error("postgres: failed to rollback transaction", zap.Error(err))
-			return nil, errors.New("failed to rollback transaction")
-		}
 		return nil, errors.New("failed to begin transaction")
 	}
+	defer rollback(tx)
 
 	logger.Log.Debug("postgres: storing batch of urls", zap.Int("count", len(urls)))
 	res := make([]BatchURLOutput, len(urls))
+	first := make(map[string]int, len(urls))
+	stored := 0
 	for i, url := range urls {
-		shortURL, err := p.store(userID, baseURL, url.OriginalURL)
+		if j, ok := first[url.OriginalURL]; ok {
+			res[i] = BatchURLOutput{CID: url.CID, ShortURL: res[j].ShortURL, Existing: true}
+			continue
+		}
+		first[url.OriginalURL] = i
+
+		shortURL, err := p.storeTx(tx, userID, baseURL, url.OriginalURL, url.Options)
 		var cErr *ConflictError
 		if errors.As(err, &cErr) {
-			return nil, cErr
+			res[i] = BatchURLOutput{
+				CID:      url.CID,
+				ShortURL: cErr.ShortURL,
+				Existing: true,
+			}
+			continue
 		}
 		if err != nil {
-			err := tx.Rollback()
-			if err != nil {
-				logger.Log.Error("postgres: failed to rollback transaction", zap.Error(err))
-				return nil, errors.New("failed to rollback transaction")
-			}
 			return nil, errors.New("failed to storing batch of urls")
 		}
 
@@ -238,26 +579,78 @@ func (p *PostgresRepository) storeBatch(userID, baseURL string, urls []BatchURLI
 			ShortURL: shortURL,
 		}
 		res[i] = ou
+		stored++
+	}
+	if stored > 0 {
+		if err := p.checkQuota(tx, userID, stored); err != nil {
+			return nil, err
+		}
 	}
 
 	logger.Log.Debug("postgres: commiting transaction for storing batch of urls")
-	return res, tx.Commit()
+	if err := tx.Commit(); err != nil {
+		logger.Log.Error("postgres: failed to commit transaction", zap.Error(err))
+		return nil, errors.New("failed to commit transaction")
+	}
+	return res, nil
 }
 
-func (p *PostgresRepository) fetchAliasWithUserID(userID, originalURL string) (string, error) {
-	var alias string
-	row := p.db.QueryRowContext(p.ctx, "SELECT alias FROM urls WHERE original_url = $1 AND user_id = $2", originalURL, userID)
-	err := row.Scan(&alias)
+// checkQuota returns a QuotaError if the links of the owner, including the n links inserted by the transaction,
+// exceed the quota. Transactions storing links of the same owner are serialized by an advisory lock,
+// so concurrent requests cannot exceed the quota together.
+func (p *PostgresRepository) checkQuota(tx *sql.Tx, userID string, n int) error {
+	p.mu.RLock()
+	quota := p.quota
+	p.mu.RUnlock()
+	if quota.IsZero() {
+		return nil
+	}
 
-	if errors.Is(err, sql.ErrNoRows) {
-		logger.Log.Debug("postgres: alias not found for user_id", zap.String("original_url", originalURL), zap.String("user_id", userID))
-		return "", ErrShortURLNotFound
+	if _, err := tx.ExecContext(p.ctx, "SELECT pg_advisory_xact_lock(hashtext($1));", userID); err != nil {
+		logger.Log.Error("postgres: failed to lock quota", zap.String("user_id", userID), zap.Error(err))
+		return errors.New("failed to lock quota")
 	}
+	usage, err := queryUsage(p.ctx, tx, userID, time.Now())
 	if err != nil {
-		logger.Log.Error("postgres: failed to fetch data", zap.Error(err))
-		return "", errors.New("failed to fetch data")
+		return err
 	}
-	return alias, nil
+	usage.ActiveLinks -= n
+	usage.LinksToday -= n
+	return quota.check(usage, n)
+}
+
+func (p *PostgresRepository) fetchUsage(userID string) (Usage, error) {
+	return queryUsage(p.ctx, p.db, userID, time.Now())
+}
+
+// queryUsage counts the links of the owner against the quota.
+func queryUsage(ctx context.Context, q querier, userID string, now time.Time) (Usage, error) {
+	query := `SELECT COUNT(*) FILTER (WHERE NOT is_deleted), COUNT(*) FILTER (WHERE created::timestamptz >= $2)
+			FROM urls WHERE user_id = $1;`
+	rows, err := q.QueryContext(ctx, query, userID, DayStart(now))
+	if err != nil {
+		logger.Log.Error("postgres: failed to count usage", zap.String("user_id", userID), zap.Error(err))
+		return Usage{}, errors.New("failed to count usage")
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("postgres: failed to close rows", zap.Error(err))
+		}
+	}()
+
+	var usage Usage
+	if rows.Next() {
+		if err := rows.Scan(&usage.ActiveLinks, &usage.LinksToday); err != nil {
+			logger.Log.Error("postgres: failed to count usage", zap.String("user_id", userID), zap.Error(err))
+			return Usage{}, errors.New("failed to count usage")
+		}
+	}
+	if err := rows.Err(); err != nil {
+		logger.Log.Error("postgres: failed to count usage", zap.String("user_id", userID), zap.Error(err))
+		return Usage{}, errors.New("failed to count usage")
+	}
+	return usage, nil
 }
 
 func (p *PostgresRepository) fetchAlias(originalURL string) (string, error) {
@@ -290,11 +683,12 @@ func (p *PostgresRepository) fetchOriginalURLWithUserID(userID, alias string) (s
 }
 
 func (p *PostgresRepository) fetchOriginalURL(alias string) (string, error) {
-	query := "SELECT original_url, is_deleted FROM urls WHERE alias = $1"
+	query := "SELECT original_url, is_deleted, disabled_status, disabled_reason, quarantined FROM urls WHERE alias = $1"
 	row := p.db.QueryRowContext(p.ctx, query, alias)
 
 	var model Model
-	err := row.Scan(&model.originalURL, &model.isDeleted)
+	var quarantined bool
+	err := row.Scan(&model.originalURL, &model.isDeleted, &model.disabledStatus, &model.disabledReason, &quarantined)
 	if errors.Is(err, sql.ErrNoRows) {
 		logger.Log.Error("postgres: original url not found", zap.String("alias", alias))
 		return "", ErrShortURLNotFound
@@ -306,67 +700,1150 @@ func (p *PostgresRepository) fetchOriginalURL(alias string) (string, error) {
 	if model.isDeleted {
 		return "", ErrURLDeleted
 	}
+	if model.disabledStatus != 0 {
+		return "", &DisabledError{StatusCode: model.disabledStatus, Reason: model.disabledReason.String}
+	}
+	if quarantined {
+		return "", ErrLinkQuarantined
+	}
 	return model.originalURL, nil
 }
 
-func (p *PostgresRepository) fetchURs(userID, baseURL string) ([]URLOutput, error) {
-	query := "SELECT alias, original_url FROM urls WHERE user_id = $1 AND NOT is_deleted"
-	rows, err := p.db.QueryContext(p.ctx, query, userID)
+func (p *PostgresRepository) resolve(alias string) (Link, error) {
+	// A visit of a quarantined link is not counted.
+	query := `UPDATE urls
+			SET clicks = clicks + CASE WHEN quarantined THEN 0 ELSE 1 END,
+				is_deleted = NOT quarantined AND max_clicks > 0 AND clicks + 1 >= max_clicks
+			WHERE alias = $1 AND NOT is_deleted AND disabled_status = 0
+			RETURNING original_url, max_clicks, clicks, rules, variants, pass_query, utm, redirect_status, quarantined;`
+	row := p.db.QueryRowContext(p.ctx, query, alias)
+
+	model := Model{alias: alias}
+	var quarantined bool
+	err := row.Scan(&model.originalURL, &model.maxClicks, &model.clicks, &model.rules, &model.variants, &model.passQuery, &model.utm,
+		&model.redirectStatus, &quarantined)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Log.Debug("postgres: no active url to resolve", zap.String("alias", alias))
+		// The link is missing, deleted or disabled, or it was deleted by a concurrent redirect.
+		if _, err := p.fetchOriginalURL(alias); err != nil {
+			return Link{}, err
+		}
+		return Link{}, ErrURLDeleted
+	}
 	if err != nil {
-		logger.Log.Error("postgres: failed to fetch urls", zap.String("user_id", userID), zap.Error(err))
-		return nil, errors.New("failed to fetch urls")
+		logger.Log.Error("postgres: failed to resolve url", zap.Error(err))
+		return Link{}, errors.New("failed to resolve url")
+	}
+	linkRules, err := decodeRules(model.rules)
+	if err != nil {
+		return Link{}, err
+	}
+	variants, err := decodeVariants(model.variants)
+	if err != nil {
+		return Link{}, err
+	}
+	utm, err := decodeUTM(model.utm)
+	if err != nil {
+		return Link{}, err
+	}
+	return Link{
+		Alias:       model.alias,
+		OriginalURL: model.originalURL,
+		Options: LinkOptions{
+			MaxClicks:      model.maxClicks,
+			Variants:       variants,
+			PassQuery:      model.passQuery,
+			UTM:            utm,
+			RedirectStatus: model.redirectStatus,
+		},
+		Clicks:      model.clicks,
+		Rules:       linkRules,
+		Quarantined: quarantined,
+	}, nil
+}
+
+func (p *PostgresRepository) fetchRules(userID, alias string) ([]rules.Rule, error) {
+	query := "SELECT rules, is_deleted FROM urls WHERE alias = $1 AND user_id = $2"
+	row := p.db.QueryRowContext(p.ctx, query, alias, userID)
+
+	var model Model
+	err := row.Scan(&model.rules, &model.isDeleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Log.Debug("postgres: url not found for user_id", zap.String("alias", alias), zap.String("user_id", userID))
+		return nil, ErrShortURLNotFound
+	}
+	if err != nil {
+		logger.Log.Error("postgres: failed to fetch rules", zap.Error(err))
+		return nil, errors.New("failed to fetch rules")
+	}
+	if model.isDeleted {
+		return nil, ErrURLDeleted
+	}
+	return decodeRules(model.rules)
+}
+
+func (p *PostgresRepository) updateRules(userID, alias string, linkRules []rules.Rule) error {
+	data, err := json.Marshal(linkRules)
+	if err != nil {
+		logger.Log.Error("postgres: failed to encode rules", zap.Error(err))
+		return errors.New("failed to encode rules")
+	}
+
+	query := "UPDATE urls SET rules = $1 WHERE alias = $2 AND user_id = $3 AND NOT is_deleted"
+	res, err := p.db.ExecContext(p.ctx, query, string(data), alias, userID)
+	if err != nil {
+		logger.Log.Error("postgres: failed to update rules", zap.Error(err))
+		return errors.New("failed to update rules")
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		logger.Log.Error("postgres: failed to update rules", zap.Error(err))
+		return errors.New("failed to update rules")
+	}
+	if affected == 0 {
+		if _, err := p.fetchRules(userID, alias); err != nil {
+			return err
+		}
+		return ErrShortURLNotFound
+	}
+	return nil
+}
+
+func (p *PostgresRepository) incrementVariantClicks(alias string, variant int) error {
+	query := `UPDATE urls
+			SET variants = jsonb_set(variants, ARRAY[$2, 'clicks']::text[],
+				to_jsonb(COALESCE((variants->$3::int->>'clicks')::int, 0) + 1))
+			WHERE alias = $1 AND $3::int >= 0 AND $3::int < jsonb_array_length(variants);`
+	res, err := p.db.ExecContext(p.ctx, query, alias, strconv.Itoa(variant), variant)
+	if err != nil {
+		logger.Log.Error("postgres: failed to track variant", zap.String("alias", alias), zap.Error(err))
+		return errors.New("failed to track variant")
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		logger.Log.Error("postgres: failed to track variant", zap.String("alias", alias), zap.Error(err))
+		return errors.New("failed to track variant")
+	}
+	if affected == 0 {
+		return ErrVariantNotFound
+	}
+	return nil
+}
+
+func (p *PostgresRepository) fetchCheckTargets(checkedBefore time.Time, limit int) ([]CheckTarget, error) {
+	query := `SELECT alias, original_url FROM urls
+			WHERE NOT is_deleted AND (checked_at IS NULL OR checked_at < $1)
+			ORDER BY checked_at NULLS FIRST
+			LIMIT $2;`
+	rows, err := p.db.QueryContext(p.ctx, query, checkedBefore, limit)
+	if err != nil {
+		logger.Log.Error("postgres: failed to fetch check targets", zap.Error(err))
+		return nil, errors.New("failed to fetch check targets")
 	}
 	defer func() {
 		err := rows.Close()
 		if err != nil {
 			logger.Log.Error("postgres: failed to close rows", zap.Error(err))
-			return
 		}
 	}()
 
-	res := make([]URLOutput, 0)
+	res := make([]CheckTarget, 0)
 	for rows.Next() {
-		var record struct {
-			alias       string
-			originalURL string
+		var target CheckTarget
+		if err := rows.Scan(&target.Alias, &target.OriginalURL); err != nil {
+			logger.Log.Error("postgres: failed to fetch check targets", zap.Error(err))
+			return nil, errors.New("failed to fetch check targets")
 		}
+		res = append(res, target)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Log.Error("postgres: failed to fetch check targets", zap.Error(err))
+		return nil, errors.New("failed to fetch check targets")
+	}
+	return res, nil
+}
+
+func (p *PostgresRepository) updateCheckResult(alias string, result CheckResult) error {
+	query := "UPDATE urls SET last_status = $2, checked_at = $3 WHERE alias = $1;"
+	res, err := p.db.ExecContext(p.ctx, query, alias, result.StatusCode, result.CheckedAt)
+	if err != nil {
+		logger.Log.Error("postgres: failed to save check result", zap.String("alias", alias), zap.Error(err))
+		return errors.New("failed to save check result")
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		logger.Log.Error("postgres: failed to save check result", zap.String("alias", alias), zap.Error(err))
+		return errors.New("failed to save check result")
+	}
+	if affected == 0 {
+		return ErrShortURLNotFound
+	}
+	return nil
+}
+
+func (p *PostgresRepository) insertAPIKey(key APIKey) error {
+	query := `INSERT INTO api_keys(id, user_id, name, prefix, key_hash, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6);`
+	_, err := p.db.ExecContext(p.ctx, query, key.ID, key.UserID, key.Name, key.Prefix, key.Hash, key.CreatedAt)
+	if err != nil {
+		logger.Log.Error("postgres: failed to insert api key", zap.String("user_id", key.UserID), zap.Error(err))
+		return errors.New("failed to insert api key")
+	}
+	return nil
+}
 
-		err := rows.Scan(&record.alias, &record.originalURL)
+func (p *PostgresRepository) fetchAPIKeys(userID string) ([]APIKey, error) {
+	query := `SELECT id, name, prefix, created_at FROM api_keys
+			WHERE user_id = $1 AND revoked_at IS NULL
+			ORDER BY created_at;`
+	rows, err := p.db.QueryContext(p.ctx, query, userID)
+	if err != nil {
+		logger.Log.Error("postgres: failed to fetch api keys", zap.String("user_id", userID), zap.Error(err))
+		return nil, errors.New("failed to fetch api keys")
+	}
+	defer func() {
+		err := rows.Close()
 		if err != nil {
-			logger.Log.Error("postgres: failed to fetch all urls", zap.Error(err))
-			return nil, errors.New("failed to fetch all urls")
+			logger.Log.Error("postgres: failed to close rows", zap.Error(err))
 		}
-		model := URLOutput{
-			ShortURL:    baseURL + "/" + record.alias,
-			OriginalURL: record.originalURL,
+	}()
+
+	res := make([]APIKey, 0)
+	for rows.Next() {
+		key := APIKey{UserID: userID}
+		if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &key.CreatedAt); err != nil {
+			logger.Log.Error("postgres: failed to fetch api keys", zap.Error(err))
+			return nil, errors.New("failed to fetch api keys")
 		}
-		res = append(res, model)
+		res = append(res, key)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Log.Error("postgres: failed to fetch api keys", zap.Error(err))
+		return nil, errors.New("failed to fetch api keys")
 	}
+	return res, nil
+}
 
-	err = rows.Err()
+func (p *PostgresRepository) updateAPIKeyRevoked(userID, keyID string, revokedAt time.Time) error {
+	if _, err := uuid.Parse(keyID); err != nil {
+		return ErrAPIKeyNotFound
+	}
+
+	query := "UPDATE api_keys SET revoked_at = $3 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;"
+	res, err := p.db.ExecContext(p.ctx, query, keyID, userID, revokedAt)
 	if err != nil {
-		logger.Log.Error("postgres: failed to fetch all urls", zap.Error(err))
-		return nil, errors.New("failed to fetch all urls")
+		logger.Log.Error("postgres: failed to revoke api key", zap.String("id", keyID), zap.Error(err))
+		return errors.New("failed to revoke api key")
 	}
-	if len(res) == 0 {
-		return nil, ErrUserHasNoData
+	affected, err := res.RowsAffected()
+	if err != nil {
+		logger.Log.Error("postgres: failed to revoke api key", zap.String("id", keyID), zap.Error(err))
+		return errors.New("failed to revoke api key")
 	}
-	return res, nil
+	if affected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
 }
 
-func (p *PostgresRepository) insert(model Model) (string, error) {
-	var alias string
-	query := `INSERT INTO urls(user_id, cid, alias, original_url)
+func (p *PostgresRepository) fetchAPIKeyUser(keyHash string) (string, error) {
+	var userID string
+	row := p.db.QueryRowContext(p.ctx, "SELECT user_id FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL", keyHash)
+	err := row.Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrAPIKeyNotFound
+	}
+	if err != nil {
+		logger.Log.Error("postgres: failed to fetch api key", zap.Error(err))
+		return "", errors.New("failed to fetch api key")
+	}
+	return userID, nil
+}
+
+func (p *PostgresRepository) insertUser(user User) error {
+	query := `INSERT INTO users(id, login, password_hash, created_at)
 			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (login) DO NOTHING;`
+	res, err := p.db.ExecContext(p.ctx, query, user.ID, user.Login, user.PasswordHash, user.CreatedAt)
+	if err != nil {
+		logger.Log.Error("postgres: failed to insert user", zap.String("login", user.Login), zap.Error(err))
+		return errors.New("failed to insert user")
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		logger.Log.Error("postgres: failed to insert user", zap.String("login", user.Login), zap.Error(err))
+		return errors.New("failed to insert user")
+	}
+	if affected == 0 {
+		return ErrLoginTaken
+	}
+	return nil
+}
+
+func (p *PostgresRepository) fetchUserByLogin(login string) (User, error) {
+	var user User
+	row := p.db.QueryRowContext(p.ctx, "SELECT id, login, password_hash, created_at FROM users WHERE login = $1", login)
+	err := row.Scan(&user.ID, &user.Login, &user.PasswordHash, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
+	if err != nil {
+		logger.Log.Error("postgres: failed to fetch user", zap.String("login", login), zap.Error(err))
+		return User{}, errors.New("failed to fetch user")
+	}
+	return user, nil
+}
+
+func (p *PostgresRepository) fetchUserByID(userID string) (User, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return User{}, ErrUserNotFound
+	}
+
+	var user User
+	row := p.db.QueryRowContext(p.ctx, "SELECT id, login, password_hash, created_at FROM users WHERE id = $1", userID)
+	err := row.Scan(&user.ID, &user.Login, &user.PasswordHash, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
+	if err != nil {
+		logger.Log.Error("postgres: failed to fetch user", zap.String("user_id", userID), zap.Error(err))
+		return User{}, errors.New("failed to fetch user")
+	}
+	return user, nil
+}
+
+func (p *PostgresRepository) mergeLinks(fromUserID, toUserID string, mergedAt time.Time) (LinkMerge, error) {
+	tx, err := p.db.BeginTx(p.ctx, nil)
+	if err != nil {
+		logger.Log.Error("postgres: failed to begin transaction", zap.Error(err))
+		return LinkMerge{}, errors.New("failed to begin transaction")
+	}
+	defer rollback(tx)
+
+	var registered bool
+	row := tx.QueryRowContext(p.ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id::text = $1)", fromUserID)
+	if err := row.Scan(&registered); err != nil {
+		logger.Log.Error("postgres: failed to fetch user", zap.String("user_id", fromUserID), zap.Error(err))
+		return LinkMerge{}, errors.New("failed to merge links")
+	}
+	if registered {
+		return LinkMerge{}, ErrRegisteredUser
+	}
+
+	query := `UPDATE urls SET user_id = $2
+			WHERE user_id = $1 AND NOT is_deleted
+				AND original_url NOT IN (SELECT original_url FROM urls WHERE user_id = $2 AND NOT is_deleted)
+			RETURNING alias;`
+	moved, err := queryAliases(p.ctx, tx, query, fromUserID, toUserID)
+	if err != nil {
+		return LinkMerge{}, errors.New("failed to merge links")
+	}
+	skipped, err := queryAliases(p.ctx, tx, "SELECT alias FROM urls WHERE user_id = $1 AND NOT is_deleted;", fromUserID)
+	if err != nil {
+		return LinkMerge{}, errors.New("failed to merge links")
+	}
+
+	merge := newLinkMerge(fromUserID, toUserID, moved, skipped, mergedAt)
+	if merge.IsEmpty() {
+		return merge, nil
+	}
+	movedJSON, err := json.Marshal(append([]string{}, merge.Moved...))
+	if err != nil {
+		logger.Log.Error("postgres: failed to encode merge", zap.Error(err))
+		return LinkMerge{}, errors.New("failed to merge links")
+	}
+	skippedJSON, err := json.Marshal(append([]string{}, merge.Skipped...))
+	if err != nil {
+		logger.Log.Error("postgres: failed to encode merge", zap.Error(err))
+		return LinkMerge{}, errors.New("failed to merge links")
+	}
+	query = `INSERT INTO link_merges(id, from_user_id, to_user_id, moved, skipped, merged_at)
+			VALUES ($1, $2, $3, $4, $5, $6);`
+	_, err = tx.ExecContext(p.ctx, query, merge.ID, fromUserID, toUserID, string(movedJSON), string(skippedJSON), mergedAt)
+	if err != nil {
+		logger.Log.Error("postgres: failed to record merge", zap.String("user_id", toUserID), zap.Error(err))
+		return LinkMerge{}, errors.New("failed to merge links")
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Log.Error("postgres: failed to commit transaction", zap.Error(err))
+		return LinkMerge{}, errors.New("failed to merge links")
+	}
+	return merge, nil
+}
+
+// queryAliases runs a query returning aliases inside the transaction.
+func queryAliases(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.Log.Error("postgres: failed to query aliases", zap.Error(err))
+		return nil, err
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("postgres: failed to close rows", zap.Error(err))
+		}
+	}()
+
+	var aliases []string
+	for rows.Next() {
+		var alias string
+		if err := rows.Scan(&alias); err != nil {
+			logger.Log.Error("postgres: failed to scan alias", zap.Error(err))
+			return nil, err
+		}
+		aliases = append(aliases, alias)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Log.Error("postgres: failed to query aliases", zap.Error(err))
+		return nil, err
+	}
+	return aliases, nil
+}
+
+func (p *PostgresRepository) insertWorkspace(ws Workspace, ownerID string) error {
+	tx, err := p.db.BeginTx(p.ctx, nil)
+	if err != nil {
+		logger.Log.Error("postgres: failed to begin transaction", zap.Error(err))
+		return errors.New("failed to begin transaction")
+	}
+	defer rollback(tx)
+
+	_, err = tx.ExecContext(p.ctx, "INSERT INTO workspaces(id, name, created_at) VALUES ($1, $2, $3);", ws.ID, ws.Name, ws.CreatedAt)
+	if err != nil {
+		logger.Log.Error("postgres: failed to insert workspace", zap.String("id", ws.ID), zap.Error(err))
+		return errors.New("failed to insert workspace")
+	}
+	query := "INSERT INTO workspace_members(workspace_id, user_id, role, added_at) VALUES ($1, $2, $3, $4);"
+	_, err = tx.ExecContext(p.ctx, query, ws.ID, ownerID, string(workspace.RoleOwner), ws.CreatedAt)
+	if err != nil {
+		logger.Log.Error("postgres: failed to insert workspace owner", zap.String("id", ws.ID), zap.Error(err))
+		return errors.New("failed to insert workspace")
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Log.Error("postgres: failed to commit transaction", zap.Error(err))
+		return errors.New("failed to insert workspace")
+	}
+	return nil
+}
+
+func (p *PostgresRepository) fetchWorkspaces(userID string) ([]UserWorkspace, error) {
+	query := `SELECT w.id, w.name, w.created_at, m.role FROM workspaces w
+			JOIN workspace_members m ON m.workspace_id = w.id
+			WHERE m.user_id = $1
+			ORDER BY w.created_at;`
+	rows, err := p.db.QueryContext(p.ctx, query, userID)
+	if err != nil {
+		logger.Log.Error("postgres: failed to fetch workspaces", zap.String("user_id", userID), zap.Error(err))
+		return nil, errors.New("failed to fetch workspaces")
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("postgres: failed to close rows", zap.Error(err))
+		}
+	}()
+
+	res := make([]UserWorkspace, 0)
+	for rows.Next() {
+		var ws UserWorkspace
+		var role string
+		if err := rows.Scan(&ws.ID, &ws.Name, &ws.CreatedAt, &role); err != nil {
+			logger.Log.Error("postgres: failed to fetch workspaces", zap.Error(err))
+			return nil, errors.New("failed to fetch workspaces")
+		}
+		ws.Role = workspace.Role(role)
+		res = append(res, ws)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Log.Error("postgres: failed to fetch workspaces", zap.Error(err))
+		return nil, errors.New("failed to fetch workspaces")
+	}
+	return res, nil
+}
+
+func (p *PostgresRepository) fetchMembers(workspaceID string) ([]Member, error) {
+	if _, err := uuid.Parse(workspaceID); err != nil {
+		return nil, ErrWorkspaceNotFound
+	}
+
+	members, err := queryMembers(p.ctx, p.db, "SELECT user_id, role, added_at FROM workspace_members WHERE workspace_id = $1;", workspaceID)
+	if err != nil {
+		return nil, errors.New("failed to fetch members")
+	}
+	if len(members) == 0 {
+		// Workspaces always keep an owner, so a workspace without members does not exist.
+		return nil, ErrWorkspaceNotFound
+	}
+	return members, nil
+}
+
+func (p *PostgresRepository) fetchMemberRole(workspaceID, userID string) (workspace.Role, error) {
+	if _, err := uuid.Parse(workspaceID); err != nil {
+		return "", ErrMemberNotFound
+	}
+
+	var role string
+	row := p.db.QueryRowContext(p.ctx, "SELECT role FROM workspace_members WHERE workspace_id = $1 AND user_id = $2", workspaceID, userID)
+	err := row.Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrMemberNotFound
+	}
+	if err != nil {
+		logger.Log.Error("postgres: failed to fetch member role", zap.String("workspace_id", workspaceID), zap.Error(err))
+		return "", errors.New("failed to fetch member role")
+	}
+	return workspace.Role(role), nil
+}
+
+func (p *PostgresRepository) upsertMember(member Member) error {
+	if _, err := uuid.Parse(member.WorkspaceID); err != nil {
+		return ErrWorkspaceNotFound
+	}
+
+	tx, err := p.db.BeginTx(p.ctx, nil)
+	if err != nil {
+		logger.Log.Error("postgres: failed to begin transaction", zap.Error(err))
+		return errors.New("failed to begin transaction")
+	}
+	defer rollback(tx)
+
+	members, err := lockMembers(p.ctx, tx, member.WorkspaceID)
+	if err != nil {
+		return errors.New("failed to set member")
+	}
+	if len(members) == 0 {
+		return ErrWorkspaceNotFound
+	}
+	if err := checkOwnerRemains(members, member.UserID, member.Role); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO workspace_members(workspace_id, user_id, role, added_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (workspace_id, user_id) DO UPDATE SET role = EXCLUDED.role, added_at = EXCLUDED.added_at;`
+	_, err = tx.ExecContext(p.ctx, query, member.WorkspaceID, member.UserID, string(member.Role), member.AddedAt)
+	if err != nil {
+		logger.Log.Error("postgres: failed to set member", zap.String("workspace_id", member.WorkspaceID), zap.Error(err))
+		return errors.New("failed to set member")
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Log.Error("postgres: failed to commit transaction", zap.Error(err))
+		return errors.New("failed to set member")
+	}
+	return nil
+}
+
+func (p *PostgresRepository) deleteMember(workspaceID, userID string) error {
+	if _, err := uuid.Parse(workspaceID); err != nil {
+		return ErrMemberNotFound
+	}
+
+	tx, err := p.db.BeginTx(p.ctx, nil)
+	if err != nil {
+		logger.Log.Error("postgres: failed to begin transaction", zap.Error(err))
+		return errors.New("failed to begin transaction")
+	}
+	defer rollback(tx)
+
+	members, err := lockMembers(p.ctx, tx, workspaceID)
+	if err != nil {
+		return errors.New("failed to remove member")
+	}
+	if err := checkOwnerRemains(members, userID, ""); err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(p.ctx, "DELETE FROM workspace_members WHERE workspace_id = $1 AND user_id = $2;", workspaceID, userID)
+	if err != nil {
+		logger.Log.Error("postgres: failed to remove member", zap.String("workspace_id", workspaceID), zap.Error(err))
+		return errors.New("failed to remove member")
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		logger.Log.Error("postgres: failed to remove member", zap.String("workspace_id", workspaceID), zap.Error(err))
+		return errors.New("failed to remove member")
+	}
+	if affected == 0 {
+		return ErrMemberNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Log.Error("postgres: failed to commit transaction", zap.Error(err))
+		return errors.New("failed to remove member")
+	}
+	return nil
+}
+
+// lockMembers returns the members of a workspace and locks them until the transaction ends.
+func lockMembers(ctx context.Context, tx *sql.Tx, workspaceID string) ([]Member, error) {
+	query := "SELECT user_id, role, added_at FROM workspace_members WHERE workspace_id = $1 FOR UPDATE;"
+	return queryMembers(ctx, tx, query, workspaceID)
+}
+
+// querier runs queries on a database or inside a transaction.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// execer runs statements on a database or inside a transaction.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// queryMembers runs a query returning the members of a workspace, owners first.
+func queryMembers(ctx context.Context, q querier, query, workspaceID string) ([]Member, error) {
+	rows, err := q.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		logger.Log.Error("postgres: failed to fetch members", zap.String("workspace_id", workspaceID), zap.Error(err))
+		return nil, err
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("postgres: failed to close rows", zap.Error(err))
+		}
+	}()
+
+	res := make([]Member, 0)
+	for rows.Next() {
+		member := Member{WorkspaceID: workspaceID}
+		var role string
+		if err := rows.Scan(&member.UserID, &role, &member.AddedAt); err != nil {
+			logger.Log.Error("postgres: failed to fetch members", zap.Error(err))
+			return nil, err
+		}
+		member.Role = workspace.Role(role)
+		res = append(res, member)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Log.Error("postgres: failed to fetch members", zap.Error(err))
+		return nil, err
+	}
+	sortMembers(res)
+	return res, nil
+}
+
+// rollback rolls the transaction back unless it was committed.
+func rollback(tx *sql.Tx) {
+	if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		logger.Log.Error("postgres: failed to rollback transaction", zap.Error(err))
+	}
+}
+
+func (p *PostgresRepository) searchLinks(filter LinkFilter, baseURL string) ([]LinkRecord, error) {
+	query := `SELECT alias, original_url, user_id, is_deleted, clicks, disabled_status, disabled_reason, quarantined FROM (
+				SELECT *, lower(substring(original_url from '^[^:]+://(?:[^@/]*@)?([^/:?#]+)')) AS host FROM urls
+			) u
+			WHERE ($1 = '' OR starts_with(alias, $1))
+				AND ($2 = '' OR user_id = $2)
+				AND ($3 = '' OR host = $3 OR right(host, length($3) + 1) = '.' || $3)
+			ORDER BY alias
+			LIMIT $4;`
+	rows, err := p.db.QueryContext(p.ctx, query, filter.Alias, filter.OwnerID, strings.ToLower(filter.Domain), filter.searchLimit())
+	if err != nil {
+		logger.Log.Error("postgres: failed to search links", zap.Error(err))
+		return nil, errors.New("failed to search links")
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("postgres: failed to close rows", zap.Error(err))
+		}
+	}()
+
+	res := make([]LinkRecord, 0)
+	for rows.Next() {
+		var record LinkRecord
+		var reason sql.NullString
+		err := rows.Scan(&record.Alias, &record.OriginalURL, &record.OwnerID, &record.IsDeleted, &record.Clicks,
+			&record.DisabledStatus, &reason, &record.Quarantined)
+		if err != nil {
+			logger.Log.Error("postgres: failed to search links", zap.Error(err))
+			return nil, errors.New("failed to search links")
+		}
+		record.ShortURL = baseURL + "/" + record.Alias
+		record.DisabledReason = reason.String
+		res = append(res, record)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Log.Error("postgres: failed to search links", zap.Error(err))
+		return nil, errors.New("failed to search links")
+	}
+	return res, nil
+}
+
+func (p *PostgresRepository) updateLinkDisabled(alias string, statusCode int, reason string, entry AuditEntry) error {
+	tx, err := p.db.BeginTx(p.ctx, nil)
+	if err != nil {
+		logger.Log.Error("postgres: failed to begin transaction", zap.Error(err))
+		return errors.New("failed to begin transaction")
+	}
+	defer rollback(tx)
+
+	query := "UPDATE urls SET disabled_status = $2, disabled_reason = NULLIF($3, '') WHERE alias = $1;"
+	res, err := tx.ExecContext(p.ctx, query, alias, statusCode, reason)
+	if err != nil {
+		logger.Log.Error("postgres: failed to disable link", zap.String("alias", alias), zap.Error(err))
+		return errors.New("failed to disable link")
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		logger.Log.Error("postgres: failed to disable link", zap.String("alias", alias), zap.Error(err))
+		return errors.New("failed to disable link")
+	}
+	if affected == 0 {
+		return ErrShortURLNotFound
+	}
+
+	if err := p.insertAudit(tx, entry); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Log.Error("postgres: failed to commit transaction", zap.Error(err))
+		return errors.New("failed to commit transaction")
+	}
+	return nil
+}
+
+func (p *PostgresRepository) updateLinkOwner(alias, ownerID string, entry AuditEntry) (string, error) {
+	tx, err := p.db.BeginTx(p.ctx, nil)
+	if err != nil {
+		logger.Log.Error("postgres: failed to begin transaction", zap.Error(err))
+		return "", errors.New("failed to begin transaction")
+	}
+	defer rollback(tx)
+
+	query := `UPDATE urls u SET user_id = $2
+			FROM (SELECT id, user_id FROM urls WHERE alias = $1 FOR UPDATE) prev
+			WHERE u.id = prev.id
+			RETURNING prev.user_id;`
+	var previous string
+	err = tx.QueryRowContext(p.ctx, query, alias, ownerID).Scan(&previous)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrShortURLNotFound
+	}
+	if err != nil {
+		logger.Log.Error("postgres: failed to reassign link", zap.String("alias", alias), zap.Error(err))
+		return "", errors.New("failed to reassign link")
+	}
+	previous = strings.TrimSpace(previous)
+
+	if err := p.insertAudit(tx, entry.withDetail(AuditDetailFrom, previous)); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Log.Error("postgres: failed to commit transaction", zap.Error(err))
+		return "", errors.New("failed to commit transaction")
+	}
+	return previous, nil
+}
+
+func (p *PostgresRepository) fetchOwnerStats() ([]OwnerStats, error) {
+	query := `SELECT user_id,
+				COUNT(*) FILTER (WHERE NOT is_deleted AND disabled_status = 0),
+				COUNT(*) FILTER (WHERE is_deleted),
+				COUNT(*) FILTER (WHERE NOT is_deleted AND disabled_status <> 0),
+				COALESCE(SUM(clicks), 0)
+			FROM urls
+			GROUP BY user_id;`
+	rows, err := p.db.QueryContext(p.ctx, query)
+	if err != nil {
+		logger.Log.Error("postgres: failed to fetch owner stats", zap.Error(err))
+		return nil, errors.New("failed to fetch owner stats")
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("postgres: failed to close rows", zap.Error(err))
+		}
+	}()
+
+	res := make([]OwnerStats, 0)
+	for rows.Next() {
+		var stats OwnerStats
+		if err := rows.Scan(&stats.OwnerID, &stats.Active, &stats.Deleted, &stats.Disabled, &stats.Clicks); err != nil {
+			logger.Log.Error("postgres: failed to fetch owner stats", zap.Error(err))
+			return nil, errors.New("failed to fetch owner stats")
+		}
+		stats.OwnerID = strings.TrimSpace(stats.OwnerID)
+		res = append(res, stats)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Log.Error("postgres: failed to fetch owner stats", zap.Error(err))
+		return nil, errors.New("failed to fetch owner stats")
+	}
+	sortOwnerStats(res)
+	return res, nil
+}
+
+func (p *PostgresRepository) insertAudit(e execer, entry AuditEntry) error {
+	var details []byte
+	if len(entry.Details) > 0 {
+		var err error
+		details, err = json.Marshal(entry.Details)
+		if err != nil {
+			logger.Log.Error("postgres: failed to encode audit details", zap.Error(err))
+			return errors.New("failed to encode audit details")
+		}
+	}
+
+	query := `INSERT INTO audit_log(id, actor, action, target, details, created_at)
+			VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6);`
+	_, err := e.ExecContext(p.ctx, query, entry.ID, entry.Actor, entry.Action, entry.Target, nullableJSON(details), entry.CreatedAt)
+	if err != nil {
+		logger.Log.Error("postgres: failed to insert audit entry", zap.String("action", entry.Action), zap.Error(err))
+		return errors.New("failed to insert audit entry")
+	}
+	return nil
+}
+
+func (p *PostgresRepository) fetchAuditLog(limit int) ([]AuditEntry, error) {
+	var queryLimit interface{}
+	if limit > 0 {
+		queryLimit = limit
+	}
+	query := "SELECT id, actor, action, target, details, created_at FROM audit_log ORDER BY created_at DESC LIMIT $1;"
+	rows, err := p.db.QueryContext(p.ctx, query, queryLimit)
+	if err != nil {
+		logger.Log.Error("postgres: failed to fetch audit log", zap.Error(err))
+		return nil, errors.New("failed to fetch audit log")
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("postgres: failed to close rows", zap.Error(err))
+		}
+	}()
+
+	res := make([]AuditEntry, 0)
+	for rows.Next() {
+		var entry AuditEntry
+		var target sql.NullString
+		var details []byte
+		if err := rows.Scan(&entry.ID, &entry.Actor, &entry.Action, &target, &details, &entry.CreatedAt); err != nil {
+			logger.Log.Error("postgres: failed to fetch audit log", zap.Error(err))
+			return nil, errors.New("failed to fetch audit log")
+		}
+		entry.Target = target.String
+		if len(details) > 0 {
+			if err := json.Unmarshal(details, &entry.Details); err != nil {
+				logger.Log.Error("postgres: failed to decode audit details", zap.Error(err))
+				return nil, errors.New("failed to decode audit details")
+			}
+		}
+		res = append(res, entry)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Log.Error("postgres: failed to fetch audit log", zap.Error(err))
+		return nil, errors.New("failed to fetch audit log")
+	}
+	return res, nil
+}
+
+func (p *PostgresRepository) insertReport(report Report, threshold int) (bool, error) {
+	tx, err := p.db.BeginTx(p.ctx, nil)
+	if err != nil {
+		logger.Log.Error("postgres: failed to begin transaction", zap.Error(err))
+		return false, errors.New("failed to begin transaction")
+	}
+	defer rollback(tx)
+
+	// Locking the link serializes the reports against it, so the threshold is checked once.
+	query := "SELECT is_deleted, disabled_status, disabled_reason, quarantined FROM urls WHERE alias = $1 FOR UPDATE;"
+	var model Model
+	var quarantined bool
+	err = tx.QueryRowContext(p.ctx, query, report.Alias).Scan(&model.isDeleted, &model.disabledStatus, &model.disabledReason, &quarantined)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrShortURLNotFound
+	}
+	if err != nil {
+		logger.Log.Error("postgres: failed to lock reported link", zap.String("alias", report.Alias), zap.Error(err))
+		return false, errors.New("failed to insert report")
+	}
+	if model.isDeleted {
+		return false, ErrURLDeleted
+	}
+	if model.disabledStatus != 0 {
+		return false, &DisabledError{StatusCode: model.disabledStatus, Reason: model.disabledReason.String}
+	}
+
+	query = `INSERT INTO reports(id, alias, category, reason, reporter, status, created_at)
+			VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7)
+			ON CONFLICT (alias, reporter) WHERE status = 'open' DO NOTHING;`
+	res, err := tx.ExecContext(p.ctx, query, report.ID, report.Alias, report.Category, report.Reason, report.Reporter,
+		report.Status, report.CreatedAt)
+	if err != nil {
+		logger.Log.Error("postgres: failed to insert report", zap.String("alias", report.Alias), zap.Error(err))
+		return false, errors.New("failed to insert report")
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		logger.Log.Error("postgres: failed to insert report", zap.String("alias", report.Alias), zap.Error(err))
+		return false, errors.New("failed to insert report")
+	}
+	if affected == 0 {
+		return false, ErrReportExists
+	}
+
+	if threshold > 0 && !quarantined {
+		query = `UPDATE urls SET quarantined = TRUE
+				WHERE alias = $1
+					AND (SELECT COUNT(DISTINCT reporter) FROM reports WHERE alias = $1 AND status = 'open') >= $2;`
+		res, err := tx.ExecContext(p.ctx, query, report.Alias, threshold)
+		if err != nil {
+			logger.Log.Error("postgres: failed to quarantine link", zap.String("alias", report.Alias), zap.Error(err))
+			return false, errors.New("failed to quarantine link")
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			logger.Log.Error("postgres: failed to quarantine link", zap.String("alias", report.Alias), zap.Error(err))
+			return false, errors.New("failed to quarantine link")
+		}
+		quarantined = affected > 0
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Log.Error("postgres: failed to commit transaction", zap.Error(err))
+		return false, errors.New("failed to commit transaction")
+	}
+	return quarantined, nil
+}
+
+func (p *PostgresRepository) fetchReports(status string, limit int) ([]Report, error) {
+	var queryLimit interface{}
+	if limit > 0 {
+		queryLimit = limit
+	}
+	query := `SELECT id, alias, category, reason, reporter, status, created_at, resolved_at, resolved_by FROM reports
+			WHERE $1 = '' OR status = $1
+			ORDER BY created_at DESC, id
+			LIMIT $2;`
+	rows, err := p.db.QueryContext(p.ctx, query, status, queryLimit)
+	if err != nil {
+		logger.Log.Error("postgres: failed to fetch reports", zap.Error(err))
+		return nil, errors.New("failed to fetch reports")
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("postgres: failed to close rows", zap.Error(err))
+		}
+	}()
+
+	res := make([]Report, 0)
+	for rows.Next() {
+		var report Report
+		var reason, resolvedBy sql.NullString
+		var resolvedAt sql.NullTime
+		err := rows.Scan(&report.ID, &report.Alias, &report.Category, &reason, &report.Reporter, &report.Status,
+			&report.CreatedAt, &resolvedAt, &resolvedBy)
+		if err != nil {
+			logger.Log.Error("postgres: failed to fetch reports", zap.Error(err))
+			return nil, errors.New("failed to fetch reports")
+		}
+		report.Reason = reason.String
+		report.ResolvedBy = resolvedBy.String
+		if resolvedAt.Valid {
+			report.ResolvedAt = &resolvedAt.Time
+		}
+		res = append(res, report)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Log.Error("postgres: failed to fetch reports", zap.Error(err))
+		return nil, errors.New("failed to fetch reports")
+	}
+	return res, nil
+}
+
+func (p *PostgresRepository) updateReportsResolved(alias, status string, entry AuditEntry) (int, error) {
+	tx, err := p.db.BeginTx(p.ctx, nil)
+	if err != nil {
+		logger.Log.Error("postgres: failed to begin transaction", zap.Error(err))
+		return 0, errors.New("failed to begin transaction")
+	}
+	defer rollback(tx)
+
+	res, err := tx.ExecContext(p.ctx, "UPDATE urls SET quarantined = FALSE WHERE alias = $1;", alias)
+	if err != nil {
+		logger.Log.Error("postgres: failed to lift quarantine", zap.String("alias", alias), zap.Error(err))
+		return 0, errors.New("failed to resolve reports")
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		logger.Log.Error("postgres: failed to lift quarantine", zap.String("alias", alias), zap.Error(err))
+		return 0, errors.New("failed to resolve reports")
+	}
+	if affected == 0 {
+		return 0, ErrShortURLNotFound
+	}
+
+	query := `UPDATE reports SET status = $2, resolved_at = $3, resolved_by = NULLIF($4, '')
+			WHERE alias = $1 AND status = 'open';`
+	res, err = tx.ExecContext(p.ctx, query, alias, status, entry.CreatedAt, entry.Actor)
+	if err != nil {
+		logger.Log.Error("postgres: failed to resolve reports", zap.String("alias", alias), zap.Error(err))
+		return 0, errors.New("failed to resolve reports")
+	}
+	resolved, err := res.RowsAffected()
+	if err != nil {
+		logger.Log.Error("postgres: failed to resolve reports", zap.String("alias", alias), zap.Error(err))
+		return 0, errors.New("failed to resolve reports")
+	}
+
+	if err := p.insertAudit(tx, entry.withResolved(int(resolved))); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Log.Error("postgres: failed to commit transaction", zap.Error(err))
+		return 0, errors.New("failed to commit transaction")
+	}
+	return int(resolved), nil
+}
+
+func encodeVariants(variants []split.Variant) ([]byte, error) {
+	if len(variants) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(variants)
+	if err != nil {
+		logger.Log.Error("postgres: failed to encode variants", zap.Error(err))
+		return nil, errors.New("failed to encode variants")
+	}
+	return data, nil
+}
+
+func encodeUTM(utm querymerge.UTM) ([]byte, error) {
+	if utm.IsZero() {
+		return nil, nil
+	}
+	data, err := json.Marshal(utm)
+	if err != nil {
+		logger.Log.Error("postgres: failed to encode utm", zap.Error(err))
+		return nil, errors.New("failed to encode utm")
+	}
+	return data, nil
+}
+
+func decodeUTM(data []byte) (querymerge.UTM, error) {
+	var utm querymerge.UTM
+	if len(data) == 0 {
+		return utm, nil
+	}
+	if err := json.Unmarshal(data, &utm); err != nil {
+		logger.Log.Error("postgres: failed to decode utm", zap.Error(err))
+		return querymerge.UTM{}, errors.New("failed to decode utm")
+	}
+	return utm, nil
+}
+
+// nullableJSON converts an encoded JSON document to a query argument, storing NULL for an empty document.
+func nullableJSON(data []byte) interface{} {
+	if data == nil {
+		return nil
+	}
+	return string(data)
+}
+
+func decodeVariants(data []byte) ([]split.Variant, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var variants []split.Variant
+	if err := json.Unmarshal(data, &variants); err != nil {
+		logger.Log.Error("postgres: failed to decode variants", zap.Error(err))
+		return nil, errors.New("failed to decode variants")
+	}
+	return variants, nil
+}
+
+func decodeRules(data []byte) ([]rules.Rule, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var linkRules []rules.Rule
+	if err := json.Unmarshal(data, &linkRules); err != nil {
+		logger.Log.Error("postgres: failed to decode rules", zap.Error(err))
+		return nil, errors.New("failed to decode rules")
+	}
+	return linkRules, nil
+}
+
+func (p *PostgresRepository) fetchURs(userID, baseURL string) ([]URLOutput, error) {
+	query := "SELECT alias, original_url, submitted_url, variants, redirect_status, last_status, checked_at FROM urls WHERE user_id = $1 AND NOT is_deleted"
+	rows, err := p.db.QueryContext(p.ctx, query, userID)
+	if err != nil {
+		logger.Log.Error("postgres: failed to fetch urls", zap.String("user_id", userID), zap.Error(err))
+		return nil, errors.New("failed to fetch urls")
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("postgres: failed to close rows", zap.Error(err))
+			return
+		}
+	}()
+
+	res := make([]URLOutput, 0)
+	for rows.Next() {
+		var record Model
+		err := rows.Scan(&record.alias, &record.originalURL, &record.submittedURL, &record.variants, &record.redirectStatus,
+			&record.lastStatus, &record.checkedAt)
+		if err != nil {
+			logger.Log.Error("postgres: failed to fetch all urls", zap.Error(err))
+			return nil, errors.New("failed to fetch all urls")
+		}
+		variants, err := decodeVariants(record.variants)
+		if err != nil {
+			return nil, err
+		}
+		model := URLOutput{
+			ShortURL:       baseURL + "/" + record.alias,
+			OriginalURL:    record.originalURL,
+			SubmittedURL:   record.submittedURL.String,
+			Variants:       variants,
+			RedirectStatus: record.redirectStatus,
+			LastStatus:     record.lastStatus,
+		}
+		if record.checkedAt.Valid {
+			checkedAt := record.checkedAt.Time
+			model.CheckedAt = &checkedAt
+		}
+		res = append(res, model)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		logger.Log.Error("postgres: failed to fetch all urls", zap.Error(err))
+		return nil, errors.New("failed to fetch all urls")
+	}
+	if len(res) == 0 {
+		return nil, ErrUserHasNoData
+	}
+	return res, nil
+}
+
+// insert adds the link in the transaction. Original URLs are unique across owners, a URL stored before,
+// also earlier in the same transaction or by another user, is returned as a ConflictError with its short URL.
+func (p *PostgresRepository) insert(tx *sql.Tx, model Model) (string, error) {
+	var alias string
+	query := `INSERT INTO urls(user_id, cid, alias, original_url, max_clicks, variants, pass_query, utm, redirect_status,
+				submitted_url)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 			ON CONFLICT (original_url)
           	DO NOTHING 
           	RETURNING alias;`
-	row := p.db.QueryRowContext(p.ctx, query, model.userID, model.cid, model.alias, model.originalURL)
+	row := tx.QueryRowContext(p.ctx, query, model.userID, model.cid, model.alias, model.originalURL, model.maxClicks,
+		nullableJSON(model.variants), model.passQuery, nullableJSON(model.utm),
+		model.redirectStatus, model.submittedURL)
 
 	err := row.Scan(&alias)
 	if errors.Is(err, sql.ErrNoRows) {
 		logger.Log.Debug("postgres: fetching conflicted url", zap.Error(err))
-		alias, err := p.fetchAliasWithUserID(model.userID, model.originalURL)
+		err := tx.QueryRowContext(p.ctx, "SELECT alias FROM urls WHERE original_url = $1", model.originalURL).Scan(&alias)
 		if err != nil {
 			logger.Log.Error("postgres: failed to fetch existed url", zap.Error(err))
 			return "", errors.New("postgres: failed to fetch existed url")
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDSNEnv names the database the PostgreSQL tests run against, they are skipped without it.
+const testDSNEnv = "TEST_DATABASE_DSN"
+
+func openPostgres(t *testing.T, userIDs ...string) *PostgresRepository {
+	t.Helper()
+
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNEnv)
+	}
+	storage := NewPosgresRepository(context.Background(), dsn)
+	require.NoError(t, storage.Run())
+	t.Cleanup(func() {
+		for _, userID := range userIDs {
+			_, err := storage.db.Exec("DELETE FROM urls WHERE user_id = $1;", userID)
+			assert.NoError(t, err)
+		}
+		_ = storage.Close()
+	})
+	return storage
+}
+
+func TestPostgresStorage_StoreBatchDuplicates(t *testing.T) {
+	userID, otherID := uuid.NewString(), uuid.NewString()
+	storage := openPostgres(t, userID, otherID)
+	repeated := "https://example.com/" + uuid.NewString()
+	taken := "https://example.com/" + uuid.NewString()
+
+	otherURL, err := storage.Store(otherID, "http://localhost", taken, LinkOptions{})
+	require.NoError(t, err)
+
+	res, err := storage.StoreBatch(userID, "http://localhost", []BatchURLInput{
+		{CID: "1", OriginalURL: repeated},
+		{CID: "2", OriginalURL: repeated},
+		{CID: "3", OriginalURL: taken},
+	})
+	require.NoError(t, err)
+	require.Len(t, res, 3)
+	assert.False(t, res[0].Existing)
+	assert.Equal(t, BatchURLOutput{CID: "2", ShortURL: res[0].ShortURL, Existing: true}, res[1],
+		"a URL listed twice is stored once")
+	assert.Equal(t, BatchURLOutput{CID: "3", ShortURL: otherURL, Existing: true}, res[2],
+		"a URL of another user is answered with its link")
+
+	_, err = storage.Store(userID, "http://localhost", repeated, LinkOptions{})
+	var cErr *ConflictError
+	require.ErrorAs(t, err, &cErr)
+	assert.Equal(t, res[0].ShortURL, cErr.ShortURL)
+}
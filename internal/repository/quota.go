@@ -0,0 +1,43 @@
+package repository
+
+import "time"
+
+// IsZero reports whether the quota is unlimited.
+func (q Quota) IsZero() bool {
+	return q.MaxActiveLinks <= 0 && q.MaxLinksPerDay <= 0
+}
+
+// check returns a QuotaError if adding n links to the usage exceeds the quota.
+// The active links quota is checked first, it cannot be waited out.
+func (q Quota) check(usage Usage, n int) error {
+	if q.MaxActiveLinks > 0 && usage.ActiveLinks+n > q.MaxActiveLinks {
+		return &QuotaError{Quota: QuotaActiveLinks, Limit: q.MaxActiveLinks, Used: usage.ActiveLinks, Requested: n}
+	}
+	if q.MaxLinksPerDay > 0 && usage.LinksToday+n > q.MaxLinksPerDay {
+		return &QuotaError{Quota: QuotaDailyLinks, Limit: q.MaxLinksPerDay, Used: usage.LinksToday, Requested: n}
+	}
+	return nil
+}
+
+// DayStart returns the start of the UTC day of t, daily quotas are reset at that time.
+func DayStart(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// ownerUsage counts the mappings of the owner against the quota. Callers must hold the repository lock.
+func ownerUsage(records map[string]*URLMapping, ownerID string, now time.Time) Usage {
+	var usage Usage
+	dayStart := DayStart(now)
+	for _, record := range records {
+		if record.UserID != ownerID {
+			continue
+		}
+		if !record.IsDeleted {
+			usage.ActiveLinks++
+		}
+		if !record.CreatedAt.Before(dayStart) {
+			usage.LinksToday++
+		}
+	}
+	return usage
+}
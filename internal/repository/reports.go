@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"sort"
+	"time"
+)
+
+// hasOpenReport reports whether the reporter has an open report against the link.
+func hasOpenReport(reports map[string]*Report, alias, reporter string) bool {
+	for _, report := range reports {
+		if report.Alias == alias && report.Reporter == reporter && report.Status == ReportOpen {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldQuarantine reports whether the open reports against the mapping reach the threshold
+// and the mapping is not quarantined yet. Callers must hold the repository lock.
+func shouldQuarantine(m *URLMapping, reports map[string]*Report, threshold int) bool {
+	if threshold <= 0 || m.Quarantined {
+		return false
+	}
+	reporters := make(map[string]struct{})
+	for _, report := range reports {
+		if report.Alias == m.ShortURL && report.Status == ReportOpen {
+			reporters[report.Reporter] = struct{}{}
+		}
+	}
+	return len(reporters) >= threshold
+}
+
+// resolveReports returns the open reports against the link closed with the status.
+// The reports in the map are left unchanged.
+func resolveReports(reports map[string]*Report, alias, status, resolvedBy string, resolvedAt time.Time) []Report {
+	res := make([]Report, 0)
+	for _, report := range reports {
+		if report.Alias != alias || report.Status != ReportOpen {
+			continue
+		}
+		resolved := *report
+		resolved.Status = status
+		resolved.ResolvedAt = &resolvedAt
+		resolved.ResolvedBy = resolvedBy
+		res = append(res, resolved)
+	}
+	return res
+}
+
+// latestReports returns up to limit reports with the status, newest first. An empty status matches every report.
+func latestReports(reports map[string]*Report, status string, limit int) []Report {
+	res := make([]Report, 0)
+	for _, report := range reports {
+		if status == "" || report.Status == status {
+			res = append(res, *report)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].CreatedAt.Equal(res[j].CreatedAt) {
+			return res[i].CreatedAt.After(res[j].CreatedAt)
+		}
+		return res[i].ID < res[j].ID
+	})
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return res
+}
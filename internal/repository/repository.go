@@ -3,9 +3,16 @@ package repository
 import (
 	"context"
 	"errors"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
 
 	"github.com/aifedorov/shortener/internal/config"
 	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/pkg/canonical"
+	"github.com/aifedorov/shortener/internal/pkg/rules"
+	"github.com/aifedorov/shortener/internal/pkg/workspace"
 )
 
 // ConflictError represents an error that occurs when a URL already exists in the repository.
@@ -27,6 +34,56 @@ func (e *ConflictError) Error() string {
 	return e.err.Error()
 }
 
+// DisabledError represents a link disabled by an operator, the redirect answers with its status code.
+type DisabledError struct {
+	// StatusCode is the status code of the redirect response, 410 or 451.
+	StatusCode int
+	// Reason is the note left by the operator.
+	Reason string
+}
+
+// Error returns the message of ErrLinkDisabled.
+func (e *DisabledError) Error() string {
+	return ErrLinkDisabled.Error()
+}
+
+// Unwrap returns ErrLinkDisabled so errors.Is matches every disabled link.
+func (e *DisabledError) Unwrap() error {
+	return ErrLinkDisabled
+}
+
+// Quota names
+const (
+	// QuotaActiveLinks limits the number of links of an owner that are not deleted.
+	QuotaActiveLinks = "active_links"
+	// QuotaDailyLinks limits the number of links an owner creates per UTC day.
+	QuotaDailyLinks = "daily_links"
+	// QuotaBatchSize limits the number of links in a single batch request.
+	QuotaBatchSize = "batch_size"
+)
+
+// QuotaError represents a request rejected because it would exceed a quota.
+type QuotaError struct {
+	// Quota is the name of the exceeded quota.
+	Quota string
+	// Limit is the configured limit of the quota.
+	Limit int
+	// Used is the usage counted against the quota before the request.
+	Used int
+	// Requested is the number of links the request would add.
+	Requested int
+}
+
+// Error returns a message naming the exceeded quota.
+func (e *QuotaError) Error() string {
+	return ErrQuotaExceeded.Error() + ": " + e.Quota
+}
+
+// Unwrap returns ErrQuotaExceeded so errors.Is matches every exceeded quota.
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
 // Repository error definitions
 var (
 	// ErrShortURLNotFound is returned when a requested short URL does not exist in the repository.
@@ -37,6 +94,30 @@ var (
 	ErrUserHasNoData = errors.New("user has no data")
 	// ErrURLDeleted is returned when attempting to access a URL that has been marked as deleted.
 	ErrURLDeleted = errors.New("url deleted")
+	// ErrVariantNotFound is returned when a split link has no variant with the requested index.
+	ErrVariantNotFound = errors.New("variant not found")
+	// ErrAPIKeyNotFound is returned when an API key does not exist, belongs to another user or is revoked.
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrLoginTaken is returned when registering a login that is already in use.
+	ErrLoginTaken = errors.New("login is taken")
+	// ErrUserNotFound is returned when no registered user has the requested login.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrRegisteredUser is returned when merging the links of a registered user into another account.
+	ErrRegisteredUser = errors.New("user is registered")
+	// ErrWorkspaceNotFound is returned when a workspace does not exist.
+	ErrWorkspaceNotFound = errors.New("workspace not found")
+	// ErrMemberNotFound is returned when a user is not a member of the workspace.
+	ErrMemberNotFound = errors.New("member not found")
+	// ErrLastOwner is returned when removing or demoting the last owner of a workspace.
+	ErrLastOwner = errors.New("workspace must keep an owner")
+	// ErrLinkDisabled is returned when resolving a link disabled by an operator.
+	ErrLinkDisabled = errors.New("link disabled")
+	// ErrLinkQuarantined is returned when looking up a link quarantined by abuse reports.
+	ErrLinkQuarantined = errors.New("link quarantined")
+	// ErrQuotaExceeded is returned when storing links would exceed a quota of the owner.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrReportExists is returned when a reporter files a second open report against the same link.
+	ErrReportExists = errors.New("report exists")
 )
 
 // Repository defines the interface for URL storage operations.
@@ -48,21 +129,117 @@ type Repository interface {
 	// Close closes the repository connection and performs cleanup.
 	Close() error
 	// Get retrieves the original URL for a given short URL.
+	// It returns ErrLinkQuarantined if the link is quarantined by abuse reports.
 	Get(shortURL string) (string, error)
+	// Resolve retrieves the link for a given short URL and atomically counts the redirect.
+	// A click-limited link is marked as deleted once its last allowed redirect is counted.
+	Resolve(shortURL string) (Link, error)
 	// GetAll retrieves all URLs belonging to a specific user.
 	GetAll(userID, baseURL string) ([]URLOutput, error)
 	// Store saves a new URL and returns the generated short URL.
-	Store(userID, baseURL, targetURL string) (string, error)
-	// StoreBatch saves multiple URLs in a single operation and returns the generated short URLs.
+	// It returns a QuotaError if the owner would exceed the quota.
+	Store(userID, baseURL, targetURL string, opts LinkOptions) (string, error)
+	// StoreBatch saves multiple URLs in a single operation and returns their short URLs in the order of the input.
+	// URLs shortened before are not stored again, their outputs are marked as existing.
+	// It stores none of them and returns a QuotaError if the owner would exceed the quota.
 	StoreBatch(userID, baseURL string, urls []BatchURLInput) ([]BatchURLOutput, error)
+	// SetQuota sets the quota enforced by Store and StoreBatch for every owner.
+	SetQuota(quota Quota)
+	// GetUsage counts the links of the owner that are counted against the quota.
+	GetUsage(userID string) (Usage, error)
 	// DeleteBatch marks multiple URLs as deleted for a specific user.
 	DeleteBatch(userID string, aliases []string) error
+	// GetRules retrieves the conditional redirect rules of a link owned by the user.
+	GetRules(userID, alias string) ([]rules.Rule, error)
+	// SetRules replaces the conditional redirect rules of a link owned by the user.
+	SetRules(userID, alias string, linkRules []rules.Rule) error
+	// TrackVariant counts a redirect served by the variant of a split link.
+	TrackVariant(alias string, variant int) error
+	// GetCheckTargets returns up to limit active links that were never checked or last checked before the given moment.
+	// Links that were never checked come first, then the ones with the oldest check.
+	GetCheckTargets(checkedBefore time.Time, limit int) ([]CheckTarget, error)
+	// SaveCheckResult records the outcome of the latest dead-link check of a link.
+	SaveCheckResult(alias string, result CheckResult) error
+	// StoreAPIKey saves a new API key.
+	StoreAPIKey(key APIKey) error
+	// GetAPIKeys retrieves the active API keys of a user.
+	GetAPIKeys(userID string) ([]APIKey, error)
+	// RevokeAPIKey revokes an active API key of a user.
+	RevokeAPIKey(userID, keyID string, revokedAt time.Time) error
+	// GetAPIKeyUser returns the ID of the user owning the active API key with the given hash.
+	GetAPIKeyUser(keyHash string) (string, error)
+	// CreateUser saves a new registered user, it returns ErrLoginTaken if the login is in use.
+	CreateUser(user User) error
+	// GetUserByLogin retrieves the registered user with the given login.
+	GetUserByLogin(login string) (User, error)
+	// GetUserByID retrieves the registered user with the given ID.
+	GetUserByID(userID string) (User, error)
+	// MergeLinks atomically moves the active links of an anonymous user to a registered account
+	// following the conflict rules of LinkMerge, and records the merge unless it is empty.
+	// It returns ErrRegisteredUser if fromUserID belongs to a registered user.
+	MergeLinks(fromUserID, toUserID string, mergedAt time.Time) (LinkMerge, error)
+	// CreateWorkspace saves a new workspace with the user as its owner.
+	CreateWorkspace(ws Workspace, ownerID string) error
+	// GetWorkspaces retrieves the workspaces the user is a member of with the role of the user.
+	GetWorkspaces(userID string) ([]UserWorkspace, error)
+	// GetMembers retrieves the members of a workspace, it returns ErrWorkspaceNotFound if the workspace does not exist.
+	GetMembers(workspaceID string) ([]Member, error)
+	// GetMemberRole returns the role of the user in the workspace, it returns ErrMemberNotFound if the user is not a member.
+	GetMemberRole(workspaceID, userID string) (workspace.Role, error)
+	// SetMember adds a member to a workspace or changes the role of a member.
+	// It returns ErrLastOwner if the change would leave the workspace without an owner.
+	SetMember(member Member) error
+	// RemoveMember removes a member from a workspace.
+	// It returns ErrLastOwner if the member is the last owner of the workspace.
+	RemoveMember(workspaceID, userID string) error
+	// SearchLinks returns the links of all owners matching the filter, ordered by alias.
+	SearchLinks(filter LinkFilter, baseURL string) ([]LinkRecord, error)
+	// SetLinkDisabled disables a link with the redirect status code and reason, status code zero enables it again.
+	// The audit entry is recorded together with the change, neither is saved without the other.
+	SetLinkDisabled(alias string, statusCode int, reason string, entry AuditEntry) error
+	// ReassignLink moves a link to another owner and returns the previous owner.
+	// The audit entry is recorded together with the change with the previous owner as the from detail.
+	ReassignLink(alias, ownerID string, entry AuditEntry) (string, error)
+	// GetOwnerStats returns the link counts of every owner, owners with the most active links first.
+	GetOwnerStats() ([]OwnerStats, error)
+	// AppendAudit records an admin action in the audit log.
+	AppendAudit(entry AuditEntry) error
+	// GetAuditLog returns up to limit audit log entries, newest first.
+	GetAuditLog(limit int) ([]AuditEntry, error)
+	// AddReport files an abuse report against a link and quarantines the link once threshold distinct reporters
+	// have open reports against it, zero threshold never quarantines. It returns whether the link is quarantined,
+	// and ErrReportExists if the reporter already has an open report against the link.
+	AddReport(report Report, threshold int) (bool, error)
+	// GetReports returns up to limit reports with the status, newest first. An empty status matches every report.
+	GetReports(status string, limit int) ([]Report, error)
+	// ResolveReports closes the open reports against a link with the status and lifts its quarantine.
+	// The actor and the time of the audit entry resolve the reports, the entry is recorded together with the change
+	// with the number of closed reports as the resolved detail. It returns the number of closed reports.
+	ResolveReports(alias, status string, entry AuditEntry) (int, error)
 }
 
 // NewRepository creates a new repository instance based on the provided configuration.
 // It returns a PostgreSQL repository if DSN is configured, a file repository if FileStoragePath is configured,
-// or an in-memory repository as fallback.
+// or an in-memory repository as fallback. URLs are canonicalized before storage unless no rule is configured.
 func NewRepository(ctx context.Context, cfg *config.Config) Repository {
+	repo := newStorage(ctx, cfg)
+	repo.SetQuota(Quota{
+		MaxActiveLinks: cfg.QuotaActiveLinks,
+		MaxLinksPerDay: cfg.QuotaDailyLinks,
+	})
+
+	opts, err := canonical.ParseRules(strings.Split(cfg.CanonicalRules, ","))
+	if err != nil {
+		logger.Log.Fatal("repository: invalid canonicalization rules", zap.Error(err))
+	}
+	if opts.IsZero() {
+		return repo
+	}
+	opts.TrackingParams = splitParams(cfg.TrackingParams)
+	return NewCanonicalRepository(repo, opts)
+}
+
+func newStorage(ctx context.Context, cfg *config.Config) Repository {
 	if cfg.DSN != "" {
 		logger.Log.Debug("repository: use posgres storage")
 		return NewPosgresRepository(ctx, cfg.DSN)
@@ -74,3 +251,13 @@ func NewRepository(ctx context.Context, cfg *config.Config) Repository {
 	logger.Log.Debug("repository: use in memory storage")
 	return NewMemoryRepository()
 }
+
+func splitParams(value string) []string {
+	var params []string
+	for _, param := range strings.Split(value, ",") {
+		if param = strings.TrimSpace(param); param != "" {
+			params = append(params, param)
+		}
+	}
+	return params
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"sort"
+
+	"github.com/aifedorov/shortener/internal/pkg/workspace"
+)
+
+// memberList returns the members of a workspace, owners first, then by the time they joined.
+func memberList(members map[string]*Member) []Member {
+	res := make([]Member, 0, len(members))
+	for _, member := range members {
+		res = append(res, *member)
+	}
+	sortMembers(res)
+	return res
+}
+
+// sortMembers orders members with owners first, then by the time they joined.
+func sortMembers(members []Member) {
+	sort.Slice(members, func(i, j int) bool {
+		if (members[i].Role == workspace.RoleOwner) != (members[j].Role == workspace.RoleOwner) {
+			return members[i].Role == workspace.RoleOwner
+		}
+		if !members[i].AddedAt.Equal(members[j].AddedAt) {
+			return members[i].AddedAt.Before(members[j].AddedAt)
+		}
+		return members[i].UserID < members[j].UserID
+	})
+}
+
+// userWorkspaces returns the workspaces the user is a member of, oldest first.
+func userWorkspaces(workspaces map[string]*Workspace, members map[string]map[string]*Member, userID string) []UserWorkspace {
+	res := make([]UserWorkspace, 0)
+	for id, ws := range workspaces {
+		if member, ok := members[id][userID]; ok {
+			res = append(res, UserWorkspace{Workspace: *ws, Role: member.Role})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+	return res
+}
+
+// checkOwnerRemains returns ErrLastOwner if giving the user the role leaves the workspace without an owner.
+// An empty role stands for removing the user from the workspace.
+func checkOwnerRemains(members []Member, userID string, role workspace.Role) error {
+	if role == workspace.RoleOwner {
+		return nil
+	}
+	for _, member := range members {
+		if member.UserID != userID && member.Role == workspace.RoleOwner {
+			return nil
+		}
+	}
+	for _, member := range members {
+		if member.UserID == userID && member.Role == workspace.RoleOwner {
+			return ErrLastOwner
+		}
+	}
+	return nil
+}
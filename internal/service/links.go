@@ -0,0 +1,284 @@
+// Package service implements the link operations shared by the versions of the HTTP API.
+// Handlers decode requests, resolve the owner and encode responses, the service validates
+// the submitted URLs and link settings and works with the repository.
+package service
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/aifedorov/shortener/internal/config"
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/pkg/querymerge"
+	"github.com/aifedorov/shortener/internal/pkg/split"
+	"github.com/aifedorov/shortener/internal/pkg/validate"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+// InvalidError reports input rejected by validation, its message explains the reason to the client.
+// URL validation errors are wrapped, so errors.As still finds a validate.URLError or validate.PolicyError.
+type InvalidError struct {
+	// Err is the reason the input was rejected.
+	Err error
+}
+
+// Error returns the message of the wrapped error.
+func (e *InvalidError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *InvalidError) Unwrap() error {
+	return e.Err
+}
+
+// Options holds the optional settings of a link requested by a client.
+type Options struct {
+	// MaxClicks limits the number of redirects of the short URL, zero means unlimited.
+	MaxClicks int
+	// Variants lists weighted destinations the visits of the short URL are split between.
+	Variants []split.Variant
+	// PassQuery forwards the query parameters of the short URL to the destination.
+	PassQuery bool
+	// UTM holds the campaign parameters appended to the destination.
+	UTM querymerge.UTM
+	// RedirectStatus overrides the server-wide redirect status code: 301, 302, 303, 307 or 308.
+	RedirectStatus int
+}
+
+// BatchItem is a URL of a batch shortening request.
+type BatchItem struct {
+	// CID is the correlation ID to match request and response items.
+	CID string
+	// URL is the original URL to be shortened.
+	URL string
+	// Options holds the optional settings of the link.
+	Options Options
+}
+
+// Link describes a shortened URL.
+type Link struct {
+	// ShortURL is the short URL of the link.
+	ShortURL string
+	// OriginalURL is the stored URL the link redirects to.
+	OriginalURL string
+	// Existing is set when the URL was shortened before and ShortURL is the existing link.
+	Existing bool
+}
+
+// BatchLink describes the outcome of a batch item.
+type BatchLink struct {
+	// CID is the correlation ID of the batch item.
+	CID string
+	// Link is the created or existing link, it is empty if the item is invalid.
+	Link
+	// Err is the InvalidError the item was rejected with, nil if the item was stored or found.
+	Err error
+}
+
+// Links shortens, lists and deletes the links of an owner, a user or a workspace.
+type Links struct {
+	// repo is the repository interface for data persistence.
+	repo repository.Repository
+	// urlChecker validates URLs before they are stored.
+	urlChecker validate.URLChecker
+	// baseURL is the base URL of the short URLs.
+	baseURL string
+	// maxBatchSize is the maximum number of URLs in a batch, zero means unlimited.
+	maxBatchSize int
+}
+
+// NewLinks creates the link service storing links in the repository.
+func NewLinks(cfg *config.Config, repo repository.Repository, urlChecker validate.URLChecker) *Links {
+	return &Links{
+		repo:         repo,
+		urlChecker:   urlChecker,
+		baseURL:      cfg.BaseURL,
+		maxBatchSize: cfg.QuotaBatchSize,
+	}
+}
+
+// Shorten validates the URL and the options and stores the link for the owner.
+// A URL the owner shortened before is not stored again, its existing link is returned.
+// It returns an InvalidError for rejected input and a repository.QuotaError if the owner would exceed a quota.
+func (s *Links) Shorten(ownerID, rawURL string, opts Options) (Link, error) {
+	originalURL, err := s.resolveURL(rawURL)
+	if err != nil {
+		return Link{}, &InvalidError{Err: err}
+	}
+	linkOpts, err := s.linkOptions(opts)
+	if err != nil {
+		return Link{}, &InvalidError{Err: err}
+	}
+
+	logger.Log.Debug("service: storing url", zap.String("owner_id", ownerID), zap.String("original_url", originalURL))
+	shortURL, err := s.repo.Store(ownerID, s.baseURL, originalURL, linkOpts)
+	var cErr *repository.ConflictError
+	if errors.As(err, &cErr) {
+		return Link{ShortURL: cErr.ShortURL, OriginalURL: originalURL, Existing: true}, nil
+	}
+	if err != nil {
+		return Link{}, err
+	}
+	return Link{ShortURL: shortURL, OriginalURL: originalURL}, nil
+}
+
+// CheckBatchSize returns a repository.QuotaError if a batch of the size holds more URLs than allowed.
+func (s *Links) CheckBatchSize(size int) error {
+	if s.maxBatchSize > 0 && size > s.maxBatchSize {
+		return &repository.QuotaError{Quota: repository.QuotaBatchSize, Limit: s.maxBatchSize, Requested: size}
+	}
+	return nil
+}
+
+// ShortenBatch validates the URLs and the options of the batch items and stores the valid ones for the owner.
+// It returns the outcome of every item in the order of the batch: invalid items carry an InvalidError,
+// URLs the owner shortened before are returned as existing links.
+// It stores none of them and returns a repository.QuotaError if the owner would exceed a quota.
+func (s *Links) ShortenBatch(ownerID string, items []BatchItem) ([]BatchLink, error) {
+	logger.Log.Debug("service: validating batch", zap.Int("count", len(items)))
+	links := make([]BatchLink, len(items))
+	urls := make([]repository.BatchURLInput, 0, len(items))
+	// indexes maps the stored URLs to their items.
+	indexes := make([]int, 0, len(items))
+	for i, item := range items {
+		links[i].CID = item.CID
+		input, err := s.validateItem(item)
+		if err != nil {
+			links[i].Err = err
+			continue
+		}
+		urls = append(urls, input)
+		indexes = append(indexes, i)
+	}
+	if len(urls) == 0 {
+		return links, nil
+	}
+
+	stored, err := s.repo.StoreBatch(ownerID, s.baseURL, urls)
+	if err != nil {
+		return nil, err
+	}
+	for j, out := range stored {
+		links[indexes[j]].Link = Link{
+			ShortURL:    out.ShortURL,
+			OriginalURL: urls[j].OriginalURL,
+			Existing:    out.Existing,
+		}
+	}
+	return links, nil
+}
+
+// validateItem validates the URL and the options of a batch item and returns the link to store.
+func (s *Links) validateItem(item BatchItem) (repository.BatchURLInput, error) {
+	originalURL, err := s.resolveURL(item.URL)
+	if err != nil {
+		logger.Log.Info("service: invalid url", zap.String("url", item.URL), zap.Error(err))
+		return repository.BatchURLInput{}, &InvalidError{Err: fmt.Errorf("invalid url: %w", err)}
+	}
+	opts, err := s.linkOptions(item.Options)
+	if err != nil {
+		logger.Log.Info("service: invalid link options", zap.String("url", item.URL), zap.Error(err))
+		return repository.BatchURLInput{}, &InvalidError{Err: err}
+	}
+	return repository.BatchURLInput{
+		CID:         item.CID,
+		OriginalURL: originalURL,
+		Options:     opts,
+	}, nil
+}
+
+// List returns the links of the owner, brokenOnly limits them to the links whose latest dead-link check failed.
+// It returns repository.ErrUserHasNoData if the owner has no links.
+func (s *Links) List(ownerID string, brokenOnly bool) ([]repository.URLOutput, error) {
+	logger.Log.Debug("service: fetching urls", zap.String("owner_id", ownerID))
+	urls, err := s.repo.GetAll(ownerID, s.baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if !brokenOnly {
+		return urls, nil
+	}
+
+	broken := make([]repository.URLOutput, 0, len(urls))
+	for _, u := range urls {
+		if u.IsBroken() {
+			broken = append(broken, u)
+		}
+	}
+	return broken, nil
+}
+
+// Delete marks the links of the owner as deleted in the background, failures are logged.
+// A panic of the repository is recovered and logged as well, so it cannot take the server down.
+func (s *Links) Delete(ownerID string, aliases []string) {
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				logger.Log.Error("service: panic while deleting urls",
+					zap.String("owner_id", ownerID),
+					zap.Any("panic", rec),
+					zap.ByteString("stack", debug.Stack()),
+				)
+			}
+		}()
+		if err := s.repo.DeleteBatch(ownerID, aliases); err != nil {
+			logger.Log.Error("service: failed to delete urls", zap.String("owner_id", ownerID), zap.Error(err))
+		}
+	}()
+}
+
+// Alias returns the alias of a short URL of the service.
+func (s *Links) Alias(shortURL string) string {
+	return strings.TrimPrefix(shortURL, s.baseURL+"/")
+}
+
+// resolveURL validates the URL and returns the URL to store.
+// Checkers implementing validate.URLResolver may replace a shortener link with its final destination.
+func (s *Links) resolveURL(rawURL string) (string, error) {
+	if resolver, ok := s.urlChecker.(validate.URLResolver); ok {
+		return resolver.ResolveURL(rawURL)
+	}
+	return rawURL, s.urlChecker.CheckURL(rawURL)
+}
+
+// linkOptions validates the options and returns the settings to store, variant URLs are resolved like the URL.
+func (s *Links) linkOptions(opts Options) (repository.LinkOptions, error) {
+	if opts.MaxClicks < 0 {
+		return repository.LinkOptions{}, errors.New("max_clicks must not be negative")
+	}
+	if opts.RedirectStatus != 0 && !config.IsRedirectStatus(opts.RedirectStatus) {
+		return repository.LinkOptions{}, errors.New("unsupported redirect_status")
+	}
+
+	var variants []split.Variant
+	if len(opts.Variants) > 0 {
+		if err := split.Validate(opts.Variants); err != nil {
+			return repository.LinkOptions{}, err
+		}
+		variants = make([]split.Variant, len(opts.Variants))
+		for i, variant := range opts.Variants {
+			variantURL, err := s.resolveURL(variant.URL)
+			if err != nil {
+				logger.Log.Info("service: invalid variant url", zap.String("url", variant.URL), zap.Error(err))
+				return repository.LinkOptions{}, fmt.Errorf("invalid variant url: %w", err)
+			}
+			variants[i] = split.Variant{
+				URL:    variantURL,
+				Weight: variant.Weight,
+			}
+		}
+	}
+
+	return repository.LinkOptions{
+		MaxClicks:      opts.MaxClicks,
+		Variants:       variants,
+		PassQuery:      opts.PassQuery,
+		UTM:            opts.UTM,
+		RedirectStatus: opts.RedirectStatus,
+	}, nil
+}
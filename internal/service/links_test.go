@@ -0,0 +1,358 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/aifedorov/shortener/internal/config"
+	"github.com/aifedorov/shortener/internal/http/middleware/logger"
+	"github.com/aifedorov/shortener/internal/mocks"
+	"github.com/aifedorov/shortener/internal/pkg/split"
+	"github.com/aifedorov/shortener/internal/pkg/validate"
+	"github.com/aifedorov/shortener/internal/repository"
+)
+
+const testBaseURL = "http://localhost:8080"
+
+func newTestLinks(t *testing.T, maxBatchSize int) (*Links, *mocks.MockRepository, *mocks.MockURLChecker) {
+	t.Helper()
+
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockRepository(ctrl)
+	checker := mocks.NewMockURLChecker(ctrl)
+	cfg := &config.Config{BaseURL: testBaseURL, QuotaBatchSize: maxBatchSize}
+	return NewLinks(cfg, repo, checker), repo, checker
+}
+
+func TestLinks_Shorten(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		opts          Options
+		checkErr      error
+		expectStore   bool
+		storeURL      string
+		storeErr      error
+		expected      Link
+		expectInvalid bool
+		expectedErr   error
+	}{
+		{
+			name:        "created",
+			url:         "https://example.com",
+			expectStore: true,
+			storeURL:    testBaseURL + "/abc",
+			expected:    Link{ShortURL: testBaseURL + "/abc", OriginalURL: "https://example.com"},
+		},
+		{
+			name:        "existing",
+			url:         "https://example.com",
+			expectStore: true,
+			storeErr:    repository.NewConflictError(testBaseURL+"/old", repository.ErrURLExists),
+			expected:    Link{ShortURL: testBaseURL + "/old", OriginalURL: "https://example.com", Existing: true},
+		},
+		{
+			name:          "invalid url",
+			url:           "not a url",
+			checkErr:      &validate.URLError{Err: validate.ErrMalformedURL},
+			expectInvalid: true,
+		},
+		{
+			name:          "negative max clicks",
+			url:           "https://example.com",
+			opts:          Options{MaxClicks: -1},
+			expectInvalid: true,
+		},
+		{
+			name:          "unsupported redirect status",
+			url:           "https://example.com",
+			opts:          Options{RedirectStatus: 200},
+			expectInvalid: true,
+		},
+		{
+			name:        "quota exceeded",
+			url:         "https://example.com",
+			expectStore: true,
+			storeErr:    &repository.QuotaError{Quota: repository.QuotaActiveLinks, Limit: 1, Used: 1, Requested: 1},
+			expectedErr: &repository.QuotaError{Quota: repository.QuotaActiveLinks, Limit: 1, Used: 1, Requested: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links, repo, checker := newTestLinks(t, 0)
+			checker.EXPECT().CheckURL(tt.url).Return(tt.checkErr)
+			if tt.expectStore {
+				repo.EXPECT().Store("user1", testBaseURL, tt.url, gomock.Any()).Return(tt.storeURL, tt.storeErr)
+			}
+
+			link, err := links.Shorten("user1", tt.url, tt.opts)
+
+			switch {
+			case tt.expectInvalid:
+				var invalidErr *InvalidError
+				assert.ErrorAs(t, err, &invalidErr)
+			case tt.expectedErr != nil:
+				assert.Equal(t, tt.expectedErr, err)
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, link)
+			}
+		})
+	}
+}
+
+func TestLinks_CheckBatchSize(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxBatchSize int
+		size         int
+		expectErr    bool
+	}{
+		{name: "unlimited", maxBatchSize: 0, size: 1000},
+		{name: "within limit", maxBatchSize: 2, size: 2},
+		{name: "over limit", maxBatchSize: 2, size: 3, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links, _, _ := newTestLinks(t, tt.maxBatchSize)
+
+			err := links.CheckBatchSize(tt.size)
+
+			if !tt.expectErr {
+				assert.NoError(t, err)
+				return
+			}
+			var qErr *repository.QuotaError
+			require.ErrorAs(t, err, &qErr)
+			assert.Equal(t, repository.QuotaBatchSize, qErr.Quota)
+			assert.Equal(t, tt.size, qErr.Requested)
+		})
+	}
+}
+
+func TestLinks_ShortenBatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		items       []BatchItem
+		checkErrs   map[string]error
+		stored      []repository.BatchURLInput
+		storeResult []repository.BatchURLOutput
+		storeErr    error
+		expected    []BatchLink
+		invalid     []bool
+		expectErr   bool
+	}{
+		{
+			name: "created and existing",
+			items: []BatchItem{
+				{CID: "1", URL: "https://example.com"},
+				{CID: "2", URL: "https://google.com", Options: Options{MaxClicks: 5}},
+			},
+			stored: []repository.BatchURLInput{
+				{CID: "1", OriginalURL: "https://example.com"},
+				{CID: "2", OriginalURL: "https://google.com", Options: repository.LinkOptions{MaxClicks: 5}},
+			},
+			storeResult: []repository.BatchURLOutput{
+				{CID: "1", ShortURL: testBaseURL + "/aaa"},
+				{CID: "2", ShortURL: testBaseURL + "/bbb", Existing: true},
+			},
+			expected: []BatchLink{
+				{CID: "1", Link: Link{ShortURL: testBaseURL + "/aaa", OriginalURL: "https://example.com"}},
+				{CID: "2", Link: Link{ShortURL: testBaseURL + "/bbb", OriginalURL: "https://google.com", Existing: true}},
+			},
+			invalid: []bool{false, false},
+		},
+		{
+			name: "invalid items are skipped",
+			items: []BatchItem{
+				{CID: "1", URL: "invalid-url"},
+				{CID: "2", URL: "https://google.com"},
+				{CID: "3", URL: "https://example.com", Options: Options{MaxClicks: -1}},
+			},
+			checkErrs: map[string]error{"invalid-url": errors.New("invalid URL")},
+			stored: []repository.BatchURLInput{
+				{CID: "2", OriginalURL: "https://google.com"},
+			},
+			storeResult: []repository.BatchURLOutput{
+				{CID: "2", ShortURL: testBaseURL + "/bbb"},
+			},
+			expected: []BatchLink{
+				{CID: "1"},
+				{CID: "2", Link: Link{ShortURL: testBaseURL + "/bbb", OriginalURL: "https://google.com"}},
+				{CID: "3"},
+			},
+			invalid: []bool{true, false, true},
+		},
+		{
+			name: "all items invalid",
+			items: []BatchItem{
+				{CID: "1", URL: "invalid-url"},
+			},
+			checkErrs: map[string]error{"invalid-url": errors.New("invalid URL")},
+			expected:  []BatchLink{{CID: "1"}},
+			invalid:   []bool{true},
+		},
+		{
+			name:     "empty batch",
+			items:    []BatchItem{},
+			expected: []BatchLink{},
+		},
+		{
+			name: "quota exceeded",
+			items: []BatchItem{
+				{CID: "1", URL: "https://example.com"},
+			},
+			stored: []repository.BatchURLInput{
+				{CID: "1", OriginalURL: "https://example.com"},
+			},
+			storeErr:  &repository.QuotaError{Quota: repository.QuotaActiveLinks, Limit: 1, Used: 1, Requested: 1},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links, repo, checker := newTestLinks(t, 0)
+			for _, item := range tt.items {
+				checker.EXPECT().CheckURL(item.URL).Return(tt.checkErrs[item.URL])
+			}
+			if tt.stored != nil {
+				repo.EXPECT().StoreBatch("user1", testBaseURL, tt.stored).Return(tt.storeResult, tt.storeErr)
+			}
+
+			res, err := links.ShortenBatch("user1", tt.items)
+
+			if tt.expectErr {
+				var qErr *repository.QuotaError
+				assert.ErrorAs(t, err, &qErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, res, len(tt.expected))
+			for i, link := range res {
+				if tt.invalid[i] {
+					var invalidErr *InvalidError
+					assert.ErrorAs(t, link.Err, &invalidErr)
+				} else {
+					assert.NoError(t, link.Err)
+				}
+				link.Err = nil
+				assert.Equal(t, tt.expected[i], link)
+			}
+		})
+	}
+}
+
+func TestLinks_ShortenBatch_Variants(t *testing.T) {
+	links, _, checker := newTestLinks(t, 0)
+	checker.EXPECT().CheckURL("https://example.com").Return(nil)
+	checker.EXPECT().CheckURL("https://a.example.com").Return(nil)
+	checker.EXPECT().CheckURL("ftp://b.example.com").Return(errors.New("unsupported scheme"))
+
+	res, err := links.ShortenBatch("user1", []BatchItem{{
+		CID: "1",
+		URL: "https://example.com",
+		Options: Options{Variants: []split.Variant{
+			{URL: "https://a.example.com", Weight: 50},
+			{URL: "ftp://b.example.com", Weight: 50},
+		}},
+	}})
+
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	var invalidErr *InvalidError
+	require.ErrorAs(t, res[0].Err, &invalidErr)
+	assert.Contains(t, res[0].Err.Error(), "invalid variant url")
+}
+
+func TestLinks_List(t *testing.T) {
+	checkedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	urls := []repository.URLOutput{
+		{ShortURL: testBaseURL + "/aaa", OriginalURL: "https://example.com", LastStatus: 200, CheckedAt: &checkedAt},
+		{ShortURL: testBaseURL + "/bbb", OriginalURL: "https://gone.example.com", LastStatus: 404, CheckedAt: &checkedAt},
+	}
+
+	tests := []struct {
+		name       string
+		brokenOnly bool
+		getErr     error
+		expected   []repository.URLOutput
+		expectErr  error
+	}{
+		{name: "all", expected: urls},
+		{name: "broken only", brokenOnly: true, expected: urls[1:]},
+		{name: "no data", getErr: repository.ErrUserHasNoData, expectErr: repository.ErrUserHasNoData},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links, repo, _ := newTestLinks(t, 0)
+			if tt.getErr != nil {
+				repo.EXPECT().GetAll("user1", testBaseURL).Return(nil, tt.getErr)
+			} else {
+				repo.EXPECT().GetAll("user1", testBaseURL).Return(urls, nil)
+			}
+
+			res, err := links.List("user1", tt.brokenOnly)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, res)
+		})
+	}
+}
+
+func TestLinks_Delete(t *testing.T) {
+	core, logs := observer.New(zap.ErrorLevel)
+	prev := logger.Log
+	logger.Log = zap.New(core)
+	t.Cleanup(func() { logger.Log = prev })
+
+	tests := []struct {
+		name        string
+		deleteBatch func(string, []string) error
+		expectedLog string
+	}{
+		{
+			name:        "repository error is logged",
+			deleteBatch: func(string, []string) error { return errors.New("database error") },
+			expectedLog: "service: failed to delete urls",
+		},
+		{
+			name:        "repository panic is recovered",
+			deleteBatch: func(string, []string) error { panic("boom") },
+			expectedLog: "service: panic while deleting urls",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links, repo, _ := newTestLinks(t, 0)
+			repo.EXPECT().DeleteBatch("user1", []string{"abc"}).DoAndReturn(tt.deleteBatch)
+
+			links.Delete("user1", []string{"abc"})
+
+			assert.Eventually(t, func() bool {
+				return logs.FilterMessage(tt.expectedLog).Len() == 1
+			}, time.Second, 10*time.Millisecond)
+		})
+	}
+}
+
+func TestLinks_Alias(t *testing.T) {
+	links, _, _ := newTestLinks(t, 0)
+
+	assert.Equal(t, "abc123", links.Alias(testBaseURL+"/abc123"))
+}